@@ -0,0 +1,39 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Máscara de CPUs de sched_setaffinity, para hasta 1024 CPUs
+type cpuMask [1024 / 64]uint64
+
+// Función que retorna las CPUs en las que el proceso puede ejecutarse
+func allowedCPUs() ([]int, error) {
+	var mask cpuMask
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return nil, errno
+	}
+	var cpus []int
+	for cpu := 0; cpu < len(mask)*64; cpu++ {
+		if mask[cpu/64]&(1<<(cpu%64)) != 0 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// Función que fija el hilo actual a una CPU. Se llama después de
+// runtime.LockOSThread, para que la goroutine siga en ese hilo.
+func pinThread(cpu int) error {
+	var mask cpuMask
+	mask[cpu/64] |= 1 << (cpu % 64)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Fuera de Linux la biblioteca estándar no permite fijar hilos a una CPU
+var errNoAffinity = errors.New("la afinidad de CPU solo está disponible en Linux")
+
+// Función que retorna las CPUs en las que el proceso puede ejecutarse
+func allowedCPUs() ([]int, error) {
+	return nil, errNoAffinity
+}
+
+// Función que fija el hilo actual a una CPU
+func pinThread(int) error {
+	return errNoAffinity
+}
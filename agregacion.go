@@ -0,0 +1,185 @@
+package main
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Motor de agregación por grupos al estilo map-reduce: las filas se reparten en
+// tramos, cada goroutine agrega su tramo en un mapa parcial y al final los mapas
+// parciales se combinan. Reemplaza los recorridos escritos a mano para sumar o
+// promediar por establecimiento, mes o fecha.
+//
+//	byName := func(att Atencion) string { return att.NombreEstablecimiento }
+//	stats := GroupBy(data, byName).Aggregate(Avg(atendidosValue), P95(atendidosValue), Count())
+//	stats["SANTA MARTHA"][1] // Percentil 95 de atendidos
+
+// Filas mínimas por tramo: con menos datos no vale la pena repartir
+const minShardSize = 4096
+
+// Función que divide n filas en tramos [inicio, fin) para procesarlos en paralelo
+func shardRanges(n int) [][2]int {
+	workers := runtime.GOMAXPROCS(0)
+	size := max((n+workers-1)/workers, minShardSize)
+	var ranges [][2]int
+	for start := 0; start < n; start += size {
+		ranges = append(ranges, [2]int{start, min(start+size, n)})
+	}
+	return ranges
+}
+
+// Tipo de agregación
+type aggKind int
+
+const (
+	aggSum aggKind = iota
+	aggAvg
+	aggCount
+	aggPercentile
+)
+
+// Agregación sobre un valor de cada fila
+type Aggregation struct {
+	kind       aggKind
+	value      func(Atencion) float64 // Valor agregado (nil en Count)
+	percentile float64                // Percentil pedido (0-1) en aggPercentile
+}
+
+// Suma del valor
+func Sum(value func(Atencion) float64) Aggregation {
+	return Aggregation{kind: aggSum, value: value}
+}
+
+// Promedio del valor
+func Avg(value func(Atencion) float64) Aggregation {
+	return Aggregation{kind: aggAvg, value: value}
+}
+
+// Número de filas del grupo
+func Count() Aggregation {
+	return Aggregation{kind: aggCount}
+}
+
+// Percentil p (0-1) del valor, por rango más cercano
+func Percentile(value func(Atencion) float64, p float64) Aggregation {
+	return Aggregation{kind: aggPercentile, value: value, percentile: p}
+}
+
+// Percentil 95 del valor
+func P95(value func(Atencion) float64) Aggregation {
+	return Percentile(value, 0.95)
+}
+
+// Valores de uso frecuente
+func atendidosValue(att Atencion) float64  { return float64(att.Atendidos) }
+func atencionesValue(att Atencion) float64 { return float64(att.Atenciones) }
+func citasValue(att Atencion) float64      { return float64(att.Citas) }
+
+// Agrupación pendiente de agregar
+type Grouping[K comparable] struct {
+	data []Atencion
+	key  func(Atencion) K
+}
+
+// Función que agrupa las filas según la clave que retorna key
+func GroupBy[K comparable](data []Atencion, key func(Atencion) K) *Grouping[K] {
+	return &Grouping[K]{data: data, key: key}
+}
+
+// Estado parcial de un grupo: suma y valores de cada agregación
+type groupState struct {
+	count  int
+	sums   []float64
+	values [][]float64 // Solo para los percentiles
+}
+
+// Función que calcula las agregaciones de cada grupo. El resultado de cada
+// grupo tiene un valor por agregación, en el mismo orden en que se pidieron.
+func (g *Grouping[K]) Aggregate(aggs ...Aggregation) map[K][]float64 {
+	ranges := shardRanges(len(g.data))
+	partials := make([]map[K]*groupState, len(ranges))
+
+	// Map: cada tramo se agrega en su propio mapa, sin compartir nada
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			partial := make(map[K]*groupState)
+			for _, att := range g.data[r[0]:r[1]] {
+				key := g.key(att)
+				state, ok := partial[key]
+				if !ok {
+					state = newGroupState(aggs)
+					partial[key] = state
+				}
+				state.add(aggs, att)
+			}
+			partials[i] = partial
+		}()
+	}
+	wg.Wait()
+
+	// Reduce: combinar los mapas parciales y calcular el resultado final
+	merged := make(map[K]*groupState)
+	for _, partial := range partials {
+		for key, state := range partial {
+			if current, ok := merged[key]; ok {
+				current.merge(state)
+			} else {
+				merged[key] = state
+			}
+		}
+	}
+	result := make(map[K][]float64, len(merged))
+	for key, state := range merged {
+		result[key] = state.finish(aggs)
+	}
+	return result
+}
+
+func newGroupState(aggs []Aggregation) *groupState {
+	return &groupState{sums: make([]float64, len(aggs)), values: make([][]float64, len(aggs))}
+}
+
+// Función que suma una fila al estado del grupo
+func (s *groupState) add(aggs []Aggregation, att Atencion) {
+	s.count++
+	for i, agg := range aggs {
+		switch agg.kind {
+		case aggSum, aggAvg:
+			s.sums[i] += agg.value(att)
+		case aggPercentile:
+			s.values[i] = append(s.values[i], agg.value(att))
+		}
+	}
+}
+
+// Función que combina el estado parcial de otro tramo
+func (s *groupState) merge(other *groupState) {
+	s.count += other.count
+	for i := range s.sums {
+		s.sums[i] += other.sums[i]
+		s.values[i] = append(s.values[i], other.values[i]...)
+	}
+}
+
+// Función que convierte el estado en el valor final de cada agregación
+func (s *groupState) finish(aggs []Aggregation) []float64 {
+	out := make([]float64, len(aggs))
+	for i, agg := range aggs {
+		switch agg.kind {
+		case aggSum:
+			out[i] = s.sums[i]
+		case aggAvg:
+			out[i] = s.sums[i] / float64(s.count)
+		case aggCount:
+			out[i] = float64(s.count)
+		case aggPercentile:
+			sort.Float64s(s.values[i])
+			out[i] = percentile(s.values[i], agg.percentile)
+		}
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Agregación por establecimiento durante la carga (train -agregacion), con dos
+// arquitecturas para comparar. En "mutex" las goroutines de validación
+// actualizan un mapa compartido protegido por un mutex. En "actores" cada
+// establecimiento pertenece a una goroutine agregadora: el nombre se reparte
+// por hash entre las particiones, cada validador envía las filas de un bloque
+// a la partición que corresponde por su canal, y cada agregador actualiza su
+// propio mapa sin locks porque nadie más lo toca. Los resúmenes son sumas
+// enteras, así que ambas dan exactamente el mismo resultado aunque las filas
+// lleguen en otro orden.
+
+// Registros que cada agregador puede tener pendientes antes de frenar a los validadores
+const actorBuffer = 64
+
+// Resumen de los registros de un establecimiento
+type establishmentTally struct {
+	Records     int
+	Attended    int64 // Suma de atendidos
+	AttendedSq  int64 // Suma de sus cuadrados, para la desviación
+	MaxAttended int
+	First, Last recordDate
+}
+
+// Función que suma un registro al resumen
+func (s *establishmentTally) add(att Atencion) {
+	date := recordDate{att.Anio, att.Mes, att.Dia}
+	if s.Records == 0 || date.before(s.First) {
+		s.First = date
+	}
+	if s.Records == 0 || s.Last.before(date) {
+		s.Last = date
+	}
+	s.Records++
+	s.Attended += int64(att.Atendidos)
+	s.AttendedSq += int64(att.Atendidos) * int64(att.Atendidos)
+	s.MaxAttended = max(s.MaxAttended, att.Atendidos)
+}
+
+// Promedio y desviación estándar de los atendidos
+func (s *establishmentTally) meanStdDev() (float64, float64) {
+	n := float64(s.Records)
+	mean := float64(s.Attended) / n
+	return mean, math.Sqrt(max(0, float64(s.AttendedSq)/n-mean*mean))
+}
+
+// Agregador por establecimiento alimentado por las goroutines de validación
+type establishmentAggregator interface {
+	add(records []Atencion)                // Se llama desde varias goroutines a la vez
+	close() map[string]*establishmentTally // Después de la última llamada a add
+	describe() string                      // Arquitectura, para el informe
+}
+
+// Función que crea el agregador de la arquitectura indicada (vacío = ninguno)
+func newEstablishmentAggregator(mode string) (establishmentAggregator, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "mutex":
+		return &mutexAggregator{summaries: make(map[string]*establishmentTally)}, nil
+	case "actores":
+		return newActorAggregator(runtime.GOMAXPROCS(0)), nil
+	}
+	return nil, fmt.Errorf("agregación desconocida %q (mutex o actores)", mode)
+}
+
+// Agregador con un mapa compartido y un mutex
+type mutexAggregator struct {
+	mu        sync.Mutex
+	summaries map[string]*establishmentTally
+}
+
+func (a *mutexAggregator) add(records []Atencion) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, att := range records {
+		s, ok := a.summaries[att.NombreEstablecimiento]
+		if !ok {
+			s = &establishmentTally{}
+			a.summaries[att.NombreEstablecimiento] = s
+		}
+		s.add(att)
+	}
+}
+
+func (a *mutexAggregator) close() map[string]*establishmentTally {
+	return a.summaries
+}
+
+func (a *mutexAggregator) describe() string {
+	return "mapa compartido con mutex"
+}
+
+// Agregador con una goroutine dueña de cada partición de establecimientos
+type actorAggregator struct {
+	inboxes []chan []Atencion                // Canal de cada agregador
+	owned   []map[string]*establishmentTally // Mapa de cada agregador; solo lo toca su goroutine
+	wg      sync.WaitGroup
+}
+
+// Función que arranca partitions goroutines agregadoras
+func newActorAggregator(partitions int) *actorAggregator {
+	a := &actorAggregator{inboxes: make([]chan []Atencion, partitions), owned: make([]map[string]*establishmentTally, partitions)}
+	for p := range partitions {
+		a.inboxes[p] = make(chan []Atencion, actorBuffer)
+		a.owned[p] = make(map[string]*establishmentTally)
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			summaries := a.owned[p]
+			for records := range a.inboxes[p] {
+				for _, att := range records {
+					s, ok := summaries[att.NombreEstablecimiento]
+					if !ok {
+						s = &establishmentTally{}
+						summaries[att.NombreEstablecimiento] = s
+					}
+					s.add(att)
+				}
+			}
+		}()
+	}
+	return a
+}
+
+// Función que retorna la partición dueña de un establecimiento
+func (a *actorAggregator) partition(establishment string) int {
+	h := fnv.New32a()
+	h.Write([]byte(establishment))
+	return int(h.Sum32() % uint32(len(a.inboxes)))
+}
+
+// Función que reparte las filas de un bloque entre los agregadores, con un
+// solo envío por partición
+func (a *actorAggregator) add(records []Atencion) {
+	routed := make([][]Atencion, len(a.inboxes))
+	last, lastPartition := "", 0 // Las filas de un establecimiento suelen venir seguidas
+	for _, att := range records {
+		if att.NombreEstablecimiento != last {
+			last, lastPartition = att.NombreEstablecimiento, a.partition(att.NombreEstablecimiento)
+		}
+		routed[lastPartition] = append(routed[lastPartition], att)
+	}
+	for p, batch := range routed {
+		if len(batch) > 0 {
+			a.inboxes[p] <- batch
+		}
+	}
+}
+
+// Función que cierra los canales, espera a los agregadores y une sus mapas,
+// que no comparten establecimientos
+func (a *actorAggregator) close() map[string]*establishmentTally {
+	for _, inbox := range a.inboxes {
+		close(inbox)
+	}
+	a.wg.Wait()
+	summaries := make(map[string]*establishmentTally)
+	for _, owned := range a.owned {
+		for name, s := range owned {
+			summaries[name] = s
+		}
+	}
+	return summaries
+}
+
+func (a *actorAggregator) describe() string {
+	return fmt.Sprintf("%d agregadores con particiones por hash", len(a.inboxes))
+}
+
+// Función que escribe el resumen de la agregación: los establecimientos con más
+// atendidos promedio y el tiempo que tomó esperar a los agregadores
+func writeEstablishmentTallies(w io.Writer, summaries map[string]*establishmentTally, describe string, closing time.Duration, top int) {
+	names := sortedKeys(summaries)
+	slices.SortStableFunc(names, func(a, b string) int {
+		return cmp.Compare(summaries[b].Attended*int64(summaries[a].Records), summaries[a].Attended*int64(summaries[b].Records))
+	})
+	fmt.Fprintf(w, "Agregación por establecimiento (%s): %d establecimientos, cierre en %v\n", describe, len(summaries), closing)
+	fmt.Fprintf(w, "  %-40s %8s %9s %9s %7s %10s %10s\n", "ESTABLECIMIENTO", "FILAS", "PROMEDIO", "DESVÍO", "MÁXIMO", "DESDE", "HASTA")
+	for _, name := range names[:min(top, len(names))] {
+		s := summaries[name]
+		mean, stdDev := s.meanStdDev()
+		fmt.Fprintf(w, "  %-40s %8d %9.2f %9.2f %7d %10s %10s\n", name, s.Records, mean, stdDev, s.MaxAttended, s.First, s.Last)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Agrupamiento de establecimientos por perfil de demanda: el perfil es el
+// promedio de atendidos de cada mes y k-means (con inicialización k-means++)
+// reúne los que tienen un volumen y una estacionalidad parecidos. El grupo se
+// conoce al predecir, porque depende solo del establecimiento, así que puede
+// usarse como característica ("Grupo") además de en el reporte.
+
+// Grupos que se forman cuando el modelo usa la característica Grupo
+const defaultDemandClusters = 4
+
+// Iteraciones máximas de k-means
+const clusterIterations = 100
+
+// Grupos de demanda guardados en el pipeline
+type DemandClusters struct {
+	Centroids   [][12]float64  // Perfil promedio de cada grupo, de menor a mayor demanda
+	Assignments map[string]int // Nombre del establecimiento -> grupo (desde 1)
+}
+
+// Función que arma el perfil de cada establecimiento: el promedio de atendidos
+// de cada mes, o el de todo el año en los meses sin datos, tomados de las
+// estadísticas compartidas
+func demandProfiles(data []Atencion) (names []string, profiles [][12]float64) {
+	stats := statisticsFor(data)
+	names = sortedKeys(stats.Establishments)
+	profiles = make([][12]float64, len(names))
+	for i, name := range names {
+		e := stats.Establishments[name]
+		for m, avg := range e.Monthly {
+			if avg.Count > 0 {
+				profiles[i][m] = avg.Atendidos
+			} else {
+				profiles[i][m] = e.Average.Atendidos
+			}
+		}
+	}
+	return names, profiles
+}
+
+// Función que agrupa los establecimientos en k grupos. Si hay menos
+// establecimientos que grupos, cada uno queda en el suyo.
+func ClusterEstablishments(data []Atencion, k int, seed int64) *DemandClusters {
+	names, profiles := demandProfiles(data)
+	k = min(k, len(profiles))
+	c := &DemandClusters{Assignments: make(map[string]int, len(names))}
+	if k == 0 {
+		return c
+	}
+
+	// k-means++: cada centroide nuevo se elige con probabilidad proporcional a
+	// la distancia al cuadrado al más cercano de los ya elegidos
+	r := rand.New(rand.NewSource(seed))
+	c.Centroids = append(c.Centroids, profiles[r.Intn(len(profiles))])
+	for len(c.Centroids) < k {
+		weights := make([]float64, len(profiles))
+		total := 0.0
+		for i, p := range profiles {
+			_, weights[i] = c.nearest(p)
+			total += weights[i]
+		}
+		if total == 0 {
+			break // Quedan solo perfiles repetidos
+		}
+		target := r.Float64() * total
+		chosen := len(profiles) - 1
+		for i, w := range weights {
+			if target -= w; target < 0 {
+				chosen = i
+				break
+			}
+		}
+		c.Centroids = append(c.Centroids, profiles[chosen])
+	}
+
+	assignments := make([]int, len(profiles))
+	for iteration := 0; iteration < clusterIterations; iteration++ {
+		if !c.assign(profiles, assignments) && iteration > 0 {
+			break
+		}
+		// Cada centroide pasa a ser el promedio de sus perfiles; uno vacío queda donde estaba
+		sums := make([][12]float64, len(c.Centroids))
+		counts := make([]int, len(c.Centroids))
+		for i, p := range profiles {
+			g := assignments[i]
+			counts[g]++
+			for m := range p {
+				sums[g][m] += p[m]
+			}
+		}
+		for g := range c.Centroids {
+			if counts[g] == 0 {
+				continue
+			}
+			for m := range sums[g] {
+				c.Centroids[g][m] = sums[g][m] / float64(counts[g])
+			}
+		}
+	}
+	// Los grupos se numeran de menor a mayor demanda, para que los árboles
+	// puedan separar los de mucha demanda con un umbral
+	order := make([]int, len(c.Centroids))
+	for g := range order {
+		order[g] = g
+	}
+	sort.SliceStable(order, func(i, j int) bool { return meanDemand(c.Centroids[order[i]]) < meanDemand(c.Centroids[order[j]]) })
+	rank := make([]int, len(order))
+	centroids := make([][12]float64, len(order))
+	for r, g := range order {
+		rank[g], centroids[r] = r, c.Centroids[g]
+	}
+	c.Centroids = centroids
+	for i, name := range names {
+		c.Assignments[name] = rank[assignments[i]] + 1
+	}
+	return c
+}
+
+// Función que retorna los atendidos por día promedio de un perfil
+func meanDemand(profile [12]float64) float64 {
+	sum := 0.0
+	for _, v := range profile {
+		sum += v
+	}
+	return sum / 12
+}
+
+// Función que asigna cada perfil a su centroide más cercano. Las distancias se
+// calculan en paralelo, repartiendo los perfiles entre los procesadores.
+// Retorna si cambió alguna asignación.
+func (c *DemandClusters) assign(profiles [][12]float64, assignments []int) bool {
+	workers := min(runtime.GOMAXPROCS(0), len(profiles))
+	changed := make([]bool, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < len(profiles); i += workers {
+				if g, _ := c.nearest(profiles[i]); g != assignments[i] {
+					assignments[i], changed[w] = g, true
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, ch := range changed {
+		if ch {
+			return true
+		}
+	}
+	return false
+}
+
+// Función que retorna el centroide más cercano a un perfil y la distancia
+// euclídea al cuadrado
+func (c *DemandClusters) nearest(profile [12]float64) (group int, distance float64) {
+	distance = math.Inf(1)
+	for g, centroid := range c.Centroids {
+		d := 0.0
+		for m := range profile {
+			d += (profile[m] - centroid[m]) * (profile[m] - centroid[m])
+		}
+		if d < distance {
+			group, distance = g, d
+		}
+	}
+	return group, distance
+}
+
+// Función que retorna el grupo de un establecimiento (0 si no se conoce o no
+// hay grupos)
+func (c *DemandClusters) Group(establishment string) int {
+	if c == nil {
+		return 0
+	}
+	return c.Assignments[establishment]
+}
+
+// Función que completa el grupo de cada registro
+func (c *DemandClusters) Label(data []Atencion) {
+	for i := range data {
+		data[i].Grupo = c.Group(data[i].NombreEstablecimiento)
+	}
+}
+
+// Subcomando "cluster-report": agrupa los establecimientos y describe cada
+// grupo, por ejemplo "estos 12 establecimientos se comportan igual"
+func clusterReportCommand(args []string) error {
+	fs := flag.NewFlagSet("cluster-report", flag.ContinueOnError)
+	dataPath := fs.String("datos", "atenciones_filtradas.csv", "archivo CSV de atenciones")
+	k := fs.Int("grupos", defaultDemandClusters, "número de grupos")
+	seed := fs.Int64("semilla", 1, "semilla de la inicialización de k-means")
+	output := fs.String("o", "", "archivo CSV con el grupo de cada establecimiento (vacío = no escribirlo)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *k <= 0 {
+		return fmt.Errorf("número de grupos inválido: %d", *k)
+	}
+
+	data, err := loadAtenciones(context.Background(), *dataPath)
+	if err != nil {
+		return err
+	}
+	clusters := ClusterEstablishments(data, *k, *seed)
+	if len(clusters.Assignments) == 0 {
+		return errors.New("no hay establecimientos para agrupar")
+	}
+	clusters.report(os.Stdout)
+
+	if *output == "" {
+		return nil
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"establecimiento", "grupo"})
+	for _, name := range sortedKeys(clusters.Assignments) {
+		cw.Write([]string{name, strconv.Itoa(clusters.Assignments[name])})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Grupos guardados en %s\n", *output)
+	return file.Close()
+}
+
+// Función que escribe cada grupo con su demanda promedio, su mes pico y sus establecimientos
+func (c *DemandClusters) report(w io.Writer) {
+	members := make([][]string, len(c.Centroids))
+	for _, name := range sortedKeys(c.Assignments) {
+		g := c.Assignments[name] - 1
+		members[g] = append(members[g], name)
+	}
+	order := make([]int, len(c.Centroids))
+	for g := range order {
+		order[g] = g
+	}
+	sort.SliceStable(order, func(i, j int) bool { return len(members[order[i]]) > len(members[order[j]]) })
+
+	for _, g := range order {
+		if len(members[g]) == 0 {
+			continue
+		}
+		peak := 0
+		for m, v := range c.Centroids[g] {
+			if v > c.Centroids[g][peak] {
+				peak = m
+			}
+		}
+		who := fmt.Sprintf("estos %d establecimientos se comportan igual", len(members[g]))
+		if len(members[g]) == 1 {
+			who = "un establecimiento con un perfil propio"
+		}
+		fmt.Fprintf(w, "Grupo %d: %s (%.1f atendidos por día en promedio, pico en %s)\n", g+1, who, meanDemand(c.Centroids[g]), monthNames[peak+1])
+		fmt.Fprintf(w, "  %s\n", strings.Join(members[g], "\n  "))
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ajuste de hiperparámetros con validación cruzada anidada: el ciclo interno
+// elige, dentro de los registros de entrenamiento de cada pliegue externo, la
+// configuración de la grilla con mejor métrica promedio; el ciclo externo
+// entrena esa configuración con todos esos registros y la evalúa en el pliegue
+// externo, que el ciclo interno nunca vio. El promedio de los pliegues externos
+// estima sin sesgo optimista el rendimiento del procedimiento de ajuste. La
+// configuración recomendada sale de una validación cruzada simple sobre todos
+// los registros; su puntaje se informa también, pero es optimista porque es el
+// máximo de la grilla. Los pliegues externos se ajustan en paralelo.
+
+// Métricas por las que se puede elegir la configuración
+var tuneMetrics = map[string]func(confusionMatrix) float64{
+	"precision":           confusionMatrix.Accuracy,
+	"precision_positivos": confusionMatrix.Precision,
+	"exhaustividad":       confusionMatrix.Recall,
+	"f1":                  confusionMatrix.F1,
+}
+
+// Configuración de hiperparámetros de la grilla
+type tuneConfig struct {
+	Trees        int      `json:"arboles"`
+	Features     []string `json:"caracteristicas"`
+	Winsorize    float64  `json:"winsorizar"`
+	RecencyDecay float64  `json:"peso_recencia"`
+}
+
+func (c tuneConfig) String() string {
+	s := fmt.Sprintf("%d árboles, %s", c.Trees, strings.Join(c.Features, ","))
+	if c.Winsorize > 0 {
+		s += fmt.Sprintf(", winsorizar %g", c.Winsorize)
+	}
+	if c.RecencyDecay > 0 {
+		s += fmt.Sprintf(", recencia %g", c.RecencyDecay)
+	}
+	return s
+}
+
+// Función que entrena un bosque con la configuración
+func (c tuneConfig) train(data []Atencion, threshold int) *RandomForest {
+	rf := &RandomForest{Features: c.Features, Winsorize: c.Winsorize, RecencyDecay: c.RecencyDecay, Threshold: threshold}
+	rf.TrainTrees(data, c.Trees)
+	return rf
+}
+
+// Resultado de un pliegue externo
+type outerFoldResult struct {
+	Fold       int             `json:"pliegue"`
+	Config     tuneConfig      `json:"configuracion"`   // Elegida por el ciclo interno
+	InnerScore float64         `json:"puntaje_interno"` // Promedio de la configuración en los pliegues internos
+	OuterScore float64         `json:"puntaje_externo"` // En el pliegue externo
+	Metrics    *holdoutMetrics `json:"metricas"`
+}
+
+// Resultado del ajuste
+type tuneResult struct {
+	Metric        string            `json:"metrica"`
+	Configs       int               `json:"configuraciones"`
+	OuterFolds    []outerFoldResult `json:"pliegues_externos"`
+	NestedMean    float64           `json:"estimacion_anidada"` // Promedio de los puntajes externos
+	NestedStdDev  float64           `json:"desvio_anidado"`
+	Selected      tuneConfig        `json:"recomendada"`
+	SelectedScore float64           `json:"puntaje_cv_recomendada"` // Optimista: máximo de la grilla
+	Seconds       float64           `json:"segundos"`
+}
+
+// Subcomando "tune": elige hiperparámetros y estima su rendimiento con
+// validación cruzada anidada
+func tuneCommand(args []string) error {
+	fs := flag.NewFlagSet("tune", flag.ContinueOnError)
+	dataPath := fs.String("datos", "atenciones_filtradas.csv", "CSV de atenciones")
+	treeList := fs.String("arboles", "25,50,100", "números de árboles de la grilla, separados por comas")
+	featureSets := fs.String("caracteristicas", "Mes,Dia", "conjuntos de características de la grilla, separados por punto y coma (p. ej. 'Mes,Dia;Mes,Dia,Grupo')")
+	winsorizeList := fs.String("winsorizar", "0", "percentiles de recorte de la grilla, separados por comas (0 = sin recorte)")
+	recencyList := fs.String("peso-recencia", "0", "pesos de recencia de la grilla, separados por comas (0 = sin ponderar)")
+	metricName := fs.String("metrica", "f1", "métrica que se maximiza: precision, precision_positivos, exhaustividad o f1")
+	outerFolds := fs.Int("pliegues", 5, "pliegues del ciclo externo (evaluación)")
+	innerFolds := fs.Int("pliegues-internos", 3, "pliegues del ciclo interno (ajuste)")
+	threshold := fs.Int("umbral", congestionThreshold, "atendidos a partir de los cuales un día está congestionado")
+	parallel := fs.Int("paralelo", 2, "pliegues externos que se ajustan a la vez")
+	seed := fs.Int64("semilla", 1, "semilla para repartir los registros en pliegues")
+	resultPath := fs.String("resultado", "", "archivo JSON con los pliegues, la estimación y la configuración recomendada")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	metric, ok := tuneMetrics[*metricName]
+	if !ok {
+		return fmt.Errorf("métrica desconocida: %q (precision, precision_positivos, exhaustividad o f1)", *metricName)
+	}
+	if *outerFolds < 2 || *innerFolds < 2 {
+		return errors.New("-pliegues y -pliegues-internos deben ser al menos 2")
+	}
+	if *parallel <= 0 || *threshold <= 0 {
+		return errors.New("-paralelo y -umbral deben ser positivos")
+	}
+	configs, err := tuneGrid(*treeList, *featureSets, *winsorizeList, *recencyList)
+	if err != nil {
+		return err
+	}
+
+	data, err := loadAtenciones(context.Background(), *dataPath)
+	if err != nil {
+		return withExitCode(exitLoadFailure, err)
+	}
+	if len(data) < *outerFolds**innerFolds {
+		return fmt.Errorf("hay %d registros, pocos para %d×%d pliegues", len(data), *outerFolds, *innerFolds)
+	}
+	fmt.Printf("%d configuraciones, %d registros, %d pliegues externos y %d internos (%d entrenamientos)\n",
+		len(configs), len(data), *outerFolds, *innerFolds, (*outerFolds+1)*len(configs)**innerFolds+*outerFolds)
+
+	start := time.Now()
+	result := &tuneResult{Metric: *metricName, Configs: len(configs), OuterFolds: make([]outerFoldResult, *outerFolds)}
+	folds := kFolds(len(data), *outerFolds, *seed)
+	slots := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for i := range folds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			train, test := splitFold(data, folds, i)
+			best, scores := crossValidate(train, configs, *innerFolds, *seed+int64(i)+1, *threshold, metric)
+			rf := configs[best].train(train, *threshold)
+			confusion := evaluateHoldout(rf, rf.Pipeline, test, 0)
+			result.OuterFolds[i] = outerFoldResult{Fold: i + 1, Config: configs[best], InnerScore: scores[best],
+				OuterScore: metric(confusion), Metrics: confusion.metrics()}
+			fmt.Printf("Pliegue %d: %s (interno %.4f, externo %.4f)\n", i+1, configs[best], scores[best], metric(confusion))
+		}()
+	}
+	// La validación simple sobre todos los registros corre junto con los pliegues
+	var selected int
+	var selectedScores []float64
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slots <- struct{}{}
+		defer func() { <-slots }()
+		selected, selectedScores = crossValidate(data, configs, *innerFolds, *seed, *threshold, metric)
+	}()
+	wg.Wait()
+
+	outer := make([]float64, len(result.OuterFolds))
+	for i, fold := range result.OuterFolds {
+		outer[i] = fold.OuterScore
+	}
+	result.NestedMean, result.NestedStdDev = meanStdDev(outer)
+	result.Selected, result.SelectedScore = configs[selected], selectedScores[selected]
+	result.Seconds = time.Since(start).Seconds()
+
+	fmt.Printf("Estimación anidada de %s: %.4f ± %.4f\n", *metricName, result.NestedMean, result.NestedStdDev)
+	fmt.Printf("Configuración recomendada: %s (%s %.4f en validación simple, optimista)\n", result.Selected, *metricName, result.SelectedScore)
+	fmt.Printf("Ajuste en %v\n", time.Since(start).Round(time.Millisecond))
+	if *resultPath == "" {
+		return nil
+	}
+	return writeJSONOutput(*resultPath, result)
+}
+
+// Función que arma el producto de las listas de la grilla
+func tuneGrid(treeList, featureSets, winsorizeList, recencyList string) ([]tuneConfig, error) {
+	var trees []int
+	for _, part := range strings.Split(treeList, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("número de árboles inválido: %q", part)
+		}
+		trees = append(trees, n)
+	}
+	var featureLists [][]string
+	for _, set := range strings.Split(featureSets, ";") {
+		features, err := ParseFeatures(strings.TrimSpace(set))
+		if err != nil {
+			return nil, err
+		}
+		if len(features) == 0 {
+			features = defaultFeatures
+		}
+		if trainOnly := trainOnlyFeatures(features); len(trainOnly) > 0 {
+			return nil, fmt.Errorf("%s no se conocen al predecir", strings.Join(trainOnly, ", "))
+		}
+		featureLists = append(featureLists, features)
+	}
+	winsorize, err := parseGridFloats(winsorizeList, "percentil de recorte", true)
+	if err != nil {
+		return nil, err
+	}
+	recency, err := parseGridFloats(recencyList, "peso de recencia", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []tuneConfig
+	for _, n := range trees {
+		for _, features := range featureLists {
+			for _, w := range winsorize {
+				for _, r := range recency {
+					configs = append(configs, tuneConfig{Trees: n, Features: features, Winsorize: w, RecencyDecay: r})
+				}
+			}
+		}
+	}
+	return configs, nil
+}
+
+// Función que interpreta una lista de valores entre 0 y 1 de la grilla (con
+// exclusive, el 1 no se admite)
+func parseGridFloats(list, name string, exclusive bool) ([]float64, error) {
+	var values []float64
+	for _, part := range strings.Split(list, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || v < 0 || v > 1 || (exclusive && v == 1) {
+			return nil, fmt.Errorf("%s inválido: %q", name, part)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Función que reparte al azar los índices de n registros en k pliegues de
+// tamaños parecidos
+func kFolds(n, k int, seed int64) [][]int {
+	perm := rand.New(rand.NewSource(seed)).Perm(n)
+	folds := make([][]int, k)
+	for i, idx := range perm {
+		folds[i%k] = append(folds[i%k], idx)
+	}
+	return folds
+}
+
+// Función que separa los registros del pliegue i (prueba) de los demás (entrenamiento)
+func splitFold(data []Atencion, folds [][]int, i int) (train, test []Atencion) {
+	for j, fold := range folds {
+		for _, idx := range fold {
+			if j == i {
+				test = append(test, data[idx])
+			} else {
+				train = append(train, data[idx])
+			}
+		}
+	}
+	return train, test
+}
+
+// Función que evalúa cada configuración con validación cruzada de k pliegues
+// y retorna la de mejor métrica promedio (la primera ante un empate) y el
+// promedio de cada una
+func crossValidate(data []Atencion, configs []tuneConfig, k int, seed int64, threshold int, metric func(confusionMatrix) float64) (int, []float64) {
+	folds := kFolds(len(data), k, seed)
+	scores := make([]float64, len(configs))
+	for i := range folds {
+		train, test := splitFold(data, folds, i)
+		for c, config := range configs {
+			rf := config.train(train, threshold)
+			scores[c] += metric(evaluateHoldout(rf, rf.Pipeline, test, 0)) / float64(k)
+		}
+	}
+	best := 0
+	for c, score := range scores {
+		if score > scores[best] {
+			best = c
+		}
+	}
+	return best, scores
+}
+
+// Función que retorna el promedio y el desvío estándar muestral
+func meanStdDev(values []float64) (mean, stdDev float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	for _, v := range values {
+		stdDev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(stdDev / float64(len(values)-1))
+}
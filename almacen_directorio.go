@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Almacén de modelos en un directorio: cada modelo tiene su carpeta con un
+// archivo por versión (000003.modelo) y sus metadatos al lado (000003.json).
+// El número de versión se reserva con un enlace duro, que falla si el archivo
+// ya existe, así que dos procesos que guardan a la vez no se pisan. Una versión
+// sin su .json todavía se está escribiendo y no se lista.
+
+// Almacén en un directorio local o compartido
+type dirModelStore struct {
+	dir string
+}
+
+// Constructor del almacén en un directorio, que se crea si no existe
+func openDirModelStore(dir string) (*dirModelStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("almacén de modelos: %w", err)
+	}
+	return &dirModelStore{dir: dir}, nil
+}
+
+// Función que retorna la ruta de un archivo de una versión
+func (s *dirModelStore) path(name string, version int, ext string) string {
+	return filepath.Join(s.dir, name, fmt.Sprintf("%06d%s", version, ext))
+}
+
+func (s *dirModelStore) Put(ctx context.Context, info StoredModel, artifact []byte) (StoredModel, error) {
+	modelDir := filepath.Join(s.dir, info.Name)
+	if err := os.MkdirAll(modelDir, 0o755); err != nil {
+		return info, err
+	}
+	tmp, err := os.CreateTemp(modelDir, ".subida-*")
+	if err != nil {
+		return info, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(artifact)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return info, err
+	}
+
+	// Reservar el número siguiente; si otro proceso lo tomó, probar con el que sigue
+	versions, err := s.versions(info.Name)
+	if err != nil {
+		return info, err
+	}
+	info.Version = 1
+	if len(versions) > 0 {
+		info.Version = versions[len(versions)-1] + 1
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return info, err
+		}
+		err := os.Link(tmp.Name(), s.path(info.Name, info.Version, ".modelo"))
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return info, err
+		}
+		info.Version++
+	}
+
+	meta, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return info, err
+	}
+	metaPath := s.path(info.Name, info.Version, ".json")
+	if err := os.WriteFile(metaPath+".tmp", meta, 0o644); err != nil {
+		return info, err
+	}
+	return info, os.Rename(metaPath+".tmp", metaPath)
+}
+
+func (s *dirModelStore) Get(ctx context.Context, name string, version int) (StoredModel, []byte, error) {
+	if version == 0 {
+		versions, err := s.List(ctx, name)
+		if err != nil {
+			return StoredModel{}, nil, err
+		}
+		latest, err := pickVersion(name, versions, 0)
+		if err != nil {
+			return StoredModel{}, nil, err
+		}
+		version = latest.Version
+	}
+	info, err := s.readInfo(name, version)
+	if err != nil {
+		return info, nil, err
+	}
+	artifact, err := os.ReadFile(s.path(name, version, ".modelo"))
+	return info, artifact, err
+}
+
+func (s *dirModelStore) List(ctx context.Context, name string) ([]StoredModel, error) {
+	versions, err := s.versions(name)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]StoredModel, 0, len(versions))
+	for _, version := range versions {
+		info, err := s.readInfo(name, version)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Versión que se está escribiendo
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// Función que retorna los números de versión con artefacto, en orden
+func (s *dirModelStore) versions(name string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".modelo")
+		if !ok {
+			continue
+		}
+		if version, err := strconv.Atoi(base); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	slices.Sort(versions)
+	return versions, nil
+}
+
+// Función que lee los metadatos de una versión
+func (s *dirModelStore) readInfo(name string, version int) (StoredModel, error) {
+	var info StoredModel
+	data, err := os.ReadFile(s.path(name, version, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return info, fmt.Errorf("el modelo %s no tiene la versión %d en el almacén: %w", name, version, err)
+	}
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("metadatos inválidos de %s v%d: %w", name, version, err)
+	}
+	return info, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Almacén de modelos: en lugar de una ruta, un modelo se puede guardar y abrir
+// como almacen:nombre (la última versión) o almacen:nombre@3. Cada guardado
+// crea una versión nueva con sus metadatos (suma, tamaño, árboles, datos y
+// fecha del entrenamiento). El almacén se elige con TP_ALMACEN_MODELOS: un
+// directorio, una base SQL (postgres://, mysql:// o sqlite:) o un prefijo en
+// S3 o GCS (s3://bucket/prefijo, gs://bucket/prefijo). Como la resolución está
+// en openInput y createOutput, entrenar, servir, seguir y el menú usan el
+// almacén sin cambios: solo cambia la ruta que se les pasa.
+
+// Prefijo de las referencias a modelos del almacén
+const storedModelPrefix = "almacen:"
+
+// Nombres de modelo aceptados (se usan en rutas y claves de objetos)
+var storedModelName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Versión de un modelo guardada en el almacén
+type StoredModel struct {
+	Name       string    `json:"nombre"`
+	Version    int       `json:"version"`
+	SHA256     string    `json:"sha256"` // Suma del artefacto
+	Size       int64     `json:"bytes"`
+	CreatedAt  time.Time `json:"creado"`
+	Trees      int       `json:"arboles,omitempty"`
+	DataSHA256 string    `json:"datos_sha256,omitempty"` // Suma de los datos de entrenamiento
+	TrainedAt  string    `json:"entrenado,omitempty"`    // Fecha del entrenamiento (RFC 3339)
+}
+
+// Almacén de artefactos y metadatos de modelos
+type ModelStore interface {
+	// Guarda el artefacto como la versión siguiente del modelo y la retorna
+	Put(ctx context.Context, info StoredModel, artifact []byte) (StoredModel, error)
+	// Retorna una versión (0 = la última) con su artefacto
+	Get(ctx context.Context, name string, version int) (StoredModel, []byte, error)
+	// Retorna las versiones de un modelo, la más vieja primero
+	List(ctx context.Context, name string) ([]StoredModel, error)
+}
+
+// Almacén del proceso, abierto la primera vez que se usa
+var modelStore struct {
+	once  sync.Once
+	store ModelStore
+	err   error
+}
+
+// Función que indica si la ruta es una referencia al almacén de modelos
+func isStoredModel(path string) bool {
+	return strings.HasPrefix(path, storedModelPrefix)
+}
+
+// Función que separa una referencia almacen:nombre[@versión]
+func parseStoredModel(ref string) (string, int, error) {
+	name, version, hasVersion := strings.Cut(strings.TrimPrefix(ref, storedModelPrefix), "@")
+	if !storedModelName.MatchString(name) {
+		return "", 0, fmt.Errorf("nombre de modelo inválido en %q", ref)
+	}
+	if !hasVersion {
+		return name, 0, nil
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil || v <= 0 {
+		return "", 0, fmt.Errorf("versión inválida en %q", ref)
+	}
+	return name, v, nil
+}
+
+// Función que retorna el almacén indicado en TP_ALMACEN_MODELOS
+func defaultModelStore() (ModelStore, error) {
+	modelStore.once.Do(func() {
+		uri := os.Getenv("TP_ALMACEN_MODELOS")
+		if uri == "" {
+			modelStore.err = errors.New("para usar almacen: hay que definir TP_ALMACEN_MODELOS")
+			return
+		}
+		modelStore.store, modelStore.err = openModelStore(context.Background(), uri)
+	})
+	return modelStore.store, modelStore.err
+}
+
+// Función que abre el almacén de una URI según su esquema
+func openModelStore(ctx context.Context, uri string) (ModelStore, error) {
+	if isRemote(uri) {
+		return openObjectModelStore(uri)
+	}
+	scheme, _, _ := strings.Cut(uri, ":")
+	switch scheme {
+	case "postgres", "postgresql", "mysql", "sqlite":
+		return openSQLModelStore(ctx, uri)
+	}
+	return openDirModelStore(strings.TrimPrefix(uri, "file://"))
+}
+
+// Función que obtiene una versión del almacén a partir de una referencia
+func fetchStoredModel(ctx context.Context, ref string) (StoredModel, []byte, error) {
+	name, version, err := parseStoredModel(ref)
+	if err != nil {
+		return StoredModel{}, nil, err
+	}
+	store, err := defaultModelStore()
+	if err != nil {
+		return StoredModel{}, nil, err
+	}
+	return store.Get(ctx, name, version)
+}
+
+// Función que retorna los metadatos de una referencia sin traer el artefacto
+func statStoredModel(ctx context.Context, ref string) (StoredModel, error) {
+	name, version, err := parseStoredModel(ref)
+	if err != nil {
+		return StoredModel{}, err
+	}
+	store, err := defaultModelStore()
+	if err != nil {
+		return StoredModel{}, err
+	}
+	versions, err := store.List(ctx, name)
+	if err != nil {
+		return StoredModel{}, err
+	}
+	return pickVersion(name, versions, version)
+}
+
+// Función que elige una versión de la lista (0 = la última)
+func pickVersion(name string, versions []StoredModel, version int) (StoredModel, error) {
+	if len(versions) == 0 {
+		return StoredModel{}, fmt.Errorf("el modelo %s no está en el almacén", name)
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return StoredModel{}, fmt.Errorf("el modelo %s no tiene la versión %d en el almacén", name, version)
+}
+
+// Función que abre una versión del almacén para leerla
+func openStoredModel(ctx context.Context, ref string) (io.ReadCloser, error) {
+	_, artifact, err := fetchStoredModel(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(artifact)), nil
+}
+
+// Salida hacia el almacén: acumula el artefacto y lo guarda como versión
+// nueva al cerrarse
+type storeOutput struct {
+	ctx  context.Context
+	info StoredModel
+	buf  bytes.Buffer
+	done bool
+	err  error
+}
+
+// Función que crea la salida de una referencia; no puede indicar la versión
+func createStoredModel(ctx context.Context, ref string) (*storeOutput, error) {
+	name, version, err := parseStoredModel(ref)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 {
+		return nil, fmt.Errorf("%s: la versión la asigna el almacén al guardar", ref)
+	}
+	return &storeOutput{ctx: ctx, info: StoredModel{Name: name}}, nil
+}
+
+// Función que agrega a la versión los metadatos del modelo que se guarda
+func (o *storeOutput) describe(model Predictor) {
+	meta := newModelMetadata(model, "")
+	o.info.Trees, o.info.DataSHA256, o.info.TrainedAt = meta.Trees, meta.DataSHA256, meta.TrainedAt
+}
+
+func (o *storeOutput) Write(p []byte) (int, error) {
+	return o.buf.Write(p)
+}
+
+func (o *storeOutput) Close() error {
+	if o.done {
+		return o.err
+	}
+	o.done = true
+	store, err := defaultModelStore()
+	if err != nil {
+		o.err = err
+		return err
+	}
+	sum := sha256.Sum256(o.buf.Bytes())
+	o.info.SHA256, o.info.Size, o.info.CreatedAt = hex.EncodeToString(sum[:]), int64(o.buf.Len()), time.Now().UTC()
+	stored, err := store.Put(o.ctx, o.info, o.buf.Bytes())
+	if err != nil {
+		o.err = fmt.Errorf("no se pudo guardar %s en el almacén: %w", o.info.Name, err)
+		return o.err
+	}
+	log.Printf("Modelo %s guardado en el almacén como versión %d", stored.Name, stored.Version)
+	return nil
+}
+
+func (o *storeOutput) Abort() {
+	o.done = true
+}
+
+// Subcomando model-versions: lista las versiones de un modelo del almacén
+func modelVersionsCommand(args []string) error {
+	fs := flag.NewFlagSet("model-versions", flag.ContinueOnError)
+	name := fs.String("nombre", "", "nombre del modelo en el almacén (TP_ALMACEN_MODELOS)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !storedModelName.MatchString(*name) {
+		return fmt.Errorf("nombre de modelo inválido: %q", *name)
+	}
+	store, err := defaultModelStore()
+	if err != nil {
+		return err
+	}
+	versions, err := store.List(context.Background(), *name)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("el modelo %s no está en el almacén", *name)
+	}
+	fmt.Printf("%-8s %-20s %-12s %10s %7s  %s\n", "VERSIÓN", "CREADO", "HUELLA", "BYTES", "ÁRBOLES", "ENTRENADO")
+	for _, v := range versions {
+		trained := v.TrainedAt
+		if trained == "" {
+			trained = "-"
+		}
+		fmt.Printf("%-8d %-20s %-12s %10d %7d  %s\n", v.Version, v.CreatedAt.Format(time.DateTime), v.SHA256[:12], v.Size, v.Trees, trained)
+	}
+	return nil
+}
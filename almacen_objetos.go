@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Almacén de modelos en S3 o GCS: bajo el prefijo, cada modelo tiene un objeto
+// por versión (nombre/000003.modelo) y un índice (nombre/indice.json) con los
+// metadatos de todas sus versiones, porque los clientes no listan objetos. El
+// artefacto se sube antes que el índice, así que una versión listada siempre
+// existe. El índice no se bloquea entre procesos: las publicaciones de un mismo
+// modelo deben hacerse de a una (dentro de un proceso ya se serializan).
+
+// Almacén bajo un prefijo de un bucket
+type objectModelStore struct {
+	store  objectStore
+	bucket string
+	prefix string
+
+	mu sync.Mutex // Serializa las publicaciones del proceso
+}
+
+// Constructor del almacén a partir de s3://bucket/prefijo o gs://bucket/prefijo
+func openObjectModelStore(uri string) (*objectModelStore, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("almacén de modelos inválido %q, se espera esquema://bucket/prefijo", uri)
+	}
+	store, err := objectStoreFor(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return &objectModelStore{store: store, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+// Función que retorna la clave de un objeto del modelo
+func (s *objectModelStore) key(name, file string) string {
+	return path.Join(s.prefix, name, file)
+}
+
+func (s *objectModelStore) Put(ctx context.Context, info StoredModel, artifact []byte) (StoredModel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.List(ctx, info.Name)
+	if err != nil {
+		return info, err
+	}
+	info.Version = 1
+	if len(index) > 0 {
+		info.Version = index[len(index)-1].Version + 1
+	}
+	if err := putObject(ctx, s.store, s.bucket, s.key(info.Name, fmt.Sprintf("%06d.modelo", info.Version)), artifact); err != nil {
+		return info, err
+	}
+	data, err := json.MarshalIndent(append(index, info), "", "  ")
+	if err != nil {
+		return info, err
+	}
+	return info, putObject(ctx, s.store, s.bucket, s.key(info.Name, "indice.json"), data)
+}
+
+func (s *objectModelStore) Get(ctx context.Context, name string, version int) (StoredModel, []byte, error) {
+	index, err := s.List(ctx, name)
+	if err != nil {
+		return StoredModel{}, nil, err
+	}
+	info, err := pickVersion(name, index, version)
+	if err != nil {
+		return info, nil, err
+	}
+	artifact, err := getObject(ctx, s.store, s.bucket, s.key(name, fmt.Sprintf("%06d.modelo", info.Version)))
+	return info, artifact, err
+}
+
+func (s *objectModelStore) List(ctx context.Context, name string) ([]StoredModel, error) {
+	data, err := getObject(ctx, s.store, s.bucket, s.key(name, "indice.json"))
+	if errors.Is(err, errObjectNotFound) {
+		return nil, nil // Modelo sin versiones todavía
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index []StoredModel
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("índice inválido del modelo %s: %w", name, err)
+	}
+	return index, nil
+}
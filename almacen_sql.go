@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Almacén de modelos en una tabla SQL (modelos): una fila por versión con los
+// metadatos en columnas y el artefacto en una columna binaria. La versión
+// siguiente se calcula dentro de la transacción que inserta la fila; si otro
+// proceso insertó la misma versión, la clave primaria rechaza la fila y se
+// reintenta con la siguiente. Usa los mismos drivers que la salida -sql de
+// predict-batch.
+
+// Intentos de inserción de una versión ante escrituras simultáneas
+const sqlStoreAttempts = 5
+
+// Columnas de metadatos de la tabla de modelos, en el orden de scanStored
+const sqlStoreColumns = "nombre, version, sha256, bytes, creado, arboles, datos_sha256, entrenado"
+
+// Almacén en una base SQL
+type sqlModelStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// Constructor del almacén SQL, que crea la tabla si no existe
+func openSQLModelStore(ctx context.Context, conn string) (*sqlModelStore, error) {
+	db, dialect, err := openSQL(conn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS modelos (
+	nombre VARCHAR(200) NOT NULL,
+	version INTEGER NOT NULL,
+	sha256 CHAR(64) NOT NULL,
+	bytes BIGINT NOT NULL,
+	creado VARCHAR(40) NOT NULL,
+	arboles INTEGER NOT NULL,
+	datos_sha256 VARCHAR(64) NOT NULL,
+	entrenado VARCHAR(40) NOT NULL,
+	artefacto `+dialect.blob+` NOT NULL,
+	PRIMARY KEY (nombre, version))`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error al crear la tabla modelos: %w", err)
+	}
+	return &sqlModelStore{db: db, dialect: dialect}, nil
+}
+
+func (s *sqlModelStore) Put(ctx context.Context, info StoredModel, artifact []byte) (StoredModel, error) {
+	var err error
+	for attempt := 0; attempt < sqlStoreAttempts; attempt++ {
+		if info, err = s.insert(ctx, info, artifact); err == nil || ctx.Err() != nil {
+			return info, err
+		}
+	}
+	return info, err
+}
+
+// Función que inserta el artefacto con el número siguiente al último guardado
+func (s *sqlModelStore) insert(ctx context.Context, info StoredModel, artifact []byte) (StoredModel, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return info, err
+	}
+	defer tx.Rollback() // No hace nada después de Commit
+
+	p := s.dialect.param
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) + 1 FROM modelos WHERE nombre = "+p(1),
+		info.Name).Scan(&info.Version); err != nil {
+		return info, err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO modelos ("+sqlStoreColumns+", artefacto) VALUES ("+
+		p(1)+", "+p(2)+", "+p(3)+", "+p(4)+", "+p(5)+", "+p(6)+", "+p(7)+", "+p(8)+", "+p(9)+")",
+		info.Name, info.Version, info.SHA256, info.Size, info.CreatedAt.Format(time.RFC3339Nano),
+		info.Trees, info.DataSHA256, info.TrainedAt, artifact)
+	if err != nil {
+		return info, err
+	}
+	return info, tx.Commit()
+}
+
+func (s *sqlModelStore) Get(ctx context.Context, name string, version int) (StoredModel, []byte, error) {
+	p := s.dialect.param
+	query := "SELECT " + sqlStoreColumns + ", artefacto FROM modelos WHERE nombre = " + p(1)
+	args := []any{name}
+	if version == 0 {
+		query += " ORDER BY version DESC LIMIT 1"
+	} else {
+		query += " AND version = " + p(2)
+		args = append(args, version)
+	}
+	var artifact []byte
+	info, err := scanStored(s.db.QueryRowContext(ctx, query, args...), &artifact)
+	if errors.Is(err, sql.ErrNoRows) {
+		if version == 0 {
+			return info, nil, fmt.Errorf("el modelo %s no está en el almacén", name)
+		}
+		return info, nil, fmt.Errorf("el modelo %s no tiene la versión %d en el almacén", name, version)
+	}
+	return info, artifact, err
+}
+
+func (s *sqlModelStore) List(ctx context.Context, name string) ([]StoredModel, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+sqlStoreColumns+" FROM modelos WHERE nombre = "+
+		s.dialect.param(1)+" ORDER BY version", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []StoredModel
+	for rows.Next() {
+		info, err := scanStored(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	return list, rows.Err()
+}
+
+// Función que lee las columnas de metadatos de una fila y, si se indican,
+// las columnas que siguen
+func scanStored(row interface{ Scan(...any) error }, extra ...any) (StoredModel, error) {
+	var info StoredModel
+	var created string
+	dest := append([]any{&info.Name, &info.Version, &info.SHA256, &info.Size, &created,
+		&info.Trees, &info.DataSHA256, &info.TrainedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return info, err
+	}
+	var err error
+	if info.CreatedAt, err = time.Parse(time.RFC3339Nano, created); err != nil {
+		return info, fmt.Errorf("fecha inválida en la versión %d de %s: %w", info.Version, info.Name, err)
+	}
+	return info, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Días análogos: al explicar una predicción se buscan en el histórico los días
+// más parecidos del mismo establecimiento, con lo que atendió de verdad, para
+// que el pronóstico tenga un precedente concreto. La distancia suma la
+// separación en el calendario (en semanas, y un mes distinto cuenta aparte), la
+// diferencia relativa con la demanda esperada y, si se conoce el año de los
+// datos, si el día de la semana es distinto.
+
+// Día del histórico parecido a una consulta
+type AnalogDay struct {
+	Month      int     `json:"mes"`
+	Day        int     `json:"dia"`
+	Attended   int     `json:"atendidos"`
+	Attentions int     `json:"atenciones"`
+	Congested  bool    `json:"congestionado"`
+	Distance   float64 `json:"distancia"`
+}
+
+// Histórico indexado donde se buscan los días análogos
+type analogIndex struct {
+	index *DatasetIndex
+	names map[string]string // Nombre normalizado -> nombre tal como aparece en los datos
+	year  int               // Año de los datos para comparar el día de la semana (0 = no comparar)
+}
+
+// Constructor a partir de un índice ya armado
+func newAnalogIndex(index *DatasetIndex, year int) *analogIndex {
+	a := &analogIndex{index: index, names: make(map[string]string), year: year}
+	for _, name := range index.Establishments() {
+		a.names[normalizeEstablishment(name)] = name
+	}
+	return a
+}
+
+// Función que retorna los k días del establecimiento más parecidos a la
+// consulta ya preprocesada (su Atendidos es la demanda esperada). Un día estuvo
+// congestionado si superó threshold atendidos, el umbral del pipeline del modelo.
+func (a *analogIndex) Nearest(att Atencion, k, threshold int) []AnalogDay {
+	name, ok := a.names[normalizeEstablishment(att.NombreEstablecimiento)]
+	if !ok || k <= 0 {
+		return nil
+	}
+	queryDay := calendarDay(att.Mes, att.Dia)
+	var analogs []AnalogDay
+	for _, id := range a.index.EstablishmentRows(name) {
+		row := a.index.Row(id)
+		gap := math.Abs(float64(calendarDay(row.Mes, row.Dia) - queryDay))
+		gap = min(gap, 366-gap) // Fin de diciembre está cerca de inicio de enero
+		distance := gap / 7
+		if row.Mes != att.Mes {
+			distance++
+		}
+		if att.Atendidos > 0 { // Sin pipeline no hay demanda esperada con qué comparar
+			distance += math.Abs(float64(row.Atendidos-att.Atendidos)) / float64(att.Atendidos)
+		}
+		if a.year > 0 && weekdayOf(a.year, row.Mes, row.Dia) != weekdayOf(a.year, att.Mes, att.Dia) {
+			distance++
+		}
+		analogs = append(analogs, AnalogDay{
+			Month: row.Mes, Day: row.Dia, Attended: row.Atendidos, Attentions: row.Atenciones,
+			Congested: row.Atendidos > threshold, Distance: math.Round(distance*1000) / 1000,
+		})
+	}
+	sort.SliceStable(analogs, func(i, j int) bool { return analogs[i].Distance < analogs[j].Distance })
+	return analogs[:min(k, len(analogs))]
+}
+
+// Función que resume los días análogos, por ejemplo "3 de 5 días parecidos
+// estuvieron congestionados (22 atendidos en promedio)"
+func summarizeAnalogs(analogs []AnalogDay) string {
+	if len(analogs) == 0 {
+		return "no hay días parecidos en el histórico"
+	}
+	congested, attended := 0, 0
+	for _, d := range analogs {
+		if d.Congested {
+			congested++
+		}
+		attended += d.Attended
+	}
+	return fmt.Sprintf("%d de %d días parecidos estuvieron congestionados (%d atendidos en promedio)",
+		congested, len(analogs), attended/len(analogs))
+}
+
+// Función que retorna el día del año de una fecha sin año (con 29 de febrero)
+func calendarDay(month, day int) int {
+	return time.Date(2000, time.Month(month), day, 0, 0, 0, 0, time.UTC).YearDay()
+}
+
+// Función que retorna el día de la semana de una fecha en el año indicado
+func weekdayOf(year, month, day int) time.Weekday {
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Weekday()
+}
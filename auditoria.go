@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registro de auditoría: cada operación que cambia datos o modelos (cargas,
+// filtros, entrenamientos, guardados, cargas, canarios, promociones y rollbacks
+// de modelos) agrega una línea JSON con quién, cuándo, qué y con qué resultado,
+// para poder reconstruir de dónde salió el modelo desplegado. El archivo se abre
+// solo para agregar y se elige con TP_AUDITORIA; sin esa variable no se audita.
+
+// Operaciones auditadas
+const (
+	auditLoadData    = "carga_datos"
+	auditFilter      = "filtro"
+	auditTrain       = "entrenamiento"
+	auditAddTrees    = "agregar_arboles"
+	auditSaveModel   = "guardar_modelo"
+	auditLoadModel   = "cargar_modelo"
+	auditMergeModels = "combinar_modelos"
+	auditShadow      = "sombra"
+	auditUnshadow    = "quitar_sombra"
+	auditPromote     = "promocion"
+	auditCanary      = "canario"
+	auditUncanary    = "quitar_canario"
+	auditRollback    = "rollback"
+	auditDrain       = "drenado"
+)
+
+// Línea del registro de auditoría
+type AuditRecord struct {
+	Time      time.Time      `json:"hora"`
+	User      string         `json:"usuario"`
+	Role      Role           `json:"perfil"`
+	Tenant    string         `json:"inquilino,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	Operation string         `json:"operacion"`
+	Target    string         `json:"objetivo"`           // Archivo o modelo afectado
+	Error     string         `json:"error,omitempty"`    // Vacío si la operación terminó bien
+	Details   map[string]any `json:"detalles,omitempty"` // Sumas, filas, hiperparámetros y métricas
+}
+
+// Registro de auditoría en un archivo de solo agregado
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Registro de auditoría del proceso (nil si no se audita)
+var auditLog *AuditLog
+
+// Función que abre (o crea) el registro de auditoría para agregar líneas
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{path: path, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Función que abre el registro indicado en TP_AUDITORIA, si lo hay
+func openAuditFromEnv() error {
+	path := os.Getenv("TP_AUDITORIA")
+	if path == "" {
+		return nil
+	}
+	audit, err := OpenAuditLog(path)
+	if err != nil {
+		return fmt.Errorf("registro de auditoría: %w", err)
+	}
+	auditLog = audit
+	return nil
+}
+
+// Función que agrega una línea al registro. Un registro nil no registra nada.
+func (a *AuditLog) Record(rec AuditRecord) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.enc.Encode(rec)
+}
+
+// Función para cerrar el archivo del registro
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// Función que registra una operación con el usuario, el perfil y el inquilino
+// de ctx (o los del proceso, fuera del servidor). Si no se puede escribir se
+// informa en el log: la operación ya ocurrió.
+func audit(ctx context.Context, operation, target string, opErr error, details map[string]any) {
+	if auditLog == nil {
+		return
+	}
+	rec := AuditRecord{
+		Time:      time.Now(),
+		User:      userFrom(ctx),
+		Role:      roleFrom(ctx),
+		RequestID: requestID(ctx),
+		Operation: operation,
+		Target:    target,
+		Details:   details,
+	}
+	if t := tenantFrom(ctx); t != nil {
+		rec.Tenant = t.Name
+	}
+	if opErr != nil {
+		rec.Error = opErr.Error()
+	}
+	if err := auditLog.Record(rec); err != nil {
+		log.Printf("No se pudo escribir el registro de auditoría: %v", err)
+	}
+}
+
+// Función que retorna el usuario de la petición o el del proceso
+func userFrom(ctx context.Context) string {
+	if name, ok := ctx.Value(userKey).(string); ok {
+		return name
+	}
+	return processUser()
+}
+
+// Función que retorna el usuario del sistema que ejecuta el proceso
+var processUser = sync.OnceValue(func() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+})
+
+// Función que describe el resumen de una carga
+func loadDetails(report LoadReport) map[string]any {
+	return map[string]any{"sha256": report.SHA256, "registros": report.Records, "filas_invalidas": report.Invalid}
+}
+
+// Función que describe los hiperparámetros y las métricas de un bosque entrenado
+func forestDetails(rf *RandomForest, requested int, elapsed time.Duration) map[string]any {
+	features := rf.Features
+	if features == nil {
+		features = defaultFeatures
+	}
+	return map[string]any{
+		"arboles_pedidos": requested,
+		"arboles":         len(rf.Trees),
+		"caracteristicas": strings.Join(features, ","),
+		"parada_temprana": rf.EarlyStopping.Enabled,
+		"error_oob":       rf.OOBError,
+		"segundos":        elapsed.Seconds(),
+	}
+}
+
+// Función que lee el registro de auditoría y retorna las últimas n líneas
+// (todas si n <= 0) de la operación indicada (todas si está vacía)
+func ReadAudit(path, operation string, n int) ([]AuditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if operation == "" || rec.Operation == operation {
+			records = append(records, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if n > 0 && len(records) > n {
+		records = records[len(records)-n:]
+	}
+	return records, nil
+}
+
+// Función que escribe las líneas de auditoría en forma legible
+func printAudit(w io.Writer, records []AuditRecord) {
+	if len(records) == 0 {
+		fmt.Fprintln(w, "No hay operaciones registradas.")
+		return
+	}
+	for _, rec := range records {
+		who := rec.User + " (" + string(rec.Role) + ")"
+		if rec.Tenant != "" {
+			who = rec.Tenant + "/" + who
+		}
+		result := "ok"
+		if rec.Error != "" {
+			result = "error: " + rec.Error
+		}
+		fmt.Fprintf(w, "%s  %-16s %-40s %s — %s\n", rec.Time.Local().Format("2006-01-02 15:04:05"), rec.Operation, rec.Target, who, result)
+
+		var parts []string
+		for _, key := range sortedKeys(rec.Details) {
+			parts = append(parts, fmt.Sprintf("%s=%v", key, rec.Details[key]))
+		}
+		if len(parts) > 0 {
+			fmt.Fprintf(w, "    %s\n", strings.Join(parts, " "))
+		}
+	}
+}
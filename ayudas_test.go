@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Función que escribe un CSV sintético de atenciones en un directorio temporal
+// y retorna su ruta
+func writeTestAttendances(t testing.TB, facilities, days int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "atenciones.csv")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	opts := GenerateOptions{Facilities: facilities, Days: days, Start: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Pattern: "weekly", Noise: 0.2, Seed: 7}
+	if _, err := GenerateAttendances(file, opts); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Función que carga los registros sintéticos de las pruebas: 6 establecimientos durante 120 días
+func loadAtencionesTest(t testing.TB) ([]Atencion, error) {
+	t.Helper()
+	data, err := loadAtenciones(context.Background(), writeTestAttendances(t, 6, 120))
+	if err == nil && len(data) != 6*120 {
+		t.Fatalf("registros cargados: %d, se esperaban %d", len(data), 6*120)
+	}
+	return data, err
+}
+
+// Función que carga registros sintéticos y entrena con ellos un bosque con semilla fija
+func trainTestForest(t testing.TB, trees int) (*RandomForest, []Atencion) {
+	t.Helper()
+	data, err := loadAtencionesTest(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf := &RandomForest{Seed: 1}
+	if err := rf.TrainTreesContext(context.Background(), data, trees); err != nil {
+		t.Fatal(err)
+	}
+	return rf, data
+}
+
+// Función que compara los votos de dos modelos sobre las consultas de todos los registros
+func assertSameVotes(t *testing.T, want, got Predictor, p *Pipeline, data []Atencion) {
+	t.Helper()
+	for _, att := range data {
+		query := queryAtencion(p, att.NombreEstablecimiento, att.Mes, att.Dia)
+		wv, wt := want.Vote(query)
+		gv, gt := got.Vote(query)
+		if wv != gv || wt != gt {
+			t.Fatalf("votos distintos para %s %d/%d: %d/%d, se esperaba %d/%d", att.NombreEstablecimiento, att.Dia, att.Mes, gv, gt, wv, wt)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// API para incrustar el predictor en otro servicio Go: cargar, entrenar,
+// evaluar, predecir y guardar con funciones exportadas que retornan errores.
+// Ninguna de ellas lee la entrada estándar ni escribe en la salida estándar;
+// los avisos de la carga y del entrenamiento (filas inválidas, memoria
+// limitada) van al paquete log, que el servicio puede redirigir con
+// log.SetOutput. El menú, los subcomandos y sus mensajes quedan fuera de esta
+// API. Para usarla desde otro módulo basta con copiar los archivos a un paquete
+// propio y quitar main.
+
+// Opciones del entrenamiento con Train
+type TrainOptions struct {
+	Trees         int           // Árboles a entrenar (obligatorio)
+	Features      []string      // Características que pueden usar los árboles (nil = las por defecto)
+	Threshold     int           // Atendidos a partir de los cuales hay congestión (0 = congestionThreshold)
+	Capacities    *Capacities   // Capacidad declarada de los establecimientos (nil = umbral fijo para todos)
+	Winsorize     float64       // Percentil al que se recortan los atendidos (0 = sin recorte)
+	RecencyDecay  float64       // Peso de cada año respecto del siguiente (0 = sin ponderar)
+	MaxParallel   int           // Árboles que se construyen a la vez (0 = los que quepan en memoria)
+	EarlyStopping EarlyStopping // Parada temprana por error OOB
+}
+
+// Métricas de una evaluación con Evaluate
+type Evaluation struct {
+	Records        int
+	TruePositives  int
+	FalsePositives int
+	TrueNegatives  int
+	FalseNegatives int
+	Accuracy       float64
+	Precision      float64
+	Recall         float64
+	F1             float64
+}
+
+// Predicción de un establecimiento en una fecha con Predict
+type Prediction struct {
+	Congested   bool
+	Probability float64 // Fracción de árboles que votan congestión
+	Votes       int
+	Trees       int
+	Fallback    string // Respaldo usado si el establecimiento no estaba en el entrenamiento ("" si estaba)
+	Caveat      string // Advertencia si los datos del establecimiento son de baja calidad
+}
+
+// Función que carga un CSV de atenciones (ruta local o URL) con las opciones dadas
+func LoadData(ctx context.Context, path string, opts LoadOptions) ([]Atencion, error) {
+	return loadAtencionesWith(ctx, path, opts)
+}
+
+// Función que entrena un bosque desde cero. Si ctx se cancela a mitad del
+// entrenamiento retorna el bosque con los árboles ya entrenados y la causa.
+func Train(ctx context.Context, data []Atencion, opts TrainOptions) (*RandomForest, error) {
+	if opts.Trees <= 0 {
+		return nil, errors.New("el número de árboles debe ser positivo")
+	}
+	if len(data) == 0 {
+		return nil, errors.New("no hay registros para entrenar")
+	}
+	if _, err := ParseFeatures(strings.Join(opts.Features, ",")); err != nil {
+		return nil, err
+	}
+	rf := &RandomForest{Features: opts.Features, Threshold: opts.Threshold, Capacities: opts.Capacities, Winsorize: opts.Winsorize,
+		RecencyDecay: opts.RecencyDecay, MaxParallel: opts.MaxParallel, EarlyStopping: opts.EarlyStopping}
+	err := rf.TrainTreesContext(ctx, data, opts.Trees)
+	if err != nil && len(rf.Trees) == 0 {
+		return nil, err
+	}
+	return rf, err
+}
+
+// Función que evalúa un modelo sobre registros con la congestión conocida.
+// Si ctx se cancela retorna las métricas de los registros evaluados y la causa.
+func Evaluate(ctx context.Context, model Predictor, data []Atencion) (*Evaluation, error) {
+	p := pipelineFor(model, nil)
+	if p == nil {
+		p = NewPipeline(data, nil) // Modelo antiguo: se imputa con los mismos registros
+	}
+	c, err := evaluateHoldoutContext(ctx, model, p, data, 0)
+	return &Evaluation{
+		Records:        c.Total(),
+		TruePositives:  c.TruePositives,
+		FalsePositives: c.FalsePositives,
+		TrueNegatives:  c.TrueNegatives,
+		FalseNegatives: c.FalseNegatives,
+		Accuracy:       c.Accuracy(),
+		Precision:      c.Precision(),
+		Recall:         c.Recall(),
+		F1:             c.F1(),
+	}, err
+}
+
+// Función que predice la congestión de un establecimiento en una fecha
+func Predict(model Predictor, establishment string, date time.Time) (Prediction, error) {
+	if model == nil || model.NumTrees() == 0 {
+		return Prediction{}, errors.New("el modelo no tiene árboles")
+	}
+	if establishment == "" {
+		return Prediction{}, errors.New("falta el establecimiento")
+	}
+	p := pipelineFor(model, nil)
+	if p == nil {
+		return Prediction{}, errors.New("el modelo no tiene pipeline: vuelve a entrenarlo")
+	}
+	r := predictBatch(model, p, []batchQuery{{Establishment: establishment, Month: int(date.Month()), Day: date.Day()}}, 1)[0]
+	return Prediction{Congested: r.Congested, Probability: ratio(r.Votes, r.Trees), Votes: r.Votes, Trees: r.Trees,
+		Fallback: r.Fallback, Caveat: r.Caveat}, nil
+}
+
+// Función que guarda un bosque (comprimido si la ruta termina en .gz); se
+// vuelve a abrir con OpenModel
+func SaveModel(rf *RandomForest, path string) error {
+	if rf == nil {
+		return errors.New("no hay modelo para guardar")
+	}
+	return rf.Save(path)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Bloques de la carga: en lugar de una goroutine por fila, el lector junta las
+// filas en bloques y cada bloque se valida en su goroutine. El tamaño se adapta
+// a lo que cuesta validar una fila: cada bloque terminado informa su duración y
+// el siguiente se dimensiona para tardar alrededor de targetChunkTime, así que
+// con filas baratas los bloques crecen y se reparte menos trabajo al planificador.
+// Si el archivo llega lento (disco o red lentos), un bloque se despacha igual
+// cuando pasaron maxChunkWait desde su primera fila, para que los registros no
+// esperen a que el bloque se llene.
+
+const (
+	minChunkRows    = 16                     // Filas mínimas de un bloque
+	maxChunkRows    = 8192                   // Filas máximas de un bloque
+	targetChunkTime = 500 * time.Microsecond // Duración buscada de la validación de un bloque
+	maxChunkWait    = 5 * time.Millisecond   // Espera máxima de la primera fila de un bloque
+)
+
+// Tamaño de bloque que se ajusta con la latencia observada
+type chunkSizer struct {
+	mu     sync.Mutex
+	fixed  bool    // Tamaño fijo elegido por el usuario
+	rows   int     // Tamaño del próximo bloque
+	perRow float64 // Promedio móvil de nanosegundos por fila (0 = sin medir)
+	chunks int     // Bloques despachados
+}
+
+// Función que crea el dimensionador; con fixed > 0 el tamaño no se adapta
+func newChunkSizer(fixed int) *chunkSizer {
+	if fixed > 0 {
+		return &chunkSizer{fixed: true, rows: fixed}
+	}
+	return &chunkSizer{rows: minChunkRows}
+}
+
+// Función que retorna el tamaño del próximo bloque y lo cuenta
+func (s *chunkSizer) next() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks++
+	return s.rows
+}
+
+// Función que registra lo que tardó un bloque y recalcula el tamaño. El
+// promedio móvil evita que un bloque aislado (por ejemplo, uno que esperó al
+// planificador) cambie el tamaño de golpe.
+func (s *chunkSizer) observe(rows int, elapsed time.Duration) {
+	if s.fixed || rows == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	perRow := float64(elapsed) / float64(rows)
+	if s.perRow == 0 {
+		s.perRow = perRow
+	} else {
+		s.perRow = 0.8*s.perRow + 0.2*perRow
+	}
+	s.rows = minChunkRows
+	if s.perRow > 0 {
+		s.rows = max(minChunkRows, min(maxChunkRows, int(float64(targetChunkTime)/s.perRow)))
+	}
+}
+
+// Función que retorna el tamaño actual y los bloques despachados, para el span
+func (s *chunkSizer) stats() (rows, chunks int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rows, s.chunks
+}
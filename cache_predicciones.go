@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Caché de predicciones del servidor: la misma consulta al mismo modelo da
+// siempre los mismos votos, así que se guardan por un tiempo. Con varias
+// réplicas detrás de un balanceador conviene un caché en Redis para que todas
+// compartan los aciertos. La clave incluye la huella del modelo, de modo que
+// publicar una versión nueva deja de usar las entradas de la anterior, que
+// vencen solas con el TTL.
+
+// Métrica del caché de predicciones
+var predictionCacheLookups = NewCounterVec("tp_cache_predicciones_total",
+	"Lecturas y escrituras del caché de predicciones por resultado (acierto, fallo o error)", "resultado")
+
+// Caché de votos por consulta
+type PredictionCache interface {
+	Get(ctx context.Context, key string) (votes, total int, ok bool)
+	Set(ctx context.Context, key string, votes, total int)
+	Close() error
+}
+
+// Función que crea el caché indicado en -cache: "memoria[:entradas]" o una URL
+// redis:// o rediss://. Vacío es sin caché (retorna nil).
+func NewPredictionCache(spec string, ttl time.Duration) (PredictionCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("TTL del caché inválido: %v", ttl)
+	}
+	switch {
+	case spec == "":
+		return nil, nil
+	case spec == "memoria" || strings.HasPrefix(spec, "memoria:"):
+		size := 100_000
+		if _, n, ok := strings.Cut(spec, ":"); ok {
+			var err error
+			if size, err = strconv.Atoi(n); err != nil || size <= 0 {
+				return nil, fmt.Errorf("tamaño del caché inválido: %s", n)
+			}
+		}
+		return &memoryCache{entries: make(map[string]cachedVotes), size: size, ttl: ttl}, nil
+	case strings.HasPrefix(spec, "redis://") || strings.HasPrefix(spec, "rediss://"):
+		client, err := newRedisClient(spec)
+		if err != nil {
+			return nil, err
+		}
+		return &redisCache{client: client, ttl: ttl}, nil
+	}
+	return nil, fmt.Errorf("caché desconocido %q (memoria[:entradas] o redis://host:puerto)", spec)
+}
+
+// Función que arma la clave de una consulta: inquilino, modelo, huella del
+// modelo y la atención ya preprocesada
+func predictionCacheKey(tenant string, entry *ModelEntry, att Atencion) string {
+	return fmt.Sprintf("tp:prediccion:%s:%s:%s:%s:%d:%d",
+		tenant, entry.Name, entry.Fingerprint, att.NombreEstablecimiento, att.Mes, att.Dia)
+}
+
+// Votos guardados y su vencimiento
+type cachedVotes struct {
+	votes, total int
+	expires      time.Time
+}
+
+// Caché en la memoria del proceso, para una sola réplica
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedVotes
+	size    int // Entradas como máximo
+	ttl     time.Duration
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (int, int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		predictionCacheLookups.Inc("fallo")
+		return 0, 0, false
+	}
+	predictionCacheLookups.Inc("acierto")
+	return entry.votes, entry.total, true
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, votes, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		// Lleno: se descartan las vencidas y, si no alcanza, una cualquiera
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedVotes{votes: votes, total: total, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *memoryCache) Close() error { return nil }
+
+// Caché compartido en Redis. Si Redis no responde las predicciones se calculan
+// igual: el caché solo ahorra trabajo.
+type redisCache struct {
+	client *redisClient
+	ttl    time.Duration
+	down   atomic.Bool // Indica si el último comando falló, para avisar solo en los cambios
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) (int, int, bool) {
+	reply, err := c.client.do(ctx, "GET", key)
+	if c.failed(err) {
+		return 0, 0, false
+	}
+	value, ok := reply.(string)
+	if !ok {
+		predictionCacheLookups.Inc("fallo")
+		return 0, 0, false
+	}
+	v, t, _ := strings.Cut(value, "/") // "votos/total"
+	votes, err1 := strconv.Atoi(v)
+	total, err2 := strconv.Atoi(t)
+	if err1 != nil || err2 != nil {
+		predictionCacheLookups.Inc("fallo")
+		return 0, 0, false
+	}
+	predictionCacheLookups.Inc("acierto")
+	return votes, total, true
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, votes, total int) {
+	value := strconv.Itoa(votes) + "/" + strconv.Itoa(total)
+	_, err := c.client.do(ctx, "SET", key, value, "PX", strconv.FormatInt(c.ttl.Milliseconds(), 10))
+	c.failed(err)
+}
+
+func (c *redisCache) Close() error {
+	return c.client.Close()
+}
+
+// Función que registra el resultado de un comando y avisa cuando Redis deja de
+// responder o vuelve a hacerlo. Retorna true si el comando falló.
+func (c *redisCache) failed(err error) bool {
+	if err != nil {
+		predictionCacheLookups.Inc("error")
+		if !c.down.Swap(true) {
+			log.Printf("Caché de predicciones no disponible, se calculan sin caché: %v", err)
+		}
+		return true
+	}
+	if c.down.Swap(false) {
+		log.Println("Caché de predicciones disponible de nuevo")
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expansión de un rango de fechas para predict-batch: en lugar de leer las
+// consultas de un CSV se generan todas las fechas entre -desde y -hasta para
+// cada establecimiento, y cada fila de salida lleva su día de la semana y si es
+// feriado o parte de un feriado largo, para que los tableros agrupen por tipo de
+// día sin volver a armar el calendario. Los feriados se leen de un CSV con las
+// columna fecha (AAAA-MM-DD); las demás se ignoran. Un feriado largo es una
+// racha de al menos tres días no laborables (fin de semana o feriado) que
+// incluye algún feriado.
+
+// Formato de las fechas del rango y del CSV de feriados
+const dateLayout = "2006-01-02"
+
+// Formato de las fechas que se escriben en el menú: dd/mm/aaaa, como en Perú
+// (el día y el mes pueden ir sin cero adelante)
+const localDateLayout = "2/1/2006"
+
+// Días no laborables seguidos a partir de los cuales hay un feriado largo
+const longHolidayDays = 3
+
+// Columnas de calendario que se agregan a la salida al expandir un rango
+var calendarOutputColumns = []string{"fecha", "dia_semana", "feriado", "feriado_largo"}
+
+// Calendario de feriados
+type Calendar struct {
+	holidays map[string]bool // Fechas de los feriados
+}
+
+// Etiquetas de calendario de una fecha
+type dateTags struct {
+	Date        time.Time
+	Holiday     bool
+	LongHoliday bool
+}
+
+// Función que lee el CSV de feriados (ruta vacía = calendario sin feriados)
+func loadHolidays(path string) (*Calendar, error) {
+	c := &Calendar{holidays: make(map[string]bool)}
+	if path == "" {
+		return c, nil
+	}
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera de %s: %w", path, err)
+	}
+	dateColumn := -1
+	for i, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), "fecha") {
+			dateColumn = i
+		}
+	}
+	if dateColumn < 0 {
+		return nil, errors.New("la cabecera de los feriados debe tener la columna fecha")
+	}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if dateColumn >= len(row) {
+			return nil, fmt.Errorf("línea %d: falta la fecha", line)
+		}
+		date, err := time.Parse(dateLayout, strings.TrimSpace(row[dateColumn]))
+		if err != nil {
+			return nil, fmt.Errorf("línea %d: fecha inválida %q", line, row[dateColumn])
+		}
+		c.holidays[date.Format(dateLayout)] = true
+	}
+}
+
+// Función que interpreta una fecha dd/mm/aaaa (también con guiones o puntos)
+// y rechaza las que no existen en el calendario, como el 31/02
+func parseLocalDate(text string) (time.Time, error) {
+	text = strings.NewReplacer("-", "/", ".", "/").Replace(strings.TrimSpace(text))
+	date, err := time.Parse(localDateLayout, text)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fecha inválida %q: escribe una fecha que exista en el formato dd/mm/aaaa", text)
+	}
+	return date, nil
+}
+
+// Indica si la fecha es feriado
+func (c *Calendar) IsHoliday(date time.Time) bool {
+	return c.holidays[date.Format(dateLayout)]
+}
+
+// Indica si la fecha no es laborable: fin de semana o feriado
+func (c *Calendar) nonWorking(date time.Time) bool {
+	weekday := date.Weekday()
+	return weekday == time.Saturday || weekday == time.Sunday || c.IsHoliday(date)
+}
+
+// Función que etiqueta una fecha. Para el feriado largo se recorre la racha de
+// días no laborables que la contiene hacia ambos lados.
+func (c *Calendar) Tag(date time.Time) dateTags {
+	tags := dateTags{Date: date, Holiday: c.IsHoliday(date)}
+	if !c.nonWorking(date) {
+		return tags
+	}
+	first, last := date, date
+	for c.nonWorking(first.AddDate(0, 0, -1)) {
+		first = first.AddDate(0, 0, -1)
+	}
+	for c.nonWorking(last.AddDate(0, 0, 1)) {
+		last = last.AddDate(0, 0, 1)
+	}
+	if int(last.Sub(first).Hours()/24)+1 < longHolidayDays {
+		return tags
+	}
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		if c.IsHoliday(d) {
+			tags.LongHoliday = true
+			break
+		}
+	}
+	return tags
+}
+
+// Columnas de calendario de una fila de salida
+func (t *dateTags) record() []string {
+	return []string{
+		t.Date.Format(dateLayout),
+		weekdayNames[t.Date.Weekday()],
+		strconv.FormatBool(t.Holiday),
+		strconv.FormatBool(t.LongHoliday),
+	}
+}
+
+// Consultas generadas a partir de un rango de fechas, en el orden fecha por
+// fecha y, dentro de cada fecha, establecimiento por establecimiento
+type rangeQueries struct {
+	calendar       *Calendar
+	establishments []string
+	date           time.Time // Fecha de la próxima consulta
+	tags           dateTags  // Etiquetas de date, calculadas una vez por fecha
+	index          int       // Establecimiento de la próxima consulta
+	last           time.Time
+}
+
+// Función que interpreta el rango y arma el generador de consultas
+func newRangeQueries(from, to string, establishments []string, calendar *Calendar) (*rangeQueries, error) {
+	start, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return nil, fmt.Errorf("fecha -desde inválida %q (AAAA-MM-DD)", from)
+	}
+	end, err := time.Parse(dateLayout, to)
+	if err != nil {
+		return nil, fmt.Errorf("fecha -hasta inválida %q (AAAA-MM-DD)", to)
+	}
+	if end.Before(start) {
+		return nil, errors.New("-hasta es anterior a -desde")
+	}
+	if len(establishments) == 0 {
+		return nil, errors.New("no hay establecimientos para el rango: indícalos con -establecimientos")
+	}
+	return &rangeQueries{calendar: calendar, establishments: establishments, date: start, tags: calendar.Tag(start), last: end}, nil
+}
+
+// Función que genera hasta n consultas; retorna io.EOF cuando no quedan más
+func (rq *rangeQueries) next(n int) ([]batchQuery, error) {
+	var queries []batchQuery
+	for len(queries) < n && !rq.date.After(rq.last) {
+		tags := rq.tags
+		queries = append(queries, batchQuery{
+			Establishment: rq.establishments[rq.index],
+			Month:         int(rq.date.Month()),
+			Day:           rq.date.Day(),
+			Tags:          &tags,
+		})
+		if rq.index++; rq.index == len(rq.establishments) {
+			rq.index, rq.date = 0, rq.date.AddDate(0, 0, 1)
+			rq.tags = rq.calendar.Tag(rq.date)
+		}
+	}
+	if len(queries) == 0 {
+		return nil, io.EOF
+	}
+	return queries, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// Calidad de los datos por establecimiento: un puntaje entre 0 y 1 que resume
+// tres problemas que hacen menos confiables las predicciones de un
+// establecimiento aunque el modelo sea bueno en general:
+//
+//   - cobertura: fracción de las fechas de los datos en las que reportó
+//     (un establecimiento con huecos o que dejó de reportar tiene menos);
+//   - duplicados: fracción de sus registros que repiten una fecha ya reportada;
+//   - atípicos: fracción de registros con más atendidos que atenciones o con
+//     atendidos lejos de su mediana (z modificado, con la MAD, mayor que 3.5).
+//
+// El puntaje es cobertura × (1 − duplicados) × (1 − atípicos). Se calcula al
+// entrenar, con los datos sin recortar, y se guarda en el pipeline para
+// advertirlo en las predicciones de los establecimientos con puntaje bajo.
+
+// Puntaje por debajo del cual se advierte en las predicciones
+const lowQualityScore = 0.8
+
+// Advertencia de las predicciones de un establecimiento con datos de baja calidad
+const lowQualityCaveat = "datos de baja calidad para este establecimiento"
+
+// Z modificado a partir del cual un valor es atípico (Iglewicz y Hoaglin)
+const outlierZScore = 3.5
+
+// Calidad de los datos de un establecimiento
+type dataQuality struct {
+	Score      float64 `json:"puntaje"`
+	Coverage   float64 `json:"cobertura"`
+	Duplicates float64 `json:"duplicados"`
+	Outliers   float64 `json:"atipicos"`
+}
+
+// Función que calcula la calidad de los datos de cada establecimiento, por
+// nombre normalizado, repartiendo los establecimientos entre varias goroutines
+func assessQuality(data []Atencion) map[string]dataQuality {
+	groups := make(map[string][]Atencion)
+	dates := make(map[recordDate]bool)
+	for _, att := range data {
+		name := normalizeEstablishment(att.NombreEstablecimiento)
+		groups[name] = append(groups[name], att)
+		dates[recordDate{att.Anio, att.Mes, att.Dia}] = true
+	}
+	names := sortedKeys(groups)
+	scores := make([]dataQuality, len(names))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(names)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				scores[i] = rowsQuality(groups[names[i]], len(dates))
+			}
+		}()
+	}
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	quality := make(map[string]dataQuality, len(names))
+	for i, name := range names {
+		quality[name] = scores[i]
+	}
+	return quality
+}
+
+// Función que calcula la calidad de los registros de un establecimiento;
+// totalDates es la cantidad de fechas distintas de todos los datos
+func rowsQuality(rows []Atencion, totalDates int) dataQuality {
+	seen := make(map[recordDate]bool, len(rows))
+	duplicates := 0
+	attended := make([]float64, len(rows))
+	for i, att := range rows {
+		date := recordDate{att.Anio, att.Mes, att.Dia}
+		if seen[date] {
+			duplicates++
+		}
+		seen[date] = true
+		attended[i] = float64(att.Atendidos)
+	}
+
+	slices.Sort(attended)
+	median := percentile(attended, 0.5)
+	deviations := make([]float64, len(attended))
+	for i, v := range attended {
+		deviations[i] = math.Abs(v - median)
+	}
+	slices.Sort(deviations)
+	mad := percentile(deviations, 0.5)
+	outliers := 0
+	for _, att := range rows {
+		inconsistent := att.Atendidos > att.Atenciones
+		far := mad > 0 && 0.6745*math.Abs(float64(att.Atendidos)-median)/mad > outlierZScore
+		if inconsistent || far {
+			outliers++
+		}
+	}
+
+	q := dataQuality{
+		Coverage:   ratio(len(seen), totalDates),
+		Duplicates: ratio(duplicates, len(rows)),
+		Outliers:   ratio(outliers, len(rows)),
+	}
+	q.Score = q.Coverage * (1 - q.Duplicates) * (1 - q.Outliers)
+	return q
+}
+
+// Función que retorna la advertencia de calidad para las predicciones del
+// establecimiento ("" si sus datos son buenos o no se conoce su calidad)
+func (p *Pipeline) Caveat(establishment string) string {
+	if p == nil || p.Quality == nil {
+		return ""
+	}
+	if q, ok := p.Quality[normalizeEstablishment(establishment)]; ok && q.Score < lowQualityScore {
+		return lowQualityCaveat
+	}
+	return ""
+}
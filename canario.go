@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Despliegue en canario: a diferencia del modo sombra, el candidato responde de
+// verdad una parte del tráfico. La consulta (establecimiento, mes y día) decide
+// por hash qué modelo la atiende, así la misma consulta recibe siempre la misma
+// respuesta y todas las réplicas reparten igual. Las predicciones quedan en el
+// historial con su variante para compararlas después con los datos reales
+// (reconcile), y el reporte compara en vivo la tasa de congestión predicha y
+// la latencia de ambos modelos antes de promover.
+
+// Predicciones atendidas por el canario
+var canaryPredictions = NewCounterVec("tp_canario_predicciones_total",
+	"Predicciones por variante mientras hay un canario", "modelo", "variante")
+
+// Variante que se registra en el historial para las predicciones del canario
+const canaryVariant = "canario"
+
+// Modelo candidato que atiende un porcentaje de las predicciones
+type Canary struct {
+	Entry *ModelEntry // Modelo candidato
+	Since time.Time   // Momento en que empezó el canario
+
+	percent atomic.Int64 // Porcentaje del tráfico en centésimas (0 a 10000)
+
+	mu     sync.Mutex
+	stable variantStats // Predicciones del modelo principal mientras dura el canario
+	canary variantStats // Predicciones del candidato
+}
+
+// Predicciones de una variante
+type variantStats struct {
+	predictions int
+	congested   int
+	latency     []float64 // Últimas latencias (segundos)
+}
+
+// Criterios para considerar que un canario es seguro de promover
+type CanaryPolicy struct {
+	MinPredictions    int     // Predicciones mínimas del candidato antes de decidir
+	MaxRateDifference float64 // Diferencia máxima entre las tasas de congestión predichas
+	MaxLatencyRatio   float64 // Máximo p95 del candidato respecto del principal
+}
+
+// Función que convierte un porcentaje en centésimas, limitado a 0-100
+func percentToBasisPoints(percent float64) int64 {
+	return int64(math.Round(min(100, max(0, percent)) * 100))
+}
+
+// Función que retorna el porcentaje del tráfico que atiende el canario
+func (c *Canary) Percent() float64 {
+	return float64(c.percent.Load()) / 100
+}
+
+// Función que cambia el porcentaje del tráfico sin reemplazar el candidato
+func (c *Canary) SetPercent(percent float64) {
+	c.percent.Store(percentToBasisPoints(percent))
+}
+
+// Función que decide por hash de la consulta si la atiende el canario
+func (c *Canary) routes(att Atencion) bool {
+	h := fnv.New32a()
+	h.Write([]byte(att.NombreEstablecimiento + "|" + strconv.Itoa(att.Mes) + "|" + strconv.Itoa(att.Dia)))
+	return int64(h.Sum32()%10000) < c.percent.Load()
+}
+
+// Función que registra una predicción atendida por una de las variantes
+func (c *Canary) record(candidate, congested bool, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := &c.stable
+	if candidate {
+		stats = &c.canary
+	}
+	stats.predictions++
+	if congested {
+		stats.congested++
+	}
+	stats.latency = appendWindow(stats.latency, latency.Seconds())
+}
+
+// Resumen de una variante en el reporte
+type VariantReport struct {
+	Predictions   int     `json:"predicciones"`
+	CongestedRate float64 `json:"tasa_congestion"`
+	P50Ms         float64 `json:"p50_ms"`
+	P95Ms         float64 `json:"p95_ms"`
+}
+
+// Función que resume las predicciones de una variante (con el lock tomado)
+func (v *variantStats) report() VariantReport {
+	latency := append([]float64(nil), v.latency...)
+	sort.Float64s(latency)
+	r := VariantReport{Predictions: v.predictions, P50Ms: percentile(latency, 0.50) * 1000, P95Ms: percentile(latency, 0.95) * 1000}
+	if v.predictions > 0 {
+		r.CongestedRate = float64(v.congested) / float64(v.predictions)
+	}
+	return r
+}
+
+// Resumen del canario
+type CanaryReport struct {
+	Model          string        `json:"modelo"`
+	Candidate      string        `json:"candidato"`
+	Percent        float64       `json:"porcentaje"`
+	Since          time.Time     `json:"desde"`
+	Stable         VariantReport `json:"principal"`
+	Canary         VariantReport `json:"canario"`
+	RateDifference float64       `json:"diferencia_tasa"` // Tasa del canario menos la del principal
+	SafeToPromote  bool          `json:"seguro_promover"`
+	Reason         string        `json:"motivo"`
+}
+
+// Función que compara ambas variantes y decide si el candidato puede promoverse
+func (c *Canary) Report(model string, policy CanaryPolicy) CanaryReport {
+	c.mu.Lock()
+	report := CanaryReport{
+		Model:     model,
+		Candidate: c.Entry.Source,
+		Percent:   c.Percent(),
+		Since:     c.Since,
+		Stable:    c.stable.report(),
+		Canary:    c.canary.report(),
+	}
+	c.mu.Unlock()
+	report.RateDifference = report.Canary.CongestedRate - report.Stable.CongestedRate
+
+	switch {
+	case report.Canary.Predictions < policy.MinPredictions:
+		report.Reason = fmt.Sprintf("faltan predicciones del canario: %d de %d", report.Canary.Predictions, policy.MinPredictions)
+	case math.Abs(report.RateDifference) > policy.MaxRateDifference:
+		report.Reason = fmt.Sprintf("la tasa de congestión predicha difiere en %.3f (máximo %.3f)", report.RateDifference, policy.MaxRateDifference)
+	case report.Stable.P95Ms > 0 && report.Canary.P95Ms > policy.MaxLatencyRatio*report.Stable.P95Ms:
+		report.Reason = fmt.Sprintf("latencia p95 del canario %.3fms frente a %.3fms", report.Canary.P95Ms, report.Stable.P95Ms)
+	default:
+		report.SafeToPromote = true
+		report.Reason = "el canario cumple los criterios"
+	}
+	return report
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Congestión relativa a la capacidad: un umbral fijo de 20 atendidos no sirve
+// igual para un centro de salud chico que para un hospital. Con un CSV de
+// metadatos de los establecimientos (columnas establecimiento y capacidad) un
+// día está congestionado si Atendidos > α·capacidad; los establecimientos sin
+// capacidad declarada siguen con el umbral fijo. Las hojas de los árboles
+// predicen congestión si la carga promedio (atendidos sobre el umbral de cada
+// establecimiento) supera 1, que con el umbral fijo es lo mismo que antes.
+
+// Fracción de la capacidad por defecto
+const defaultCapacityFactor = 1.0
+
+// Capacidades declaradas, guardadas en el pipeline
+type Capacities struct {
+	Factor   float64        // α: fracción de la capacidad a partir de la cual hay congestión
+	Declared map[string]int // Nombre normalizado -> capacidad declarada (pacientes por día)
+}
+
+// Función que lee el CSV de metadatos. Las columnas se ubican por la cabecera
+// y las demás se ignoran.
+func loadCapacities(path string, factor float64) (*Capacities, error) {
+	if factor <= 0 {
+		return nil, fmt.Errorf("fracción de la capacidad inválida: %g", factor)
+	}
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera de %s: %w", path, err)
+	}
+	name, capacity := -1, -1
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "establecimiento", "nombre_establecimiento":
+			name = i
+		case "capacidad":
+			capacity = i
+		}
+	}
+	if name < 0 || capacity < 0 {
+		return nil, errors.New("la cabecera de los metadatos debe tener las columnas establecimiento y capacidad")
+	}
+
+	c := &Capacities{Factor: factor, Declared: make(map[string]int)}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(row[capacity]))
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("línea %d: capacidad inválida %q", line, row[capacity])
+		}
+		c.Declared[normalizeEstablishment(row[name])] = value
+	}
+	if len(c.Declared) == 0 {
+		return nil, fmt.Errorf("%s no declara ninguna capacidad", path)
+	}
+	return c, nil
+}
+
+// Función que retorna los atendidos a partir de los cuales un día del
+// establecimiento está congestionado: α·capacidad o, sin capacidad declarada,
+// el umbral fijo del pipeline
+func (p *Pipeline) Limit(establishment string) float64 {
+	if p.Capacities != nil {
+		if capacity, ok := p.Capacities.Declared[normalizeEstablishment(establishment)]; ok {
+			return p.Capacities.Factor * float64(capacity)
+		}
+	}
+	return float64(p.CongestionThreshold)
+}
+
+// Función que retorna el umbral entero equivalente a Limit: como Atendidos es
+// entero, superar α·capacidad es lo mismo que superar su parte entera
+func (p *Pipeline) ThresholdFor(establishment string) int {
+	return int(math.Floor(p.Limit(establishment)))
+}
+
+// Función que retorna el umbral por establecimiento para las hojas de los
+// árboles, o nil si todos usan el umbral fijo
+func (p *Pipeline) limitFunc() func(string) float64 {
+	if p.Capacities == nil {
+		return nil
+	}
+	return p.Limit
+}
+
+// Función que combina las capacidades de dos pipelines: ante un mismo
+// establecimiento gana el primero. La fracción tiene que coincidir.
+func (c *Capacities) merge(other *Capacities) (*Capacities, error) {
+	if c == nil {
+		return other, nil
+	}
+	if other == nil {
+		return c, nil
+	}
+	if c.Factor != other.Factor {
+		return nil, fmt.Errorf("fracción de la capacidad %g distinta de %g", other.Factor, c.Factor)
+	}
+	merged := &Capacities{Factor: c.Factor, Declared: make(map[string]int, len(c.Declared))}
+	for _, source := range []*Capacities{other, c} {
+		for name, capacity := range source.Declared {
+			merged.Declared[name] = capacity
+		}
+	}
+	return merged, nil
+}
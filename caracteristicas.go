@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Columnas numéricas de Atencion sobre las que los árboles pueden dividir; a
+// estas se suman las características propias registradas (ver extensiones.go)
+var availableFeatures = []string{"Mes", "Dia", "Atendidos", "Atenciones", "Grupo", "Anio", "Citas"}
+
+// Características que se conocen al momento de predecir. Atendidos y Atenciones
+// solo se saben después del día consultado (Atendidos es además la etiqueta), por
+// lo que en una consulta valen cero y un árbol que divide por ellas sesga su voto.
+// Grupo depende solo del establecimiento y lo completa el pipeline; Anio, si la
+// consulta no lo trae, es el último año de los datos. Citas sale de la agenda
+// del día consultado (ver citas.go).
+var predictTimeFeatures = map[string]bool{"Mes": true, "Dia": true, "Grupo": true, "Anio": true, "Citas": true}
+
+// Características que usan los árboles cuando no se elige ninguna
+var defaultFeatures = []string{"Mes", "Dia"}
+
+// Función que interpreta una lista de características separadas por comas,
+// por ejemplo "Mes,Dia". Cada nombre se valida contra las columnas disponibles
+// y las características registradas sin distinguir mayúsculas. Una lista vacía retorna nil, que equivale a las
+// características por defecto; "todas" incluye también las de solo entrenamiento.
+func ParseFeatures(list string) ([]string, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil, nil
+	}
+	available := registeredFeatures()
+	if strings.EqualFold(list, "todas") {
+		return available, nil
+	}
+
+	var features []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		canonical := ""
+		for _, candidate := range available {
+			if strings.EqualFold(name, candidate) {
+				canonical = candidate
+				break
+			}
+		}
+		if canonical == "" {
+			return nil, fmt.Errorf("característica desconocida %q (disponibles: %s)", name, strings.Join(available, ", "))
+		}
+		if seen[canonical] {
+			return nil, fmt.Errorf("característica repetida %q", canonical)
+		}
+		seen[canonical] = true
+		features = append(features, canonical)
+	}
+	if len(features) == 0 {
+		return nil, errors.New("no se indicó ninguna característica")
+	}
+	return features, nil
+}
+
+// Función que retorna las características de la lista que no se conocen al predecir
+func trainOnlyFeatures(features []string) []string {
+	var trainOnly []string
+	for _, name := range features {
+		if _, custom := customFeature(name); !predictTimeFeatures[name] && !custom {
+			trainOnly = append(trainOnly, name)
+		}
+	}
+	return trainOnly
+}
+
+// Modelo que puede informar por qué características dividen sus árboles
+type featureUser interface {
+	UsedFeatures() []string
+}
+
+// Función que retorna las características por las que divide algún árbol del bosque
+func (rf *RandomForest) UsedFeatures() []string {
+	used := make(map[string]bool)
+	visited := make(map[*Node]bool) // Los modelos cargados comparten subárboles
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		if node == nil || node.IsLeaf || visited[node] {
+			return
+		}
+		visited[node] = true
+		used[node.Feature] = true
+		walk(node.Left)
+		walk(node.Right)
+	}
+	for _, tree := range rf.Trees {
+		walk(tree.Root)
+	}
+	return sortedKeys(used)
+}
+
+// Función que retorna las características por las que divide algún nodo del bosque plano
+func (ff *FlatForest) UsedFeatures() []string {
+	used := make(map[string]bool)
+	for i := 0; i < ff.numNodes; i++ {
+		node := ff.data[ff.nodesOff+flatNodeSize*i:]
+		if node[1]&flatLeaf == 0 && int(node[0]) < len(ff.names) {
+			used[ff.names[node[0]]] = true
+		}
+	}
+	return sortedKeys(used)
+}
+
+// Función que verifica que el modelo no dependa de características que no se
+// conocen al predecir. Retorna un error que las enumera si las hay y no hay
+// un pipeline con promedios históricos con los que imputarlas.
+func checkLeakage(model Predictor, p *Pipeline) error {
+	user, ok := model.(featureUser)
+	if !ok || (p != nil && p.Imputer != nil) {
+		return nil
+	}
+	if trainOnly := trainOnlyFeatures(user.UsedFeatures()); len(trainOnly) > 0 {
+		return fmt.Errorf("el modelo divide por características que no se conocen al predecir: %s", strings.Join(trainOnly, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Función que lee un archivo CSV de atenciones y convierte cada fila en una
+// Atencion. Los registros se validan por bloques, cada uno en su propia
+// goroutine, con un tamaño que se adapta a la velocidad de la validación.
+func loadAtenciones(ctx context.Context, path string) ([]Atencion, error) {
+	return loadAtencionesWith(ctx, path, LoadOptions{})
+}
+
+// Opciones de la carga de un CSV de atenciones
+type LoadOptions struct {
+	Check    InputCheck          // Suma SHA-256 y esquema esperados (vacío = sin verificar)
+	Ingest   IngestOptions       // Tamaño del canal de registros y política de desborde
+	Sinks    []RecordSink        // Destinos que reciben también cada registro válido
+	Report   *LoadReport         // Si no es nil, se completa con la suma del archivo y las filas leídas
+	Year     int                 // Año de los registros si el archivo no tiene columna ANIO (0 = desconocido)
+	Strategy concurrencyStrategy // Cómo se validan los bloques de filas (ver estrategias.go)
+	Monitor  *pipelineMonitor    // Si no es nil, mide las esperas en los canales de la carga
+	// Si no es nil, recibe los registros de cada bloque desde las goroutines de validación
+	Aggregator establishmentAggregator
+}
+
+// Resumen de una carga, para la auditoría
+type LoadReport struct {
+	SHA256  string // Suma SHA-256 del archivo leído
+	Records int    // Registros válidos
+	Invalid int64  // Filas descartadas por la validación (0 si se leyó la instantánea)
+	Schema  int    // Versión de esquema de la cabecera (0 = desconocida o leída de la instantánea)
+}
+
+// Igual que loadAtenciones, con opciones. Si opts.Check lo indica, verifica la
+// cabecera y la suma SHA-256 del archivo y lo rechaza completo si no coinciden.
+// Si path es un patrón, carga y concatena todos los archivos que coinciden.
+func loadAtencionesWith(ctx context.Context, path string, opts LoadOptions) (atenciones []Atencion, err error) {
+	if isGlob(path) {
+		return loadAtencionesGlob(ctx, path, opts) // Varios archivos, p. ej. uno por mes
+	}
+	check := opts.Check
+	ctx, span := startSpan(ctx, "cargar_datos")
+	span.SetAttr("archivo", path)
+	defer func() {
+		span.SetAttr("registros", len(atenciones))
+		span.SetError(err)
+		span.End()
+	}()
+
+	// Los destinos adicionales se cierran siempre, sabiendo si la carga falló
+	fan := newFanOut(opts.Sinks)
+	defer func() {
+		if sinkErr := fan.close(opts.Sinks, err); sinkErr != nil && err == nil {
+			atenciones, err = nil, sinkErr
+		}
+	}()
+
+	// Abrir el archivo CSV que contiene los registros (local, s3://, gs:// o http(s)://)
+	file, err := openInput(ctx, path)
+	if err != nil {
+		return nil, err // Manejar error si no se puede abrir el archivo
+	}
+	defer file.Close() // Asegurarse de cerrar el archivo al final
+
+	hashed, sum := check.hashReader(file, opts.Report != nil) // Calcular la suma mientras se lee, si se pidió
+	// Un archivo comprimido con gzip (p. ej. .csv.gz) se descomprime al leerlo;
+	// la suma sigue siendo la del archivo tal como está guardado
+	plain, err := decompressIfNeeded(bufio.NewReaderSize(hashed, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera: %w", err)
+	}
+	reader := newRowReader(plain) // Lector de filas sin asignaciones (ver lectura_rapida.go)
+
+	// Leer y verificar la cabecera del CSV
+	headerRow, err := reader.next()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera: %w", err)
+	}
+	header, err := parseCSVRow(headerRow)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera: %w", err)
+	}
+	if err := check.verifyHeader(header); err != nil {
+		return nil, err
+	}
+	mapper, version := mapperFor(header) // Dónde está cada campo según la versión del esquema
+	mapper.year = opts.Year
+	span.SetAttr("esquema", version)
+	if version == 0 {
+		log.Printf("Cabecera desconocida %q en %s: se leen las columnas de la versión %d del esquema", strings.Join(header, ","), path, defaultSchemaVersion)
+	}
+
+	var wg sync.WaitGroup                             // Grupo de espera para sincronizar goroutines
+	dataChannel, err := newIngestChannel(opts.Ingest) // Canal para enviar datos de atención procesados
+	if err != nil {
+		return nil, err
+	}
+	// Los bloques entregan sus registros de a uno por vez (ver ordered), así que hay un solo productor
+	recordsProbe := opts.Monitor.channel("validación", "recolección de registros", cap(dataChannel.Out), 1, 1).toCollector()
+	var invalid atomic.Int64 // Filas descartadas por la validación
+	_, validateSpan := startSpan(ctx, "validar_registros")
+
+	// Goroutine para leer registros del CSV y repartirlos en bloques, validados
+	// según la estrategia: por defecto cada uno en su propia goroutine. Se
+	// detiene si se cancela el contexto; las goroutines de los bloques terminan
+	// porque el canal se sigue vaciando hasta que se cierra.
+	sizer := newChunkSizer(opts.Ingest.ChunkRows)
+	names := newNameInterner()
+	beat := heartbeatFrom(ctx) // Cada bloque leído es un avance para la vigilancia del demonio
+	var readErr error          // Error de lectura distinto del fin del archivo; se lee después de cerrar el canal
+	go func() {
+		validate := func(chunk *rowChunk) []Atencion {
+			// Se mide solo la validación: la espera por un canal lleno no
+			// depende del tamaño del bloque
+			start := time.Now()
+			parsed := make([]Atencion, 0, chunk.len())
+			for i := 0; i < chunk.len(); i++ {
+				data, err := parseRow(chunk.row(i), mapper, names)
+				switch {
+				case err == nil:
+					parsed = append(parsed, data)
+				case err == errShortRow:
+					// Mostrar mensaje de error para fila inválida
+					log.Printf("Fila inválida: %s", chunk.row(i))
+					invalid.Add(1)
+				case err == errInvalidNumber:
+					invalid.Add(1) // Ya se informó cuál número
+				default:
+					log.Print(err)
+					invalid.Add(1)
+				}
+			}
+			sizer.observe(chunk.len(), time.Since(start))
+			chunk.release()
+			if opts.Aggregator != nil {
+				opts.Aggregator.add(parsed)
+			}
+			return parsed
+		}
+		send := func(parsed []Atencion) {
+			for _, data := range parsed {
+				sendProbed(recordsProbe, dataChannel.In, data) // Enviar el objeto Atencion al canal
+			}
+		}
+		// Los bloques validados en paralelo esperan el turno del anterior para
+		// enviar sus registros, así todos llegan en el orden del archivo
+		turn := make(chan struct{})
+		close(turn)
+		ordered := func(chunk *rowChunk) func() {
+			prev, done := turn, make(chan struct{})
+			turn = done
+			return func() {
+				parsed := validate(chunk)
+				<-prev
+				send(parsed)
+				close(done)
+			}
+		}
+
+		var handle func(chunk *rowChunk) // Valida el bloque y envía sus registros
+		stop := func() {}                // Avisa a los workers que no hay más bloques
+		switch opts.Strategy {
+		case strategySequential:
+			handle = func(chunk *rowChunk) { send(validate(chunk)) }
+		case strategyPipeline:
+			chunks := make(chan *rowChunk, 1) // Etapa de validación, entre la lectura y la recolección
+			probe := opts.Monitor.channel("lectura", "validación", cap(chunks), 1, 1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					chunk, ok := recvProbed(probe, chunks)
+					if !ok {
+						break
+					}
+					send(validate(chunk))
+				}
+			}()
+			handle = func(chunk *rowChunk) { sendProbed(probe, chunks, chunk) }
+			stop = func() { close(chunks) }
+		case strategyPool:
+			jobs := make(chan func())
+			workers := poolWorkers(runtime.GOMAXPROCS(0))
+			probe := opts.Monitor.channel("lectura", "validación", 0, 1, workers)
+			for range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						job, ok := recvProbed(probe, jobs)
+						if !ok {
+							break
+						}
+						job()
+					}
+				}()
+			}
+			handle = func(chunk *rowChunk) { sendProbed(probe, jobs, ordered(chunk)) }
+			stop = func() { close(jobs) }
+		default:
+			handle = func(chunk *rowChunk) {
+				job := ordered(chunk)
+				wg.Add(1) // Aumentar el contador de goroutines
+				go func() {
+					defer wg.Done() // Decrementar el contador al finalizar
+					job()
+				}()
+			}
+		}
+		dispatch := func(chunk *rowChunk) {
+			beat()
+			handle(chunk)
+		}
+
+		var rowBytes, rows int // Para estimar cuánto ocupará el próximo bloque
+		newChunk := func(size int) *rowChunk {
+			chunk := rowChunkPool.Get().(*rowChunk)
+			if rows > 0 {
+				chunk.reserve(size, rowBytes/rows+1)
+			}
+			return chunk
+		}
+		size := sizer.next()
+		chunk := newChunk(size)
+		var chunkStart time.Time
+		for ctx.Err() == nil {
+			row, err := reader.next() // Leer cada registro del archivo
+			if err == io.EOF {
+				break // Salir si no hay más registros
+			}
+			if err != nil {
+				readErr = err // P. ej. un .gz truncado: los registros leídos están incompletos
+				break
+			}
+
+			if chunk.len() == 0 {
+				chunkStart = time.Now()
+			}
+			chunk.add(row) // La fila se copia: el lector reutiliza su buffer
+			rowBytes, rows = rowBytes+len(row), rows+1
+			// El bloque sale lleno o, si el archivo llega lento, cuando su primera fila ya esperó demasiado
+			if chunk.len() >= size || time.Since(chunkStart) >= maxChunkWait {
+				dispatch(chunk)
+				size = sizer.next()
+				chunk = newChunk(size)
+			}
+		}
+		if chunk.len() > 0 {
+			dispatch(chunk)
+		} else {
+			chunk.release()
+		}
+		stop()
+		wg.Wait() // Esperar a que todas las goroutines terminen
+		rows, chunks := sizer.stats()
+		validateSpan.SetAttr("filas_invalidas", invalid.Load())
+		validateSpan.SetAttr("bloques", chunks)
+		validateSpan.SetAttr("filas_por_bloque", rows)
+		validateSpan.End()
+		close(dataChannel.In) // Cerrar el canal
+	}()
+
+	// Recibir los datos del canal y agregarlos al slice de atenciones
+	for {
+		data, ok := recvProbed(recordsProbe, dataChannel.Out)
+		if !ok {
+			break
+		}
+		atenciones = append(atenciones, data) // Agregar datos procesados al slice
+		fan.send(data)                        // Y a los destinos adicionales
+	}
+	stats, err := dataChannel.finish()
+	span.SetAttr("canal_ocupacion_max", stats.MaxOccupancy)
+	span.SetAttr("registros_derramados", stats.Spilled)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Spilled > 0 {
+		log.Printf("Canal de registros lleno: %d registros pasaron por disco", stats.Spilled)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err // Carga cancelada: los registros leídos están incompletos
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("error al leer los registros: %w", readErr)
+	}
+
+	// Con la suma verificada se descarta todo el archivo, no solo las filas dañadas
+	if err := check.verifySum(hashed, sum); err != nil {
+		return nil, err
+	}
+	if opts.Report != nil {
+		*opts.Report = LoadReport{SHA256: hex.EncodeToString(sum.Sum(nil)), Records: len(atenciones), Invalid: invalid.Load(), Schema: version}
+	}
+	return atenciones, nil
+}
+
+// Función que convierte los valores de un registro, con las columnas en el
+// orden de la versión 1 del esquema, a tipos adecuados. Retorna false (y lo
+// informa) si algún número es inválido.
+func parseRecord(record []string) (Atencion, bool) {
+	mes, err := strconv.Atoi(record[0])
+	if err != nil {
+		log.Printf("Error al convertir mes: %v", err)
+		return Atencion{}, false
+	}
+	dia, err := strconv.Atoi(record[1])
+	if err != nil {
+		log.Printf("Error al convertir dia: %v", err)
+		return Atencion{}, false
+	}
+	atendidos, err := strconv.Atoi(record[3])
+	if err != nil {
+		log.Printf("Error al número de atendidos: %v", err)
+		return Atencion{}, false
+	}
+	atencionesCount, err := strconv.Atoi(record[4])
+	if err != nil {
+		log.Printf("Error al número de atenciones: %v", err)
+		return Atencion{}, false
+	}
+
+	// Crear un nuevo objeto Atencion con los datos procesados
+	return Atencion{
+		Mes:                   mes,
+		Dia:                   dia,
+		NombreEstablecimiento: record[2],
+		Atendidos:             atendidos,
+		Atenciones:            atencionesCount,
+	}, true
+}
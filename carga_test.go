@@ -0,0 +1,49 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Un .csv.gz cortado a la mitad falla al cargar en lugar de entregar solo las
+// filas que se alcanzaron a leer
+func TestLoadTruncatedGzip(t *testing.T) {
+	csvData, err := os.ReadFile(writeTestAttendances(t, 6, 120))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "atenciones.csv.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(file)
+	zw.Write(csvData)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := loadAtenciones(context.Background(), path)
+	if err != nil || len(data) != 6*120 {
+		t.Fatalf("archivo completo: %d registros, %v", len(data), err)
+	}
+
+	compressed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncado.csv.gz")
+	if err := os.WriteFile(truncated, compressed[:len(compressed)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := loadAtenciones(context.Background(), truncated); err == nil {
+		t.Fatalf("se cargaron %d registros de un archivo truncado sin error", len(data))
+	}
+}
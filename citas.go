@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Citas programadas: un segundo conjunto de datos con las citas reservadas por
+// establecimiento y día, que anticipa la demanda mejor que cualquier promedio.
+// Se lee de un CSV (columnas establecimiento, citas y fecha AAAA-MM-DD o mes y
+// dia, con anio opcional) o de una tabla SQL (establecimiento, fecha, citas),
+// y se une a las atenciones por establecimiento y fecha en la característica
+// Citas. Al entrenar, -citas completa los registros; al predecir, la agenda
+// del día consultado entra como valor conocido (ver valores_conocidos.go) y,
+// si no hay citas cargadas para ese día, se imputa el promedio histórico.
+// Las consultas no traen año: se usan las citas del año más reciente de la
+// agenda para ese día.
+
+// Tabla de citas por defecto con una conexión SQL
+const defaultBookingsTable = "citas"
+
+// Clave de la agenda: establecimiento normalizado y fecha (Year 0 = cualquier año)
+type bookingKey struct {
+	Establishment    string
+	Year, Month, Day int
+}
+
+// Citas programadas por establecimiento y día
+type Bookings struct {
+	counts map[bookingKey]int
+	latest map[bookingKey]int // Año más reciente de cada día, con la clave sin año
+}
+
+// Función que carga la agenda de un CSV (ruta local o URL) o, si source es una
+// conexión postgres://, mysql:// o sqlite:, de la tabla indicada
+func loadBookings(ctx context.Context, source, table string) (*Bookings, error) {
+	var b *Bookings
+	var err error
+	if isSQLConnection(source) {
+		b, err = loadBookingsSQL(ctx, source, table)
+	} else {
+		b, err = loadBookingsCSV(ctx, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b.counts) == 0 {
+		return nil, fmt.Errorf("%s no tiene citas", source)
+	}
+	return b, nil
+}
+
+// Indica si el origen es una conexión SQL y no un archivo
+func isSQLConnection(source string) bool {
+	scheme, _, ok := strings.Cut(source, ":")
+	return ok && (scheme == "postgres" || scheme == "postgresql" || scheme == "mysql" || scheme == "sqlite")
+}
+
+// Función que crea una agenda vacía
+func newBookings() *Bookings {
+	return &Bookings{counts: make(map[bookingKey]int), latest: make(map[bookingKey]int)}
+}
+
+// Función que agrega las citas de un día; las filas repetidas se suman
+func (b *Bookings) add(establishment string, year, month, day, count int) {
+	key := bookingKey{normalizeEstablishment(establishment), year, month, day}
+	b.counts[key] += count
+	undated := bookingKey{key.Establishment, 0, month, day}
+	if latest, ok := b.latest[undated]; !ok || year > latest {
+		b.latest[undated] = year
+	}
+}
+
+// Función que retorna las citas de un establecimiento en una fecha; con año 0
+// (o sin citas de ese año) usa el año más reciente de la agenda para ese día
+func (b *Bookings) Lookup(establishment string, year, month, day int) (int, bool) {
+	if b == nil {
+		return 0, false
+	}
+	name := normalizeEstablishment(establishment)
+	if count, ok := b.counts[bookingKey{name, year, month, day}]; ok {
+		return count, true
+	}
+	latest, ok := b.latest[bookingKey{name, 0, month, day}]
+	if !ok {
+		return 0, false
+	}
+	return b.counts[bookingKey{name, latest, month, day}], true
+}
+
+// Función que completa las citas de los registros y retorna cuántos las tenían
+func (b *Bookings) Join(data []Atencion) int {
+	joined := 0
+	for i := range data {
+		if count, ok := b.Lookup(data[i].NombreEstablecimiento, data[i].Anio, data[i].Mes, data[i].Dia); ok {
+			data[i].Citas = count
+			joined++
+		}
+	}
+	invalidateStatistics(data) // Los promedios de Citas cambiaron
+	return joined
+}
+
+// Función que agrega las citas del día consultado a los valores conocidos, si
+// la consulta no las trae ya
+func (b *Bookings) fill(known knownValues, establishment string, year, month, day int) knownValues {
+	if _, ok := known["Citas"]; ok {
+		return known
+	}
+	count, ok := b.Lookup(establishment, year, month, day)
+	if !ok {
+		return known
+	}
+	filled := knownValues{"Citas": count}
+	for feature, v := range known {
+		filled[feature] = v
+	}
+	return filled
+}
+
+// Función que agrega las citas de la agenda a las consultas de un bloque
+func (b *Bookings) fillQueries(queries []batchQuery, year int) {
+	if b == nil {
+		return
+	}
+	for i, q := range queries {
+		queries[i].Known = b.fill(q.Known, q.Establishment, year, q.Month, q.Day)
+	}
+}
+
+// Función que lee la agenda de un CSV, ubicando las columnas por la cabecera
+func loadBookingsCSV(ctx context.Context, path string) (*Bookings, error) {
+	file, err := openInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera de %s: %w", path, err)
+	}
+	columns := map[string]int{"establecimiento": -1, "citas": -1, "fecha": -1, "anio": -1, "mes": -1, "dia": -1}
+	for i, column := range header {
+		switch name := strings.ToLower(strings.TrimSpace(column)); name {
+		case "nombre_establecimiento":
+			columns["establecimiento"] = i
+		case "año":
+			columns["anio"] = i
+		case "día":
+			columns["dia"] = i
+		default:
+			if _, ok := columns[name]; ok {
+				columns[name] = i
+			}
+		}
+	}
+	dated := columns["fecha"] >= 0
+	if columns["establecimiento"] < 0 || columns["citas"] < 0 || (!dated && (columns["mes"] < 0 || columns["dia"] < 0)) {
+		return nil, errors.New("la cabecera de las citas debe tener las columnas establecimiento, citas y fecha (o mes y dia)")
+	}
+
+	b := newBookings()
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(row[columns["citas"]]))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("línea %d: citas inválidas %q", line, row[columns["citas"]])
+		}
+		var year, month, day int
+		if dated {
+			date, err := time.Parse(time.DateOnly, strings.TrimSpace(row[columns["fecha"]]))
+			if err != nil {
+				return nil, fmt.Errorf("línea %d: fecha inválida %q", line, row[columns["fecha"]])
+			}
+			year, month, day = date.Year(), int(date.Month()), date.Day()
+		} else {
+			month, err = strconv.Atoi(strings.TrimSpace(row[columns["mes"]]))
+			if err != nil || month < 1 || month > 12 {
+				return nil, fmt.Errorf("línea %d: mes inválido %q", line, row[columns["mes"]])
+			}
+			day, err = strconv.Atoi(strings.TrimSpace(row[columns["dia"]]))
+			if err != nil || day < 1 || day > 31 {
+				return nil, fmt.Errorf("línea %d: día inválido %q", line, row[columns["dia"]])
+			}
+			if columns["anio"] >= 0 {
+				if year, err = strconv.Atoi(strings.TrimSpace(row[columns["anio"]])); err != nil {
+					return nil, fmt.Errorf("línea %d: año inválido %q", line, row[columns["anio"]])
+				}
+			}
+		}
+		b.add(row[columns["establecimiento"]], year, month, day, count)
+	}
+	return b, nil
+}
+
+// Función que lee la agenda de una tabla con columnas establecimiento, fecha y citas
+func loadBookingsSQL(ctx context.Context, conn, table string) (*Bookings, error) {
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("nombre de tabla inválido: %q", table)
+	}
+	db, _, err := openSQL(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, "SELECT establecimiento, fecha, citas FROM "+table)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la tabla %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	b := newBookings()
+	for rows.Next() {
+		var establishment string
+		var value any
+		var count sql.NullInt64
+		if err := rows.Scan(&establishment, &value, &count); err != nil {
+			return nil, fmt.Errorf("error al leer la tabla %s: %w", table, err)
+		}
+		date, err := sqlDate(value)
+		if err != nil {
+			return nil, fmt.Errorf("tabla %s, %s: %w", table, establishment, err)
+		}
+		if count.Valid && count.Int64 >= 0 {
+			b.add(establishment, date.Year(), int(date.Month()), date.Day(), int(count.Int64))
+		}
+	}
+	return b, rows.Err()
+}
+
+// Función que interpreta una columna DATE, que según el driver llega como
+// time.Time o como texto
+func sqlDate(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case []byte:
+		return sqlDate(string(v))
+	case string:
+		if len(v) >= len(time.DateOnly) {
+			if date, err := time.Parse(time.DateOnly, v[:len(time.DateOnly)]); err == nil {
+				return date, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("fecha inválida %v", value)
+}
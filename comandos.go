@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Subcomando de la línea de comandos
+type command struct {
+	description string                    // Descripción mostrada en la ayuda
+	run         func(args []string) error // Función que ejecuta el subcomando
+	action      Action                    // Acción que realiza, para verificar el perfil
+}
+
+// Subcomandos disponibles, indexados por nombre
+var commands = map[string]command{
+	"ctl":                  {"Controlar un servidor en marcha: estado, recarga, reentrenamiento y drenado", ctlCommand, ActionPredict},
+	"diff":                 {"Comparar dos cargas de datos: establecimientos, filas por mes y distribución", diffCommand, ActionLoadData},
+	"daemon":               {"Generar y enviar el reporte de pronóstico periódicamente", daemonCommand, ActionPredict},
+	"establishments":       {"Exportar la lista de establecimientos con registros, cobertura de fechas y demanda promedio", establishmentsCommand, ActionLoadData},
+	"evaluate":             {"Evaluar un modelo sobre un CSV reservado con una matriz de confusión", evaluateCommand, ActionTrain},
+	"forecast-report":      {"Generar el reporte mensual de congestión pronosticada", forecastReportCommand, ActionPredict},
+	"generate":             {"Generar un CSV sintético de atenciones con patrones de congestión", generateCommand, ActionLoadData},
+	"loadtest":             {"Medir latencia y errores del servidor con predicciones a ritmo fijo", loadtestCommand, ActionPredict},
+	"manifest":             {"Calcular la suma SHA-256 y el esquema de archivos CSV", manifestCommand, ActionLoadData},
+	"menu":                 {"Mostrar el menú, ejecutar un guion de acciones (-script) o grabarlo (-grabar)", menuCommand, ActionPredict},
+	"merge-models":         {"Combinar los árboles de varios modelos compatibles", mergeModelsCommand, ActionPublish},
+	"model-versions":       {"Listar las versiones de un modelo del almacén (TP_ALMACEN_MODELOS)", modelVersionsCommand, ActionPredict},
+	"rollback":             {"Volver a la versión anterior de un modelo en un servidor", rollbackCommand, ActionPublish},
+	"reconcile":            {"Comparar predicciones pasadas con los datos reales", reconcileCommand, ActionTrain},
+	"bot":                  {"Responder pronósticos por Telegram o Slack consultando un servidor", botCommand, ActionPredict},
+	"affinity":             {"Comparar estrategias de planificación de los árboles, con y sin afinidad de hilos y CPUs", affinityCommand, ActionTrain},
+	"bench":                {"Medir ns/op y allocs/op de los caminos críticos con datos sintéticos", benchCommand, ActionTrain},
+	"cluster-report":       {"Agrupar los establecimientos por perfil de demanda", clusterReportCommand, ActionTrain},
+	"feature-importance":   {"Medir la importancia de cada característica por permutación sobre datos reservados", featureImportanceCommand, ActionTrain},
+	"feature-interactions": {"Medir la interacción entre pares de características con el estadístico H de Friedman", featureInteractionsCommand, ActionTrain},
+	"rules":                {"Resumir el bosque en reglas SI-ENTONCES legibles con un árbol sustituto", rulesCommand, ActionTrain},
+	"heatmap":              {"Exportar la matriz de probabilidades de congestión por establecimiento y día de un mes", heatmapCommand, ActionPredict},
+	"forecast-volume":      {"Pronosticar los atendidos de los próximos días con Holt-Winters", forecastVolumeCommand, ActionPredict},
+	"partial-dependence":   {"Exportar a CSV la dependencia parcial de la congestión en cada característica", partialDependenceCommand, ActionTrain},
+	"predict-batch":        {"Predecir un CSV de consultas por bloques, con reanudación", predictBatchCommand, ActionPredict},
+	"serve":                {"Servir predicciones por HTTP con varios modelos", serveCommand, ActionPredict},
+	"threshold-sweep":      {"Comparar modelos entrenados con distintos umbrales de congestión", thresholdSweepCommand, ActionTrain},
+	"tune":                 {"Elegir hiperparámetros y estimar su rendimiento con validación cruzada anidada", tuneCommand, ActionTrain},
+	"train-online":         {"Aprender un CSV registro por registro con árboles de Hoeffding", trainOnlineCommand, ActionTrain},
+	"train":                {"Entrenar un modelo desde un CSV y guardarlo", trainCommand, ActionTrain},
+}
+
+// Función que ejecuta un subcomando y retorna el código de salida del proceso
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Subcomando desconocido: %s\n\n", name)
+		printUsage()
+		return exitUsage
+	}
+	if err := profile.check(cmd.action); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	if err := cmd.run(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitCodeFor(err)
+	}
+	return exitOK
+}
+
+// Función que muestra los subcomandos disponibles
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Uso: tpconcurrente [-perfil analista|operador] [-cpuprofile archivo] [-memprofile archivo] [subcomando] [opciones]")
+	fmt.Fprintln(os.Stderr, "Sin subcomando se muestra el menú interactivo (con -script o -grabar, ver menu).")
+	fmt.Fprintln(os.Stderr, "\nSubcomandos:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if profile.Can(commands[name].action) {
+			fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].description)
+		}
+	}
+}
+
+// Función que interpreta las opciones de un subcomando aunque aparezcan después
+// de los argumentos posicionales (flag se detiene en el primero que no es opción).
+// Retorna los argumentos posicionales en orden.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
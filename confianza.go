@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Incertidumbre de una predicción: cada árbol vota sí o no, así que la
+// fracción de votos p es un promedio de valores 0/1 y su dispersión entre
+// árboles es sqrt(p(1-p)). El intervalo se estima con jackknife: se recalcula
+// p quitando un árbol por vez; con votos binarios la varianza del jackknife
+// tiene forma cerrada, p(1-p)/(n-1), y no hace falta volver a votar. Con pocos
+// árboles o votos divididos el intervalo es ancho y conviene no fiarse.
+
+// Valor z del intervalo del 95%
+const confidenceZ = 1.96
+
+// Intervalo de la fracción de votos de congestión
+type ConfidenceInterval struct {
+	Method  string  `json:"metodo"`
+	Level   float64 `json:"nivel"`
+	Margin  float64 `json:"margen"`
+	Lower   float64 `json:"inferior"`
+	Upper   float64 `json:"superior"`
+	Summary string  `json:"resumen"` // Por ejemplo "probabilidad 0.72 ± 0.08"
+}
+
+// Función que retorna la fracción de votos de congestión y su desvío entre árboles
+func voteDispersion(votes, total int) (probability, stddev float64) {
+	if total == 0 {
+		return 0, 0
+	}
+	probability = float64(votes) / float64(total)
+	return probability, math.Sqrt(probability * (1 - probability))
+}
+
+// Función que calcula el intervalo jackknife del 95% de la fracción de votos.
+// Con un solo árbol no hay con qué estimarlo y el margen cubre todo [0, 1].
+func jackknifeInterval(votes, total int) *ConfidenceInterval {
+	probability, _ := voteDispersion(votes, total)
+	margin := 1.0
+	if total > 1 {
+		margin = confidenceZ * math.Sqrt(probability*(1-probability)/float64(total-1))
+	}
+	return &ConfidenceInterval{
+		Method:  "jackknife",
+		Level:   0.95,
+		Margin:  margin,
+		Lower:   max(0, probability-margin),
+		Upper:   min(1, probability+margin),
+		Summary: fmt.Sprintf("probabilidad %.2f ± %.2f", probability, margin),
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Conjuntos de registros del menú: una sesión puede procesar varios archivos,
+// cada uno con un nombre (por ejemplo "2022", "2023" o "sintético"), y elegir
+// cuál es el activo. El entrenamiento, las predicciones y los filtros usan el
+// conjunto activo; la opción 12 compara las estadísticas de todos. El nombre
+// por defecto es el del archivo sin extensiones.
+
+// Registros procesados de un archivo
+type dataset struct {
+	Name    string
+	Path    string
+	Records []Atencion
+	Index   *DatasetIndex // Índices de los registros por establecimiento y fecha
+	SHA256  string        // Suma del archivo
+}
+
+// Conjuntos procesados en la sesión, en el orden en que se procesaron
+type datasets struct {
+	list   []*dataset
+	active *dataset // nil = no se procesó ninguno
+}
+
+// Función que retorna el nombre por defecto de un archivo o URL de registros
+func datasetName(source string) string {
+	name := path.Base(strings.ReplaceAll(source, "\\", "/"))
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// Función que busca un conjunto por su nombre, sin distinguir mayúsculas ni tildes
+func (d *datasets) get(name string) *dataset {
+	key := foldAccents(strings.ToLower(strings.TrimSpace(name)))
+	for _, ds := range d.list {
+		if foldAccents(strings.ToLower(ds.Name)) == key {
+			return ds
+		}
+	}
+	return nil
+}
+
+// Función que agrega un conjunto y lo deja activo
+func (d *datasets) add(ds *dataset) {
+	d.list = append(d.list, ds)
+	d.active = ds
+}
+
+// Función que retorna los nombres de los conjuntos
+func (d *datasets) names() []string {
+	names := make([]string, len(d.list))
+	for i, ds := range d.list {
+		names[i] = ds.Name
+	}
+	return names
+}
+
+// Función que retorna los registros del conjunto activo (nil si no hay)
+func (d *datasets) records() []Atencion {
+	if d.active == nil {
+		return nil
+	}
+	return d.active.Records
+}
+
+// Función que procesa los registros de un archivo: lee el CSV, o su
+// instantánea si el archivo no cambió desde la última sesión, y arma el índice
+func processRecords(name, source string) (*dataset, error) {
+	fmt.Println("Procesando registros...")
+	start := time.Now() // Iniciar el temporizador para medir el tiempo de procesamiento
+
+	snapshot, err := defaultSnapshotPath(source)
+	if err != nil {
+		return nil, err
+	}
+	var report LoadReport
+	data, fromSnapshot, err := loadAtencionesSnapshot(context.Background(), source, snapshot, LoadOptions{Report: &report})
+	audit(context.Background(), auditLoadData, source, err, loadDetails(report))
+	if err != nil {
+		return nil, err
+	}
+	if fromSnapshot {
+		fmt.Println("Registros leídos de la instantánea guardada (el archivo no cambió).")
+	}
+	ds := &dataset{Name: name, Path: source, Records: data, Index: NewDatasetIndex(data), SHA256: report.SHA256}
+
+	// Mostrar información sobre el procesamiento
+	fmt.Printf("Registros procesados: %d\n", len(data))
+	duration := time.Since(start) // Calcular el tiempo de procesamiento
+	fmt.Printf("Tiempo de procesamiento: %v\n", duration)
+	return ds, nil
+}
+
+// Estadísticas de un conjunto para compararlo con otros
+type datasetStats struct {
+	Rows           int
+	Establishments int
+	First, Last    recordDate // Primera y última fecha con datos
+	AvgAttended    float64
+	P95Attended    float64
+	AvgAttention   float64
+}
+
+// Función que calcula las estadísticas de un conjunto
+func (ds *dataset) stats() datasetStats {
+	s := datasetStats{Rows: len(ds.Records), Establishments: len(ds.Index.Establishments())}
+	if len(ds.Records) == 0 {
+		return s
+	}
+	all := GroupBy(ds.Records, func(Atencion) bool { return true }).Aggregate(Avg(atendidosValue), P95(atendidosValue), Avg(atencionesValue))[true]
+	s.AvgAttended, s.P95Attended, s.AvgAttention = all[0], all[1], all[2]
+	first := ds.Records[0]
+	s.First = recordDate{first.Anio, first.Mes, first.Dia}
+	s.Last = s.First
+	for _, att := range ds.Records[1:] {
+		date := recordDate{att.Anio, att.Mes, att.Dia}
+		if date.before(s.First) {
+			s.First = date
+		}
+		if s.Last.before(date) {
+			s.Last = date
+		}
+	}
+	return s
+}
+
+// Función que muestra las estadísticas de los conjuntos en columnas, con el
+// activo marcado con *, y los establecimientos que no comparten
+func printDatasetComparison(list []*dataset, active *dataset) {
+	stats := make([]datasetStats, len(list))
+	fmt.Printf("%-22s", "")
+	for i, ds := range list {
+		stats[i] = ds.stats()
+		name := ds.Name
+		if ds == active {
+			name = "*" + name
+		}
+		fmt.Printf(" %14s", name)
+	}
+	fmt.Println()
+	row := func(label string, value func(s datasetStats) string) {
+		fmt.Printf("%-22s", label)
+		for _, s := range stats {
+			fmt.Printf(" %14s", value(s))
+		}
+		fmt.Println()
+	}
+	row("Registros", func(s datasetStats) string { return fmt.Sprint(s.Rows) })
+	row("Establecimientos", func(s datasetStats) string { return fmt.Sprint(s.Establishments) })
+	row("Desde", func(s datasetStats) string { return s.First.String() })
+	row("Hasta", func(s datasetStats) string { return s.Last.String() })
+	row("Atendidos promedio", func(s datasetStats) string { return fmt.Sprintf("%.2f", s.AvgAttended) })
+	row("Atendidos p95", func(s datasetStats) string { return fmt.Sprintf("%.2f", s.P95Attended) })
+	row("Atenciones promedio", func(s datasetStats) string { return fmt.Sprintf("%.2f", s.AvgAttention) })
+
+	// Establecimientos que faltan en algún conjunto, que el modelo de otro no conoce
+	in := make(map[string][]string)
+	for _, ds := range list {
+		for _, name := range ds.Index.Establishments() {
+			name = normalizeEstablishment(name)
+			if !slices.Contains(in[name], ds.Name) {
+				in[name] = append(in[name], ds.Name)
+			}
+		}
+	}
+	common := 0
+	for _, name := range sortedKeys(in) {
+		if len(in[name]) == len(list) {
+			common++
+			continue
+		}
+		fmt.Printf("%s: solo en %s\n", name, strings.Join(in[name], ", "))
+	}
+	fmt.Printf("Establecimientos en todos los conjuntos: %d de %d\n", common, len(in))
+}
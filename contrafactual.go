@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Consultas contrafactuales: ¿qué cambio mínimo haría que el día no esté
+// congestionado (o que sí lo esté)? Se prueban valores cercanos a la consulta
+// en orden de distancia: mover la fecha unos días (otro día de la semana),
+// bajar o subir la demanda esperada unos puntos porcentuales y, al final, mover
+// el mes. Solo se prueban las características que usa el modelo.
+
+// Distancia máxima de la búsqueda: días hacia cada lado y pasos de demanda
+const counterfactualRings = 7
+
+// Cambio de la demanda esperada en cada paso (0.05 = 5%)
+const counterfactualDemandStep = 0.05
+
+// Cambio que invierte la predicción
+type CounterfactualChange struct {
+	Feature     string `json:"caracteristica"`
+	From        int    `json:"desde"`
+	To          int    `json:"hasta"`
+	Description string `json:"descripcion"`
+	Votes       int    `json:"votos"`
+	Trees       int    `json:"arboles"`
+}
+
+// Resultado de la búsqueda contrafactual
+type Counterfactual struct {
+	Congested bool                   `json:"congestionado"` // Predicción original
+	Changes   []CounterfactualChange `json:"cambios"`       // El más cercano de cada tipo, del más cercano al más lejano
+	Summary   string                 `json:"resumen"`
+}
+
+// Candidato de la búsqueda
+type counterfactualCandidate struct {
+	kind   string // Tipo de cambio: se reporta solo el más cercano de cada uno
+	change CounterfactualChange
+	att    Atencion
+}
+
+// Función que busca los cambios cercanos que invierten la predicción de una
+// consulta. Los cambios de fecha vuelven a pasar por el pipeline, como una
+// consulta nueva; los de demanda modifican los valores ya imputados.
+func FindCounterfactual(model Predictor, p *Pipeline, establishment string, month, day int) *Counterfactual {
+	att := queryAtencion(p, establishment, month, day)
+	votes, total := model.Vote(att)
+	result := &Counterfactual{Congested: decideVote(votes, total, p.tiePolicy()).Congested, Changes: []CounterfactualChange{}}
+
+	used := map[string]bool{"Mes": true, "Dia": true}
+	if user, ok := model.(featureUser); ok {
+		used = make(map[string]bool)
+		for _, feature := range user.UsedFeatures() {
+			used[feature] = true
+		}
+	}
+
+	var candidates []counterfactualCandidate
+	for ring := 1; ring <= counterfactualRings; ring++ {
+		if used["Dia"] {
+			for _, delta := range []int{-ring, ring} {
+				if d := day + delta; d >= 1 && d <= daysInMonth(month) {
+					candidates = append(candidates, counterfactualCandidate{
+						kind:   "dia",
+						change: CounterfactualChange{Feature: "Dia", From: day, To: d, Description: fmt.Sprintf("el día %d (%s)", d, dayShift(delta))},
+						att:    queryAtencion(p, establishment, month, d),
+					})
+				}
+			}
+		}
+		// La demanda baja si se predice congestión y sube si no
+		factor := 1 - counterfactualDemandStep*float64(ring)
+		verb := "menos"
+		if !result.Congested {
+			factor, verb = 1+counterfactualDemandStep*float64(ring), "más"
+		}
+		for _, feature := range []string{"Atendidos", "Atenciones"} {
+			if !used[feature] {
+				continue
+			}
+			get, _ := featureAccessor(feature)
+			set, _ := featureSetter(feature)
+			changed := att
+			set(&changed, int(math.Round(float64(get(att))*factor)))
+			candidates = append(candidates, counterfactualCandidate{
+				kind: feature,
+				change: CounterfactualChange{Feature: feature, From: get(att), To: get(changed),
+					Description: fmt.Sprintf("%.0f%% %s %s", counterfactualDemandStep*float64(ring)*100, verb, strings.ToLower(feature))},
+				att: changed,
+			})
+		}
+	}
+	if used["Mes"] {
+		for _, delta := range []int{-1, 1, -2, 2} {
+			m := (month+delta+11)%12 + 1 // Enero sigue a diciembre
+			d := min(day, daysInMonth(m))
+			candidates = append(candidates, counterfactualCandidate{
+				kind:   "mes",
+				change: CounterfactualChange{Feature: "Mes", From: month, To: m, Description: fmt.Sprintf("el mismo día en %s", monthNames[m])},
+				att:    queryAtencion(p, establishment, m, d),
+			})
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, c := range candidates {
+		if found[c.kind] {
+			continue
+		}
+		votes, total := model.Vote(c.att)
+		decision := decideVote(votes, total, p.tiePolicy())
+		if total == 0 || decision.Abstained || decision.Congested == result.Congested {
+			continue
+		}
+		found[c.kind] = true
+		c.change.Votes, c.change.Trees = votes, total
+		result.Changes = append(result.Changes, c.change)
+	}
+
+	outcome := "estaría congestionado"
+	if result.Congested {
+		outcome = "no estaría congestionado"
+	}
+	if len(result.Changes) == 0 {
+		result.Summary = "ningún cambio cercano invierte la predicción"
+	} else {
+		result.Summary = fmt.Sprintf("%s con %s", outcome, result.Changes[0].Description)
+	}
+	return result
+}
+
+// Función que describe un desplazamiento de la fecha en días
+func dayShift(delta int) string {
+	switch {
+	case delta == -1:
+		return "un día antes"
+	case delta == 1:
+		return "un día después"
+	case delta < 0:
+		return fmt.Sprintf("%d días antes", -delta)
+	}
+	return fmt.Sprintf("%d días después", delta)
+}
+
+// Función que retorna los días de un mes; febrero tiene 29 porque las
+// consultas no indican el año
+func daysInMonth(month int) int {
+	return time.Date(2000, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
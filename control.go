@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Control del servidor en marcha: "tpconcurrente ctl" consulta el estado,
+// recarga un modelo, encola un reentrenamiento o drena la réplica usando la API,
+// sin reiniciar el servicio ni armar peticiones con curl. Con -socket el servidor
+// atiende la misma API en un socket unix que solo puede abrir su usuario, y ctl
+// se conecta con -servidor unix:/ruta/al/socket. Al drenar, el servidor rechaza
+// predicciones y entrenamientos nuevos con 503 (el balanceador deja de enviarle
+// tráfico) y termina los que están en curso; DELETE /drain lo vuelve a abrir.
+// Con inquilinos solo se drena por el socket, porque el drenado es de todo el
+// servidor. La clave de API se toma de TP_CLAVE, como en rollback.
+
+// Intervalo de consulta de ctl mientras espera un trabajo o el drenado
+const controlPollInterval = time.Second
+
+// Respuesta de GET /status
+type statusResponse struct {
+	Started    time.Time         `json:"inicio"`
+	Uptime     float64           `json:"segundos_activo"`
+	Draining   bool              `json:"drenando"`
+	Predicting int64             `json:"predicciones_en_curso,omitempty"` // De todo el servidor: solo por el socket o sin inquilinos
+	Jobs       map[JobStatus]int `json:"trabajos"`                        // Trabajos conservados por estado
+	Models     []modelInfo       `json:"modelos"`
+}
+
+// Función que indica si el servidor terminó de drenar: sin predicciones ni
+// entrenamientos en curso
+func (st statusResponse) drained() bool {
+	return st.Draining && st.Predicting == 0 && st.Jobs[JobQueued] == 0 && st.Jobs[JobRunning] == 0
+}
+
+// Función que abre el socket unix de control, reemplazando uno viejo que haya
+// quedado de una ejecución anterior
+func listenSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("-socket %s: el archivo existe y no es un socket", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Función que marca en el contexto las conexiones que llegan por el socket unix
+func markControlSocket(ctx context.Context, c net.Conn) context.Context {
+	if c.LocalAddr().Network() == "unix" {
+		ctx = context.WithValue(ctx, controlSocketKey, true)
+	}
+	return ctx
+}
+
+// Función que indica si la petición administra todo el servidor y no solo su
+// inquilino: llega por el socket de control o el servidor no tiene inquilinos
+func (s *server) serverAdmin(r *http.Request) bool {
+	viaSocket, _ := r.Context().Value(controlSocketKey).(bool)
+	return viaSocket || s.tenants.open != nil
+}
+
+// Función que rechaza la petición si el servidor se está drenando
+func (s *server) rejectDraining(w http.ResponseWriter) bool {
+	if !s.draining.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", "30")
+	writeError(w, http.StatusServiceUnavailable, errors.New("el servidor se está drenando"))
+	return true
+}
+
+// GET /status: estado del servidor, sus trabajos y los modelos del inquilino
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantFrom(r.Context())
+	status := statusResponse{
+		Started:  s.started,
+		Uptime:   time.Since(s.started).Seconds(),
+		Draining: s.draining.Load(),
+		Jobs:     make(map[JobStatus]int),
+		Models:   []modelInfo{},
+	}
+	if s.serverAdmin(r) {
+		// Las predicciones en curso son de todos los inquilinos
+		status.Predicting = s.predicting.Load()
+	}
+	for _, job := range s.jobs.List(tenant) {
+		status.Jobs[job.Status]++
+	}
+	for _, entry := range tenant.registry.List() {
+		info := newModelInfo(entry)
+		info.Previous = tenant.registry.PreviousVersions(entry.Name)
+		status.Models = append(status.Models, info)
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// POST /drain deja de aceptar predicciones y entrenamientos; DELETE /drain los
+// vuelve a aceptar
+func (s *server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if !s.serverAdmin(r) {
+		// Drenar afecta a todos los inquilinos, no solo al de la clave
+		writeError(w, http.StatusForbidden, errors.New("con inquilinos el servidor solo se drena por el socket de control (serve -socket)"))
+		return
+	}
+	draining := r.Method == http.MethodPost
+	if s.draining.Swap(draining) != draining {
+		audit(r.Context(), auditDrain, "servidor", nil, map[string]any{"drenando": draining})
+		if draining {
+			logf(r.Context(), "Drenando el servidor: se rechazan predicciones y entrenamientos nuevos")
+		} else {
+			logf(r.Context(), "El servidor vuelve a aceptar predicciones y entrenamientos")
+		}
+	}
+	s.handleStatus(w, r)
+}
+
+// Cliente de la API de un servidor en marcha, por HTTP o por socket unix
+type controlClient struct {
+	base   string // URL base de la API
+	client *http.Client
+	key    string // Clave de API (TP_CLAVE)
+}
+
+// Constructor del cliente: el servidor es una URL o unix:/ruta/al/socket
+func newControlClient(server string, timeout time.Duration) *controlClient {
+	c := &controlClient{base: strings.TrimSuffix(server, "/"), client: &http.Client{Timeout: timeout}, key: os.Getenv("TP_CLAVE")}
+	if socket, ok := strings.CutPrefix(server, "unix:"); ok {
+		c.base = "http://socket" // El host no se usa: todas las conexiones van al socket
+		c.client.Transport = &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}}
+	}
+	return c
+}
+
+// Función que envía una petición a la API y decodifica la respuesta en out.
+// body, si no es nil, se envía como JSON. Una respuesta que no es 2xx se
+// convierte en un error con el mensaje del servidor.
+func (c *controlClient) call(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) != nil || failure.Error == "" {
+			return fmt.Errorf("el servidor respondió %s", resp.Status)
+		}
+		return fmt.Errorf("el servidor respondió %s: %s", resp.Status, failure.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("respuesta inválida del servidor: %w", err)
+	}
+	return nil
+}
+
+// Acciones de ctl, indexadas por nombre
+var controlActions = map[string]struct {
+	description string
+	run         func(c *controlClient, args []string) error
+}{
+	"status":          {"Mostrar el estado del servidor, sus trabajos y modelos", ctlStatus},
+	"reload-model":    {"Recargar un modelo desde una ruta (-ruta) o desde su origen seguido", ctlReloadModel},
+	"trigger-retrain": {"Encolar un reentrenamiento y, con -esperar, seguirlo hasta que termine", ctlTriggerRetrain},
+	"drain":           {"Dejar de aceptar predicciones y entrenamientos (-deshacer para volver)", ctlDrain},
+}
+
+// Subcomando ctl: controla un servidor en marcha
+func ctlCommand(args []string) error {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	serverURL := fs.String("servidor", "http://localhost:8080", "URL del servidor o unix:/ruta/al/socket")
+	timeout := fs.Duration("timeout", 30*time.Second, "tiempo máximo de espera de cada respuesta")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: tpconcurrente ctl [-servidor URL|unix:socket] acción [opciones]")
+		fmt.Fprintln(fs.Output(), "\nAcciones:")
+		for _, name := range sortedKeys(controlActions) {
+			fmt.Fprintf(fs.Output(), "  %-16s %s\n", name, controlActions[name].description)
+		}
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("falta la acción")
+	}
+	action, ok := controlActions[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("acción desconocida: %s (%s)", fs.Arg(0), strings.Join(sortedKeys(controlActions), ", "))
+	}
+	return action.run(newControlClient(*serverURL, *timeout), fs.Args()[1:])
+}
+
+// Acción status
+func ctlStatus(c *controlClient, args []string) error {
+	fs := flag.NewFlagSet("ctl status", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var status statusResponse
+	if err := c.call(http.MethodGet, "/status", nil, &status); err != nil {
+		return err
+	}
+	printStatus(status)
+	return nil
+}
+
+// Función que muestra el estado del servidor
+func printStatus(status statusResponse) {
+	state := "aceptando tráfico"
+	if status.Draining {
+		state = "drenando"
+	}
+	fmt.Printf("Servidor activo hace %s (desde %s), %s\n",
+		(time.Duration(status.Uptime) * time.Second).String(), status.Started.Format(time.DateTime), state)
+	fmt.Printf("Predicciones en curso: %d\n", status.Predicting)
+	jobs := make([]string, 0, len(status.Jobs))
+	for _, s := range []JobStatus{JobQueued, JobRunning, JobCompleted, JobFailed, JobCanceled} {
+		if n := status.Jobs[s]; n > 0 {
+			jobs = append(jobs, fmt.Sprintf("%d %s", n, s))
+		}
+	}
+	if len(jobs) == 0 {
+		jobs = append(jobs, "ninguno")
+	}
+	fmt.Printf("Trabajos: %s\n", strings.Join(jobs, ", "))
+	fmt.Printf("Modelos: %d\n", len(status.Models))
+	for _, m := range status.Models {
+		fmt.Printf("  %-20s v%-4d %4d árboles  %s (cargado %s)\n", m.Name, m.Version, m.Trees, m.Source, m.LoadedAt.Local().Format(time.DateTime))
+	}
+}
+
+// Acción reload-model: con -ruta carga el modelo desde ese archivo; sin ella
+// consulta ya el origen de un modelo seguido (-seguir)
+func ctlReloadModel(c *controlClient, args []string) error {
+	fs := flag.NewFlagSet("ctl reload-model", flag.ContinueOnError)
+	path := fs.String("ruta", "", "archivo del modelo (vacío = volver a consultar el modelo seguido)")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return errors.New("se espera un solo modelo")
+	}
+	name := defaultModelName
+	if len(positional) == 1 {
+		name = positional[0]
+	}
+
+	target := "/models/" + url.PathEscape(name)
+	if *path != "" {
+		var info modelInfo
+		if err := c.call(http.MethodPost, target+"/load", map[string]string{"ruta": *path}, &info); err != nil {
+			return err
+		}
+		fmt.Printf("Modelo %s v%d cargado desde %s (%d árboles)\n", info.Name, info.Version, info.Source, info.Trees)
+		return nil
+	}
+	var refresh refreshResponse
+	if err := c.call(http.MethodPost, target+"/refresh", nil, &refresh); err != nil {
+		return err
+	}
+	if !refresh.Updated {
+		fmt.Printf("Modelo %s sin cambios: sigue la versión %d (%s)\n", refresh.Model.Name, refresh.Model.Version, refresh.Model.Source)
+		return nil
+	}
+	fmt.Printf("Modelo %s v%d recargado desde %s (%d árboles)\n", refresh.Model.Name, refresh.Model.Version, refresh.Model.Source, refresh.Model.Trees)
+	return nil
+}
+
+// Acción trigger-retrain: encola un entrenamiento en el servidor
+func ctlTriggerRetrain(c *controlClient, args []string) error {
+	fs := flag.NewFlagSet("ctl trigger-retrain", flag.ContinueOnError)
+	var req trainRequest
+	fs.StringVar(&req.Model, "modelo", defaultModelName, "nombre con el que se registra el modelo")
+	fs.StringVar(&req.Data, "datos", "", "CSV de atenciones visible para el servidor (vacío = el del inquilino)")
+	fs.IntVar(&req.Trees, "arboles", 100, "árboles a entrenar")
+	fs.StringVar(&req.Filter, "filtro", "", "expresión de filtro opcional")
+	fs.StringVar(&req.Features, "caracteristicas", "", "características separadas por comas (vacío = Mes,Dia)")
+	fs.StringVar(&req.Timeout, "plazo", "", "plazo del entrenamiento, p. ej. 10m (vacío = el del servidor)")
+	fs.StringVar(&req.Policy, "al-vencer", "", "al vencer el plazo: fallar o parcial (vacío = la política del servidor)")
+	wait := fs.Bool("esperar", false, "seguir el trabajo hasta que termine")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var job jobReport
+	if err := c.call(http.MethodPost, "/train", req, &job); err != nil {
+		return err
+	}
+	fmt.Printf("Trabajo %s encolado: entrenar %s con %d árboles (posición %d)\n", job.ID, job.Model, job.Requested, job.Position)
+	if !*wait {
+		return nil
+	}
+	for job.Status == JobQueued || job.Status == JobRunning {
+		time.Sleep(controlPollInterval)
+		if err := c.call(http.MethodGet, "/jobs/"+url.PathEscape(job.ID), nil, &job); err != nil {
+			return err
+		}
+		fmt.Printf("\r%s: %d/%d árboles (%.0f%%)", job.Status, job.Trained, job.Requested, 100*job.Progress)
+	}
+	fmt.Println()
+	if job.Status != JobCompleted {
+		return fmt.Errorf("el trabajo %s terminó %s: %s", job.ID, job.Status, job.Error)
+	}
+	if job.Partial {
+		fmt.Printf("Venció el plazo: se entrenaron %d de %d árboles\n", job.Trained, job.Requested)
+	}
+	if job.Result != nil {
+		fmt.Printf("Modelo %s v%d registrado (%d árboles)\n", job.Result.Name, job.Result.Version, job.Result.Trees)
+	}
+	return nil
+}
+
+// Acción drain: drena el servidor o, con -deshacer, lo vuelve a abrir
+func ctlDrain(c *controlClient, args []string) error {
+	fs := flag.NewFlagSet("ctl drain", flag.ContinueOnError)
+	undo := fs.Bool("deshacer", false, "volver a aceptar predicciones y entrenamientos")
+	wait := fs.Duration("esperar", 0, "esperar hasta este tiempo a que terminen las predicciones y entrenamientos en curso (0 = no esperar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	method := http.MethodPost
+	if *undo {
+		method = http.MethodDelete
+	}
+	var status statusResponse
+	if err := c.call(method, "/drain", nil, &status); err != nil {
+		return err
+	}
+	if *undo {
+		fmt.Println("El servidor vuelve a aceptar predicciones y entrenamientos")
+		return nil
+	}
+	fmt.Println("Servidor drenando: rechaza predicciones y entrenamientos nuevos")
+	deadline := time.Now().Add(*wait)
+	for *wait > 0 && !status.drained() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("el servidor no terminó de drenar: %d predicciones, %d trabajos en cola y %d ejecutando",
+				status.Predicting, status.Jobs[JobQueued], status.Jobs[JobRunning])
+		}
+		time.Sleep(controlPollInterval)
+		if err := c.call(http.MethodGet, "/status", nil, &status); err != nil {
+			return err
+		}
+	}
+	if *wait > 0 {
+		fmt.Println("Sin predicciones ni entrenamientos en curso: el servidor se puede detener")
+	}
+	return nil
+}
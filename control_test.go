@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Con inquilinos, la clave de analista de un inquilino no puede drenar el
+// servidor de todos ni ver sus predicciones en curso; el socket de control sí
+func TestDrainNeedsControlSocketWithTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inquilinos.json")
+	tenantsJSON := `[{"nombre": "norte", "claves": ["norte"]}, {"nombre": "sur", "claves": ["sur"]}]`
+	if err := os.WriteFile(path, []byte(tenantsJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := LoadTenants(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{tenants: tenants, jobs: NewTrainQueue(nil)}
+	defer s.jobs.Close()
+	s.predicting.Store(3)
+	handler := tenants.middleware(s.apiRoutes())
+
+	call := func(method, target string, viaSocket bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set(apiKeyHeader, "norte")
+		if viaSocket {
+			r = r.WithContext(context.WithValue(r.Context(), controlSocketKey, true))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := call(http.MethodPost, "/drain", false); w.Code != http.StatusForbidden || s.draining.Load() {
+		t.Fatalf("drenado por HTTP: %d, drenando %v; se esperaba 403 sin drenar", w.Code, s.draining.Load())
+	}
+	if w := call(http.MethodGet, "/status", false); strings.Contains(w.Body.String(), "predicciones_en_curso") {
+		t.Fatalf("el estado por HTTP muestra las predicciones de todo el servidor: %s", w.Body)
+	}
+	w := call(http.MethodPost, "/drain", true)
+	if w.Code != http.StatusOK || !s.draining.Load() {
+		t.Fatalf("drenado por el socket: %d, drenando %v", w.Code, s.draining.Load())
+	}
+	var status statusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.Predicting != 3 {
+		t.Fatalf("estado por el socket: %+v, %v", status, err)
+	}
+}
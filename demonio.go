@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Subcomando "daemon": genera periódicamente el pronóstico y lo entrega a los
+// destinos configurados, para que el equipo de operaciones lo reciba sin entrar
+// al servidor. El modelo se vuelve a abrir en cada ejecución, así que toma el
+// último reentrenamiento.
+func daemonCommand(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	opts := daemonOptions{}
+	fs.StringVar(&opts.ModelPath, "modelo", "modelo.gob.gz", "archivo del modelo")
+	fs.StringVar(&opts.DataPath, "datos", "", "CSV histórico para la comparación (vacío = sin comparación)")
+	fs.StringVar(&opts.Format, "formato", "html", "formato del reporte: markdown o html")
+	fs.BoolVar(&opts.NextMonth, "mes-siguiente", false, "pronosticar el mes siguiente en lugar del actual")
+	fs.Float64Var(&opts.Anomaly, "anomalia", 0.25, "diferencia con el histórico que se reporta como anomalía")
+	fs.IntVar(&opts.Retries, "reintentos", 3, "reintentos por destino si falla la entrega")
+	every := fs.Duration("cada", 24*time.Hour, "intervalo entre reportes")
+	once := fs.Bool("una-vez", false, "generar y entregar un solo reporte y salir")
+	fs.Var(&opts.Senders, "enviar", "destino del reporte: smtp://, s3://, gdrive:// o file:// (se puede repetir)")
+	watchdog := &Watchdog{}
+	fs.DurationVar(&watchdog.Stall, "vigilancia", 0, "tiempo sin avance tras el que una etapa se da por trabada (0 = sin vigilancia)")
+	fs.IntVar(&watchdog.Restarts, "reinicios", 0, "reinicios de una etapa trabada antes de dar la ejecución por fallida")
+	fs.StringVar(&watchdog.Heartbeat, "latido", "", "archivo donde la vigilancia escribe la etapa en curso y su último avance")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(opts.Senders) == 0 {
+		return errors.New("indica al menos un destino con -enviar")
+	}
+	if opts.Format != "markdown" && opts.Format != "html" {
+		return fmt.Errorf("formato desconocido %q (markdown o html)", opts.Format)
+	}
+	if watchdog.Stall < 0 || watchdog.Restarts < 0 {
+		return errors.New("-vigilancia y -reinicios no pueden ser negativos")
+	}
+	if watchdog.Stall == 0 && (watchdog.Restarts > 0 || watchdog.Heartbeat != "") {
+		return errors.New("-reinicios y -latido requieren -vigilancia")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if watchdog.Stall > 0 {
+		opts.Watchdog = watchdog
+		var wg sync.WaitGroup
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watchdog.Run(watchCtx)
+		}()
+		defer wg.Wait()
+		defer stopWatch()
+	}
+
+	if *once {
+		return opts.run(ctx)
+	}
+	log.Printf("Demonio de reportes: cada %v hacia %s", *every, opts.Senders.String())
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		if err := opts.run(ctx); err != nil {
+			log.Printf("Error al generar o entregar el reporte: %v", err) // Se reintenta en la próxima vuelta
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println("Demonio detenido")
+			return nil
+		}
+	}
+}
+
+// Configuración de cada ejecución del demonio
+type daemonOptions struct {
+	ModelPath string
+	DataPath  string
+	Format    string
+	NextMonth bool
+	Anomaly   float64
+	Retries   int
+	Senders   senderFlags
+	Watchdog  *Watchdog // Vigilancia de las etapas (nil = sin vigilancia)
+}
+
+// Función que genera el reporte del mes y lo entrega a todos los destinos
+func (o *daemonOptions) run(ctx context.Context) error {
+	now := time.Now()
+	if o.NextMonth {
+		now = now.AddDate(0, 1, 1-now.Day()) // Primer día del mes siguiente
+	}
+
+	model, err := watchStage(ctx, o.Watchdog, "modelo", func(context.Context) (Predictor, error) {
+		return OpenModel(o.ModelPath)
+	})
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+	var history []Atencion
+	if o.DataPath != "" {
+		history, err = watchStage(ctx, o.Watchdog, "ingesta", func(ctx context.Context) ([]Atencion, error) {
+			return loadAtenciones(ctx, o.DataPath)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	pipeline := pipelineFor(model, nil)
+	if pipeline == nil && history != nil {
+		pipeline = NewPipeline(history, nil)
+	}
+
+	report, err := watchStage(ctx, o.Watchdog, "reporte", func(context.Context) (*forecastReport, error) {
+		return buildForecastReport(model, pipeline, history, o.ModelPath, now.Year(), int(now.Month()), o.Anomaly)
+	})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if err := report.render(&body, o.Format); err != nil {
+		return err
+	}
+	file := reportFile{
+		Name:        fmt.Sprintf("pronostico-%d-%02d.md", report.Year, report.Month),
+		Title:       report.Title(),
+		ContentType: "text/markdown",
+		Body:        body.Bytes(),
+	}
+	if o.Format == "html" {
+		file.Name = fmt.Sprintf("pronostico-%d-%02d.html", report.Year, report.Month)
+		file.ContentType = "text/html"
+	}
+
+	_, err = watchStage(ctx, o.Watchdog, "entrega", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, deliverReport(ctx, o.Senders, file, o.Retries)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Reporte %s entregado a %d destinos", file.Name, len(o.Senders))
+	return nil
+}
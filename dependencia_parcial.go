@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Dependencia parcial: para cada característica y cada valor de una grilla se
+// fija ese valor en todas las consultas de una muestra de fondo y se promedia
+// la fracción de árboles que votan congestión. La curva resultante muestra cómo
+// responde el modelo a la característica en general, no para una consulta en
+// particular (para eso está explicar=true en /predict).
+
+// Punto de una curva de dependencia parcial
+type dependencePoint struct {
+	Feature       string
+	Value         int
+	Probability   float64 // Fracción promedio de votos de congestión
+	CongestedRate float64 // Fracción de consultas que la mayoría predice congestionadas
+	Queries       int     // Consultas de fondo promediadas
+}
+
+// Subcomando "partial-dependence": exporta las curvas a CSV para graficarlas
+func partialDependenceCommand(args []string) error {
+	fs := flag.NewFlagSet("partial-dependence", flag.ContinueOnError)
+	modelPath := fs.String("modelo", "modelo.gob.gz", "archivo del modelo")
+	dataPath := fs.String("datos", "", "CSV de atenciones de donde tomar las consultas de fondo (vacío = calendario completo de los establecimientos del modelo)")
+	featureList := fs.String("caracteristicas", "", "características separadas por comas (vacío = las que usa el modelo)")
+	sample := fs.Int("muestra", 1000, "consultas de fondo como máximo")
+	points := fs.Int("puntos", 20, "valores de la grilla para las características que no son Mes ni Dia")
+	seed := fs.Int64("semilla", 1, "semilla para elegir la muestra de fondo")
+	workers := fs.Int("paralelo", runtime.GOMAXPROCS(0), "puntos de la grilla que se calculan a la vez")
+	output := fs.String("o", "", "archivo CSV de las curvas (vacío = salida estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sample <= 0 || *points < 2 || *workers <= 0 {
+		return errors.New("-muestra y -paralelo deben ser positivos y -puntos al menos 2")
+	}
+
+	model, err := OpenModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	var history []Atencion
+	if *dataPath != "" {
+		if history, err = loadAtenciones(context.Background(), *dataPath); err != nil {
+			return err
+		}
+	}
+	pipeline := pipelineFor(model, nil)
+	if pipeline == nil && history != nil {
+		pipeline = NewPipeline(history, nil) // Modelo antiguo: el histórico sirve para imputar
+	}
+	background, err := dependenceBackground(pipeline, history, *sample, *seed)
+	if err != nil {
+		return err
+	}
+
+	features, err := ParseFeatures(*featureList)
+	if err != nil {
+		return err
+	}
+	if features == nil {
+		if user, ok := model.(featureUser); ok {
+			features = user.UsedFeatures()
+		}
+		if len(features) == 0 {
+			features = defaultFeatures
+		}
+	}
+	features = withoutCustomFeatures(features)
+
+	start := time.Now()
+	curves := partialDependence(model, background, features, *points, *workers)
+	fmt.Fprintf(os.Stderr, "%d puntos de %d características sobre %d consultas de fondo en %v\n",
+		len(curves), len(features), len(background), time.Since(start).Round(time.Millisecond))
+
+	if *output == "" {
+		return writeDependenceCSV(os.Stdout, curves)
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	if err := writeDependenceCSV(w, curves); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que arma las consultas de fondo, ya pasadas por el pipeline como en
+// una predicción: las fechas y establecimientos del histórico o, sin él, todos
+// los días del año de cada establecimiento que conoce el pipeline. Si hay más
+// que el máximo se elige una muestra al azar.
+func dependenceBackground(p *Pipeline, history []Atencion, sample int, seed int64) ([]Atencion, error) {
+	var queries []Atencion
+	for _, att := range history {
+		queries = append(queries, queryAtencion(p, att.NombreEstablecimiento, att.Mes, att.Dia))
+	}
+	if len(history) == 0 && p != nil {
+		names := make(map[string]bool)
+		for _, name := range p.Establishments {
+			names[name] = true
+		}
+		for _, name := range sortedKeys(names) {
+			for month := 1; month <= 12; month++ {
+				days := time.Date(2001, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day() // Año no bisiesto
+				for day := 1; day <= days; day++ {
+					queries = append(queries, queryAtencion(p, name, month, day))
+				}
+			}
+		}
+	}
+	if len(queries) == 0 {
+		return nil, errors.New("no hay consultas de fondo: el modelo no trae establecimientos, indica un histórico con -datos")
+	}
+	if len(queries) > sample {
+		r := rand.New(rand.NewSource(seed))
+		r.Shuffle(len(queries), func(i, j int) { queries[i], queries[j] = queries[j], queries[i] })
+		queries = queries[:sample]
+	}
+	return queries, nil
+}
+
+// Función que retorna la función que cambia una característica de una consulta
+func featureSetter(name string) (func(*Atencion, int), bool) {
+	switch name {
+	case "Mes":
+		return func(att *Atencion, v int) { att.Mes = v }, true
+	case "Dia":
+		return func(att *Atencion, v int) { att.Dia = v }, true
+	case "Atendidos":
+		return func(att *Atencion, v int) { att.Atendidos = v }, true
+	case "Atenciones":
+		return func(att *Atencion, v int) { att.Atenciones = v }, true
+	case "Grupo":
+		return func(att *Atencion, v int) { att.Grupo = v }, true
+	case "Anio":
+		return func(att *Atencion, v int) { att.Anio = v }, true
+	case "Citas":
+		return func(att *Atencion, v int) { att.Citas = v }, true
+	}
+	return nil, false
+}
+
+// Función que arma la grilla de una característica: el calendario para Mes y
+// Dia y, para las demás, hasta points cuantiles de sus valores en el fondo
+func dependenceGrid(feature string, background []Atencion, points int) []int {
+	var grid []int
+	switch feature {
+	case "Mes":
+		for v := 1; v <= 12; v++ {
+			grid = append(grid, v)
+		}
+		return grid
+	case "Dia":
+		for v := 1; v <= 31; v++ {
+			grid = append(grid, v)
+		}
+		return grid
+	}
+
+	accessor, _ := featureAccessor(feature)
+	values := make([]int, len(background))
+	for i, att := range background {
+		values[i] = accessor(att)
+	}
+	sort.Ints(values)
+	for i := 0; i < points; i++ {
+		v := values[i*(len(values)-1)/(points-1)]
+		if len(grid) == 0 || grid[len(grid)-1] != v {
+			grid = append(grid, v)
+		}
+	}
+	return grid
+}
+
+// Función que calcula las curvas de todas las características. Cada punto de
+// la grilla recorre todo el fondo, así que los puntos se reparten entre los
+// workers; el resultado queda ordenado por característica y valor.
+func partialDependence(model Predictor, background []Atencion, features []string, points, workers int) []dependencePoint {
+	var curves []dependencePoint
+	for _, feature := range features {
+		for _, v := range dependenceGrid(feature, background, points) {
+			curves = append(curves, dependencePoint{Feature: feature, Value: v})
+		}
+	}
+
+	ties := pipelineFor(model, nil).tiePolicy()
+	indexes := make(chan int, workers) // Índices de puntos pendientes
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				point := &curves[i]
+				set, _ := featureSetter(point.Feature)
+				var sum float64
+				congested := 0
+				for _, att := range background {
+					set(&att, point.Value)
+					votes, total := model.Vote(att)
+					if total == 0 {
+						continue // Ningún árbol votó: la consulta no cuenta
+					}
+					sum += float64(votes) / float64(total)
+					if decideVote(votes, total, ties).Congested {
+						congested++
+					}
+					point.Queries++
+				}
+				if point.Queries > 0 {
+					point.Probability = sum / float64(point.Queries)
+					point.CongestedRate = float64(congested) / float64(point.Queries)
+				}
+			}
+		}()
+	}
+	for i := range curves {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return curves
+}
+
+// Función que escribe las curvas en CSV, un punto por fila
+func writeDependenceCSV(w io.Writer, curves []dependencePoint) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"caracteristica", "valor", "probabilidad", "tasa_congestion", "consultas"})
+	for _, p := range curves {
+		cw.Write([]string{
+			p.Feature,
+			strconv.Itoa(p.Value),
+			strconv.FormatFloat(p.Probability, 'f', 4, 64),
+			strconv.FormatFloat(p.CongestedRate, 'f', 4, 64),
+			strconv.Itoa(p.Queries),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
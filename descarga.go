@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Descarga de archivos publicados por HTTP(S), como los CSV mensuales de datos
+// abiertos del ministerio. Cada URL se guarda en un caché local junto con su
+// ETag: si el servidor responde 304 se reutiliza la copia, y una descarga
+// interrumpida continúa con una petición Range desde el último byte recibido.
+
+// Metadatos de una URL guardada en el caché
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`                 // Tamaño total anunciado por el servidor (-1 si no se conoce)
+	Complete     bool   `json:"complete"`             // La descarga terminó y el archivo está en su ruta final
+	Downloaded   string `json:"downloaded,omitempty"` // Fecha de la última descarga completa
+}
+
+// Función que indica si la ruta es una URL HTTP(S)
+func isHTTP(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// Función que retorna el directorio del caché de descargas. TP_CACHE_DIR lo
+// reemplaza; por defecto se usa el directorio de caché del usuario.
+func downloadCacheDir() (string, error) {
+	if dir := os.Getenv("TP_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "tpconcurrente"), nil
+}
+
+// Función que descarga la URL al caché (o la revalida si ya está) y retorna la
+// ruta del archivo local
+func fetchURL(ctx context.Context, rawURL string) (string, error) {
+	dir, err := downloadCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	base := filepath.Join(dir, hex.EncodeToString(sum[:12]))
+	d := &download{url: rawURL, path: base + filepath.Ext(strings.SplitN(rawURL, "?", 2)[0]), metaPath: base + ".json"}
+	d.entry = d.loadEntry()
+
+	err = d.run(ctx)
+	if err != nil && d.entry.Complete {
+		// Sin conexión se puede seguir trabajando con la última copia completa
+		log.Printf("No se pudo revalidar %s, se usa la copia del %s: %v", rawURL, d.entry.Downloaded, err)
+		return d.path, nil
+	}
+	return d.path, err
+}
+
+// Descarga de una URL al caché
+type download struct {
+	url      string
+	path     string     // Archivo completo en el caché
+	metaPath string     // Metadatos (cacheEntry) en JSON
+	entry    cacheEntry // Estado conocido de la descarga
+}
+
+// Función que lee los metadatos guardados, descartándolos si no corresponden a los archivos presentes
+func (d *download) loadEntry() cacheEntry {
+	fresh := cacheEntry{URL: d.url, Size: -1}
+	data, err := os.ReadFile(d.metaPath)
+	if err != nil {
+		return fresh
+	}
+	var entry cacheEntry
+	if json.Unmarshal(data, &entry) != nil || entry.URL != d.url {
+		return fresh
+	}
+	if entry.Complete {
+		if _, err := os.Stat(d.path); err != nil {
+			return fresh
+		}
+	}
+	return entry
+}
+
+// Función que guarda los metadatos
+func (d *download) saveEntry() error {
+	data, err := json.MarshalIndent(d.entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.metaPath, data, 0o644)
+}
+
+// Función que revalida o descarga la URL, reintentando desde el último byte si se corta
+func (d *download) run(ctx context.Context) error {
+	var err error
+	for attempt := 0; attempt <= remoteRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Reintentando la descarga de %s (intento %d): %v", d.url, attempt, err)
+			if werr := sleepContext(ctx, time.Duration(attempt)*time.Second); werr != nil {
+				return werr
+			}
+		}
+		var retry bool
+		if retry, err = d.fetch(ctx); err == nil || !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("no se pudo descargar %s: %w", d.url, err)
+}
+
+// Función que hace una petición. Retorna si el error justifica reintentar.
+func (d *download) fetch(ctx context.Context) (retry bool, err error) {
+	partPath := d.path + ".part"
+	var offset int64
+	if !d.entry.Complete && d.entry.ETag != "" {
+		if info, err := os.Stat(partPath); err == nil {
+			offset = info.Size() // Continuar la descarga anterior
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case d.entry.Complete && d.entry.ETag != "":
+		req.Header.Set("If-None-Match", d.entry.ETag)
+	case d.entry.Complete && d.entry.LastModified != "":
+		req.Header.Set("If-Modified-Since", d.entry.LastModified)
+	case offset > 0:
+		// If-Range: si el archivo cambió en el servidor se recibe completo (200)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", d.entry.ETag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		fmt.Fprintf(os.Stderr, "%s no cambió, se usa la copia en caché\n", d.url)
+		return false, nil
+	case http.StatusPartialContent:
+		fmt.Fprintf(os.Stderr, "Continuando la descarga de %s desde el byte %d\n", d.url, offset)
+	case http.StatusOK:
+		offset = 0 // Descarga completa desde el inicio
+		d.entry = cacheEntry{
+			URL:          d.url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         resp.ContentLength,
+		}
+		if err := d.saveEntry(); err != nil {
+			return false, err
+		}
+	default:
+		// Los errores del servidor pueden ser transitorios; los del cliente no
+		return resp.StatusCode >= 500, fmt.Errorf("GET %s respondió %s", d.url, resp.Status)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return false, err
+	}
+	progress := &progressWriter{name: d.url, done: offset, total: d.entry.Size}
+	_, copyErr := io.Copy(io.MultiWriter(file, progress), resp.Body)
+	progress.finish()
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return ctx.Err() == nil, copyErr // Queda el .part para continuar en el siguiente intento
+	}
+	if d.entry.Size >= 0 && progress.done != d.entry.Size {
+		return true, fmt.Errorf("descarga incompleta: %d de %d bytes", progress.done, d.entry.Size)
+	}
+
+	if err := os.Rename(partPath, d.path); err != nil {
+		return false, err
+	}
+	d.entry.Size = progress.done
+	d.entry.Complete = true
+	d.entry.Downloaded = time.Now().Format(time.RFC3339)
+	return false, d.saveEntry()
+}
+
+// Escritor que muestra el avance de una descarga como mucho una vez por segundo
+type progressWriter struct {
+	name  string
+	done  int64 // Bytes recibidos (incluye los de descargas anteriores)
+	total int64 // Tamaño total (-1 si no se conoce)
+	last  time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if time.Since(p.last) >= time.Second {
+		p.last = time.Now()
+		p.print()
+	}
+	return len(b), nil
+}
+
+func (p *progressWriter) print() {
+	if p.total > 0 {
+		fmt.Fprintf(os.Stderr, "\rDescargando %s: %.1f de %.1f MB (%.0f%%)", p.name,
+			float64(p.done)/1e6, float64(p.total)/1e6, float64(p.done)*100/float64(p.total))
+	} else {
+		fmt.Fprintf(os.Stderr, "\rDescargando %s: %.1f MB", p.name, float64(p.done)/1e6)
+	}
+}
+
+// Función que muestra el avance final y termina la línea
+func (p *progressWriter) finish() {
+	p.print()
+	fmt.Fprintln(os.Stderr)
+}
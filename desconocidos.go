@@ -0,0 +1,73 @@
+package main
+
+import "math"
+
+// Establecimientos desconocidos: una consulta de un establecimiento que no
+// estaba en los datos de entrenamiento no tiene grupo de demanda (queda en el
+// grupo 0, que ningún árbol vio) ni promedios propios para imputar, así que el
+// modelo responde como para el establecimiento de menor demanda y la respuesta
+// suele ser "sin congestión" sin que nada lo indique. En su lugar se usa un
+// respaldo explícito, que se informa en la salida:
+//
+//   - grupos: si el modelo divide por Grupo, el promedio de sus votos con la
+//     consulta en cada grupo, ponderado por los establecimientos de cada uno.
+//   - global: si no, el modelo no distingue establecimientos y su predicción
+//     para la fecha vale igual (lo imputado sale de los promedios globales).
+//   - previa: si ningún árbol votó, la tasa de congestión del entrenamiento.
+
+// Respaldos para las consultas de establecimientos desconocidos
+const (
+	fallbackGroups = "grupos"
+	fallbackGlobal = "global"
+	fallbackPrior  = "previa"
+)
+
+// Función que vota una consulta ya transformada. Si el establecimiento no
+// estaba en el entrenamiento usa un respaldo y lo retorna ("" si lo conocía).
+func voteQuery(model Predictor, p *Pipeline, establishment string, att Atencion) (votes, total int, fallback string) {
+	if p.Known(establishment) {
+		votes, total = model.Vote(att)
+		return votes, total, ""
+	}
+	return voteUnseen(model, p, att)
+}
+
+// Función que vota la consulta de un establecimiento desconocido con el respaldo
+// que corresponde al modelo. Los votos del promedio por grupos se redondean a la
+// escala de los del modelo, para que se lean igual que los de una predicción común.
+func voteUnseen(model Predictor, p *Pipeline, att Atencion) (votes, total int, fallback string) {
+	sizes := p.Clusters.sizes()
+	if len(sizes) == 0 {
+		votes, total = model.Vote(att)
+		fallback = fallbackGlobal
+	} else {
+		var votesSum, totalSum, weights float64
+		for group, size := range sizes {
+			att.Grupo = group
+			v, t := model.Vote(att)
+			votesSum += float64(size * v)
+			totalSum += float64(size * t)
+			weights += float64(size)
+		}
+		votes, total = int(math.Round(votesSum/weights)), int(math.Round(totalSum/weights))
+		fallback = fallbackGroups
+	}
+	if total == 0 && p.CongestedRate > 0 {
+		total = model.NumTrees()
+		votes = int(math.Round(p.CongestedRate * float64(total)))
+		fallback = fallbackPrior
+	}
+	return votes, total, fallback
+}
+
+// Función que retorna cuántos establecimientos hay en cada grupo (nil sin grupos)
+func (c *DemandClusters) sizes() map[int]int {
+	if c == nil || len(c.Assignments) == 0 {
+		return nil
+	}
+	sizes := make(map[int]int)
+	for _, group := range c.Assignments {
+		sizes[group]++
+	}
+	return sizes
+}
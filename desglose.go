@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Desglose de los votos de una predicción, para depurar las que quedan cerca
+// del empate: cuántos árboles votan cada clase, cuántos no votaron (los del
+// bosque incremental sin datos en la hoja, o los de un modelo plano dañado),
+// cuántos votos tendrían que cambiar para invertir la predicción y, en bosques
+// chicos, el voto de cada árbol. Se pide con detalle=true en GET /predict y
+// con -detalle en predict-batch.
+
+// Árboles hasta los que se informa el voto de cada uno
+const maxDetailTrees = 200
+
+// Columnas que agrega -detalle al CSV de predict-batch
+var voteDetailColumns = []string{"votos_sin_congestion", "sin_voto", "margen", "votos_arboles"}
+
+// Voto de un árbol
+type TreeVote struct {
+	Tree      int  `json:"arbol"`
+	Congested bool `json:"congestion"`
+}
+
+// Desglose de los votos de una predicción
+type VoteBreakdown struct {
+	Congested    int        `json:"congestion"`        // Árboles que votan congestión
+	NotCongested int        `json:"sin_congestion"`    // Árboles que votan sin congestión
+	Abstained    int        `json:"sin_voto"`          // Árboles que no votaron
+	Margin       int        `json:"margen"`            // Votos que tendrían que cambiar para invertir la predicción
+	Trees        []TreeVote `json:"arboles,omitempty"` // Voto de cada árbol que votó, con hasta maxDetailTrees árboles
+
+	numTrees int
+}
+
+// Modelo que puede informar el voto de cada árbol
+type treeVoter interface {
+	// Llama a fn con el índice y el voto de cada árbol que vota la consulta
+	VoteEach(att Atencion, fn func(tree int, congested bool))
+}
+
+// Función que arma el desglose de los votos del modelo para la consulta; el
+// margen tiene en cuenta la política de desempate
+func voteBreakdown(model Predictor, att Atencion, ties tiePolicy) *VoteBreakdown {
+	b := &VoteBreakdown{numTrees: model.NumTrees()}
+	voter, ok := model.(treeVoter)
+	if !ok || b.numTrees > maxDetailTrees {
+		votes, total := model.Vote(att)
+		b.count(votes, total, ties)
+		return b
+	}
+	votes, total := 0, 0
+	voter.VoteEach(att, func(tree int, congested bool) {
+		b.Trees = append(b.Trees, TreeVote{Tree: tree, Congested: congested})
+		total++
+		if congested {
+			votes++
+		}
+	})
+	b.count(votes, total, ties)
+	return b
+}
+
+// Función que completa los conteos a partir de los votos de congestión y de
+// los árboles que votaron. Un empate cambia la predicción salvo que la
+// política lo resuelva igual que la mayoría que se pierde: con optimista el
+// empate queda sin congestión y con pesimista congestionado.
+func (b *VoteBreakdown) count(votes, total int, ties tiePolicy) {
+	b.Congested, b.NotCongested = votes, total-votes
+	b.Abstained = max(b.numTrees-total, 0)
+	switch {
+	case total == 0 || votes*2 == total:
+		b.Margin = 1 // Un voto rompe el empate hacia algún lado
+	case votes*2 > total && ties == tiePessimistic:
+		b.Margin = votes - (total-1)/2 // Hay que bajar de la mitad
+	case votes*2 > total:
+		b.Margin = votes - total/2 // Con total/2 votos ya no hay mayoría
+	case ties == tieOptimistic:
+		b.Margin = total/2 + 1 - votes // Hay que pasar la mitad
+	default:
+		b.Margin = (total+1)/2 - votes // Alcanza con llegar a la mitad
+	}
+}
+
+// Función que convierte el desglose en las columnas de voteDetailColumns; el
+// voto de cada árbol va como una cadena con 1 (congestión), 0 o - (no votó)
+func (b *VoteBreakdown) record() []string {
+	var trees string
+	if b.Trees != nil {
+		votes := []byte(strings.Repeat("-", b.numTrees))
+		for _, vote := range b.Trees {
+			if vote.Tree < len(votes) {
+				votes[vote.Tree] = '0'
+				if vote.Congested {
+					votes[vote.Tree] = '1'
+				}
+			}
+		}
+		trees = string(votes)
+	}
+	return []string{strconv.Itoa(b.NotCongested), strconv.Itoa(b.Abstained), strconv.Itoa(b.Margin), trees}
+}
+
+// Función que informa el voto de cada árbol del bosque
+func (rf *RandomForest) VoteEach(att Atencion, fn func(tree int, congested bool)) {
+	for i, tree := range rf.Trees {
+		fn(i, tree.Predict(att))
+	}
+}
+
+// Función que informa el voto de cada árbol del bosque plano que llega a una hoja válida
+func (ff *FlatForest) VoteEach(att Atencion, fn func(tree int, congested bool)) {
+	for i := 0; i < ff.numTrees; i++ {
+		if prediction, ok := ff.predictTree(i, att); ok {
+			fn(i, prediction)
+		}
+	}
+}
+
+// Función que informa el voto de cada árbol que ya tiene datos en la hoja de la consulta
+func (f *OnlineForest) VoteEach(att Atencion, fn func(tree int, congested bool)) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i, tree := range f.trees {
+		if prediction, ok := tree.predict(att); ok {
+			fn(i, prediction)
+		}
+	}
+}
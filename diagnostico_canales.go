@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Diagnóstico de las etapas de la carga y el entrenamiento (train -diagnostico).
+// Cada canal entre dos etapas mide cuánto esperan los que envían (el canal está
+// lleno: la etapa siguiente no da abasto, está atascada) y los que reciben (el
+// canal está vacío: la etapa siguiente está hambrienta). Solo se toma el tiempo
+// de las operaciones que se bloquean: primero se intenta sin esperar, así
+// medir no frena el caso común. Al final se informa la fracción del tiempo que
+// cada lado pasó esperando, con una sugerencia de workers o de buffer. Además
+// un vigilante avisa si un canal con goroutines esperando no avanza durante
+// stallWarning, que suele indicar un interbloqueo o una etapa que dejó de
+// producir.
+
+// Fracción del tiempo esperando a partir de la cual un lado se considera trabado
+const waitingShare = 0.2
+
+// Tiempo sin movimiento en un canal con goroutines esperando antes de avisar
+const stallWarning = 10 * time.Second
+
+// Esperas medidas en un canal entre dos etapas
+type channelProbe struct {
+	From, To   string // Etapas que une el canal
+	Capacity   int
+	Senders    int  // Goroutines que envían (las que pueden esperar a la vez)
+	Receivers  int  // Goroutines que reciben
+	Collector  bool // Quien recibe es la última etapa, que solo junta los resultados
+	sendWait   atomic.Int64
+	recvWait   atomic.Int64
+	sends      atomic.Int64
+	blockedTx  atomic.Int32 // Envíos esperando ahora
+	blockedRx  atomic.Int32 // Recepciones esperando ahora
+	first      atomic.Int64 // Primera y última operación, en ns desde el inicio del monitor
+	last       atomic.Int64
+	monitor    *pipelineMonitor
+	stallNoted atomic.Bool
+}
+
+// Monitor de los canales de una ejecución
+type pipelineMonitor struct {
+	start  time.Time
+	mu     sync.Mutex
+	probes []*channelProbe
+	stop   chan struct{}
+}
+
+// Función que crea un monitor y arranca el vigilante de canales detenidos
+func newPipelineMonitor() *pipelineMonitor {
+	m := &pipelineMonitor{start: time.Now(), stop: make(chan struct{})}
+	go m.watch()
+	return m
+}
+
+// Función que retorna la sonda del canal entre las etapas from y to. Varias
+// cargas con el mismo canal comparten la sonda. Con un monitor nil retorna
+// nil, y las operaciones sobre una sonda nil no miden nada.
+func (m *pipelineMonitor) channel(from, to string, capacity, senders, receivers int) *channelProbe {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.probes {
+		if p.From == from && p.To == to {
+			return p
+		}
+	}
+	p := &channelProbe{From: from, To: to, Capacity: capacity, Senders: max(1, senders), Receivers: max(1, receivers), monitor: m}
+	p.first.Store(-1)
+	m.probes = append(m.probes, p)
+	return p
+}
+
+// Función que marca que quien recibe es la etapa que junta los resultados
+func (p *channelProbe) toCollector() *channelProbe {
+	if p != nil {
+		p.Collector = true
+	}
+	return p
+}
+
+// Función que anota una operación en el canal, con su espera
+func (p *channelProbe) touch() {
+	now := int64(time.Since(p.monitor.start))
+	p.first.CompareAndSwap(-1, now)
+	p.last.Store(now)
+	if p.stallNoted.Load() {
+		p.stallNoted.Store(false)
+	}
+}
+
+// Función que envía v por ch midiendo la espera si el canal está lleno
+func sendProbed[T any](p *channelProbe, ch chan<- T, v T) {
+	if p == nil {
+		ch <- v
+		return
+	}
+	select {
+	case ch <- v:
+	default:
+		p.blockedTx.Add(1)
+		start := time.Now()
+		ch <- v
+		p.sendWait.Add(int64(time.Since(start)))
+		p.blockedTx.Add(-1)
+	}
+	p.sends.Add(1)
+	p.touch()
+}
+
+// Función que recibe de ch midiendo la espera si el canal está vacío; ok es
+// false cuando el canal se cerró
+func recvProbed[T any](p *channelProbe, ch <-chan T) (v T, ok bool) {
+	if p == nil {
+		v, ok = <-ch
+		return v, ok
+	}
+	select {
+	case v, ok = <-ch:
+	default:
+		p.blockedRx.Add(1)
+		start := time.Now()
+		v, ok = <-ch
+		p.recvWait.Add(int64(time.Since(start)))
+		p.blockedRx.Add(-1)
+	}
+	p.touch()
+	return v, ok
+}
+
+// Goroutine que avisa de los canales con goroutines esperando que no avanzan
+func (m *pipelineMonitor) watch() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		probes := m.probes
+		m.mu.Unlock()
+		now := time.Since(m.start)
+		for _, p := range probes {
+			tx, rx := p.blockedTx.Load(), p.blockedRx.Load()
+			idle := now - time.Duration(p.last.Load())
+			if (tx == 0 && rx == 0) || idle < stallWarning || !p.stallNoted.CompareAndSwap(false, true) {
+				continue
+			}
+			log.Printf("Canal %s → %s sin movimiento hace %v con %d envíos y %d recepciones esperando: posible interbloqueo o etapa detenida",
+				p.From, p.To, idle.Round(time.Second), tx, rx)
+		}
+	}
+}
+
+// Función que detiene el vigilante
+func (m *pipelineMonitor) Close() {
+	if m != nil {
+		close(m.stop)
+	}
+}
+
+// Fracciones del tiempo activo del canal que esperaron los que envían y los que reciben
+func (p *channelProbe) shares() (send, recv float64, active time.Duration) {
+	active = time.Duration(p.last.Load() - p.first.Load())
+	if p.first.Load() < 0 || active <= 0 {
+		return 0, 0, 0
+	}
+	send = float64(p.sendWait.Load()) / float64(active) / float64(p.Senders)
+	recv = float64(p.recvWait.Load()) / float64(active) / float64(p.Receivers)
+	return min(send, 1), min(recv, 1), active
+}
+
+// Función que retorna el diagnóstico del canal y la sugerencia correspondiente
+func (p *channelProbe) diagnosis() string {
+	send, recv, _ := p.shares()
+	switch {
+	case send >= waitingShare && recv >= waitingShare:
+		return fmt.Sprintf("ráfagas: ambos lados esperan; un buffer mayor que %d los desacopla", p.Capacity)
+	case send >= waitingShare:
+		return fmt.Sprintf("%s atascada: %s espera para entregar; agregar workers a %s (tiene %d) o aliviar su trabajo", p.To, p.From, p.To, p.Receivers)
+	case recv >= waitingShare && p.Collector:
+		return fmt.Sprintf("%s espera, como es normal en la última etapa: el ritmo lo marca %s", p.To, p.From)
+	case recv >= waitingShare:
+		return fmt.Sprintf("%s hambrienta: espera trabajo de %s; agregar workers a %s (tiene %d) o quitar de %s", p.To, p.From, p.From, p.Senders, p.To)
+	}
+	return "equilibrado"
+}
+
+// Función que escribe la tabla de esperas y el diagnóstico de cada canal
+func (m *pipelineMonitor) Report(w io.Writer) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "%-42s %6s %8s %10s %10s %10s  %s\n", "CANAL", "BUFFER", "ENVÍOS", "ACTIVO", "ESP_ENVÍO", "ESP_RECEP", "DIAGNÓSTICO")
+	for _, p := range m.probes {
+		send, recv, active := p.shares()
+		fmt.Fprintf(w, "%-42s %6d %8d %10s %9.1f%% %9.1f%%  %s\n", p.From+" → "+p.To, p.Capacity, p.sends.Load(),
+			active.Round(time.Millisecond), send*100, recv*100, p.diagnosis())
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+)
+
+// Diferencias entre dos cargas de datos: antes de reentrenar con la
+// actualización mensual conviene ver qué cambió respecto de la carga anterior.
+// diff compara dos CSV (o, en un guion del menú, dos conjuntos procesados) y
+// muestra los establecimientos nuevos y los que dejaron de aparecer, la
+// variación de filas por mes y el corrimiento de la distribución de Atendidos
+// y Atenciones: en general con el índice de estabilidad poblacional (PSI) sobre
+// los deciles de la carga anterior, y por establecimiento con la variación del
+// promedio. Los cambios mayores que la tolerancia se marcan como alertas; con
+// -fallar el comando termina con código 8 si hay alguna.
+
+// PSI a partir del cual se considera que la distribución cambió (la regla
+// habitual: menos de 0.1 estable, entre 0.1 y 0.25 moderado, más de 0.25 grande)
+const psiShift = 0.25
+
+// Variación de filas de un mes entre las dos cargas
+type monthDelta struct {
+	Month         recordDate // Año y mes (Day = 0)
+	Before, After int
+}
+
+// Corrimiento de un valor entre las dos cargas
+type valueShift struct {
+	Name                string
+	AvgBefore, AvgAfter float64
+	P95Before, P95After float64
+	PSI                 float64
+	value               func(Atencion) float64
+}
+
+// Variación del promedio de Atendidos de un establecimiento presente en las dos cargas
+type establishmentShift struct {
+	Name                string
+	AvgBefore, AvgAfter float64
+}
+
+// Diferencias entre dos cargas
+type datasetDiff struct {
+	RowsBefore, RowsAfter int
+	Added, Removed        []string // Establecimientos normalizados
+	Months                []monthDelta
+	Values                []valueShift
+	Establishments        []establishmentShift // Solo los que superan la tolerancia
+	Alerts                []string
+}
+
+// Función que retorna la variación relativa de after respecto de before
+func relativeChange(before, after float64) float64 {
+	if before == 0 {
+		if after == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (after - before) / before
+}
+
+// Función que compara dos cargas; tolerance es la variación relativa de filas
+// por mes o de promedio por establecimiento a partir de la cual se alerta
+func diffDatasets(before, after []Atencion, tolerance float64) datasetDiff {
+	d := datasetDiff{RowsBefore: len(before), RowsAfter: len(after)}
+	statsBefore := normalizedAverages(before)
+	statsAfter := normalizedAverages(after)
+
+	// Establecimientos nuevos, retirados y con la demanda corrida
+	for _, name := range sortedKeys(statsAfter) {
+		s, ok := statsBefore[name]
+		if !ok {
+			d.Added = append(d.Added, name)
+			continue
+		}
+		if math.Abs(relativeChange(s.Atendidos, statsAfter[name].Atendidos)) > tolerance {
+			d.Establishments = append(d.Establishments, establishmentShift{name, s.Atendidos, statsAfter[name].Atendidos})
+		}
+	}
+	for _, name := range sortedKeys(statsBefore) {
+		if _, ok := statsAfter[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	if len(d.Added) > 0 {
+		d.Alerts = append(d.Alerts, fmt.Sprintf("%d establecimientos nuevos", len(d.Added)))
+	}
+	if len(d.Removed) > 0 {
+		d.Alerts = append(d.Alerts, fmt.Sprintf("%d establecimientos dejaron de aparecer", len(d.Removed)))
+	}
+	if len(d.Establishments) > 0 {
+		d.Alerts = append(d.Alerts, fmt.Sprintf("%d establecimientos con el promedio de atendidos corrido más de %.0f%%", len(d.Establishments), tolerance*100))
+	}
+
+	// Filas por mes
+	byMonth := func(att Atencion) recordDate { return recordDate{Year: att.Anio, Month: att.Mes} }
+	monthsBefore := GroupBy(before, byMonth).Aggregate(Count())
+	monthsAfter := GroupBy(after, byMonth).Aggregate(Count())
+	months := make(map[recordDate]bool)
+	for m := range monthsBefore {
+		months[m] = true
+	}
+	for m := range monthsAfter {
+		months[m] = true
+	}
+	for m := range months {
+		delta := monthDelta{Month: m}
+		if s, ok := monthsBefore[m]; ok {
+			delta.Before = int(s[0])
+		}
+		if s, ok := monthsAfter[m]; ok {
+			delta.After = int(s[0])
+		}
+		d.Months = append(d.Months, delta)
+	}
+	sort.Slice(d.Months, func(i, j int) bool { return d.Months[i].Month.before(d.Months[j].Month) })
+	for _, m := range d.Months {
+		if math.Abs(relativeChange(float64(m.Before), float64(m.After))) > tolerance {
+			d.Alerts = append(d.Alerts, fmt.Sprintf("el mes %s cambió de %d a %d filas", monthLabel(m.Month), m.Before, m.After))
+		}
+	}
+
+	// Distribución de los valores
+	for _, v := range []valueShift{{Name: "Atendidos", value: atendidosValue}, {Name: "Atenciones", value: atencionesValue}} {
+		all := func(Atencion) bool { return true }
+		if s, ok := GroupBy(before, all).Aggregate(Avg(v.value), P95(v.value))[true]; ok {
+			v.AvgBefore, v.P95Before = s[0], s[1]
+		}
+		if s, ok := GroupBy(after, all).Aggregate(Avg(v.value), P95(v.value))[true]; ok {
+			v.AvgAfter, v.P95After = s[0], s[1]
+		}
+		v.PSI = populationStability(before, after, v.value)
+		if v.PSI > psiShift {
+			d.Alerts = append(d.Alerts, fmt.Sprintf("la distribución de %s cambió (PSI %.2f)", v.Name, v.PSI))
+		}
+		d.Values = append(d.Values, v)
+	}
+	return d
+}
+
+// Función que retorna los promedios de cada establecimiento por nombre
+// normalizado, uniendo las grafías de las estadísticas compartidas
+func normalizedAverages(data []Atencion) map[string]featureAverage {
+	averages := make(map[string]featureAverage)
+	for name, e := range statisticsFor(data).Establishments {
+		key := normalizeEstablishment(name)
+		averages[key] = averages[key].combine(e.Average)
+	}
+	return averages
+}
+
+// Mes como AAAA-MM, o --MM si no se conoce el año
+func monthLabel(d recordDate) string {
+	if d.Year == 0 {
+		return fmt.Sprintf("--%02d", d.Month)
+	}
+	return fmt.Sprintf("%04d-%02d", d.Year, d.Month)
+}
+
+// Función que calcula el índice de estabilidad poblacional de un valor: suma
+// de (a-b)·ln(a/b) sobre las fracciones de filas de cada carga en los deciles
+// de la anterior. Las fracciones vacías se suavizan para que el logaritmo exista.
+func populationStability(before, after []Atencion, value func(Atencion) float64) float64 {
+	if len(before) == 0 || len(after) == 0 {
+		return 0
+	}
+	values := make([]float64, len(before))
+	for i, att := range before {
+		values[i] = value(att)
+	}
+	slices.Sort(values)
+	var edges []float64 // Límites superiores de los deciles, sin repetir
+	for q := 1; q < 10; q++ {
+		edge := values[q*len(values)/10]
+		if len(edges) == 0 || edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+	bin := func(v float64) int { return sort.SearchFloat64s(edges, v) }
+	countsBefore := make([]float64, len(edges)+1)
+	countsAfter := make([]float64, len(edges)+1)
+	for _, v := range values {
+		countsBefore[bin(v)]++
+	}
+	for _, att := range after {
+		countsAfter[bin(value(att))]++
+	}
+	const smoothing = 1e-4
+	psi := 0.0
+	for i := range countsBefore {
+		b := max(countsBefore[i]/float64(len(before)), smoothing)
+		a := max(countsAfter[i]/float64(len(after)), smoothing)
+		psi += (a - b) * math.Log(a/b)
+	}
+	return psi
+}
+
+// Función que escribe las diferencias como texto
+func writeDatasetDiff(w io.Writer, d datasetDiff, beforeName, afterName string) {
+	fmt.Fprintf(w, "Filas: %d en %s, %d en %s (%+d)\n", d.RowsBefore, beforeName, d.RowsAfter, afterName, d.RowsAfter-d.RowsBefore)
+	for _, name := range d.Added {
+		fmt.Fprintf(w, "+ %s\n", name)
+	}
+	for _, name := range d.Removed {
+		fmt.Fprintf(w, "- %s\n", name)
+	}
+
+	fmt.Fprintf(w, "\n%-8s %8s %8s %8s\n", "MES", "ANTES", "DESPUÉS", "VARIACIÓN")
+	for _, m := range d.Months {
+		change := "nuevo"
+		if m.Before > 0 {
+			change = fmt.Sprintf("%+.1f%%", relativeChange(float64(m.Before), float64(m.After))*100)
+		}
+		fmt.Fprintf(w, "%-8s %8d %8d %8s\n", monthLabel(m.Month), m.Before, m.After, change)
+	}
+
+	fmt.Fprintf(w, "\n%-11s %9s %9s %9s %9s %6s\n", "VALOR", "PROM_ANT", "PROM_DESP", "P95_ANT", "P95_DESP", "PSI")
+	for _, v := range d.Values {
+		fmt.Fprintf(w, "%-11s %9.2f %9.2f %9.0f %9.0f %6.3f\n", v.Name, v.AvgBefore, v.AvgAfter, v.P95Before, v.P95After, v.PSI)
+	}
+	if len(d.Establishments) > 0 {
+		fmt.Fprintln(w, "\nEstablecimientos con el promedio de atendidos corrido:")
+		for _, e := range d.Establishments {
+			fmt.Fprintf(w, "  %s: %.2f -> %.2f (%+.0f%%)\n", e.Name, e.AvgBefore, e.AvgAfter, relativeChange(e.AvgBefore, e.AvgAfter)*100)
+		}
+	}
+
+	if len(d.Alerts) == 0 {
+		fmt.Fprintln(w, "\nSin alertas: los datos nuevos se parecen a los anteriores.")
+		return
+	}
+	fmt.Fprintln(w, "\nAlertas:")
+	for _, alert := range d.Alerts {
+		fmt.Fprintf(w, "  %s\n", alert)
+	}
+}
+
+// Error de diff -fallar cuando hay alertas
+var errDataShift = errors.New("los datos nuevos tienen cambios mayores que la tolerancia")
+
+// Subcomando "diff": compara dos cargas de datos antes de reentrenar
+func diffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	beforePath := fs.String("antes", "", "CSV de la carga anterior")
+	afterPath := fs.String("despues", "", "CSV de la carga nueva")
+	tolerance := fs.Float64("tolerancia", 0.2, "variación relativa de filas por mes o de atendidos promedio por establecimiento a partir de la cual se alerta")
+	fail := fs.Bool("fallar", false, "terminar con código 8 si hay alertas")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 2 && *beforePath == "" && *afterPath == "" {
+		*beforePath, *afterPath = fs.Arg(0), fs.Arg(1) // diff antes.csv despues.csv
+	}
+	if *beforePath == "" || *afterPath == "" {
+		return withExitCode(exitUsage, errors.New("se necesitan -antes y -despues"))
+	}
+	if *tolerance <= 0 {
+		return withExitCode(exitUsage, fmt.Errorf("tolerancia inválida: %v", *tolerance))
+	}
+
+	ctx := context.Background()
+	before, err := loadAtenciones(ctx, *beforePath)
+	if err != nil {
+		return withExitCode(exitLoadFailure, fmt.Errorf("%s: %w", *beforePath, err))
+	}
+	after, err := loadAtenciones(ctx, *afterPath)
+	if err != nil {
+		return withExitCode(exitLoadFailure, fmt.Errorf("%s: %w", *afterPath, err))
+	}
+	d := diffDatasets(before, after, *tolerance)
+	writeDatasetDiff(os.Stdout, d, *beforePath, *afterPath)
+	if *fail && len(d.Alerts) > 0 {
+		return withExitCode(exitDataShift, errDataShift)
+	}
+	return nil
+}
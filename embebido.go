@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Núcleo de predicción para los builds sin línea de comandos: la biblioteca
+// compartida de C (embebido_cshared.go, para la intranet en PHP con FFI) y el
+// módulo WASM (embebido_wasm.go, para la demo en el navegador). Los dos
+// identifican los modelos cargados con un número entero, porque ni C ni
+// JavaScript pueden guardar punteros de Go.
+
+// Reemplaza a la línea de comandos en los builds que no la tienen (nil = CLI)
+var embeddedMain func()
+
+// Modelos cargados por número
+type modelHandles struct {
+	mu     sync.Mutex
+	next   int
+	models map[int]Predictor
+}
+
+// Modelos cargados desde C o JavaScript
+var embeddedModels = &modelHandles{models: make(map[int]Predictor)}
+
+// Función que registra un modelo y retorna su número (empiezan en 1)
+func (h *modelHandles) add(model Predictor) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next++
+	h.models[h.next] = model
+	return h.next
+}
+
+// Función que retorna el modelo de un número
+func (h *modelHandles) get(handle int) (Predictor, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	model, ok := h.models[handle]
+	if !ok {
+		return nil, fmt.Errorf("no hay un modelo cargado con el número %d", handle)
+	}
+	return model, nil
+}
+
+// Función que olvida un modelo y cierra su archivo si es plano
+func (h *modelHandles) remove(handle int) {
+	h.mu.Lock()
+	model := h.models[handle]
+	delete(h.models, handle)
+	h.mu.Unlock()
+	if closer, ok := model.(interface{ Close() error }); ok {
+		closer.Close()
+	}
+}
+
+// Función que predice un establecimiento en un mes y día, rechazando las
+// fechas que no existen (el 29 de febrero sí, porque existe en algún año)
+func predictDay(model Predictor, establishment string, month, day int) (Prediction, error) {
+	if month < 1 || month > 12 {
+		return Prediction{}, errors.New("mes inválido")
+	}
+	date := time.Date(2024, time.Month(month), day, 0, 0, 0, 0, time.UTC) // Año bisiesto
+	if day < 1 || date.Day() != day {
+		return Prediction{}, errors.New("día inválido")
+	}
+	return Predict(model, establishment, date)
+}
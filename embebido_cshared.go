@@ -0,0 +1,62 @@
+//go:build cshared
+
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import "unsafe"
+
+// Biblioteca compartida de C. Se compila con
+//
+//	go build -tags cshared -buildmode=c-shared -o libtp.so .
+//
+// que genera también libtp.h. Las funciones que pueden fallar retornan NULL si
+// salió bien o el mensaje de error, que se libera con tpFreeString.
+
+// Función que carga un modelo (gob o plano) y deja su número en handle
+//
+//export tpLoadModel
+func tpLoadModel(path *C.char, handle *C.int) *C.char {
+	model, err := OpenModel(C.GoString(path))
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	*handle = C.int(embeddedModels.add(model))
+	return nil
+}
+
+// Función que predice un establecimiento en un mes y día; deja en congested
+// 1 o 0 y en probability la fracción de árboles que votan congestión
+//
+//export tpPredict
+func tpPredict(handle C.int, establishment *C.char, month, day C.int, congested *C.int, probability *C.double) *C.char {
+	model, err := embeddedModels.get(int(handle))
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	p, err := predictDay(model, C.GoString(establishment), int(month), int(day))
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	*congested = 0
+	if p.Congested {
+		*congested = 1
+	}
+	*probability = C.double(p.Probability)
+	return nil
+}
+
+// Función que libera un modelo cargado con tpLoadModel
+//
+//export tpFreeModel
+func tpFreeModel(handle C.int) {
+	embeddedModels.remove(int(handle))
+}
+
+// Función que libera un mensaje de error
+//
+//export tpFreeString
+func tpFreeString(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
@@ -0,0 +1,70 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"syscall/js"
+)
+
+// Módulo WASM para la demo en el navegador. Se compila con
+//
+//	GOOS=js GOARCH=wasm go build -o tp.wasm .
+//
+// y se carga con el wasm_exec.js de Go. Registra en el objeto global:
+//
+//	tpLoadModel(bytes)                    -> {modelo} o {error}
+//	tpPredict(modelo, establecimiento, mes, dia)
+//	                                      -> {congestion, probabilidad, votos, arboles, desconocido, advertencia} o {error}
+//	tpFreeModel(modelo)
+//
+// donde bytes es un Uint8Array con un modelo gob (comprimido o no); los
+// modelos planos necesitan mmap y no se pueden cargar en el navegador.
+
+func init() {
+	embeddedMain = serveWasm
+}
+
+// Función que registra las funciones y deja el módulo vivo para atenderlas
+func serveWasm() {
+	js.Global().Set("tpLoadModel", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) != 1 {
+			return jsError(errors.New("uso: tpLoadModel(bytes)"))
+		}
+		data := make([]byte, args[0].Get("length").Int())
+		js.CopyBytesToGo(data, args[0])
+		model, err := ReadModel(bytes.NewReader(data))
+		if err != nil {
+			return jsError(err)
+		}
+		return map[string]any{"modelo": embeddedModels.add(model)}
+	}))
+	js.Global().Set("tpPredict", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) != 4 {
+			return jsError(errors.New("uso: tpPredict(modelo, establecimiento, mes, dia)"))
+		}
+		model, err := embeddedModels.get(args[0].Int())
+		if err != nil {
+			return jsError(err)
+		}
+		p, err := predictDay(model, args[1].String(), args[2].Int(), args[3].Int())
+		if err != nil {
+			return jsError(err)
+		}
+		return map[string]any{"congestion": p.Congested, "probabilidad": p.Probability, "votos": p.Votes, "arboles": p.Trees,
+			"desconocido": p.Fallback, "advertencia": p.Caveat}
+	}))
+	js.Global().Set("tpFreeModel", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) == 1 {
+			embeddedModels.remove(args[0].Int())
+		}
+		return nil
+	}))
+	select {} // Las funciones se atienden mientras la página esté abierta
+}
+
+// Función que retorna un error como objeto de JavaScript
+func jsError(err error) any {
+	return map[string]any{"error": err.Error()}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Decisión ante un empate en la votación por mayoría. Con un número par de
+// árboles la mitad puede votar congestión y la otra mitad no; hasta ahora eso
+// se resolvía como "no congestionado" sin avisar. La política se guarda en el
+// pipeline del modelo (train -empates) y puede cambiarse al predecir:
+//
+//   - optimista: el empate se resuelve como no congestionado (por defecto,
+//     igual que antes)
+//   - pesimista: el empate se resuelve como congestionado
+//   - azar: el empate se resuelve tirando una moneda
+//   - abstenerse: no se decide; la predicción queda sin decisión y se informa
+//
+// En todos los casos el empate se informa en la salida de la predicción.
+
+// Política de desempate
+type tiePolicy int
+
+const (
+	tieOptimistic  tiePolicy = iota // Empate = no congestionado
+	tiePessimistic                  // Empate = congestionado
+	tieRandom                       // Empate = moneda
+	tieAbstain                      // Empate = sin decisión
+)
+
+// Nombres de las políticas, en el orden de las constantes
+var tiePolicyNames = [...]string{"optimista", "pesimista", "azar", "abstenerse"}
+
+func (p tiePolicy) String() string {
+	return tiePolicyNames[p]
+}
+
+// Función que interpreta el nombre de una política de desempate (vacío = optimista)
+func ParseTiePolicy(name string) (tiePolicy, error) {
+	if name == "" {
+		return tieOptimistic, nil
+	}
+	for i, n := range tiePolicyNames {
+		if n == name {
+			return tiePolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("política de empate desconocida %q (optimista, pesimista, azar o abstenerse)", name)
+}
+
+// Resultado de la votación
+type voteDecision struct {
+	Congested bool // Decisión final (false si se abstuvo)
+	Tie       bool // La mitad exacta de los árboles votó congestión
+	Abstained bool // Empate sin decisión, con la política abstenerse
+}
+
+// Función que decide la congestión por mayoría de votos y resuelve los
+// empates según la política
+func decideVote(votes, total int, policy tiePolicy) voteDecision {
+	if total == 0 || votes*2 != total {
+		return voteDecision{Congested: total > 0 && votes > total/2}
+	}
+	d := voteDecision{Tie: true}
+	switch policy {
+	case tiePessimistic:
+		d.Congested = true
+	case tieRandom:
+		d.Congested = rand.Intn(2) == 1
+	case tieAbstain:
+		d.Abstained = true
+	}
+	return d
+}
+
+// Función que describe el empate para mostrarlo junto a la predicción ("" si no hubo)
+func (d voteDecision) tieLabel(policy tiePolicy) string {
+	if !d.Tie {
+		return ""
+	}
+	return policy.String()
+}
+
+// Función que retorna la política de desempate del pipeline (optimista sin pipeline)
+func (p *Pipeline) tiePolicy() tiePolicy {
+	if p == nil {
+		return tieOptimistic
+	}
+	return p.Ties
+}
+
+// Función que retorna una copia del pipeline con otra política de desempate,
+// para cambiarla al predecir sin tocar el modelo cargado. Un modelo guardado
+// sin pipeline sigue sin él y resuelve los empates como optimista.
+func withTiePolicy(p *Pipeline, policy tiePolicy) *Pipeline {
+	if p == nil {
+		return nil
+	}
+	copied := *p
+	copied.Ties = policy
+	return &copied
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDecideVote(t *testing.T) {
+	cases := []struct {
+		votes, total int
+		policy       tiePolicy
+		want         voteDecision
+	}{
+		{3, 5, tieOptimistic, voteDecision{Congested: true}},
+		{2, 5, tiePessimistic, voteDecision{}},
+		{0, 0, tiePessimistic, voteDecision{}},
+		{2, 4, tieOptimistic, voteDecision{Tie: true}},
+		{2, 4, tiePessimistic, voteDecision{Congested: true, Tie: true}},
+		{2, 4, tieAbstain, voteDecision{Tie: true, Abstained: true}},
+	}
+	for _, c := range cases {
+		if got := decideVote(c.votes, c.total, c.policy); got != c.want {
+			t.Errorf("%d de %d con %s: %+v, se esperaba %+v", c.votes, c.total, c.policy, got, c.want)
+		}
+	}
+	if d := decideVote(1, 2, tieRandom); !d.Tie || d.Abstained {
+		t.Errorf("azar: %+v, se esperaba un empate decidido", d)
+	}
+}
+
+func TestVoteBreakdownMarginFollowsTiePolicy(t *testing.T) {
+	cases := []struct {
+		votes, total int
+		policy       tiePolicy
+		want         int
+	}{
+		{3, 4, tieOptimistic, 1},  // Con 2 votos el empate queda sin congestión
+		{3, 4, tiePessimistic, 2}, // El empate sigue congestionado: hay que bajar a 1
+		{1, 4, tieOptimistic, 2},  // Hay que llegar a 3
+		{1, 4, tiePessimistic, 1}, // Con 2 votos el empate ya es congestión
+		{1, 4, tieAbstain, 1},     // Con 2 votos queda sin decisión
+		{2, 4, tieOptimistic, 1},
+		{3, 5, tiePessimistic, 1},
+		{2, 5, tieOptimistic, 1},
+	}
+	for _, c := range cases {
+		b := &VoteBreakdown{numTrees: c.total}
+		if b.count(c.votes, c.total, c.policy); b.Margin != c.want {
+			t.Errorf("%d de %d con %s: margen %d, se esperaba %d", c.votes, c.total, c.policy, b.Margin, c.want)
+		}
+	}
+}
+
+// La política de desempate viaja con el modelo en los formatos gob y plano
+func TestTiePolicyRoundTrip(t *testing.T) {
+	rf := &RandomForest{
+		Trees: []*DecisionTree{
+			{Root: &Node{IsLeaf: true, Prediction: true}},
+			{Root: &Node{IsLeaf: true}},
+		},
+		Pipeline: &Pipeline{CongestionThreshold: congestionThreshold, Ties: tiePessimistic},
+	}
+	dir := t.TempDir()
+	gobPath, flatPath := filepath.Join(dir, "modelo.gob"), filepath.Join(dir, "modelo.tpfl")
+	if err := rf.Save(gobPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := rf.SaveFlat(flatPath); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadModel(gobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff, err := OpenFlatModel(flatPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+
+	for name, model := range map[string]Predictor{"gob": loaded, "plano": ff} {
+		if policy := pipelineFor(model, nil).tiePolicy(); policy != tiePessimistic {
+			t.Errorf("%s: política %s, se esperaba pesimista", name, policy)
+		}
+		if !predictWith(model, Atencion{Mes: 3, Dia: 10}) {
+			t.Errorf("%s: el empate tendría que resolverse como congestionado", name)
+		}
+	}
+	if !loaded.Predict("A", 3, 10) || !ff.Predict("A", 3, 10) {
+		t.Error("Predict no aplica la política pesimista al empate")
+	}
+}
+
+// El error OOB resuelve los empates con la política del bosque y no cuenta
+// las filas sin decisión
+func TestOOBErrorFollowsTiePolicy(t *testing.T) {
+	congested := Atencion{Mes: 1, Dia: 1, Atendidos: 1000}
+	for policy, want := range map[tiePolicy]float64{tieOptimistic: 0.5, tiePessimistic: 0, tieAbstain: 0} {
+		rf := &RandomForest{
+			Pipeline: &Pipeline{CongestionThreshold: congestionThreshold, Ties: policy},
+			data:     []Atencion{congested, congested},
+			oobVotes: []int32{1, 2}, // La primera fila empata y la segunda tiene mayoría
+			oobCount: []int32{2, 2},
+		}
+		if got := rf.oobError(); got != want {
+			t.Errorf("%s: error OOB %g, se esperaba %g", policy, got, want)
+		}
+	}
+
+	data, err := loadAtencionesTest(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf := &RandomForest{Seed: 1, Ties: tieAbstain}
+	rf.TrainTrees(data, 4)
+	if rf.Pipeline.tiePolicy() != tieAbstain {
+		t.Fatalf("el pipeline entrenado tiene la política %s, se esperaba abstenerse", rf.Pipeline.tiePolicy())
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reporte generado, listo para entregar
+type reportFile struct {
+	Name        string // Nombre del archivo, por ejemplo pronostico-2026-03.html
+	Title       string // Título, usado como asunto del correo
+	ContentType string
+	Body        []byte
+}
+
+// Destino al que se entrega un reporte. Cada esquema de URI tiene su
+// implementación en senderFactories.
+type ReportSender interface {
+	Send(ctx context.Context, report reportFile) error
+	String() string
+}
+
+// Destinos disponibles, indexados por el esquema de la URI:
+//
+//	smtp://usuario@host:587?de=origen@x.org&para=a@x.org,b@x.org
+//	s3://bucket/prefijo/
+//	gdrive://id-de-carpeta
+//	file:///ruta/a/un/directorio
+var senderFactories = map[string]func(u *url.URL) (ReportSender, error){
+	"smtp":   newSMTPSender,
+	"s3":     newS3Sender,
+	"gdrive": newDriveSender,
+	"file":   newFileSender,
+}
+
+// Función que crea el destino descrito por una URI
+func parseSender(uri string) (ReportSender, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("destino inválido %q: %w", uri, err)
+	}
+	factory, ok := senderFactories[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("destino %q: esquema desconocido (smtp, s3, gdrive o file)", uri)
+	}
+	return factory(u)
+}
+
+// Lista de destinos de la línea de comandos (la opción se puede repetir)
+type senderFlags []ReportSender
+
+func (s *senderFlags) String() string {
+	names := make([]string, len(*s))
+	for i, sender := range *s {
+		names[i] = sender.String()
+	}
+	return strings.Join(names, ",")
+}
+
+func (s *senderFlags) Set(value string) error {
+	sender, err := parseSender(value)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, sender)
+	return nil
+}
+
+// Función que entrega el reporte a todos los destinos en paralelo, reintentando
+// cada uno con espera creciente. Retorna los errores de los que fallaron.
+func deliverReport(ctx context.Context, senders []ReportSender, report reportFile, retries int) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(senders))
+	for i, sender := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			beat := heartbeatFrom(ctx)
+			for attempt := 0; attempt <= retries; attempt++ {
+				beat()
+				if attempt > 0 {
+					select {
+					case <-time.After(time.Duration(attempt) * 2 * time.Second):
+					case <-ctx.Done():
+						errs[i] = ctx.Err()
+						return
+					}
+				}
+				if err = sender.Send(ctx, report); err == nil {
+					return
+				}
+			}
+			errs[i] = fmt.Errorf("%s: %w", sender, err)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Envío por correo. La contraseña se toma de la URI o de SMTP_PASSWORD.
+type smtpSender struct {
+	addr     string
+	user     string
+	password string
+	from     string
+	to       []string
+}
+
+func newSMTPSender(u *url.URL) (ReportSender, error) {
+	s := &smtpSender{addr: u.Host, from: u.Query().Get("de")}
+	if u.Port() == "" {
+		s.addr += ":587"
+	}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if s.password == "" {
+		s.password = os.Getenv("SMTP_PASSWORD")
+	}
+	for _, to := range strings.Split(u.Query().Get("para"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			s.to = append(s.to, to)
+		}
+	}
+	if s.from == "" || len(s.to) == 0 {
+		return nil, errors.New("smtp: se necesitan los parámetros de= y para=")
+	}
+	return s, nil
+}
+
+func (s *smtpSender) String() string {
+	return "smtp://" + s.addr
+}
+
+// Función que envía el reporte en el cuerpo del correo. smtp.SendMail usa
+// STARTTLS si el servidor lo ofrece.
+func (s *smtpSender) Send(ctx context.Context, report reportFile) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", report.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s; charset=utf-8\r\n", report.ContentType)
+	fmt.Fprintf(&msg, "Content-Disposition: inline; filename=%q\r\n\r\n", report.Name)
+	msg.Write(bytes.ReplaceAll(report.Body, []byte("\n"), []byte("\r\n")))
+
+	var auth smtp.Auth
+	if s.user != "" {
+		host, _, _ := strings.Cut(s.addr, ":")
+		auth = smtp.PlainAuth("", s.user, s.password, host)
+	}
+	return smtp.SendMail(s.addr, auth, s.from, s.to, msg.Bytes())
+}
+
+// Subida a un bucket de S3 bajo un prefijo
+type s3Sender struct {
+	client *s3Client
+	bucket string
+	prefix string
+}
+
+func newS3Sender(u *url.URL) (ReportSender, error) {
+	client, err := newS3ClientFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &s3Sender{client: client, bucket: u.Host, prefix: strings.TrimPrefix(u.Path, "/")}, nil
+}
+
+func (s *s3Sender) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+func (s *s3Sender) Send(ctx context.Context, report reportFile) error {
+	return s.client.Put(ctx, s.bucket, s.prefix+report.Name, report.ContentType, report.Body)
+}
+
+// Subida a una carpeta de Google Drive con un token OAuth en GOOGLE_OAUTH_ACCESS_TOKEN
+type driveSender struct {
+	folder string
+	token  string
+	client *http.Client
+}
+
+func newDriveSender(u *url.URL) (ReportSender, error) {
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return nil, errors.New("gdrive: falta GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	return &driveSender{folder: u.Host, token: token, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+func (d *driveSender) String() string {
+	return "gdrive://" + d.folder
+}
+
+// Función que sube el archivo con la carga multipart de la API de Drive v3:
+// una parte con los metadatos y otra con el contenido
+func (d *driveSender) Send(ctx context.Context, report reportFile) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	meta, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	json.NewEncoder(meta).Encode(map[string]any{"name": report.Name, "parents": []string{d.folder}})
+	content, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {report.ContentType}})
+	if err != nil {
+		return err
+	}
+	content.Write(report.Body)
+	mw.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://www.googleapis.com/upload/drive/v3/files?uploadType=multipart", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("gdrive respondió %s: %s", resp.Status, detail)
+	}
+	return nil
+}
+
+// Copia a un directorio local (o montado), útil también para probar
+type fileSender struct {
+	dir string
+}
+
+func newFileSender(u *url.URL) (ReportSender, error) {
+	if u.Path == "" {
+		return nil, errors.New("file: falta la ruta del directorio")
+	}
+	return &fileSender{dir: u.Path}, nil
+}
+
+func (f *fileSender) String() string {
+	return "file://" + f.dir
+}
+
+func (f *fileSender) Send(ctx context.Context, report reportFile) error {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(f.dir, report.Name), report.Body, 0o644)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subcomando "train": carga un CSV, entrena el bosque y lo guarda, sin menú.
+// Pensado para reentrenamientos programados (por ejemplo, cada noche).
+func trainCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	dataPath := fs.String("datos", "atenciones_filtradas.csv", "archivo CSV de atenciones, o varios separados por comas o con un patrón como datos/atenciones_*.csv (de cualquier versión del esquema)")
+	trees := fs.Int("arboles", 100, "número de árboles")
+	output := fs.String("o", "modelo.gob.gz", "archivo donde guardar el modelo")
+	early := fs.Bool("parada-temprana", false, "detener el entrenamiento cuando el error OOB deje de mejorar")
+	filterExpr := fs.String("filtro", "", `filtrar los registros antes de entrenar, p. ej. 'mes >= 6 AND establecimiento ~ "HOSPITAL"'`)
+	featureList := fs.String("caracteristicas", "", "características separadas por comas sobre las que dividir (vacío = Mes,Dia; 'todas')")
+	allowLeakage := fs.Bool("permitir-fuga", false, "permitir características que no se conocen al predecir")
+	manifestPath := fs.String("manifiesto", "", "manifiesto JSON con la suma SHA-256 y el esquema esperados de -datos")
+	snapshotPath := fs.String("instantanea", "", "archivo gob con los registros validados, reutilizado mientras -datos no cambie ('auto' = en el caché)")
+	channelSize := fs.Int("canal", defaultChannelSize, "capacidad del canal de registros durante la carga")
+	chunkRows := fs.Int("bloque-carga", 0, "filas por bloque de validación durante la carga (0 = adaptativo)")
+	overflow := fs.String("desborde", "bloquear", "si el canal se llena: bloquear o disco (escribir a un archivo temporal)")
+	showStats := fs.Bool("estadisticas", false, "mostrar estadísticas de los registros calculadas durante la carga")
+	anomalySigmas := fs.Float64("anomalias", 0, "marcar registros con atendidos mayores al promedio del establecimiento más N desviaciones (0 = no)")
+	maxParallel := fs.Int("max-paralelo", 0, "árboles que se construyen a la vez (0 = según la memoria disponible)")
+	archivePath := fs.String("archivo-crudo", "", "guardar los registros válidos en este CSV durante la carga (.gz para comprimir)")
+	bookingsPath := fs.String("citas", "", "agenda de citas programadas (CSV o conexión postgres://, mysql:// o sqlite:) para la característica Citas")
+	bookingsTable := fs.String("tabla-citas", defaultBookingsTable, "tabla de la agenda con una conexión SQL en -citas")
+	capacityPath := fs.String("capacidades", "", "CSV de metadatos con la capacidad de cada establecimiento: congestión si atendidos > alfa·capacidad (vacío = umbral fijo)")
+	threshold := fs.Int("umbral", congestionThreshold, "atendidos a partir de los cuales un día está congestionado (ver threshold-sweep)")
+	capacityFactor := fs.Float64("alfa", defaultCapacityFactor, "fracción de la capacidad a partir de la cual un día está congestionado")
+	gapFillMode := fs.String("completar-calendario", "", "agregar filas para los días sin datos de cada establecimiento: ceros o promedio (vacío = no)")
+	yearList := fs.String("anios", "", "año de los registros de cada archivo de -datos sin columna ANIO, separados por comas en el mismo orden")
+	recencyDecay := fs.Float64("peso-recencia", 0, "peso de cada año respecto del siguiente en las muestras de los árboles, p. ej. 0.5 (0 = sin ponderar)")
+	winsorize := fs.Float64("winsorizar", 0, "recortar los atendidos de cada establecimiento a su percentil, p. ej. 0.99 (0 = no)")
+	forecastDays := fs.Int("pronostico", 0, "días después del último dato en los que la demanda esperada sale de Holt-Winters y no del promedio (0 = no)")
+	minAccuracy := fs.Float64("precision-minima", 0, "precisión OOB (1 - error OOB) mínima; si el modelo no la alcanza no se guarda y se sale con código 6 (0 = no verificar)")
+	holdoutFraction := fs.Float64("reserva", 0, "fracción de los registros que se reserva al azar para evaluar el modelo (0 = ninguna)")
+	strategyName := fs.String("estrategia", "goroutines", "cómo se reparten la validación de la carga y la construcción de los árboles: goroutines, pool, pipeline o secuencial")
+	aggregation := fs.String("agregacion", "", "resumir cada establecimiento durante la carga con un mapa compartido (mutex) o con una goroutine por partición (actores)")
+	diagnose := fs.Bool("diagnostico", false, "medir las esperas en los canales entre etapas y señalar las hambrientas o atascadas")
+	ties := fs.String("empates", "optimista", "decisión ante un empate en la votación, que se guarda con el modelo: optimista, pesimista, azar o abstenerse")
+	seed := fs.Int64("semilla", 0, "semilla de los árboles: con la misma, el mismo modelo con cualquier -estrategia (0 = al azar)")
+	resultPath := fs.String("resultado", "", "archivo JSON con el resultado del entrenamiento, escrito también si falla")
+	var timeout OperationTimeout
+	timeout.register(fs, "el entrenamiento", "y guardar los árboles ya entrenados")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := timeout.check(); err != nil {
+		return err
+	}
+	if *minAccuracy < 0 || *minAccuracy > 1 {
+		return fmt.Errorf("precisión mínima inválida: %g (debe estar entre 0 y 1)", *minAccuracy)
+	}
+	if *holdoutFraction < 0 || *holdoutFraction >= 1 {
+		return fmt.Errorf("fracción reservada inválida: %g (debe estar entre 0 y 1)", *holdoutFraction)
+	}
+	if *recencyDecay < 0 || *recencyDecay > 1 {
+		return fmt.Errorf("peso de recencia inválido: %g (debe estar entre 0 y 1)", *recencyDecay)
+	}
+	if *threshold <= 0 {
+		return fmt.Errorf("umbral de congestión inválido: %d", *threshold)
+	}
+	if *winsorize < 0 || *winsorize >= 1 {
+		return fmt.Errorf("percentil de recorte inválido: %g (debe estar entre 0 y 1)", *winsorize)
+	}
+	result := &trainResult{Data: *dataPath, MinAccuracy: *minAccuracy}
+	if *resultPath != "" {
+		began := time.Now()
+		defer func() {
+			result.Duration = time.Since(began).Seconds()
+			if writeErr := result.write(*resultPath, err); writeErr != nil && err == nil {
+				err = writeErr
+			}
+		}()
+	}
+	policy, err := ParseOverflowPolicy(*overflow)
+	if err != nil {
+		return err
+	}
+	strategy, err := ParseStrategy(*strategyName)
+	if err != nil {
+		return err
+	}
+	tiePolicy, err := ParseTiePolicy(*ties)
+	if err != nil {
+		return err
+	}
+	aggregator, err := newEstablishmentAggregator(*aggregation)
+	if err != nil {
+		return err
+	}
+	aggregatorClosed := false
+	defer func() {
+		// Las salidas por error también detienen las goroutines del agregador
+		if aggregator != nil && !aggregatorClosed {
+			aggregator.close()
+		}
+	}()
+	if err := checkGapFillMode(*gapFillMode); err != nil {
+		return err
+	}
+	features, err := ParseFeatures(*featureList)
+	if err != nil {
+		return err
+	}
+	if trainOnly := trainOnlyFeatures(features); len(trainOnly) > 0 && !*allowLeakage {
+		return fmt.Errorf("%s no se conocen al predecir; usa -permitir-fuga para entrenar con ellas igualmente", strings.Join(trainOnly, ", "))
+	}
+	var bookings *Bookings
+	if *bookingsPath != "" {
+		if bookings, err = loadBookings(context.Background(), *bookingsPath, *bookingsTable); err != nil {
+			return err
+		}
+		if *featureList == "" {
+			features = append(slices.Clone(defaultFeatures), "Citas")
+			fmt.Printf("Se agregan las citas a las características: %s\n", strings.Join(features, ","))
+		}
+	}
+	if slices.Contains(features, "Citas") && bookings == nil {
+		return errors.New("la característica Citas necesita la agenda de -citas")
+	}
+	var capacities *Capacities
+	if *capacityPath != "" {
+		if capacities, err = loadCapacities(*capacityPath, *capacityFactor); err != nil {
+			return err
+		}
+		fmt.Printf("Congestión sobre %g × capacidad en %d establecimientos; los demás con %d atendidos\n",
+			capacities.Factor, len(capacities.Declared), *threshold)
+	}
+	dataPaths, err := expandDataPaths(*dataPath)
+	if err != nil {
+		return err
+	}
+	if len(dataPaths) > 1 && (*manifestPath != "" || *snapshotPath != "") {
+		return errors.New("con varios archivos de datos no se pueden usar -manifiesto ni -instantanea")
+	}
+	years, err := parseYears(*yearList, len(dataPaths))
+	if err != nil {
+		return err
+	}
+	check, err := manifestCheck(*manifestPath, *dataPath)
+	if err != nil {
+		return err
+	}
+	if *snapshotPath == "auto" {
+		if *snapshotPath, err = defaultSnapshotPath(*dataPath); err != nil {
+			return err
+		}
+	}
+	var report LoadReport
+	loadOpts := LoadOptions{Check: check, Ingest: IngestOptions{ChannelSize: *channelSize, Overflow: policy, ChunkRows: *chunkRows}, Report: &report, Strategy: strategy, Aggregator: aggregator}
+	if *diagnose {
+		loadOpts.Monitor = newPipelineMonitor()
+		defer loadOpts.Monitor.Close()
+	}
+	if years != nil {
+		loadOpts.Year = years[0] // Con un solo archivo; con varios cada uno toma el suyo
+	}
+
+	// Destinos que se alimentan en la misma pasada por el archivo
+	var stats *LoadStats
+	if *showStats {
+		stats = NewLoadStats()
+		loadOpts.Sinks = append(loadOpts.Sinks, stats)
+	}
+	var anomalies *AnomalyDetector
+	if *anomalySigmas > 0 {
+		anomalies = NewAnomalyDetector(*anomalySigmas)
+		loadOpts.Sinks = append(loadOpts.Sinks, anomalies)
+	}
+	if *archivePath != "" {
+		archive, err := newArchiveSink(context.Background(), *archivePath)
+		if err != nil {
+			return err
+		}
+		loadOpts.Sinks = append(loadOpts.Sinks, archive)
+	}
+	var filter Filter
+	if *filterExpr != "" {
+		if filter, err = ParseFilter(*filterExpr); err != nil {
+			return err
+		}
+	}
+
+	ctx, span := startSpan(context.Background(), "reentrenamiento")
+	defer span.End()
+	limited, cancel := timeout.context(ctx) // El plazo cubre la carga y el entrenamiento
+	defer cancel()
+
+	start := time.Now()
+	var data []Atencion
+	switch {
+	case len(dataPaths) > 1:
+		var loads []fileLoad
+		data, loads, err = loadAtencionesFiles(limited, dataPaths, years, loadOpts)
+		for _, load := range loads {
+			if err == nil {
+				fmt.Printf("%s: esquema v%d, %d registros\n", load.Path, load.Report.Schema, load.Report.Records)
+			}
+		}
+	case *snapshotPath == "":
+		data, err = loadAtencionesWith(limited, *dataPath, loadOpts)
+	default:
+		var fromSnapshot bool
+		data, fromSnapshot, err = loadAtencionesSnapshot(limited, *dataPath, *snapshotPath, loadOpts)
+		if fromSnapshot {
+			fmt.Printf("Registros leídos de la instantánea %s\n", *snapshotPath)
+			if aggregator != nil {
+				aggregator.add(data) // Sin validación los registros no pasaron por el agregador
+			}
+		}
+	}
+	audit(ctx, auditLoadData, *dataPath, err, loadDetails(report))
+	if err != nil {
+		span.SetError(err)
+		return withTimeoutExitCode(exitLoadFailure, err)
+	}
+	fmt.Printf("Registros procesados: %d en %v\n", len(data), time.Since(start))
+	if stats != nil {
+		stats.Print(os.Stdout)
+	}
+	if anomalies != nil {
+		anomalies.Print(os.Stdout)
+	}
+	if aggregator != nil {
+		closing := time.Now()
+		summaries := aggregator.close()
+		aggregatorClosed = true
+		writeEstablishmentTallies(os.Stdout, summaries, aggregator.describe(), time.Since(closing), 10)
+	}
+	if filter != nil {
+		data = filterAtenciones(data, filter)
+		fmt.Printf("Registros que cumplen el filtro: %d\n", len(data))
+	}
+	if *gapFillMode != gapFillNone {
+		var gaps *GapReport
+		data, gaps = fillCalendarGaps(data, *gapFillMode)
+		gaps.Print(os.Stdout)
+	}
+	if bookings != nil {
+		fmt.Printf("Registros con citas programadas: %d de %d\n", bookings.Join(data), len(data))
+	}
+	var holdout []Atencion
+	if *holdoutFraction > 0 {
+		data, holdout = splitHoldout(data, *holdoutFraction, 1)
+		fmt.Printf("Registros reservados para evaluar: %d\n", len(holdout))
+	}
+	result.Records = len(data)
+	if dataYears := yearsOf(data); dataYears.multiYear() {
+		fmt.Printf("Registros de %d a %d\n", dataYears.First, dataYears.Last)
+		if *featureList == "" {
+			if features == nil {
+				features = defaultFeatures
+			}
+			features = append(slices.Clone(features), "Anio")
+			fmt.Printf("Se agrega el año a las características: %s\n", strings.Join(features, ","))
+		}
+	}
+
+	rf := &RandomForest{Features: features, MaxParallel: *maxParallel, Capacities: capacities, Winsorize: *winsorize, RecencyDecay: *recencyDecay,
+		Threshold: *threshold, DataSHA256: report.SHA256, Seed: *seed, Strategy: strategy, Ties: tiePolicy, monitor: loadOpts.Monitor}
+	if *early {
+		rf.EarlyStopping = EarlyStopping{Enabled: true, BatchSize: 10, Patience: 3, MinDelta: 0.001}
+	}
+	stopProfile := profileStep("entrenamiento")
+	start = time.Now()
+	trainErr := rf.TrainTreesContext(limited, data, *trees)
+	stopProfile()
+	details := forestDetails(rf, *trees, time.Since(start))
+	details["datos"], details["filtro"], details["registros"] = *dataPath, *filterExpr, len(data)
+	if trainErr != nil && (!timeout.partial(trainErr) || len(rf.Trees) == 0) {
+		audit(ctx, auditTrain, *output, trainErr, details)
+		span.SetError(trainErr)
+		return withTimeoutExitCode(exitTrainFailure, trainErr)
+	}
+	if trainErr != nil {
+		log.Printf("Advertencia: %v; se conservan %d de %d árboles", trainErr, len(rf.Trees), *trees)
+		details["parcial"], result.Partial = true, true
+	}
+	audit(ctx, auditTrain, *output, nil, details)
+	fmt.Printf("Algoritmo entrenado con %d árboles en %v (error OOB %.4f)\n", len(rf.Trees), time.Since(start), rf.OOBError)
+	if *seed != 0 {
+		fmt.Printf("Huella de los árboles: %s (estrategia %s, semilla %d)\n", treesFingerprint(rf.Trees), strategy, *seed)
+	}
+	if loadOpts.Monitor != nil {
+		fmt.Printf("\nEsperas en los canales (estrategia %s):\n", strategy)
+		loadOpts.Monitor.Report(os.Stdout)
+	}
+	if rf.Pipeline.Winsorizer != nil {
+		rf.Pipeline.Winsorizer.Print(os.Stdout)
+	}
+	if len(rf.Trees)%2 == 0 {
+		fmt.Printf("Con %d árboles la votación puede empatar; los empates se resuelven como %s\n", len(rf.Trees), tiePolicy)
+	}
+	if err := rf.checkAccuracy(result, *minAccuracy); err != nil {
+		span.SetError(err)
+		return err
+	}
+	if len(holdout) > 0 {
+		start = time.Now()
+		confusion := evaluateHoldout(rf, rf.Pipeline, holdout, 0)
+		fmt.Printf("Evaluación de los registros reservados en %v\n", time.Since(start))
+		confusion.print(os.Stdout)
+		result.Holdout = confusion.metrics()
+	}
+	if *forecastDays > 0 {
+		rf.Pipeline.Forecaster = NewVolumeForecaster(data, *forecastDays)
+		fmt.Printf("Pronóstico de volumen para %d establecimientos\n", len(rf.Pipeline.Forecaster.Models))
+	}
+
+	_, saveSpan := startSpan(ctx, "guardar_modelo")
+	err = rf.Save(*output)
+	saveSpan.SetError(err)
+	saveSpan.End()
+	audit(ctx, auditSaveModel, *output, err, map[string]any{"arboles": len(rf.Trees), "error_oob": rf.OOBError})
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	fmt.Printf("Modelo guardado en %s\n", *output)
+	result.Model = *output
+	return nil
+}
+
+// Función que interpreta la lista de años de -anios, uno por archivo de datos
+// (vacía = nil; 0 = año desconocido)
+func parseYears(list string, files int) ([]int, error) {
+	if list == "" {
+		return nil, nil
+	}
+	parts := strings.Split(list, ",")
+	if len(parts) != files {
+		return nil, fmt.Errorf("se indicaron %d años para %d archivos de datos", len(parts), files)
+	}
+	years := make([]int, len(parts))
+	for i, part := range parts {
+		year, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || (year != 0 && (year < 1900 || year > 2200)) {
+			return nil, fmt.Errorf("año inválido: %q", part)
+		}
+		years[i] = year
+	}
+	return years, nil
+}
+
+// Función que verifica que el entrenamiento produjo árboles y, con una precisión
+// mínima, que la precisión OOB la alcanza; anota ambas cosas en el resultado
+func (rf *RandomForest) checkAccuracy(result *trainResult, minAccuracy float64) error {
+	result.Trees = len(rf.Trees)
+	if len(rf.Trees) == 0 {
+		return withExitCode(exitTrainFailure, errors.New("no se entrenó ningún árbol: no hay registros para entrenar"))
+	}
+	if rf.OOBError >= 0 {
+		oobError, accuracy := rf.OOBError, 1-rf.OOBError
+		result.OOBError, result.Accuracy = &oobError, &accuracy
+	}
+	if minAccuracy == 0 {
+		return nil
+	}
+	if result.Accuracy == nil {
+		return withExitCode(exitBelowThreshold, errors.New("no se pudo calcular la precisión OOB para compararla con -precision-minima"))
+	}
+	if *result.Accuracy < minAccuracy {
+		return withExitCode(exitBelowThreshold, fmt.Errorf("precisión OOB %.4f menor que la mínima %.4f; el modelo no se guarda", *result.Accuracy, minAccuracy))
+	}
+	fmt.Printf("Precisión OOB %.4f (mínima %.4f)\n", *result.Accuracy, minAccuracy)
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Un entrenamiento que falla al cargar no deja vivas las goroutines del agregador
+func TestTrainFailureStopsAggregator(t *testing.T) {
+	before := runtime.NumGoroutine()
+	missing := filepath.Join(t.TempDir(), "no_existe.csv")
+	if err := trainCommand([]string{"-datos", missing, "-agregacion", "actores"}); err == nil {
+		t.Fatal("se esperaba un error por el archivo inexistente")
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("goroutines: %d antes y %d después", before, after)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Opciones del escritor ordenado
+type WriterOptions struct {
+	Workers    int // Goroutines que formatean bloques en paralelo (0 = número de CPUs)
+	Pending    int // Bloques enviados que pueden esperar a ser escritos (0 = 2 por worker)
+	BufferSize int // Tamaño del buffer de escritura en bytes (0 = 1 MiB)
+}
+
+// Escritor de CSV que formatea bloques de filas en paralelo y los escribe en el
+// mismo orden en que se enviaron. El formateo es lo que más CPU consume al
+// exportar millones de filas; la escritura al archivo queda en un solo flujo.
+type OrderedWriter struct {
+	out  *bufio.Writer
+	jobs chan formatJob // Bloques pendientes de formatear
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	ready     map[int]*bytes.Buffer // Bloques formateados que esperan su turno
+	submitted int                   // Número de bloques enviados
+	written   int                   // Número de bloques ya escritos en orden
+	pending   int                   // Máximo de bloques enviados sin escribir
+	err       error                 // Primer error de escritura
+
+	workers sync.WaitGroup
+	buffers sync.Pool
+}
+
+// Bloque de filas a formatear junto con su número de secuencia. Las filas se
+// arman en el worker con row(i), para i de 0 a rows-1.
+type formatJob struct {
+	seq  int
+	rows int
+	row  func(i int) []string
+}
+
+// Constructor para un escritor ordenado sobre w
+func NewOrderedWriter(w io.Writer, opts WriterOptions) *OrderedWriter {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.Pending <= 0 {
+		opts.Pending = 2 * opts.Workers
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1 << 20
+	}
+
+	ow := &OrderedWriter{
+		out:     bufio.NewWriterSize(w, opts.BufferSize),
+		jobs:    make(chan formatJob, opts.Pending),
+		ready:   make(map[int]*bytes.Buffer),
+		pending: opts.Pending,
+		buffers: sync.Pool{New: func() any { return new(bytes.Buffer) }},
+	}
+	ow.cond = sync.NewCond(&ow.mu)
+
+	for i := 0; i < opts.Workers; i++ {
+		ow.workers.Add(1)
+		go ow.format()
+	}
+	return ow
+}
+
+// Función que envía un bloque de filas. Bloquea si hay demasiados bloques sin
+// escribir. Debe llamarse siempre desde la misma goroutine para fijar el orden.
+func (ow *OrderedWriter) Write(records [][]string) {
+	ow.WriteRows(len(records), func(i int) []string { return records[i] })
+}
+
+// Igual que Write, pero las filas se arman en los workers llamando a row(i)
+// para i de 0 a rows-1, así también la conversión a texto corre en paralelo
+func (ow *OrderedWriter) WriteRows(rows int, row func(i int) []string) {
+	ow.mu.Lock()
+	for ow.submitted-ow.written >= ow.pending && ow.err == nil {
+		ow.cond.Wait() // Esperar a que el escritor avance
+	}
+	seq := ow.submitted
+	ow.submitted++
+	ow.mu.Unlock()
+
+	ow.jobs <- formatJob{seq: seq, rows: rows, row: row}
+}
+
+// Goroutine que formatea bloques y escribe los que ya tienen su turno
+func (ow *OrderedWriter) format() {
+	defer ow.workers.Done()
+	for job := range ow.jobs {
+		buf := ow.buffers.Get().(*bytes.Buffer)
+		buf.Reset()
+		w := csv.NewWriter(buf)
+		for i := 0; i < job.rows; i++ {
+			w.Write(job.row(i)) // Escribir en un bytes.Buffer no falla
+		}
+		w.Flush()
+
+		ow.mu.Lock()
+		ow.ready[job.seq] = buf
+		// Escribir todos los bloques consecutivos disponibles desde el siguiente en orden
+		for {
+			next, ok := ow.ready[ow.written]
+			if !ok {
+				break
+			}
+			delete(ow.ready, ow.written)
+			if ow.err == nil {
+				_, ow.err = ow.out.Write(next.Bytes())
+			}
+			ow.buffers.Put(next)
+			ow.written++
+		}
+		ow.cond.Broadcast()
+		ow.mu.Unlock()
+	}
+}
+
+// Función que espera a que todos los bloques enviados estén escritos y vacía el buffer
+func (ow *OrderedWriter) Flush() error {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	for ow.written < ow.submitted {
+		ow.cond.Wait()
+	}
+	if ow.err == nil {
+		ow.err = ow.out.Flush()
+	}
+	return ow.err
+}
+
+// Función que espera los bloques enviados, descarta lo que quedó en el buffer y
+// el error de escritura, y continúa escribiendo en w. Permite reintentar después
+// de volver a un punto de control sin crear otro escritor.
+func (ow *OrderedWriter) Reset(w io.Writer) {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	for ow.written < ow.submitted {
+		ow.cond.Wait()
+	}
+	ow.out.Reset(w)
+	ow.err = nil
+}
+
+// Función que escribe todo lo pendiente y detiene los workers
+func (ow *OrderedWriter) Close() error {
+	err := ow.Flush()
+	close(ow.jobs)
+	ow.workers.Wait()
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// Escritor que falla en la primera escritura y después funciona
+type failOnceWriter struct {
+	bytes.Buffer
+	failed bool
+}
+
+func (w *failOnceWriter) Write(p []byte) (int, error) {
+	if !w.failed {
+		w.failed = true
+		return 0, errors.New("disco lleno")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestOrderedWriterKeepsOrderAcrossResets(t *testing.T) {
+	rows := make([][]string, 1000)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i), "fila"}
+	}
+	var want bytes.Buffer
+	csv.NewWriter(&want).WriteAll(rows)
+
+	out := &failOnceWriter{}
+	ow := NewOrderedWriter(out, WriterOptions{Workers: 4, BufferSize: 16})
+	defer ow.Close()
+	ow.WriteRows(10, func(i int) []string { return rows[i] })
+	if err := ow.Flush(); err == nil {
+		t.Fatal("se esperaba el error de la primera escritura")
+	}
+
+	// Volver al punto de control y escribir todo con el mismo escritor
+	ow.Reset(out)
+	out.Reset()
+	for start := 0; start < len(rows); start += 64 {
+		part := rows[start:min(start+64, len(rows))]
+		ow.WriteRows(len(part), func(i int) []string { return part[i] })
+	}
+	if err := ow.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want.String() {
+		t.Fatal("la salida no coincide con la escritura secuencial")
+	}
+}
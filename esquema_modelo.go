@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Compatibilidad del esquema del modelo con los datos actuales: al cargar un
+// modelo se compara lo que guardó su pipeline al entrenar (características,
+// cómo se codifican y qué establecimientos conoce) con el histórico cargado
+// ahora. Si los datos cambiaron de formato las predicciones no fallan: salen
+// mal sin avisar (un establecimiento renombrado cae en el grupo 0, un umbral
+// distinto cambia qué significa "congestión"), así que las diferencias que
+// hacen inválidas las predicciones se rechazan, salvo con -permitir-esquema, y
+// las demás se advierten.
+
+// Establecimientos que se nombran como ejemplo en una diferencia de vocabulario
+const schemaExamples = 3
+
+// Diferencias entre el esquema del modelo y el de los datos actuales
+type schemaMismatch struct {
+	Errors   []string // Hacen inválidas las predicciones
+	Warnings []string // Pueden degradarlas
+}
+
+// Función que compara el esquema del modelo con el pipeline de los datos
+// actuales (nil si no se cargó un histórico, y entonces solo se revisa el modelo)
+func checkSchema(model Predictor, current *Pipeline) schemaMismatch {
+	var m schemaMismatch
+	var used []string
+	if user, ok := model.(featureUser); ok {
+		used = user.UsedFeatures()
+	}
+	for _, name := range used {
+		if _, ok := featureAccessor(name); !ok {
+			m.Errors = append(m.Errors, fmt.Sprintf("el modelo divide por %s, que este programa no conoce", name))
+		}
+	}
+
+	var trained *Pipeline
+	if provider, ok := model.(pipelineProvider); ok {
+		trained = provider.QueryPipeline()
+	}
+	if trained == nil {
+		return m
+	}
+	for _, name := range used {
+		if len(trained.Features) > 0 && !slices.Contains(trained.Features, name) {
+			m.Errors = append(m.Errors, fmt.Sprintf("el modelo divide por %s pero su pipeline no la declara (%s)",
+				name, strings.Join(trained.Features, ",")))
+		}
+	}
+	if slices.Contains(used, "Grupo") && trained.Clusters == nil {
+		m.Errors = append(m.Errors, "el modelo divide por Grupo pero no guardó los grupos de demanda: todas las consultas quedarían en el grupo 0")
+	}
+	if current == nil {
+		return m
+	}
+
+	if trained.CongestionThreshold != current.CongestionThreshold {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("el modelo se entrenó con umbral %d y los datos actuales usan %d",
+			trained.CongestionThreshold, current.CongestionThreshold))
+	}
+	if len(trained.Establishments) == 0 {
+		return m
+	}
+	unknown := missingKeys(current.Establishments, trained.Establishments)
+	absent := missingKeys(trained.Establishments, current.Establishments)
+	if len(unknown) == len(current.Establishments) {
+		m.Errors = append(m.Errors, fmt.Sprintf("ninguno de los %d establecimientos de los datos está en el modelo (p. ej. %s): ¿cambió el formato de los nombres?",
+			len(unknown), examples(unknown)))
+		return m
+	}
+	if len(unknown) > 0 {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("%d establecimientos de los datos no están en el modelo (p. ej. %s)",
+			len(unknown), examples(unknown)))
+	}
+	if len(absent) > 0 {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("%d establecimientos del modelo no están en los datos (p. ej. %s)",
+			len(absent), examples(absent)))
+	}
+	return m
+}
+
+// Función que retorna los nombres de from cuya clave normalizada no está en to, ordenados
+func missingKeys(from, to map[string]string) []string {
+	var missing []string
+	for key, name := range from {
+		if _, ok := to[key]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// Función que arma la lista de ejemplos de una diferencia de vocabulario
+func examples(names []string) string {
+	if len(names) > schemaExamples {
+		return strings.Join(names[:schemaExamples], ", ") + ", …"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Función que advierte las diferencias que pueden degradar las predicciones y
+// retorna como error las que las hacen inválidas, salvo que se permitan
+func reportSchema(m schemaMismatch, allow bool) error {
+	for _, warning := range m.Warnings {
+		log.Printf("Advertencia: %s", warning)
+	}
+	err := m.err()
+	if err == nil {
+		return nil
+	}
+	if !allow {
+		return fmt.Errorf("%w; usa -permitir-esquema para usarlo igualmente", err)
+	}
+	log.Printf("Advertencia: %v", err)
+	return nil
+}
+
+// Función que retorna las diferencias que hacen inválidas las predicciones
+// como un error, o nil si no hay
+func (m schemaMismatch) err() error {
+	if len(m.Errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("esquema incompatible: %s", strings.Join(m.Errors, "; "))
+}
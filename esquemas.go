@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Versiones del esquema del CSV de atenciones. El formato cambió dos veces: la
+// versión 1 es la del archivo publicado, con su error de tipeo en
+// NOMBRE_ESTACLECIMIENTO; la 2 corrigió el nombre de esa columna, y la 3 agregó
+// el año y el código UBIGEO del establecimiento. Cada versión trae su propio
+// mapeo de columnas a los campos de Atencion, así que la versión se detecta por
+// la cabecera de cada archivo y archivos de versiones distintas se pueden cargar
+// juntos. El UBIGEO no se usa; a los archivos sin año se les puede indicar uno
+// al cargarlos.
+
+// Posición de cada campo de Atencion en las filas de una versión del esquema
+type recordMapper struct {
+	Mes, Dia, Establishment, Atendidos, Atenciones int
+	Anio                                           int // -1 si la versión no tiene año
+
+	year int // Año de los registros de un archivo sin columna ANIO (0 = desconocido)
+}
+
+// Versión del esquema: las columnas de su cabecera y dónde está cada campo
+type inputSchema struct {
+	Columns []string
+	Mapper  recordMapper
+}
+
+// Esquemas conocidos, por versión
+var inputSchemas = map[int]inputSchema{
+	1: {
+		Columns: []string{"MES", "DIA", "NOMBRE_ESTACLECIMIENTO", "ATENDIDOS", "ATENCIONES"},
+		Mapper:  recordMapper{Mes: 0, Dia: 1, Establishment: 2, Atendidos: 3, Atenciones: 4, Anio: -1},
+	},
+	2: {
+		Columns: []string{"MES", "DIA", "NOMBRE_ESTABLECIMIENTO", "ATENDIDOS", "ATENCIONES"},
+		Mapper:  recordMapper{Mes: 0, Dia: 1, Establishment: 2, Atendidos: 3, Atenciones: 4, Anio: -1},
+	},
+	3: {
+		Columns: []string{"ANIO", "MES", "DIA", "UBIGEO", "NOMBRE_ESTABLECIMIENTO", "ATENDIDOS", "ATENCIONES"},
+		Mapper:  recordMapper{Anio: 0, Mes: 1, Dia: 2, Establishment: 4, Atendidos: 5, Atenciones: 6},
+	},
+}
+
+// Versión que se asume cuando la cabecera no coincide con ninguna, y la de los
+// archivos que escribe el programa
+const defaultSchemaVersion = 1
+
+// Máximo de columnas de una versión del esquema
+const maxSchemaColumns = 8
+
+// Función que retorna la versión de esquema de una cabecera (0 si no coincide con ninguna)
+func schemaVersion(header []string) int {
+	columns := strings.Join(normalizeHeader(header), ",")
+	for version, schema := range inputSchemas {
+		if columns == strings.Join(schema.Columns, ",") {
+			return version
+		}
+	}
+	return 0
+}
+
+// Función que retorna el mapeo de una cabecera y su versión. Una cabecera
+// desconocida se lee con las posiciones de la versión por defecto, como antes
+// de que hubiera versiones, y retorna la versión 0.
+func mapperFor(header []string) (recordMapper, int) {
+	version := schemaVersion(header)
+	if version == 0 {
+		return inputSchemas[defaultSchemaVersion].Mapper, 0
+	}
+	return inputSchemas[version].Mapper, version
+}
+
+// Función que retorna el número de columnas que necesita el mapeo
+func (m recordMapper) columns() int {
+	return max(m.Mes, m.Dia, m.Establishment, m.Atendidos, m.Atenciones, m.Anio) + 1
+}
+
+// Función que reordena los campos de una fila en el orden de la versión 1
+func (m recordMapper) canonical(record []string) []string {
+	return []string{record[m.Mes], record[m.Dia], record[m.Establishment], record[m.Atendidos], record[m.Atenciones]}
+}
+
+// Resultado de la carga de un archivo entre varios
+type fileLoad struct {
+	Path   string
+	Report LoadReport // Registros, filas descartadas y versión de esquema detectada
+	err    error
+}
+
+// Función que indica si una ruta de datos es un patrón como
+// datos/atenciones_*.csv. Una ruta local que existe tal cual no lo es, aunque
+// su nombre tenga corchetes.
+func isGlob(path string) bool {
+	if isHTTP(path) || isRemote(path) || !strings.ContainsAny(path, "*?[") {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err != nil
+}
+
+// Función que expande una lista de archivos de datos separados por comas, en
+// la que cada uno puede ser un patrón; los archivos de un patrón quedan en
+// orden alfabético, que con nombres por mes es el orden cronológico
+func expandDataPaths(list string) ([]string, error) {
+	var paths []string
+	for _, path := range strings.Split(list, ",") {
+		path = strings.TrimSpace(path)
+		if !isGlob(path) {
+			paths = append(paths, path)
+			continue
+		}
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("patrón inválido %q: %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("ningún archivo coincide con %s", path)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// Función que carga todos los archivos que coinciden con un patrón, en
+// paralelo, como loadAtencionesFiles. Un manifiesto describe un solo archivo,
+// así que no se puede verificar contra un patrón.
+func loadAtencionesGlob(ctx context.Context, pattern string, opts LoadOptions) ([]Atencion, error) {
+	if opts.Check != (InputCheck{}) {
+		return nil, fmt.Errorf("no se puede verificar un manifiesto contra el patrón %s", pattern)
+	}
+	paths, err := expandDataPaths(pattern)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := loadAtencionesFiles(ctx, paths, nil, opts)
+	return data, err
+}
+
+// Función que carga varios CSV de atenciones en paralelo, cada uno con la
+// versión de esquema de su cabecera, y retorna los registros de todos en el
+// orden de los archivos. years, si no es nil, tiene el año de los registros de
+// cada archivo sin columna ANIO. El primer error cancela la carga de los demás.
+// Los destinos de opts reciben los registros de todos los archivos al final.
+func loadAtencionesFiles(ctx context.Context, paths []string, years []int, opts LoadOptions) ([]Atencion, []fileLoad, error) {
+	loadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	loads := make([]fileLoad, len(paths))
+	records := make([][]Atencion, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fileOpts := opts
+			fileOpts.Sinks, fileOpts.Report = nil, &loads[i].Report
+			if years != nil {
+				fileOpts.Year = years[i]
+			}
+			loads[i].Path = path
+			records[i], loads[i].err = loadAtencionesWith(loadCtx, path, fileOpts)
+			if loads[i].err != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	err := ctx.Err()
+	for _, load := range loads {
+		if err == nil && load.err != nil && !errors.Is(load.err, context.Canceled) {
+			err = fmt.Errorf("%s: %w", load.Path, load.err)
+		}
+	}
+	if err != nil {
+		for _, sink := range opts.Sinks {
+			sink.Close(err)
+		}
+		return nil, loads, err
+	}
+
+	var data []Atencion
+	var invalid int64
+	for i, load := range loads {
+		data = append(data, records[i]...)
+		invalid += load.Report.Invalid
+	}
+	if opts.Report != nil {
+		*opts.Report = LoadReport{Records: len(data), Invalid: invalid}
+	}
+	return data, loads, feedSinks(opts.Sinks, data)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Lista de establecimientos: cada nombre normalizado (mayúsculas y espacios
+// simples, como en el pipeline) con las grafías con que aparece en los datos,
+// cuántos registros tiene, qué fechas cubre, su demanda promedio y la calidad
+// de sus datos (ver calidad.go). Sirve para conciliar nuestra lista con el
+// registro oficial (RENIPRESS): las grafías muestran qué nombres se unieron al
+// normalizar y la cobertura, qué establecimientos tienen huecos o dejaron de
+// reportar. El UBIGEO de los archivos de la versión 3 no se conserva al
+// cargar, así que la conciliación es por nombre.
+
+// Resumen de un establecimiento
+type establishmentSummary struct {
+	Name         string   // Nombre normalizado
+	Spellings    []string // Grafías en los datos, ordenadas
+	Rows         int
+	Days         int        // Fechas distintas con datos
+	First, Last  recordDate // Primera y última fecha con datos
+	AvgAttended  float64    // Promedio de Atendidos por registro
+	AvgAttention float64    // Promedio de Atenciones por registro
+	P95Attended  float64
+	Quality      dataQuality
+}
+
+// Fecha de un registro; Year es 0 si los datos no traen año
+type recordDate struct {
+	Year, Month, Day int
+}
+
+// Indica si la fecha es anterior a otra
+func (d recordDate) before(other recordDate) bool {
+	if d.Year != other.Year {
+		return d.Year < other.Year
+	}
+	if d.Month != other.Month {
+		return d.Month < other.Month
+	}
+	return d.Day < other.Day
+}
+
+// Fecha como AAAA-MM-DD, o --MM-DD (ISO 8601 sin año) si no se conoce el año
+func (d recordDate) String() string {
+	if d.Year == 0 {
+		return fmt.Sprintf("--%02d-%02d", d.Month, d.Day)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Subcomando "establishments": exporta la lista de establecimientos con sus estadísticas
+func establishmentsCommand(args []string) error {
+	fs := flag.NewFlagSet("establishments", flag.ContinueOnError)
+	dataPath := fs.String("datos", "atenciones_filtradas.csv", "CSV de atenciones")
+	output := fs.String("o", "", "archivo CSV de la lista (vacío = salida estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	data, err := loadAtenciones(context.Background(), *dataPath)
+	if err != nil {
+		return withExitCode(exitLoadFailure, err)
+	}
+	if len(data) == 0 {
+		return errors.New("el CSV no tiene registros")
+	}
+	summaries := summarizeEstablishments(data)
+	fmt.Fprintf(os.Stderr, "%d establecimientos en %d registros\n", len(summaries), len(data))
+
+	if *output == "" {
+		return writeEstablishmentsCSV(os.Stdout, summaries)
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	if err := writeEstablishmentsCSV(w, summaries); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que resume los registros por nombre normalizado, ordenados por
+// nombre. Los promedios se agregan en paralelo con GroupBy; las grafías y
+// la cobertura, en una pasada aparte.
+func summarizeEstablishments(data []Atencion) []establishmentSummary {
+	key := func(att Atencion) string { return normalizeEstablishment(att.NombreEstablecimiento) }
+	stats := GroupBy(data, key).Aggregate(Count(), Avg(atendidosValue), Avg(atencionesValue), P95(atendidosValue))
+	quality := assessQuality(data)
+
+	spellings := make(map[string]map[string]bool)
+	days := make(map[string]map[recordDate]bool)
+	ranges := make(map[string][2]recordDate)
+	for _, att := range data {
+		name := key(att)
+		date := recordDate{att.Anio, att.Mes, att.Dia}
+		if spellings[name] == nil {
+			spellings[name] = make(map[string]bool)
+			days[name] = make(map[recordDate]bool)
+			ranges[name] = [2]recordDate{date, date}
+		}
+		spellings[name][att.NombreEstablecimiento] = true
+		days[name][date] = true
+		r := ranges[name]
+		if date.before(r[0]) {
+			r[0] = date
+		}
+		if r[1].before(date) {
+			r[1] = date
+		}
+		ranges[name] = r
+	}
+
+	summaries := make([]establishmentSummary, 0, len(stats))
+	for _, name := range sortedKeys(spellings) {
+		s := stats[name]
+		summaries = append(summaries, establishmentSummary{
+			Name:         name,
+			Spellings:    sortedKeys(spellings[name]),
+			Rows:         int(s[0]),
+			Days:         len(days[name]),
+			First:        ranges[name][0],
+			Last:         ranges[name][1],
+			AvgAttended:  s[1],
+			AvgAttention: s[2],
+			P95Attended:  s[3],
+			Quality:      quality[name],
+		})
+	}
+	return summaries
+}
+
+// Función que escribe la lista en CSV, un establecimiento por fila; las
+// grafías van separadas por " | "
+func writeEstablishmentsCSV(w io.Writer, summaries []establishmentSummary) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"establecimiento", "grafias", "registros", "dias_con_datos", "primera_fecha", "ultima_fecha",
+		"promedio_atendidos", "promedio_atenciones", "p95_atendidos", "cobertura", "duplicados", "atipicos", "calidad", "advertencia"})
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, s := range summaries {
+		caveat := ""
+		if s.Quality.Score < lowQualityScore {
+			caveat = lowQualityCaveat
+		}
+		cw.Write([]string{
+			s.Name,
+			strings.Join(s.Spellings, " | "),
+			strconv.Itoa(s.Rows),
+			strconv.Itoa(s.Days),
+			s.First.String(),
+			s.Last.String(),
+			format(s.AvgAttended),
+			format(s.AvgAttention),
+			format(s.P95Attended),
+			format(s.Quality.Coverage),
+			format(s.Quality.Duplicates),
+			format(s.Quality.Outliers),
+			format(s.Quality.Score),
+			caveat,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// Estadísticas por establecimiento compartidas. El imputador, el recorte de
+// atendidos, los perfiles de demanda de los grupos y diff agregan los mismos
+// registros por establecimiento; en vez de que cada uno los recorra, las
+// estadísticas de un conjunto se calculan una sola vez, la primera vez que se
+// piden, y quedan en un caché compartido entre goroutines. Un conjunto se
+// identifica por su slice (el primer registro y el largo): filtrar, recortar o
+// agregar registros da otro slice y por lo tanto otras estadísticas, y quien
+// modifica los registros en su lugar debe llamar a invalidateStatistics. Como
+// la clave retiene los registros, el caché guarda solo los últimos conjuntos.
+
+// Estadísticas de los registros de un establecimiento
+type establishmentStats struct {
+	Average  featureAverage     // Promedios de todos sus registros
+	Monthly  [12]featureAverage // Promedios de cada mes (Count 0 = sin registros ese mes)
+	Attended []float64          // Atendidos ordenados, para los percentiles
+}
+
+// Estadísticas de un conjunto de registros
+type datasetStatistics struct {
+	Establishments map[string]*establishmentStats // Por nombre tal como aparece en los datos
+	Global         featureAverage                 // De todos los registros
+}
+
+// Conjuntos cuyas estadísticas se guardan; al agregar otro se descarta el más antiguo
+const maxCachedStatistics = 4
+
+// Clave del caché: el primer registro del slice y su largo
+type statisticsKey struct {
+	first *Atencion
+	n     int
+}
+
+// Entrada del caché; once hace que solo una goroutine calcule las estadísticas
+type statisticsEntry struct {
+	once  sync.Once
+	stats *datasetStatistics
+}
+
+// Caché de estadísticas por conjunto
+var statisticsCache = struct {
+	sync.RWMutex
+	entries map[statisticsKey]*statisticsEntry
+	order   []statisticsKey // Claves en el orden en que se agregaron
+}{entries: make(map[statisticsKey]*statisticsEntry)}
+
+// Función que retorna la clave de un conjunto
+func statisticsKeyFor(data []Atencion) statisticsKey {
+	if len(data) == 0 {
+		return statisticsKey{}
+	}
+	return statisticsKey{&data[0], len(data)}
+}
+
+// Función que retorna las estadísticas de un conjunto, calculándolas si es la
+// primera vez que se piden
+func statisticsFor(data []Atencion) *datasetStatistics {
+	key := statisticsKeyFor(data)
+	statisticsCache.RLock()
+	entry, ok := statisticsCache.entries[key]
+	statisticsCache.RUnlock()
+	if !ok {
+		statisticsCache.Lock()
+		if entry, ok = statisticsCache.entries[key]; !ok {
+			if len(statisticsCache.order) == maxCachedStatistics {
+				delete(statisticsCache.entries, statisticsCache.order[0])
+				statisticsCache.order = statisticsCache.order[1:]
+			}
+			entry = &statisticsEntry{}
+			statisticsCache.entries[key] = entry
+			statisticsCache.order = append(statisticsCache.order, key)
+		}
+		statisticsCache.Unlock()
+	}
+	entry.once.Do(func() { entry.stats = computeStatistics(data) })
+	return entry.stats
+}
+
+// Función que descarta las estadísticas de un conjunto cuyos registros cambiaron
+func invalidateStatistics(data []Atencion) {
+	key := statisticsKeyFor(data)
+	statisticsCache.Lock()
+	delete(statisticsCache.entries, key)
+	statisticsCache.order = slices.DeleteFunc(statisticsCache.order, func(k statisticsKey) bool { return k == key })
+	statisticsCache.Unlock()
+}
+
+// Función que calcula las estadísticas de un conjunto: los promedios se
+// agregan en paralelo con GroupBy y los atendidos de cada establecimiento se
+// ordenan en goroutines separadas
+func computeStatistics(data []Atencion) *datasetStatistics {
+	byName := func(att Atencion) string { return att.NombreEstablecimiento }
+	s := &datasetStatistics{
+		Establishments: make(map[string]*establishmentStats),
+		Global:         averagesBy(data, func(Atencion) struct{} { return struct{}{} })[struct{}{}],
+	}
+	for name, avg := range averagesBy(data, byName) {
+		s.Establishments[name] = &establishmentStats{Average: avg, Attended: make([]float64, 0, avg.Count)}
+	}
+	for key, avg := range averagesBy(data, func(att Atencion) imputeKey { return imputeKey{att.NombreEstablecimiento, att.Mes} }) {
+		if key.Month >= 1 && key.Month <= 12 {
+			s.Establishments[key.Establishment].Monthly[key.Month-1] = avg
+		}
+	}
+	for _, att := range data {
+		e := s.Establishments[att.NombreEstablecimiento]
+		e.Attended = append(e.Attended, float64(att.Atendidos))
+	}
+	var wg sync.WaitGroup
+	for _, e := range s.Establishments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slices.Sort(e.Attended)
+		}()
+	}
+	wg.Wait()
+	return s
+}
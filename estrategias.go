@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Estrategias de concurrencia de la carga y el entrenamiento, para comparar
+// modelos de concurrencia con los mismos datos. Todas producen el mismo
+// resultado: la carga entrega los registros en el orden del archivo y cada
+// árbol usa su propio generador aleatorio, derivado de la semilla y de su
+// posición en el bosque, así que con -semilla el modelo no depende de la
+// estrategia (ver la huella de los árboles que muestra train).
+//
+//   - goroutines: una goroutine por bloque de filas y por árbol (por defecto)
+//   - pool: un grupo fijo de workers, tantos como GOMAXPROCS, que toman
+//     bloques o árboles de un canal
+//   - pipeline: etapas unidas por canales; en la carga se lee, se valida y se
+//     recolecta en etapas de una goroutine, y en el entrenamiento se muestrea,
+//     se construye el árbol (con varios workers) y se predicen las filas OOB
+//   - secuencial: todo en una goroutine, como línea de base
+
+// Estrategia de concurrencia
+type concurrencyStrategy int
+
+const (
+	strategyGoroutines concurrencyStrategy = iota // Una goroutine por elemento
+	strategyPool                                  // Grupo fijo de workers
+	strategyPipeline                              // Etapas unidas por canales
+	strategySequential                            // Sin concurrencia
+)
+
+// Nombres de las estrategias, en el orden de las constantes
+var strategyNames = [...]string{"goroutines", "pool", "pipeline", "secuencial"}
+
+func (s concurrencyStrategy) String() string {
+	return strategyNames[s]
+}
+
+// Función que interpreta el nombre de una estrategia (vacío = goroutines)
+func ParseStrategy(name string) (concurrencyStrategy, error) {
+	if name == "" {
+		return strategyGoroutines, nil
+	}
+	for i, n := range strategyNames {
+		if n == name {
+			return concurrencyStrategy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("estrategia de concurrencia desconocida %q (goroutines, pool, pipeline o secuencial)", name)
+}
+
+// Workers del grupo fijo: uno por procesador, sin pasar del límite indicado
+func poolWorkers(limit int) int {
+	return max(1, min(limit, runtime.GOMAXPROCS(0)))
+}
+
+// Función que ejecuta work(i) para cada i de 0 a n-1 según la estrategia, con
+// a lo sumo parallel a la vez. La estrategia pipeline no tiene un reparto
+// genérico: quien la usa arma sus etapas y aquí se trata como pool.
+func (s concurrencyStrategy) each(n, parallel int, work func(i int)) {
+	switch s {
+	case strategySequential:
+		for i := range n {
+			work(i)
+		}
+	case strategyPool, strategyPipeline:
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for range poolWorkers(parallel) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					work(i)
+				}
+			}()
+		}
+		for i := range n {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+	default:
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, parallel) // Semáforo: un lugar por elemento en proceso
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				work(i)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// Función que retorna el generador aleatorio del árbol en la posición index
+// del bosque: derivado de la semilla si hay una, o de una semilla al azar
+func (rf *RandomForest) treeRand(index int) *rand.Rand {
+	if rf.Seed == 0 {
+		return rand.New(rand.NewSource(rand.Int63()))
+	}
+	return rand.New(rand.NewSource(rf.Seed + int64(index)))
+}
+
+// Función que retorna la huella de los árboles: la suma SHA-256 de su
+// codificación, igual para dos bosques con los mismos árboles en el mismo orden
+func treesFingerprint(trees []*DecisionTree) string {
+	sum := sha256.New()
+	if err := gob.NewEncoder(sum).Encode(trees); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(sum.Sum(nil))[:16]
+}
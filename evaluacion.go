@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Evaluación sobre un conjunto reservado (holdout): cada registro se predice
+// con el mismo grupo de workers que predict-batch y la matriz de confusión se
+// acumula por separado en cada worker, sin bloqueos, y se suma al final. Así
+// evaluar millones de registros tarda poco más que predecirlos. La congestión
+// real de cada registro sale del umbral del pipeline del modelo, el mismo con
+// el que se entrenó.
+
+// Matriz de confusión de la congestión
+type confusionMatrix struct {
+	TruePositives  int `json:"verdaderos_positivos"`
+	FalsePositives int `json:"falsos_positivos"`
+	TrueNegatives  int `json:"verdaderos_negativos"`
+	FalseNegatives int `json:"falsos_negativos"`
+}
+
+// Matriz de un worker, con relleno para que los workers no escriban en la
+// misma línea de caché
+type confusionShard struct {
+	confusionMatrix
+	_ [64]byte
+}
+
+// Función que cuenta una predicción
+func (c *confusionMatrix) add(predicted, actual bool) {
+	switch {
+	case predicted && actual:
+		c.TruePositives++
+	case predicted:
+		c.FalsePositives++
+	case actual:
+		c.FalseNegatives++
+	default:
+		c.TrueNegatives++
+	}
+}
+
+// Función que suma otra matriz a esta
+func (c *confusionMatrix) merge(other confusionMatrix) {
+	c.TruePositives += other.TruePositives
+	c.FalsePositives += other.FalsePositives
+	c.TrueNegatives += other.TrueNegatives
+	c.FalseNegatives += other.FalseNegatives
+}
+
+// Función que retorna el número de predicciones contadas
+func (c confusionMatrix) Total() int {
+	return c.TruePositives + c.FalsePositives + c.TrueNegatives + c.FalseNegatives
+}
+
+// Función que retorna a/b, o 0 si b es 0
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// Función que retorna la fracción de predicciones correctas
+func (c confusionMatrix) Accuracy() float64 {
+	return ratio(c.TruePositives+c.TrueNegatives, c.Total())
+}
+
+// Función que retorna la fracción de congestiones predichas que fueron reales
+func (c confusionMatrix) Precision() float64 {
+	return ratio(c.TruePositives, c.TruePositives+c.FalsePositives)
+}
+
+// Función que retorna la fracción de congestiones reales que se predijeron
+func (c confusionMatrix) Recall() float64 {
+	return ratio(c.TruePositives, c.TruePositives+c.FalseNegatives)
+}
+
+// Función que retorna la media armónica de Precision y Recall
+func (c confusionMatrix) F1() float64 {
+	p, r := c.Precision(), c.Recall()
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+// Métricas de una evaluación, para el resultado en JSON
+type holdoutMetrics struct {
+	confusionMatrix
+	Records   int     `json:"registros"`
+	Partial   bool    `json:"parcial,omitempty"`           // Venció el plazo antes de evaluar todos los registros
+	Available int     `json:"registros_totales,omitempty"` // Registros que había para evaluar, si la evaluación fue parcial
+	Accuracy  float64 `json:"precision"`
+	Precision float64 `json:"precision_positivos"`
+	Recall    float64 `json:"exhaustividad"`
+	F1        float64 `json:"f1"`
+}
+
+// Función que resume la matriz con sus métricas
+func (c confusionMatrix) metrics() *holdoutMetrics {
+	return &holdoutMetrics{
+		confusionMatrix: c,
+		Records:         c.Total(),
+		Accuracy:        c.Accuracy(),
+		Precision:       c.Precision(),
+		Recall:          c.Recall(),
+		F1:              c.F1(),
+	}
+}
+
+// Función que escribe la matriz y sus métricas
+func (c confusionMatrix) print(w io.Writer) {
+	fmt.Fprintf(w, "Registros evaluados: %d\n", c.Total())
+	fmt.Fprintf(w, "                 predicho sí  predicho no\n")
+	fmt.Fprintf(w, "  congestión     %11d  %11d\n", c.TruePositives, c.FalseNegatives)
+	fmt.Fprintf(w, "  sin congestión %11d  %11d\n", c.FalsePositives, c.TrueNegatives)
+	fmt.Fprintf(w, "Precisión: %.4f, precisión de los positivos: %.4f, exhaustividad: %.4f, F1: %.4f\n",
+		c.Accuracy(), c.Precision(), c.Recall(), c.F1())
+}
+
+// Función que evalúa el modelo sobre los registros reservados. Cada worker
+// acumula su propia matriz y las matrices se suman al terminar.
+func evaluateHoldout(model Predictor, p *Pipeline, data []Atencion, workers int) confusionMatrix {
+	confusion, _ := evaluateHoldoutContext(context.Background(), model, p, data, workers)
+	return confusion
+}
+
+// Igual que evaluateHoldout, pero si ctx se cancela retorna la matriz de los
+// registros evaluados hasta entonces (los primeros del archivo) y la causa
+func evaluateHoldoutContext(ctx context.Context, model Predictor, p *Pipeline, data []Atencion, workers int) (confusionMatrix, error) {
+	workers = batchWorkers(workers)
+	queries := make([]batchQuery, len(data))
+	for i, att := range data {
+		queries[i] = batchQuery{Establishment: att.NombreEstablecimiento, Month: att.Mes, Day: att.Dia}
+		if att.Citas > 0 {
+			queries[i].Known = knownValues{"Citas": att.Citas} // La agenda del día, como al predecir
+		}
+	}
+	shards := make([]confusionShard, workers)
+	err := predictBatchEach(ctx, model, p, queries, workers, func(worker, i int, r batchResult) {
+		if r.Abstained {
+			return // Empate sin decisión: no cuenta como acierto ni como error
+		}
+		shards[worker].add(r.Congested, p.Congested(data[i]))
+	})
+
+	var total confusionMatrix
+	for _, shard := range shards {
+		total.merge(shard.confusionMatrix)
+	}
+	return total, err
+}
+
+// Función que separa al azar una fracción de los registros para evaluar.
+// Retorna los de entrenamiento y los reservados; la semilla fija hace que el
+// mismo archivo dé siempre la misma partición.
+func splitHoldout(data []Atencion, fraction float64, seed int64) (train, holdout []Atencion) {
+	shuffled := append([]Atencion(nil), data...)
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	n := int(float64(len(shuffled)) * fraction)
+	return shuffled[n:], shuffled[:n]
+}
+
+// Subcomando "evaluate": evalúa un modelo guardado sobre un CSV reservado
+func evaluateCommand(args []string) error {
+	fs := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	modelPath := fs.String("modelo", "modelo.gob.gz", "archivo del modelo")
+	dataPath := fs.String("datos", "", "CSV de atenciones reservadas para evaluar")
+	workers := fs.Int("workers", 0, "goroutines de predicción (0 = número de CPUs)")
+	historyPath := fs.String("historico", "", "CSV de atenciones para armar el pipeline si el modelo no trae el suyo")
+	resultPath := fs.String("resultado", "", "archivo JSON con la matriz de confusión y las métricas")
+	allowSchema := fs.Bool("permitir-esquema", false, "evaluar un modelo cuyo esquema no coincide con el de los datos")
+	bookingsPath := fs.String("citas", "", "agenda de citas programadas (CSV o conexión SQL) de los días a evaluar")
+	bookingsTable := fs.String("tabla-citas", defaultBookingsTable, "tabla de la agenda con una conexión SQL en -citas")
+	var timeout OperationTimeout
+	timeout.register(fs, "la evaluación", "las métricas de los registros ya evaluados")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dataPath == "" {
+		return errors.New("falta el CSV a evaluar (-datos)")
+	}
+	if err := timeout.check(); err != nil {
+		return err
+	}
+
+	model, err := OpenModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+	history, err := loadPipeline(*historyPath)
+	if err != nil {
+		return err
+	}
+	pipeline := pipelineFor(model, history)
+	if pipeline == nil {
+		return errors.New("el modelo no trae su pipeline: indica un histórico con -historico")
+	}
+	ctx, cancel := timeout.context(context.Background())
+	defer cancel()
+	data, err := loadAtenciones(ctx, *dataPath)
+	if err != nil {
+		return withTimeoutExitCode(exitLoadFailure, err)
+	}
+	if *bookingsPath != "" {
+		bookings, err := loadBookings(ctx, *bookingsPath, *bookingsTable)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Registros con citas programadas: %d de %d\n", bookings.Join(data), len(data))
+	}
+	current := history
+	if current == nil {
+		current = NewPipeline(data, nil) // Sin histórico, el esquema se compara con los datos a evaluar
+	}
+	if err := reportSchema(checkSchema(model, current), *allowSchema); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	confusion, err := evaluateHoldoutContext(ctx, model, pipeline, data, *workers)
+	if err != nil && !timeout.partial(err) {
+		return withTimeoutExitCode(exitError, err)
+	}
+	fmt.Printf("Evaluación en %v\n", time.Since(start))
+	metrics := confusion.metrics()
+	if err != nil {
+		log.Printf("Advertencia: %v; las métricas son de %d de %d registros", err, confusion.Total(), len(data))
+		metrics.Partial, metrics.Available = true, len(data)
+	}
+	confusion.print(os.Stdout)
+	if *resultPath == "" {
+		return nil
+	}
+	return writeJSONOutput(*resultPath, metrics)
+}
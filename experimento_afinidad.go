@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Experimento de afinidad para el curso de programación concurrente: ¿cambia
+// el rendimiento del entrenamiento si los árboles se reparten entre grupos de
+// workers fijos, y si cada grupo queda atado a un hilo del sistema
+// (runtime.LockOSThread) o además a una CPU (sched_setaffinity, solo Linux)?
+// Se entrenan los mismos árboles con cada estrategia varias veces, rotando el
+// orden para no favorecer a ninguna, y se comparan las medianas. La diferencia
+// solo se considera real si supera la dispersión entre repeticiones.
+
+// Estrategia de planificación de los árboles
+type schedulingStrategy struct {
+	name        string
+	description string
+	run         func(rf *RandomForest, trees, groups int, cpus []int) error
+}
+
+// Estrategias disponibles, en el orden de la tabla; la primera es la referencia
+var schedulingStrategies = []schedulingStrategy{
+	{"goroutines", "una goroutine por árbol, como máximo -grupos a la vez (como train)", runTreesPerGoroutine},
+	{"grupos", "un worker fijo por grupo; el worker w entrena los árboles w, w+grupos, ...", runTreeGroups(false, false)},
+	{"grupos-hilo", "como grupos, con cada worker atado a su hilo (LockOSThread)", runTreeGroups(true, false)},
+	{"grupos-cpu", "como grupos-hilo, con cada hilo fijado a una CPU distinta", runTreeGroups(true, true)},
+}
+
+// Función que entrena los árboles con una goroutine cada uno, como trainBatch
+func runTreesPerGoroutine(rf *RandomForest, trees, groups int, _ []int) error {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, groups)
+	results := make([]treeResult, trees)
+	for i := range trees {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = rf.buildTree(rf.treeRand(i))
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Función que arma la estrategia de grupos fijos. Un worker atado a su hilo no
+// lo libera al terminar, así el runtime descarta el hilo con su afinidad en vez
+// de reusarlo para otras goroutines.
+func runTreeGroups(lockThread, pin bool) func(rf *RandomForest, trees, groups int, cpus []int) error {
+	return func(rf *RandomForest, trees, groups int, cpus []int) error {
+		var wg sync.WaitGroup
+		results := make([]treeResult, trees)
+		errs := make([]error, groups)
+		for w := range groups {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if lockThread {
+					runtime.LockOSThread()
+				}
+				if pin {
+					if errs[w] = pinThread(cpus[w%len(cpus)]); errs[w] != nil {
+						return
+					}
+				}
+				for i := w; i < trees; i += groups {
+					results[i] = rf.buildTree(rf.treeRand(i))
+				}
+			}()
+		}
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+}
+
+// Tiempos de una estrategia en todas las repeticiones
+type strategyTiming struct {
+	Strategy schedulingStrategy
+	Runs     []time.Duration
+	Err      error // La estrategia no se pudo ejecutar (p. ej. sin afinidad en este sistema)
+}
+
+// Función que retorna la mediana de los tiempos
+func (t strategyTiming) median() time.Duration {
+	runs := slices.Clone(t.Runs)
+	slices.Sort(runs)
+	return runs[len(runs)/2]
+}
+
+// Función que retorna la dispersión relativa de los tiempos: (máximo - mínimo) / mediana
+func (t strategyTiming) spread() float64 {
+	return float64(slices.Max(t.Runs)-slices.Min(t.Runs)) / float64(t.median())
+}
+
+// Función que ejecuta las estrategias repetitions veces, rotando el orden en
+// cada repetición, y retorna sus tiempos
+func runSchedulingExperiment(rf *RandomForest, strategies []schedulingStrategy, trees, groups, repetitions int, cpus []int) []strategyTiming {
+	timings := make([]strategyTiming, len(strategies))
+	for i, s := range strategies {
+		timings[i].Strategy = s
+	}
+	for r := range repetitions {
+		for k := range strategies {
+			i := (k + r) % len(strategies)
+			if timings[i].Err != nil {
+				continue
+			}
+			runtime.GC() // Que la basura de la estrategia anterior no se cobre en esta
+			start := time.Now()
+			if err := strategies[i].run(rf, trees, groups, cpus); err != nil {
+				timings[i].Err = err
+				continue
+			}
+			timings[i].Runs = append(timings[i].Runs, time.Since(start))
+		}
+	}
+	return timings
+}
+
+// Función que escribe la tabla comparativa y la conclusión sobre la afinidad
+func writeSchedulingReport(w io.Writer, timings []strategyTiming, trees, groups int) {
+	fmt.Fprintf(w, "%-12s %6s %10s %10s %10s %10s %8s %8s\n", "ESTRATEGIA", "GRUPOS", "MEDIANA", "MÍNIMO", "MÁXIMO", "ÁRBOLES/S", "DISPERS", "VS BASE")
+	var base time.Duration
+	for _, t := range timings {
+		if t.Err != nil {
+			fmt.Fprintf(w, "%-12s %6d no disponible: %v\n", t.Strategy.name, groups, t.Err)
+			continue
+		}
+		median := t.median()
+		if base == 0 {
+			base = median
+		}
+		fmt.Fprintf(w, "%-12s %6d %10s %10s %10s %10.1f %7.1f%% %7.2fx\n", t.Strategy.name, groups,
+			median.Round(time.Microsecond), slices.Min(t.Runs).Round(time.Microsecond), slices.Max(t.Runs).Round(time.Microsecond),
+			float64(trees)/median.Seconds(), t.spread()*100, base.Seconds()/median.Seconds())
+	}
+
+	// La afinidad se juzga contra los grupos sin atar, con la misma partición de árboles
+	unpinned := slices.IndexFunc(timings, func(t strategyTiming) bool { return t.Strategy.name == "grupos" && t.Err == nil })
+	if unpinned < 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	for _, t := range timings {
+		if t.Err != nil || (t.Strategy.name != "grupos-hilo" && t.Strategy.name != "grupos-cpu") {
+			continue
+		}
+		change := relativeChange(timings[unpinned].median().Seconds(), t.median().Seconds())
+		noise := max(timings[unpinned].spread(), t.spread())
+		verdict := "dentro de la dispersión entre repeticiones: la afinidad no cambia el rendimiento"
+		switch {
+		case change < -noise:
+			verdict = "más rápido que la dispersión: la afinidad mejora el rendimiento"
+		case change > noise:
+			verdict = "más lento que la dispersión: la afinidad empeora el rendimiento"
+		}
+		fmt.Fprintf(w, "%s respecto de grupos: %+.1f%% del tiempo (dispersión %.1f%%), %s.\n", t.Strategy.name, change*100, noise*100, verdict)
+	}
+}
+
+// Función que escribe cada repetición en CSV: estrategia, grupos, repetición y segundos
+func writeSchedulingCSV(w io.Writer, timings []strategyTiming, groups int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "estrategia,grupos,repeticion,segundos")
+	for _, t := range timings {
+		for r, d := range t.Runs {
+			fmt.Fprintf(bw, "%s,%d,%d,%s\n", t.Strategy.name, groups, r+1, strconv.FormatFloat(d.Seconds(), 'f', 6, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+// Subcomando "affinity": compara estrategias de planificación del entrenamiento
+func affinityCommand(args []string) error {
+	fs := flag.NewFlagSet("affinity", flag.ContinueOnError)
+	dataPath := fs.String("datos", "", "CSV de atenciones (vacío = datos sintéticos con semilla fija, como bench)")
+	trees := fs.Int("arboles", 200, "árboles que entrena cada estrategia en cada repetición")
+	groups := fs.Int("grupos", 0, "grupos de workers (0 = GOMAXPROCS)")
+	repetitions := fs.Int("repeticiones", 5, "repeticiones de cada estrategia")
+	strategyList := fs.String("estrategias", "", "estrategias separadas por comas (vacío = todas)")
+	output := fs.String("o", "", "CSV donde guardar el tiempo de cada repetición")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *trees <= 0 || *repetitions <= 0 || *groups < 0 {
+		return withExitCode(exitUsage, errors.New("-arboles y -repeticiones deben ser positivos y -grupos no puede ser negativo"))
+	}
+	if *groups == 0 {
+		*groups = runtime.GOMAXPROCS(0)
+	}
+	strategies := schedulingStrategies
+	if *strategyList != "" {
+		strategies = nil
+		for _, name := range strings.Split(*strategyList, ",") {
+			i := slices.IndexFunc(schedulingStrategies, func(s schedulingStrategy) bool { return s.name == strings.TrimSpace(name) })
+			if i < 0 {
+				return withExitCode(exitUsage, fmt.Errorf("estrategia desconocida %q", name))
+			}
+			strategies = append(strategies, schedulingStrategies[i])
+		}
+	}
+
+	data, err := affinityData(*dataPath)
+	if err != nil {
+		return withExitCode(exitLoadFailure, err)
+	}
+	rf := &RandomForest{}
+	rf.TrainTrees(data, 0) // Solo el pipeline y la muestra: los árboles los entrena cada estrategia
+	cpus, cpuErr := allowedCPUs()
+	if cpuErr == nil && len(cpus) == 0 {
+		cpuErr = errors.New("no se pudieron leer las CPUs del proceso")
+	}
+
+	fmt.Printf("Datos: %d registros; %d árboles por estrategia, %d repeticiones, %d grupos\n", len(data), *trees, *repetitions, *groups)
+	fmt.Printf("GOMAXPROCS %d, %d CPUs", runtime.GOMAXPROCS(0), runtime.NumCPU())
+	if cpuErr == nil {
+		fmt.Printf(" (permitidas: %s)", strings.Trim(fmt.Sprint(cpus), "[]"))
+	}
+	fmt.Println()
+	for _, s := range strategies {
+		fmt.Printf("  %-12s %s\n", s.name, s.description)
+	}
+	fmt.Println()
+
+	timings := runSchedulingExperiment(rf, strategies, *trees, *groups, *repetitions, cpus)
+	for i := range timings {
+		if timings[i].Strategy.name == "grupos-cpu" && cpuErr != nil {
+			timings[i] = strategyTiming{Strategy: timings[i].Strategy, Err: cpuErr}
+		}
+	}
+	writeSchedulingReport(os.Stdout, timings, *trees, *groups)
+
+	if *output == "" {
+		return nil
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	if err := writeSchedulingCSV(file, timings, *groups); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que carga los registros del experimento o genera los sintéticos
+func affinityData(path string) ([]Atencion, error) {
+	if path != "" {
+		return loadAtenciones(context.Background(), path)
+	}
+	dir, err := os.MkdirTemp("", "tp-afinidad-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	var csvData bytes.Buffer
+	opts := GenerateOptions{Facilities: 50, Days: 365, Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Pattern: "weekly", Noise: 0.2, Seed: 1}
+	if _, err := GenerateAttendances(&csvData, opts); err != nil {
+		return nil, err
+	}
+	csvPath := filepath.Join(dir, "atenciones.csv")
+	if err := os.WriteFile(csvPath, csvData.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+	return loadAtenciones(context.Background(), csvPath)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Explicación de una predicción con aportes por característica al estilo de
+// Saabas: en cada árbol se recorre el camino de la consulta y el cambio del
+// valor esperado en cada división se atribuye a la característica que divide.
+// El valor esperado de un nodo es la fracción de votos de congestión de sus
+// hojas; como el modelo no guarda cuántas filas del entrenamiento llegaron a
+// cada rama, se supone que cada división las reparte por igual. La base (el
+// valor esperado en la raíz) más los aportes da la fracción de árboles que
+// votan congestión, así que los aportes son una estimación, no valores SHAP
+// exactos.
+
+// Aporte de una característica a la fracción de votos de congestión
+type Contribution struct {
+	Feature string  `json:"caracteristica"`
+	Value   float64 `json:"aporte"`
+}
+
+// Explicación de una predicción
+type Explanation struct {
+	Base          float64        `json:"base"`                  // Fracción esperada de votos sin mirar la consulta
+	Score         float64        `json:"puntaje"`               // Fracción de votos de congestión (base más aportes)
+	Contributions []Contribution `json:"aportes"`               // De mayor a menor aporte absoluto
+	Summary       string         `json:"resumen"`               // Los principales factores en una frase
+	Analogs       []AnalogDay    `json:"analogos,omitempty"`    // Días parecidos del histórico, si el servidor lo tiene
+	Precedent     string         `json:"precedentes,omitempty"` // Resumen de los días parecidos
+}
+
+// Modelo que puede repartir su voto entre las características
+type contributionExplainer interface {
+	// Retorna la suma de las bases y de los aportes de los árboles que votaron, y cuántos votaron
+	Contributions(att Atencion) (base float64, contributions map[string]float64, trees int)
+}
+
+// Nombre de cada característica en el resumen
+var featureDescriptions = map[string]string{
+	"Mes":        "el mes",
+	"Dia":        "el día",
+	"Atendidos":  "los atendidos",
+	"Atenciones": "las atenciones",
+	"Grupo":      "el grupo de demanda",
+	"Anio":       "el año",
+	"Citas":      "las citas programadas",
+}
+
+// Función que explica la predicción del modelo para una consulta ya preprocesada
+func Explain(model Predictor, att Atencion) (*Explanation, error) {
+	explainer, ok := model.(contributionExplainer)
+	if !ok {
+		return nil, errors.New("el modelo no permite explicar sus predicciones")
+	}
+	base, contributions, trees := explainer.Contributions(att)
+	if trees == 0 {
+		return nil, errors.New("ningún árbol del modelo votó")
+	}
+
+	e := &Explanation{Base: base / float64(trees), Score: base / float64(trees)}
+	for feature, value := range contributions {
+		value /= float64(trees)
+		e.Score += value
+		e.Contributions = append(e.Contributions, Contribution{Feature: feature, Value: value})
+	}
+	sort.Slice(e.Contributions, func(i, j int) bool {
+		a, b := e.Contributions[i], e.Contributions[j]
+		if math.Abs(a.Value) != math.Abs(b.Value) {
+			return math.Abs(a.Value) > math.Abs(b.Value)
+		}
+		return a.Feature < b.Feature
+	})
+	e.Summary = summarizeContributions(e.Contributions)
+	return e, nil
+}
+
+// Función que arma la frase con las (hasta dos) características que más aportan,
+// por ejemplo "el mes (+0.21) y el día (+0.13) son los principales factores"
+func summarizeContributions(contributions []Contribution) string {
+	var parts []string
+	for _, c := range contributions {
+		if len(parts) == 2 || math.Abs(c.Value) < 0.005 {
+			break // Ordenados de mayor a menor: el resto aporta menos
+		}
+		description, ok := featureDescriptions[c.Feature]
+		if !ok {
+			description = c.Feature
+		}
+		parts = append(parts, fmt.Sprintf("%s (%+.2f)", description, c.Value))
+	}
+	switch len(parts) {
+	case 0:
+		return "ninguna característica cambia la predicción"
+	case 1:
+		return parts[0] + " es el principal factor"
+	}
+	return strings.Join(parts, " y ") + " son los principales factores"
+}
+
+// Función que calcula los aportes de los árboles del bosque
+func (rf *RandomForest) Contributions(att Atencion) (float64, map[string]float64, int) {
+	contributions := make(map[string]float64)
+	expected := make(map[*Node]float64) // Los subárboles compartidos se calculan una vez
+	var base float64
+	for _, tree := range rf.Trees {
+		node := tree.Root
+		value := nodeExpectation(node, expected)
+		base += value
+		for !node.IsLeaf {
+			feature := node.Feature
+			accessor, _ := featureAccessor(feature)
+			if accessor(att) <= node.Threshold {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+			next := nodeExpectation(node, expected)
+			contributions[feature] += next - value
+			value = next
+		}
+	}
+	return base, contributions, len(rf.Trees)
+}
+
+// Función que calcula la fracción esperada de votos de congestión de un nodo
+func nodeExpectation(node *Node, expected map[*Node]float64) float64 {
+	if node.IsLeaf {
+		if node.Prediction {
+			return 1
+		}
+		return 0
+	}
+	if value, ok := expected[node]; ok {
+		return value
+	}
+	value := (nodeExpectation(node.Left, expected) + nodeExpectation(node.Right, expected)) / 2
+	expected[node] = value
+	return value
+}
+
+// Función que calcula los aportes de los árboles del bosque plano. Igual que en
+// Vote, un árbol corrupto no vota y no aporta.
+func (ff *FlatForest) Contributions(att Atencion) (float64, map[string]float64, int) {
+	contributions := make(map[string]float64)
+	expected := make(map[int]float64)
+	var base float64
+	trees := 0
+	for tree := 0; tree < ff.numTrees; tree++ {
+		steps := make(map[string]float64)
+		index := int(binary.LittleEndian.Uint32(ff.data[flatHeaderSize+4*tree:]))
+		value, ok := ff.nodeExpectation(index, expected, 0)
+		if !ok {
+			continue
+		}
+		rootValue := value
+		for depth := 0; ; depth++ {
+			node := ff.data[ff.nodesOff+flatNodeSize*index:]
+			if node[1]&flatLeaf != 0 {
+				break
+			}
+			threshold := int(int32(binary.LittleEndian.Uint32(node[4:])))
+			if ff.accessors[node[0]](att) <= threshold {
+				index = int(binary.LittleEndian.Uint32(node[8:]))
+			} else {
+				index = int(binary.LittleEndian.Uint32(node[12:]))
+			}
+			next, _ := ff.nodeExpectation(index, expected, depth+1) // Ya validado desde la raíz
+			steps[ff.names[node[0]]] += next - value
+			value = next
+		}
+		trees++
+		base += rootValue
+		for feature, step := range steps {
+			contributions[feature] += step
+		}
+	}
+	return base, contributions, trees
+}
+
+// Función que calcula la fracción esperada de votos de congestión de un nodo
+// del bosque plano. Retorna false si el subárbol tiene índices inválidos o es
+// más profundo que la cantidad de nodos (un ciclo).
+func (ff *FlatForest) nodeExpectation(index int, expected map[int]float64, depth int) (float64, bool) {
+	if index >= ff.numNodes || depth > ff.numNodes {
+		return 0, false
+	}
+	if value, ok := expected[index]; ok {
+		return value, true
+	}
+	node := ff.data[ff.nodesOff+flatNodeSize*index:]
+	if node[1]&flatLeaf != 0 {
+		if node[1]&flatPrediction != 0 {
+			return 1, true
+		}
+		return 0, true
+	}
+	if int(node[0]) >= len(ff.accessors) {
+		return 0, false
+	}
+	left, ok := ff.nodeExpectation(int(binary.LittleEndian.Uint32(node[8:])), expected, depth+1)
+	if !ok {
+		return 0, false
+	}
+	right, ok := ff.nodeExpectation(int(binary.LittleEndian.Uint32(node[12:])), expected, depth+1)
+	if !ok {
+		return 0, false
+	}
+	expected[index] = (left + right) / 2
+	return expected[index], true
+}
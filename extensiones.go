@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"plugin"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Características propias: otros equipos pueden agregar características del
+// dominio (por ejemplo la distancia al hospital más cercano) sin tocar el
+// entrenamiento, registrándolas con RegisterFeature desde su código o desde
+// un plugin de Go (-extensiones). Una característica registrada se elige con
+// -caracteristicas como cualquier otra, se conoce al predecir porque se calcula
+// de la fila, y su valor se redondea a entero porque los árboles dividen con
+// umbrales enteros: conviene devolverla en una unidad con la resolución
+// deseada (metros en vez de kilómetros). Los umbrales se eligen al azar dentro
+// del rango que toma en los datos de entrenamiento, que se guarda en el
+// pipeline. Un modelo que divide por una característica propia solo se puede
+// usar si esa característica está registrada.
+
+// Datos que recibe una característica propia además de la fila
+type FeatureContext struct {
+	Establishment string // Nombre normalizado del establecimiento (mayúsculas y espacios simples)
+}
+
+// Función que calcula una característica propia de una fila
+type FeatureFunc func(Atencion, FeatureContext) float64
+
+// Características registradas, en el orden de registro
+var customFeatures = struct {
+	sync.RWMutex
+	funcs map[string]FeatureFunc
+	names []string
+}{funcs: make(map[string]FeatureFunc)}
+
+// Función que registra una característica propia. Debe llamarse antes de
+// entrenar o de cargar un modelo que la use; el nombre no puede repetir el de
+// otra característica.
+func RegisterFeature(name string, fn FeatureFunc) error {
+	if name == "" || strings.ContainsAny(name, ", \t") {
+		return fmt.Errorf("nombre de característica inválido %q", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("la característica %s no tiene función", name)
+	}
+	if strings.EqualFold(name, "todas") {
+		return errors.New("\"todas\" no puede ser el nombre de una característica")
+	}
+	customFeatures.Lock()
+	defer customFeatures.Unlock()
+	for _, existing := range slices.Concat(availableFeatures, customFeatures.names) {
+		if strings.EqualFold(name, existing) {
+			return fmt.Errorf("la característica %s ya existe", existing)
+		}
+	}
+	customFeatures.funcs[name] = fn
+	customFeatures.names = append(customFeatures.names, name)
+	return nil
+}
+
+// Función que retorna la función de una característica propia
+func customFeature(name string) (FeatureFunc, bool) {
+	customFeatures.RLock()
+	defer customFeatures.RUnlock()
+	fn, ok := customFeatures.funcs[name]
+	return fn, ok
+}
+
+// Función que retorna las columnas de Atencion seguidas de las características propias
+func registeredFeatures() []string {
+	customFeatures.RLock()
+	defer customFeatures.RUnlock()
+	return slices.Concat(availableFeatures, customFeatures.names)
+}
+
+// Función que lee una característica propia de una fila, redondeada a entero.
+// Los valores infinitos o fuera del rango de int32 (el de los umbrales del
+// modelo plano) se recortan a ese rango, y NaN vale 0.
+func customAccessor(fn FeatureFunc) func(Atencion) int {
+	return func(att Atencion) int {
+		v := fn(att, FeatureContext{Establishment: normalizeEstablishment(att.NombreEstablecimiento)})
+		if math.IsNaN(v) {
+			return 0
+		}
+		return int(math.Max(math.MinInt32, math.Min(math.MaxInt32, math.Round(v))))
+	}
+}
+
+// Función que retorna el mínimo y el máximo en los datos de las
+// características de la lista sin un rango fijo, Citas y las propias (nil si
+// la lista no tiene ninguna)
+func featureRanges(data []Atencion, features []string) map[string][2]int {
+	var ranges map[string][2]int
+	for _, name := range features {
+		if _, custom := customFeature(name); (!custom && name != "Citas") || len(data) == 0 {
+			continue
+		}
+		get, _ := featureAccessor(name)
+		r := [2]int{get(data[0]), get(data[0])}
+		for _, att := range data[1:] {
+			v := get(att)
+			r[0], r[1] = min(r[0], v), max(r[1], v)
+		}
+		if ranges == nil {
+			ranges = make(map[string][2]int)
+		}
+		ranges[name] = r
+	}
+	return ranges
+}
+
+// Función que quita de la lista las características propias, que se calculan
+// de la fila y no se pueden fijar a otro valor como piden la dependencia
+// parcial, la importancia por permutación y las interacciones; avisa cuáles omite
+func withoutCustomFeatures(features []string) []string {
+	var kept, skipped []string
+	for _, name := range features {
+		if _, custom := customFeature(name); custom {
+			skipped = append(skipped, name)
+		} else {
+			kept = append(kept, name)
+		}
+	}
+	if len(skipped) > 0 {
+		log.Printf("Se omiten las características propias, que no se pueden fijar a otro valor: %s", strings.Join(skipped, ", "))
+	}
+	return kept
+}
+
+// Símbolo que exporta un plugin de características. Un plugin es un paquete
+// main compilado con -buildmode=plugin que declara
+//
+//	var Features = map[string]func(establecimiento string, anio, mes, dia int) float64{...}
+//
+// Solo usa tipos de la biblioteca estándar porque un plugin no puede importar
+// este paquete.
+const pluginSymbol = "Features"
+
+// Función que carga los plugins de una lista de rutas separadas por comas y
+// registra sus características, ordenadas por nombre dentro de cada plugin
+func loadFeaturePlugins(list string) error {
+	for _, path := range strings.Split(list, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		p, err := plugin.Open(path)
+		if err != nil {
+			return fmt.Errorf("no se pudo abrir la extensión %s: %w", path, err)
+		}
+		symbol, err := p.Lookup(pluginSymbol)
+		if err != nil {
+			return fmt.Errorf("la extensión %s no exporta %s: %w", path, pluginSymbol, err)
+		}
+		features, ok := symbol.(*map[string]func(string, int, int, int) float64)
+		if !ok {
+			return fmt.Errorf("la extensión %s exporta %s con un tipo inesperado %T", path, pluginSymbol, symbol)
+		}
+		names := make([]string, 0, len(*features))
+		for name := range *features {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fn := (*features)[name]
+			err := RegisterFeature(name, func(att Atencion, ctx FeatureContext) float64 {
+				return fn(ctx.Establishment, att.Anio, att.Mes, att.Dia)
+			})
+			if err != nil {
+				return fmt.Errorf("extensión %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
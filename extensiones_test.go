@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCustomAccessorClampsNonFiniteValues(t *testing.T) {
+	cases := map[float64]int{
+		math.Inf(1):  math.MaxInt32,
+		math.Inf(-1): math.MinInt32,
+		1e300:        math.MaxInt32,
+		-1e300:       math.MinInt32,
+		math.NaN():   0,
+		41.6:         42,
+	}
+	for value, want := range cases {
+		get := customAccessor(func(Atencion, FeatureContext) float64 { return value })
+		if got := get(Atencion{}); got != want {
+			t.Errorf("valor %g: %d, se esperaba %d", value, got, want)
+		}
+	}
+}
+
+// Un rango más ancho que el mayor int no puede hacer fallar la elección del umbral
+func TestSelectThresholdWithWideRange(t *testing.T) {
+	dt := NewDecisionTree()
+	dt.Features = []string{"Lejania"}
+	dt.ranges = map[string][2]int{"Lejania": {math.MinInt, 5000}}
+	for i := 0; i < 100; i++ {
+		if _, threshold := dt.selectFeatureAndThreshold(); threshold >= 5000 {
+			t.Fatalf("umbral %d fuera del rango", threshold)
+		}
+	}
+}
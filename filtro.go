@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Lenguaje de filtros sobre las atenciones, por ejemplo:
+//
+//	mes >= 6 AND atendidos > 0 AND establecimiento ~ "HOSPITAL"
+//
+// Campos: mes, dia, atendidos, atenciones (enteros) y establecimiento (texto).
+// Operadores: = != < <= > >= y ~ (expresión regular, solo para texto).
+// Las condiciones se combinan con AND, OR, NOT y paréntesis.
+
+// Filtro compilado
+type Filter func(att Atencion) bool
+
+// Función que compila una expresión de filtro
+func ParseFilter(expr string) (Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("filtro: símbolo inesperado %q", p.peek().text)
+	}
+	return filter, nil
+}
+
+// Tipos de símbolo del filtro
+type tokenKind int
+
+const (
+	tokWord   tokenKind = iota // Campo o palabra clave
+	tokNumber                  // Número entero
+	tokString                  // Texto entre comillas
+	tokOp                      // Operador de comparación
+	tokLParen                  // (
+	tokRParen                  // )
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+}
+
+// Función que separa la expresión en símbolos
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{tokLParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{tokRParen, ")"})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("filtro: texto sin cerrar en la posición %d", i)
+			}
+			tokens = append(tokens, filterToken{tokString, string(runes[i+1 : end])})
+			i = end + 1
+		case strings.ContainsRune("=!<>~", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("filtro: operador inválido en la posición %d", i)
+			}
+			tokens = append(tokens, filterToken{tokOp, op})
+			i += len([]rune(op))
+		case unicode.IsDigit(r) || r == '-':
+			end := i + 1
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, filterToken{tokNumber, string(runes[i:end])})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, filterToken{tokWord, string(runes[i:end])})
+			i = end
+		default:
+			return nil, fmt.Errorf("filtro: carácter inesperado %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+// Analizador descendente recursivo del filtro
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+// Indica si el siguiente símbolo es la palabra clave dada (sin distinguir mayúsculas)
+func (p *filterParser) keyword(word string) bool {
+	t := p.peek()
+	if !p.done() && t.kind == tokWord && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(att Atencion) bool { return l(att) || right(att) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(att Atencion) bool { return l(att) && right(att) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (Filter, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(att Atencion) bool { return !inner(att) }, nil
+	}
+	if p.peek().kind == tokLParen && !p.done() {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("filtro: falta cerrar un paréntesis")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+// Función que compila una comparación campo operador valor
+func (p *filterParser) parseComparison() (Filter, error) {
+	if p.done() || p.peek().kind != tokWord {
+		return nil, fmt.Errorf("filtro: se esperaba un campo")
+	}
+	field := strings.ToLower(p.tokens[p.pos].text)
+	p.pos++
+	if p.done() || p.peek().kind != tokOp {
+		return nil, fmt.Errorf("filtro: se esperaba un operador después de %s", field)
+	}
+	op := p.tokens[p.pos].text
+	p.pos++
+	if p.done() {
+		return nil, fmt.Errorf("filtro: falta el valor de %s", field)
+	}
+	value := p.tokens[p.pos]
+	p.pos++
+
+	if field == "establecimiento" {
+		if value.kind != tokString {
+			return nil, fmt.Errorf("filtro: establecimiento se compara con un texto entre comillas")
+		}
+		return stringComparison(op, value.text)
+	}
+
+	accessor, ok := filterFields[field]
+	if !ok {
+		return nil, fmt.Errorf("filtro: campo desconocido %q", field)
+	}
+	if value.kind != tokNumber {
+		return nil, fmt.Errorf("filtro: %s se compara con un número", field)
+	}
+	n, err := strconv.Atoi(value.text)
+	if err != nil {
+		return nil, fmt.Errorf("filtro: número inválido %q", value.text)
+	}
+	return intComparison(accessor, op, n)
+}
+
+// Campos enteros disponibles en los filtros
+var filterFields = map[string]func(Atencion) int{
+	"mes":        func(att Atencion) int { return att.Mes },
+	"dia":        func(att Atencion) int { return att.Dia },
+	"atendidos":  func(att Atencion) int { return att.Atendidos },
+	"atenciones": func(att Atencion) int { return att.Atenciones },
+	"citas":      func(att Atencion) int { return att.Citas },
+}
+
+func intComparison(get func(Atencion) int, op string, n int) (Filter, error) {
+	switch op {
+	case "=", "==":
+		return func(att Atencion) bool { return get(att) == n }, nil
+	case "!=":
+		return func(att Atencion) bool { return get(att) != n }, nil
+	case "<":
+		return func(att Atencion) bool { return get(att) < n }, nil
+	case "<=":
+		return func(att Atencion) bool { return get(att) <= n }, nil
+	case ">":
+		return func(att Atencion) bool { return get(att) > n }, nil
+	case ">=":
+		return func(att Atencion) bool { return get(att) >= n }, nil
+	}
+	return nil, fmt.Errorf("filtro: operador %s no válido para números", op)
+}
+
+func stringComparison(op, text string) (Filter, error) {
+	switch op {
+	case "=", "==":
+		return func(att Atencion) bool { return att.NombreEstablecimiento == text }, nil
+	case "!=":
+		return func(att Atencion) bool { return att.NombreEstablecimiento != text }, nil
+	case "~":
+		re, err := regexp.Compile(text)
+		if err != nil {
+			return nil, fmt.Errorf("filtro: expresión regular inválida: %w", err)
+		}
+		return func(att Atencion) bool { return re.MatchString(att.NombreEstablecimiento) }, nil
+	}
+	return nil, fmt.Errorf("filtro: operador %s no válido para texto", op)
+}
+
+// Función que aplica un filtro en paralelo: cada goroutine filtra un tramo del
+// slice y los resultados se unen conservando el orden original
+func filterAtenciones(data []Atencion, filter Filter) []Atencion {
+	workers := runtime.GOMAXPROCS(0)
+	size := (len(data) + workers - 1) / workers
+	if size == 0 {
+		return nil
+	}
+
+	parts := make([][]Atencion, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start, end := w*size, min((w+1)*size, len(data))
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func(w int, chunk []Atencion) {
+			defer wg.Done()
+			for _, att := range chunk {
+				if filter(att) {
+					parts[w] = append(parts[w], att)
+				}
+			}
+		}(w, data[start:end])
+	}
+	wg.Wait()
+
+	var result []Atencion
+	for _, part := range parts {
+		result = append(result, part...)
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Subcomando "merge-models": une los árboles de varios bosques compatibles en uno
+// solo, por ejemplo cuando el entrenamiento se repartió entre varias máquinas.
+//
+//	merge-models a.gob b.gob -o combinado.gob
+func mergeModelsCommand(args []string) error {
+	fs := flag.NewFlagSet("merge-models", flag.ContinueOnError)
+	output := fs.String("o", "combinado.gob.gz", "archivo donde guardar el modelo combinado")
+	inputs, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(inputs) < 2 {
+		return errors.New("se necesitan al menos dos modelos para combinar")
+	}
+
+	forests := make([]*RandomForest, len(inputs))
+	for i, path := range inputs {
+		if forests[i], err = LoadModel(path); err != nil {
+			return fmt.Errorf("no se pudo cargar %s: %w", path, err)
+		}
+		fmt.Printf("%s: %d árboles\n", path, len(forests[i].Trees))
+	}
+
+	merged, err := mergeForests(forests...)
+	if err != nil {
+		return err
+	}
+	err = merged.Save(*output)
+	audit(context.Background(), auditMergeModels, *output, err, map[string]any{"modelos": strings.Join(inputs, ","), "arboles": len(merged.Trees)})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Modelo combinado con %d árboles guardado en %s\n", len(merged.Trees), *output)
+	return nil
+}
+
+// Función que concatena los árboles de varios bosques. Todos deben tener el
+// mismo esquema de características y el mismo umbral de congestión.
+func mergeForests(forests ...*RandomForest) (*RandomForest, error) {
+	merged := &RandomForest{
+		Features: forests[0].Features,
+		OOBError: -1, // Cada bosque midió su error con otros datos; el combinado no se puede calcular
+	}
+	schema := forests[0].featureSchema()
+	for i, rf := range forests {
+		if other := rf.featureSchema(); !slices.Equal(schema, other) {
+			return nil, fmt.Errorf("el modelo %d usa las características %s y el primero %s",
+				i+1, strings.Join(other, ","), strings.Join(schema, ","))
+		}
+		if rf.TrainedAt.After(merged.TrainedAt) {
+			merged.TrainedAt = rf.TrainedAt // El combinado es tan reciente como su bosque más nuevo
+		}
+		pipeline, err := merged.Pipeline.merge(rf.Pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("el modelo %d no es compatible: %w", i+1, err)
+		}
+		merged.Pipeline = pipeline
+		merged.Trees = append(merged.Trees, rf.Trees...)
+	}
+	return merged, nil
+}
+
+// Función que retorna las características que pudieron usar los árboles, ordenadas.
+// Los modelos que no guardaron su selección se describen por las que realmente usan.
+func (rf *RandomForest) featureSchema() []string {
+	features := rf.UsedFeatures()
+	switch {
+	case rf.Pipeline != nil && len(rf.Pipeline.Features) > 0:
+		features = rf.Pipeline.Features
+	case len(rf.Features) > 0:
+		features = rf.Features
+	}
+	return slices.Sorted(slices.Values(features))
+}
+
+// Función que combina dos pipelines: une los establecimientos y promedia los
+// históricos según la cantidad de registros de cada uno. Un pipeline nil se
+// toma como ausente.
+func (p *Pipeline) merge(other *Pipeline) (*Pipeline, error) {
+	if p == nil {
+		return other, nil
+	}
+	if other == nil {
+		return p, nil
+	}
+	if p.CongestionThreshold != other.CongestionThreshold {
+		return nil, fmt.Errorf("umbral de congestión %d distinto de %d", other.CongestionThreshold, p.CongestionThreshold)
+	}
+	capacities, err := p.Capacities.merge(other.Capacities)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &Pipeline{
+		CongestionThreshold: p.CongestionThreshold,
+		Features:            p.Features,
+		Establishments:      make(map[string]string, len(p.Establishments)),
+		Imputer:             p.Imputer.merge(other.Imputer),
+		Forecaster:          p.Forecaster.merge(other.Forecaster),
+		Clusters:            p.Clusters, // Los grupos no se pueden combinar: valen los del primero
+		Capacities:          capacities,
+		Winsorizer:          p.Winsorizer, // Los topes tampoco: valen los del primero
+		Years:               p.Years.union(other.Years),
+		CongestedRate:       p.CongestedRate,
+	}
+	if p.Quality != nil || other.Quality != nil {
+		merged.Quality = make(map[string]dataQuality, len(p.Quality)+len(other.Quality))
+		for key, q := range other.Quality {
+			merged.Quality[key] = q
+		}
+		for key, q := range p.Quality {
+			merged.Quality[key] = q // Como con los nombres, gana el primero
+		}
+	}
+	if a, b := p.Imputer, other.Imputer; a != nil && b != nil && a.Global.Count+b.Global.Count > 0 {
+		// La tasa de congestión se pondera por los registros de cada entrenamiento
+		merged.CongestedRate = (p.CongestedRate*float64(a.Global.Count) + other.CongestedRate*float64(b.Global.Count)) /
+			float64(a.Global.Count+b.Global.Count)
+	}
+	for key, name := range other.Establishments {
+		merged.Establishments[key] = name
+	}
+	for key, name := range p.Establishments {
+		merged.Establishments[key] = name // Ante un mismo nombre normalizado gana el primero
+	}
+	return merged, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Cliente mínimo de Google Cloud Storage por la API JSON. El token OAuth se toma
+// de GOOGLE_OAUTH_ACCESS_TOKEN; con STORAGE_EMULATOR_HOST se usa un emulador.
+type gcsClient struct {
+	token    string
+	endpoint string
+	client   *http.Client
+}
+
+// Función que crea el cliente a partir de las variables de entorno
+func newGCSClientFromEnv() (*gcsClient, error) {
+	c := &gcsClient{
+		token:    os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		endpoint: "https://storage.googleapis.com",
+		client:   &http.Client{},
+	}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		c.endpoint = strings.TrimSuffix(host, "/")
+	} else if c.token == "" {
+		return nil, errors.New("gcs: falta GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	return c, nil
+}
+
+// Función que envía una petición autenticada y convierte las respuestas de error
+func (c *gcsClient) do(req *http.Request, accept ...int) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	for _, code := range accept {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	return nil, objectError(resp.StatusCode, fmt.Errorf("gcs: %s %s respondió %s: %s", req.Method, req.URL.Path, resp.Status, detail))
+}
+
+// Función que descarga un objeto desde el desplazamiento indicado
+func (c *gcsClient) get(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, error) {
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", c.endpoint, url.PathEscape(bucket), url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Función que retorna la generación del objeto a partir de sus metadatos
+func (c *gcsClient) version(ctx context.Context, bucket, key string) (string, error) {
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?fields=generation", c.endpoint, url.PathEscape(bucket), url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var meta struct {
+		Generation string `json:"generation"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil || meta.Generation == "" {
+		return "", fmt.Errorf("gcs: metadatos inválidos de %s/%s", bucket, key)
+	}
+	return meta.Generation, nil
+}
+
+// Subida reanudable de GCS: se abre una sesión y el contenido se envía por
+// tramos con Content-Range. Los tramos intermedios deben ser múltiplos de 256 KiB.
+type gcsUpload struct {
+	client  *gcsClient
+	session string // URI de la sesión de subida
+	offset  int64  // Bytes ya confirmados
+}
+
+func (c *gcsClient) newUpload(ctx context.Context, bucket, key string) (chunkUploader, error) {
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s", c.endpoint, url.PathEscape(bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return nil, errors.New("gcs: la respuesta no trae la sesión de subida")
+	}
+	return &gcsUpload{client: c, session: session}, nil
+}
+
+// Función que envía un tramo; el último indica el tamaño total del objeto
+func (u *gcsUpload) uploadPart(ctx context.Context, part []byte, final bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.session, bytes.NewReader(part))
+	if err != nil {
+		return err
+	}
+	end := u.offset + int64(len(part))
+	total := "*"
+	if final {
+		total = fmt.Sprint(end)
+	}
+	if len(part) == 0 {
+		req.Header.Set("Content-Range", "bytes */"+total)
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", u.offset, end-1, total))
+	}
+	resp, err := u.client.do(req, 308) // 308: tramo recibido, la subida sigue abierta
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	u.offset = end
+	return nil
+}
+
+// El último tramo ya confirma la subida
+func (u *gcsUpload) complete(ctx context.Context) error {
+	return nil
+}
+
+// Función que cancela la sesión de subida
+func (u *gcsUpload) abort(ctx context.Context) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.session, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := u.client.client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
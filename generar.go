@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Generación de datos sintéticos: CSV de atenciones con el mismo formato que
+// los del ministerio, con patrones de congestión y ruido controlables, para
+// demostraciones, mediciones y pruebas sin datos reales de pacientes. Con la
+// misma semilla se obtiene siempre el mismo archivo.
+
+// Patrones de congestión que se pueden generar
+var congestionPatterns = map[string]string{
+	"flat":      "demanda constante, solo con ruido",
+	"weekly":    "más demanda al inicio de la semana y poca los fines de semana",
+	"seasonal":  "picos en los meses de invierno",
+	"outbreaks": "brotes de varios días con demanda alta en algunos establecimientos",
+}
+
+// Prefijos y nombres con los que se arman los establecimientos sintéticos
+var (
+	facilityKinds = []string{"HOSPITAL", "CENTRO DE SALUD", "PUESTO DE SALUD", "POLICLINICO"}
+	facilityNames = []string{"SAN JUAN", "SANTA ROSA", "LA UNION", "SAN MARTIN", "LOS OLIVOS", "SANTA MARTHA",
+		"VILLA EL SALVADOR", "SAN PEDRO", "NUEVA ESPERANZA", "EL PORVENIR", "LAS PALMERAS", "SAN JOSE"}
+)
+
+// Parámetros de la generación
+type GenerateOptions struct {
+	Facilities int       // Número de establecimientos
+	Days       int       // Días consecutivos desde Start
+	Start      time.Time // Primer día
+	Pattern    string    // Patrón de congestión (ver congestionPatterns)
+	Noise      float64   // Desviación relativa de la demanda diaria (0.2 = ±20%)
+	Seed       int64     // Semilla del generador
+}
+
+// Establecimiento sintético con su demanda base
+type syntheticFacility struct {
+	name     string
+	base     float64 // Atenciones promedio por día
+	ratio    float64 // Fracción de atenciones que corresponden a pacientes distintos
+	outbreak int     // Día en que empieza su brote (-1 si no tiene)
+}
+
+// Función del subcomando generate
+func generateCommand(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	var opts GenerateOptions
+	fs.IntVar(&opts.Facilities, "establecimientos", 50, "número de establecimientos")
+	fs.IntVar(&opts.Days, "days", 365, "días consecutivos a generar")
+	fs.StringVar(&opts.Pattern, "pattern", "weekly", "patrón de congestión: flat, weekly, seasonal u outbreaks")
+	fs.Float64Var(&opts.Noise, "ruido", 0.2, "desviación relativa de la demanda diaria")
+	fs.Int64Var(&opts.Seed, "semilla", 1, "semilla del generador (la misma semilla da el mismo archivo)")
+	start := fs.String("desde", "2024-01-01", "primer día (AAAA-MM-DD)")
+	output := fs.String("o", "-", "archivo CSV de salida ('-' = salida estándar)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: tpconcurrente generate [opciones]")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), "\nPatrones:")
+		for _, name := range sortedKeys(congestionPatterns) {
+			fmt.Fprintf(fs.Output(), "  %-10s %s\n", name, congestionPatterns[name])
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if opts.Start, err = time.Parse(time.DateOnly, *start); err != nil {
+		return fmt.Errorf("fecha inválida en -desde: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	rows, err := GenerateAttendances(w, opts)
+	if err != nil {
+		return err
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "%d registros de %d establecimientos escritos en %s (patrón %s)\n", rows, opts.Facilities, *output, opts.Pattern)
+	}
+	return nil
+}
+
+// Función que escribe un CSV sintético de atenciones y retorna el número de registros
+func GenerateAttendances(w io.Writer, opts GenerateOptions) (int, error) {
+	if _, ok := congestionPatterns[opts.Pattern]; !ok {
+		return 0, fmt.Errorf("patrón desconocido %q (flat, weekly, seasonal u outbreaks)", opts.Pattern)
+	}
+	if opts.Facilities <= 0 || opts.Days <= 0 {
+		return 0, errors.New("los establecimientos y los días deben ser positivos")
+	}
+	if opts.Noise < 0 {
+		return 0, errors.New("el ruido no puede ser negativo")
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	facilities := make([]syntheticFacility, opts.Facilities)
+	for i := range facilities {
+		facilities[i] = newSyntheticFacility(rng, i, opts)
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"MES", "DIA", "NOMBRE_ESTACLECIMIENTO", "ATENDIDOS", "ATENCIONES"}); err != nil {
+		return 0, err
+	}
+	rows := 0
+	for day := 0; day < opts.Days; day++ {
+		date := opts.Start.AddDate(0, 0, day)
+		month, dayOfMonth := strconv.Itoa(int(date.Month())), strconv.Itoa(date.Day())
+		for _, f := range facilities {
+			demand := f.base * patternFactor(opts.Pattern, date, day, f) * math.Max(0, 1+opts.Noise*rng.NormFloat64())
+			attentions := poisson(rng, demand)
+			attended := binomial(rng, attentions, f.ratio)
+			if err := out.Write([]string{month, dayOfMonth, f.name, strconv.Itoa(attended), strconv.Itoa(attentions)}); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+	}
+	out.Flush()
+	return rows, out.Error()
+}
+
+// Función que arma un establecimiento con nombre único, demanda base y, en el
+// patrón de brotes, el día de su brote (uno de cada cinco tiene)
+func newSyntheticFacility(rng *rand.Rand, i int, opts GenerateOptions) syntheticFacility {
+	kind := facilityKinds[rng.Intn(len(facilityKinds))]
+	f := syntheticFacility{
+		name:     fmt.Sprintf("%s %s %d", kind, facilityNames[i%len(facilityNames)], i/len(facilityNames)+1),
+		base:     math.Exp(rng.NormFloat64()*0.6 + 2.5), // Lognormal: la mayoría con pocas atenciones, algunos con muchas
+		ratio:    0.6 + 0.3*rng.Float64(),
+		outbreak: -1,
+	}
+	if kind == "HOSPITAL" {
+		f.base *= 3
+	}
+	if opts.Pattern == "outbreaks" && rng.Intn(5) == 0 {
+		f.outbreak = rng.Intn(opts.Days)
+	}
+	return f
+}
+
+// Función que retorna el multiplicador de la demanda de un día según el patrón
+func patternFactor(pattern string, date time.Time, day int, f syntheticFacility) float64 {
+	switch pattern {
+	case "weekly":
+		return [...]float64{0.4, 1.5, 1.3, 1.1, 1.0, 0.9, 0.5}[date.Weekday()] // Domingo a sábado
+	case "seasonal":
+		// Máximo a mediados de julio (invierno en el hemisferio sur)
+		return 1 + 0.6*math.Cos(2*math.Pi*float64(date.YearDay()-196)/365)
+	case "outbreaks":
+		if f.outbreak >= 0 && day >= f.outbreak && day < f.outbreak+14 {
+			return 2.5
+		}
+	}
+	return 1
+}
+
+// Función que muestrea una variable de Poisson con media lambda (aproximada
+// por una normal para medias grandes)
+func poisson(rng *rand.Rand, lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	if lambda > 50 {
+		return max(0, int(math.Round(lambda+math.Sqrt(lambda)*rng.NormFloat64())))
+	}
+	limit, k, p := math.Exp(-lambda), 0, rng.Float64()
+	for p > limit {
+		k++
+		p *= rng.Float64()
+	}
+	return k
+}
+
+// Función que muestrea cuántos de n ensayos tienen éxito con probabilidad p
+func binomial(rng *rand.Rand, n int, p float64) int {
+	successes := 0
+	for range n {
+		if rng.Float64() < p {
+			successes++
+		}
+	}
+	return successes
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Modo de depuración de goroutines: con TP_DEBUG_GOROUTINES=1 se anotan las
+// goroutines vivas al iniciar y, al salir, se listan con su pila las que
+// siguen corriendo y no estaban al principio. Si hay alguna el proceso termina
+// con código 3, para que una prueba automatizada lo detecte.
+
+// Tiempo que se espera a que terminen las goroutines antes de darlas por filtradas
+const leakGracePeriod = 2 * time.Second
+
+// Goroutines vivas al iniciar (nil si el modo de depuración está desactivado)
+var goroutineBaseline map[string]bool
+
+// Funciones que pertenecen a goroutines del runtime o de la biblioteca estándar
+// que viven durante todo el proceso y no son una fuga
+var persistentGoroutines = []string{
+	"os/signal.loop",
+	"os/signal.signal_recv",
+	"runtime.ensureSigM",
+	"net/http.(*persistConn)",
+}
+
+// Función que anota las goroutines iniciales si el modo de depuración está activo
+func startLeakCheck() {
+	if os.Getenv("TP_DEBUG_GOROUTINES") == "" {
+		return
+	}
+	goroutineBaseline = make(map[string]bool)
+	for id := range goroutineStacks() {
+		goroutineBaseline[id] = true
+	}
+}
+
+// Función que informa las goroutines que siguen vivas al salir. Retorna cuántas hay.
+func reportLeakedGoroutines() int {
+	if goroutineBaseline == nil {
+		return 0
+	}
+	// Las conexiones HTTP inactivas mantienen goroutines de lectura y escritura
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+
+	var leaked map[string]string
+	deadline := time.Now().Add(leakGracePeriod)
+	for {
+		leaked = make(map[string]string)
+		for id, stack := range goroutineStacks() {
+			if !goroutineBaseline[id] && !isPersistentGoroutine(stack) {
+				leaked[id] = stack
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond) // Dar tiempo a las que están terminando
+	}
+
+	if len(leaked) == 0 {
+		fmt.Fprintln(os.Stderr, "Depuración: no quedaron goroutines vivas al salir.")
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Depuración: %d goroutines siguen vivas al salir:\n\n", len(leaked))
+	for _, id := range sortedKeys(leaked) {
+		fmt.Fprintf(os.Stderr, "%s\n\n", leaked[id])
+	}
+	return len(leaked)
+}
+
+// Función que retorna la pila de cada goroutine viva (salvo la actual) indexada por su ID
+func goroutineStacks() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for i, block := range bytes.Split(buf, []byte("\n\n")) {
+		if i == 0 {
+			continue // La primera pila es la de la goroutine que llama
+		}
+		header, _, _ := strings.Cut(string(block), " [") // "goroutine 12 [chan receive]:"
+		stacks[header] = strings.TrimSpace(string(block))
+	}
+	return stacks
+}
+
+// Función que indica si la pila corresponde a una goroutine que vive todo el proceso
+func isPersistentGoroutine(stack string) bool {
+	for _, fn := range persistentGoroutines {
+		if strings.Contains(stack, fn) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Guiones del menú: un archivo de texto con una acción por línea que se
+// ejecuta sin preguntar nada, para demostraciones reproducibles o para
+// corregir trabajos automáticamente. -grabar escribe en ese formato las
+// acciones de una sesión interactiva. Las líneas vacías y las que empiezan con
+// # se ignoran; los argumentos con espacios van entre comillas dobles.
+//
+//	load atenciones_filtradas.csv
+//	load atenciones_2023.csv 2023
+//	use atenciones_filtradas
+//	train 200 s Mes,Dia
+//	predict "HOSPITAL LOS OLIVOS" 15/07/2026
+//	save modelo.gob.gz
+//
+// Un guion se detiene en la primera acción que falla, con el número de línea, y
+// el proceso termina con el código de salida de la falla (ver salida.go).
+
+// Acción de un guion
+type scriptAction struct {
+	option   int // Opción equivalente del menú, para verificar el perfil
+	exitCode int // Código de salida si la acción falla (0 = el genérico)
+	usage    string
+	run      func(m *menu, args []string, rest string) error // rest es la línea sin la acción
+}
+
+// Acciones que se pueden usar en un guion
+var scriptActions = map[string]scriptAction{
+	"load": {1, exitLoadFailure, "load <archivo> [nombre]", func(m *menu, args []string, _ string) error {
+		if len(args) < 1 || len(args) > 2 {
+			return errScriptUsage
+		}
+		return m.loadRecords(args[0], strings.Join(args[1:], ""))
+	}},
+	"train": {2, exitTrainFailure, "train <árboles> [s|n] [características]", func(m *menu, args []string, _ string) error {
+		if len(args) < 1 || len(args) > 3 {
+			return errScriptUsage
+		}
+		trees, err := strconv.Atoi(args[0])
+		if err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("número de árboles inválido %q", args[0]))
+		}
+		earlyStopping := len(args) > 1 && (args[1] == "s" || args[1] == "S")
+		var features []string
+		if len(args) > 2 {
+			if features, err = ParseFeatures(args[2]); err != nil {
+				return err
+			}
+		}
+		return m.train(trees, earlyStopping, features)
+	}},
+	"predict": {3, 0, "predict <establecimiento> <dd/mm/aaaa> | predict <establecimiento> <mes> <día>", func(m *menu, args []string, _ string) error {
+		var date time.Time
+		var err error
+		switch len(args) {
+		case 2:
+			date, err = parseLocalDate(args[1])
+		case 3:
+			// Mes y día sueltos: la fecha se ubica en el año en curso
+			date, err = parseLocalDate(args[2] + "/" + args[1] + "/" + strconv.Itoa(time.Now().Year()))
+		default:
+			return errScriptUsage
+		}
+		if err != nil {
+			return err
+		}
+		establishment, err := m.findEstablishment(args[0])
+		if err != nil {
+			return err
+		}
+		return m.predict(establishment, date)
+	}},
+	"add-trees": {4, exitTrainFailure, "add-trees <árboles>", func(m *menu, args []string, _ string) error {
+		if len(args) != 1 {
+			return errScriptUsage
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("número de árboles inválido %q", args[0]))
+		}
+		return m.addTrees(n)
+	}},
+	"save": {5, 0, "save <archivo>", func(m *menu, args []string, _ string) error {
+		if len(args) != 1 {
+			return errScriptUsage
+		}
+		return m.saveModel(args[0])
+	}},
+	"load-model": {6, 0, "load-model <archivo>", func(m *menu, args []string, _ string) error {
+		if len(args) != 1 {
+			return errScriptUsage
+		}
+		return m.loadModel(args[0])
+	}},
+	"export": {7, 0, "export <archivo>", func(m *menu, args []string, _ string) error {
+		if len(args) != 1 {
+			return errScriptUsage
+		}
+		return m.exportFlat(args[0])
+	}},
+	"filter": {8, 0, "filter <expresión>", func(m *menu, _ []string, rest string) error {
+		if rest == "" {
+			return errScriptUsage
+		}
+		return m.filter(rest)
+	}},
+	"audit": {10, 0, "audit [operación]", func(m *menu, args []string, _ string) error {
+		if len(args) > 1 {
+			return errScriptUsage
+		}
+		return m.showAudit(strings.Join(args, ""))
+	}},
+	"use": {11, 0, "use <conjunto>", func(m *menu, args []string, _ string) error {
+		if len(args) != 1 {
+			return errScriptUsage
+		}
+		return m.useDataset(args[0])
+	}},
+	"compare": {12, 0, "compare [conjuntos...]", func(m *menu, args []string, _ string) error {
+		return m.compareDatasets(args)
+	}},
+	"diff": {12, 0, "diff <conjunto anterior> <conjunto nuevo>", func(m *menu, args []string, _ string) error {
+		if len(args) != 2 {
+			return errScriptUsage
+		}
+		return m.diffDatasets(args[0], args[1])
+	}},
+}
+
+// Error de una acción con argumentos de más o de menos; se completa con su uso
+var errScriptUsage = errors.New("argumentos inválidos")
+
+// Función que busca un establecimiento del conjunto activo por su nombre, sin
+// distinguir mayúsculas ni tildes
+func (m *menu) findEstablishment(name string) (string, error) {
+	if m.data.active == nil {
+		return "", errNoRecords
+	}
+	for _, establishment := range m.data.active.Index.Establishments() {
+		if normalizeEstablishment(establishment) == normalizeEstablishment(name) {
+			return establishment, nil
+		}
+	}
+	return "", fmt.Errorf("establecimiento desconocido %q", name)
+}
+
+// Función que separa una línea del guion en palabras, respetando las comillas dobles
+func splitScriptLine(line string) ([]string, error) {
+	var words []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return words, nil
+		}
+		if line[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("comillas sin cerrar en %s", line)
+			}
+			word, _ := strconv.Unquote(quoted)
+			words, line = append(words, word), line[len(quoted):]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		words, line = append(words, line[:end]), line[end:]
+	}
+}
+
+// Función que escribe un argumento, entre comillas si hace falta para leerlo igual
+func quoteScriptWord(word string) string {
+	if word == "" || strings.ContainsAny(word, " \t\"#") {
+		return strconv.Quote(word)
+	}
+	return word
+}
+
+// Función que ejecuta un guion en un menú nuevo
+func runScript(path string, recorder *scriptRecorder) error {
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Un guion no depende de la sesión anterior ni la modifica
+	m := &menu{rf: &RandomForest{}, session: &menuSession{disabled: true}, recorder: recorder}
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fmt.Printf("\n> %s\n", line)
+		if err := m.runScriptLine(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Función que ejecuta una línea del guion
+func (m *menu) runScriptLine(line string) error {
+	verb, rest, _ := strings.Cut(line, " ")
+	action, ok := scriptActions[verb]
+	if !ok {
+		return fmt.Errorf("acción desconocida %q (disponibles: %s)", verb, strings.Join(sortedKeys(scriptActions), ", "))
+	}
+	// Las mismas restricciones de perfil que las opciones del menú
+	if required, ok := menuActions[action.option]; ok {
+		if err := profile.check(required); err != nil {
+			return err
+		}
+	}
+	rest = strings.TrimSpace(rest)
+	args, err := splitScriptLine(rest)
+	if err != nil {
+		return err
+	}
+	if err := action.run(m, args, rest); err != nil {
+		if err == errScriptUsage {
+			return withExitCode(exitUsage, fmt.Errorf("%w; uso: %s", err, action.usage))
+		}
+		if action.exitCode != 0 && exitCodeFor(err) == exitError {
+			return withExitCode(action.exitCode, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Grabación de las acciones de una sesión como guion. Cada acción se escribe
+// apenas termina, para no perderla si el programa se interrumpe.
+type scriptRecorder struct {
+	file *os.File
+	err  error // Primer error de escritura; se informa al cerrar
+}
+
+// Función que crea el guion en el que se grabará la sesión
+func newScriptRecorder(path string) (*scriptRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &scriptRecorder{file: file}
+	r.addLine("# Sesión grabada el " + time.Now().Format("02/01/2006 15:04"))
+	return r, nil
+}
+
+// Función que graba una acción con sus argumentos
+func (r *scriptRecorder) add(verb string, args ...string) {
+	words := []string{verb}
+	for _, arg := range args {
+		if arg != "" {
+			words = append(words, quoteScriptWord(arg))
+		}
+	}
+	r.addLine(strings.Join(words, " "))
+}
+
+// Función que graba una línea tal cual
+func (r *scriptRecorder) addLine(line string) {
+	if r == nil || r.err != nil {
+		return
+	}
+	_, r.err = fmt.Fprintln(r.file, line)
+}
+
+// Función que cierra el guion grabado
+func (r *scriptRecorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	if err := r.file.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// Subcomando "menu": el menú interactivo, que también se elige con opciones
+// sin subcomando (tpconcurrente -script acciones.txt). -script ejecuta un
+// guion en lugar de preguntar y -grabar guarda como guion lo que se hace.
+func menuCommand(args []string) error {
+	fs := flag.NewFlagSet("menu", flag.ContinueOnError)
+	script := fs.String("script", "", "guion de acciones a ejecutar sin preguntar (archivo o URL)")
+	record := fs.String("grabar", "", "archivo en el que se graban las acciones como guion")
+	dataPath := fs.String("datos", defaultDataPath, "archivo CSV o URL de los registros que procesa la opción 1 al responder '.'")
+	fs.StringVar(dataPath, "input", defaultDataPath, "igual que -datos")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("argumento inesperado %q", fs.Arg(0))
+	}
+
+	var recorder *scriptRecorder
+	if *record != "" {
+		var err error
+		if recorder, err = newScriptRecorder(*record); err != nil {
+			return err
+		}
+	}
+	if *script == "" {
+		runMenu(recorder, *dataPath)
+		return recorder.Close()
+	}
+	err := runScript(*script, recorder)
+	if closeErr := recorder.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
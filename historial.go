@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Registro de una predicción atendida por el servidor
+type PredictionRecord struct {
+	Time          time.Time `json:"hora"`
+	RequestID     string    `json:"request_id"`
+	Tenant        string    `json:"inquilino,omitempty"`
+	Model         string    `json:"modelo"`
+	Version       int       `json:"version"`
+	Establishment string    `json:"establecimiento"`
+	Month         int       `json:"mes"`
+	Day           int       `json:"dia"`
+	Congested     bool      `json:"congestionado"`
+	Votes         int       `json:"votos"`
+	Trees         int       `json:"arboles"`
+	Tie           string    `json:"empate,omitempty"`       // Política con la que se resolvió un empate
+	Abstained     bool      `json:"sin_decision,omitempty"` // Empate sin decisión: Congested no vale
+	LatencyMs     float64   `json:"latencia_ms"`
+	Cached        bool      `json:"cache,omitempty"`    // Los votos salieron del caché
+	Variant       string    `json:"variante,omitempty"` // Con un canario activo: "principal" o "canario"
+}
+
+// Historial de predicciones: un archivo con un objeto JSON por línea
+type PredictionHistory struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Función que abre (o crea) el archivo de historial para agregar registros
+func OpenPredictionHistory(path string) (*PredictionHistory, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &PredictionHistory{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Función que agrega un registro al historial. Un historial nil no registra nada.
+func (h *PredictionHistory) Record(rec PredictionRecord) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.enc.Encode(rec)
+}
+
+// Función para cerrar el archivo del historial
+func (h *PredictionHistory) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
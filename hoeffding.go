@@ -0,0 +1,289 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Aprendizaje incremental con árboles de Hoeffding: cada registro que llega
+// actualiza los contadores de la hoja a la que cae y, cada cierto número de
+// registros, la hoja se divide si la mejor división supera a la segunda por
+// más que la cota de Hoeffding (con probabilidad 1-δ es la misma que se
+// elegiría con todos los datos). El bosque usa bagging en línea (Oza): cada
+// árbol ve cada registro un número de veces con distribución de Poisson(1).
+// Así un feed en vivo mantiene el modelo al día entre los reentrenamientos
+// nocturnos, sin guardar los registros. Los árboles solo dividen por Mes y Dia,
+// las características que se conocen al predecir.
+
+// Parámetros de los árboles de Hoeffding
+const (
+	hoeffdingGracePeriod = 50   // Registros de una hoja entre intentos de división
+	hoeffdingDelta       = 1e-6 // Probabilidad de elegir una división distinta a la de todos los datos
+	hoeffdingTieBreak    = 0.05 // Por debajo de esta cota se divide aunque haya empate
+	hoeffdingMaxDepth    = 8    // Profundidad máxima, para acotar la memoria
+	hoeffdingMaxValue    = 31   // Valor máximo de Mes y Dia
+)
+
+// Características por las que dividen los árboles incrementales
+var hoeffdingFeatures = []string{"Mes", "Dia"}
+
+// Registros (ponderados) de una hoja: por clase, para elegir divisiones, y la
+// suma de atendidos, para predecir como el árbol por lotes (promedio > umbral)
+type hoeffdingStats struct {
+	classes  [2]float64 // 0 = no congestionado, 1 = congestionado
+	attended float64
+}
+
+// Función que suma un registro con su peso
+func (s *hoeffdingStats) add(class, attended int, weight float64) {
+	s.classes[class] += weight
+	s.attended += float64(attended) * weight
+}
+
+// Función que retorna los registros que quedan al restar other
+func (s hoeffdingStats) minus(other hoeffdingStats) hoeffdingStats {
+	return hoeffdingStats{
+		classes:  [2]float64{s.classes[0] - other.classes[0], s.classes[1] - other.classes[1]},
+		attended: s.attended - other.attended,
+	}
+}
+
+// Peso total de los registros
+func (s hoeffdingStats) weight() float64 {
+	return s.classes[0] + s.classes[1]
+}
+
+// Nodo de un árbol de Hoeffding. Las hojas guardan, para cada característica
+// y cada umbral, los registros que quedaron a la izquierda.
+type hoeffdingNode struct {
+	feature   int // Índice en hoeffdingFeatures (solo en nodos internos)
+	threshold int
+	left      *hoeffdingNode
+	right     *hoeffdingNode
+	depth     int
+
+	stats hoeffdingStats                          // Registros de la hoja, incluidos los heredados del padre
+	own   hoeffdingStats                          // Como stats, sin los heredados: los que cuenta below
+	below [][hoeffdingMaxValue + 1]hoeffdingStats // Por característica y umbral, registros con valor <= umbral
+	seen  float64                                 // Registros desde el último intento de división
+}
+
+// Árbol de Hoeffding
+type HoeffdingTree struct {
+	root      *hoeffdingNode
+	threshold int
+}
+
+// Bosque incremental con bagging en línea
+type OnlineForest struct {
+	Threshold int // Atendidos a partir de los cuales un registro está congestionado
+
+	mu       sync.RWMutex
+	trees    []*HoeffdingTree
+	rng      *rand.Rand
+	observed int64 // Registros aprendidos
+}
+
+// Constructor de un bosque incremental vacío
+func NewOnlineForest(trees, threshold int, seed int64) *OnlineForest {
+	f := &OnlineForest{Threshold: threshold, rng: rand.New(rand.NewSource(seed))}
+	for i := 0; i < trees; i++ {
+		f.trees = append(f.trees, &HoeffdingTree{root: newHoeffdingLeaf(0), threshold: threshold})
+	}
+	return f
+}
+
+// Constructor de una hoja sin registros
+func newHoeffdingLeaf(depth int) *hoeffdingNode {
+	return &hoeffdingNode{depth: depth, below: make([][hoeffdingMaxValue + 1]hoeffdingStats, len(hoeffdingFeatures))}
+}
+
+// Función que retorna el valor de una característica de hoeffdingFeatures
+func hoeffdingValue(att Atencion, feature int) int {
+	if feature == 0 {
+		return att.Mes
+	}
+	return att.Dia
+}
+
+// Función que aprende un registro: lo etiqueta con el umbral y actualiza cada
+// árbol tantas veces como indique su peso de Poisson(1)
+func (f *OnlineForest) Learn(att Atencion) {
+	class := 0
+	if att.Atendidos > f.Threshold {
+		class = 1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, tree := range f.trees {
+		if weight := poisson(f.rng, 1); weight > 0 {
+			tree.learn(att, class, float64(weight))
+		}
+	}
+	f.observed++
+}
+
+// Función que lleva el registro a su hoja, actualiza los contadores y prueba dividirla
+func (t *HoeffdingTree) learn(att Atencion, class int, weight float64) {
+	node := t.root
+	for node.left != nil {
+		if hoeffdingValue(att, node.feature) <= node.threshold {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	node.stats.add(class, att.Atendidos, weight)
+	node.own.add(class, att.Atendidos, weight)
+	for feature := range hoeffdingFeatures {
+		value := hoeffdingValue(att, feature)
+		for threshold := max(value, 1); threshold <= hoeffdingMaxValue; threshold++ {
+			node.below[feature][threshold].add(class, att.Atendidos, weight)
+		}
+	}
+	if node.seen += weight; node.seen >= hoeffdingGracePeriod && node.depth < hoeffdingMaxDepth {
+		node.seen = 0
+		node.trySplit()
+	}
+}
+
+// Función que divide la hoja si la mejor división supera a la segunda (o a no
+// dividir) por más que la cota de Hoeffding
+func (n *hoeffdingNode) trySplit() {
+	total := n.own.weight()
+	if n.own.classes[0] == 0 || n.own.classes[1] == 0 {
+		return // Hoja pura: no hay nada que ganar
+	}
+	parent := entropy(n.own.classes)
+	best := make([]struct {
+		gain      float64
+		threshold int
+	}, len(hoeffdingFeatures))
+	for feature := range hoeffdingFeatures {
+		for threshold := 1; threshold < hoeffdingMaxValue; threshold++ {
+			left := n.below[feature][threshold]
+			right := n.own.minus(left)
+			l, r := left.weight(), right.weight()
+			if l == 0 || r == 0 {
+				continue
+			}
+			gain := parent - (l*entropy(left.classes)+r*entropy(right.classes))/total
+			if gain > best[feature].gain {
+				best[feature].gain, best[feature].threshold = gain, threshold
+			}
+		}
+	}
+	first, second := 0, 1
+	if best[second].gain > best[first].gain {
+		first, second = second, first
+	}
+	// Con dos clases la entropía está entre 0 y 1, así que el rango R es 1
+	epsilon := math.Sqrt(math.Log(1/hoeffdingDelta) / (2 * total))
+	if best[first].gain <= 0 || (best[first].gain-best[second].gain <= epsilon && epsilon >= hoeffdingTieBreak) {
+		return
+	}
+
+	n.feature, n.threshold = first, best[first].threshold
+	n.left, n.right = newHoeffdingLeaf(n.depth+1), newHoeffdingLeaf(n.depth+1)
+	// Los hijos predicen desde el principio con los registros que ya se sabe
+	// que irían a cada lado, pero solo dividen con lo que vean después
+	n.left.stats = n.below[first][n.threshold]
+	n.right.stats = n.own.minus(n.left.stats)
+	n.below = nil // Un nodo interno ya no necesita sus contadores por umbral
+}
+
+// Entropía en bits de un par de contadores
+func entropy(counts [2]float64) float64 {
+	total := counts[0] + counts[1]
+	h := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := c / total
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// Función que retorna la predicción de la hoja de la consulta, y false si la
+// hoja todavía no vio registros
+func (t *HoeffdingTree) predict(att Atencion) (prediction, ok bool) {
+	node := t.root
+	for node.left != nil {
+		if hoeffdingValue(att, node.feature) <= node.threshold {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	if node.stats.weight() == 0 {
+		return false, false
+	}
+	return node.congested(t.threshold), true
+}
+
+// Función que decide la predicción de una hoja como makePrediction: congestión
+// si el promedio de atendidos supera el umbral
+func (n *hoeffdingNode) congested(threshold int) bool {
+	return int(n.stats.attended/n.stats.weight()) > threshold
+}
+
+// Función que cuenta los votos de los árboles que ya tienen datos en la hoja de la consulta
+func (f *OnlineForest) Vote(att Atencion) (votes, total int) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, tree := range f.trees {
+		prediction, ok := tree.predict(att)
+		if !ok {
+			continue
+		}
+		total++
+		if prediction {
+			votes++
+		}
+	}
+	return votes, total
+}
+
+// Número de árboles del bosque incremental
+func (f *OnlineForest) NumTrees() int {
+	return len(f.trees)
+}
+
+// Registros aprendidos
+func (f *OnlineForest) Observed() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.observed
+}
+
+// Características por las que pueden dividir los árboles incrementales
+func (f *OnlineForest) UsedFeatures() []string {
+	return hoeffdingFeatures
+}
+
+// Función que copia el estado actual como un bosque común, para guardarlo con
+// Save y servirlo o compararlo como cualquier otro modelo
+func (f *OnlineForest) Snapshot() *RandomForest {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	rf := &RandomForest{Features: hoeffdingFeatures, OOBError: -1}
+	for _, tree := range f.trees {
+		rf.Trees = append(rf.Trees, &DecisionTree{Root: tree.root.snapshot(f.Threshold), Features: hoeffdingFeatures, CongestionThreshold: f.Threshold})
+	}
+	return rf
+}
+
+// Función que convierte un nodo y sus hijos en nodos del árbol común
+func (n *hoeffdingNode) snapshot(threshold int) *Node {
+	if n.left == nil {
+		return &Node{IsLeaf: true, Prediction: n.stats.weight() > 0 && n.congested(threshold)}
+	}
+	return &Node{
+		Feature:   hoeffdingFeatures[n.feature],
+		Threshold: n.threshold,
+		Left:      n.left.snapshot(threshold),
+		Right:     n.right.snapshot(threshold),
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import "math"
+
+// Imputación de las características que no se conocen al predecir. Una consulta
+// solo trae establecimiento, mes y día; Atendidos y Atenciones se completan con el
+// promedio histórico de ese establecimiento en ese mes antes de recorrer los
+// árboles. Los datos no tienen año, así que no se puede saber el día de la semana.
+
+// Promedio histórico de las características de solo entrenamiento
+type featureAverage struct {
+	Atendidos  float64
+	Atenciones float64
+	Citas      float64
+	Count      int // Registros promediados
+}
+
+// Clave de los promedios por establecimiento y mes
+type imputeKey struct {
+	Establishment string
+	Month         int
+}
+
+// Promedios históricos usados para completar las consultas
+type Imputer struct {
+	Monthly        map[imputeKey]featureAverage // Por establecimiento y mes
+	Establishments map[string]featureAverage    // Por establecimiento, si no hay datos de ese mes
+	Global         featureAverage               // De todos los registros, si el establecimiento es nuevo
+}
+
+// Función que calcula los promedios históricos a partir de los registros,
+// tomados de las estadísticas compartidas (ver estadisticas.go)
+func NewImputer(data []Atencion) *Imputer {
+	stats := statisticsFor(data)
+	im := &Imputer{
+		Monthly:        make(map[imputeKey]featureAverage),
+		Establishments: make(map[string]featureAverage, len(stats.Establishments)),
+		Global:         stats.Global,
+	}
+	for name, e := range stats.Establishments {
+		im.Establishments[name] = e.Average
+		for m, avg := range e.Monthly {
+			if avg.Count > 0 {
+				im.Monthly[imputeKey{name, m + 1}] = avg
+			}
+		}
+	}
+	return im
+}
+
+// Función que promedia Atendidos, Atenciones y Citas por la clave indicada
+func averagesBy[K comparable](data []Atencion, key func(Atencion) K) map[K]featureAverage {
+	groups := GroupBy(data, key).Aggregate(Avg(atendidosValue), Avg(atencionesValue), Avg(citasValue), Count())
+	averages := make(map[K]featureAverage, len(groups))
+	for k, g := range groups {
+		averages[k] = featureAverage{Atendidos: g[0], Atenciones: g[1], Citas: g[2], Count: int(g[3])}
+	}
+	return averages
+}
+
+// Función que completa Atendidos, Atenciones y Citas de una consulta con el
+// promedio más específico disponible. Con un imputador nil la consulta queda igual.
+func (im *Imputer) Fill(att Atencion) Atencion {
+	if im == nil {
+		return att
+	}
+	avg, ok := im.Monthly[imputeKey{att.NombreEstablecimiento, att.Mes}]
+	if !ok {
+		avg, ok = im.Establishments[att.NombreEstablecimiento]
+	}
+	if !ok {
+		avg = im.Global
+	}
+	att.Atendidos = int(math.Round(avg.Atendidos))
+	att.Atenciones = int(math.Round(avg.Atenciones))
+	att.Citas = int(math.Round(avg.Citas))
+	return att
+}
+
+// Función que combina los promedios de dos imputadores ponderando por la
+// cantidad de registros de cada uno. Un imputador nil se toma como ausente.
+func (im *Imputer) merge(other *Imputer) *Imputer {
+	if im == nil {
+		return other
+	}
+	if other == nil {
+		return im
+	}
+	merged := &Imputer{
+		Monthly:        make(map[imputeKey]featureAverage, len(im.Monthly)),
+		Establishments: make(map[string]featureAverage, len(im.Establishments)),
+		Global:         im.Global.combine(other.Global),
+	}
+	for _, source := range []*Imputer{im, other} {
+		for key, avg := range source.Monthly {
+			merged.Monthly[key] = merged.Monthly[key].combine(avg)
+		}
+		for key, avg := range source.Establishments {
+			merged.Establishments[key] = merged.Establishments[key].combine(avg)
+		}
+	}
+	return merged
+}
+
+// Función que combina dos promedios ponderando por la cantidad de registros
+func (a featureAverage) combine(b featureAverage) featureAverage {
+	total := a.Count + b.Count
+	if total == 0 {
+		return a
+	}
+	return featureAverage{
+		Atendidos:  (a.Atendidos*float64(a.Count) + b.Atendidos*float64(b.Count)) / float64(total),
+		Atenciones: (a.Atenciones*float64(a.Count) + b.Atenciones*float64(b.Count)) / float64(total),
+		Citas:      (a.Citas*float64(a.Count) + b.Citas*float64(b.Count)) / float64(total),
+		Count:      total,
+	}
+}
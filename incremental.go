@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Modelos incrementales en el servidor: con -incremental se registra un bosque
+// de Hoeffding vacío que aprende de los registros que se envían a
+// POST /models/{nombre}/observe, por ejemplo desde el feed en vivo de los
+// establecimientos. Convive con el modelo entrenado por lotes (con otro nombre)
+// y, como cambia con cada registro, sus predicciones no pasan por el caché.
+
+// Métrica de los registros aprendidos en línea
+var onlineRecords = NewCounterVec("tp_registros_incrementales_total",
+	"Registros aprendidos por los modelos incrementales", "modelo")
+
+// Modelo que aprende de a un registro
+type incrementalModel interface {
+	Learn(att Atencion)
+	Observed() int64
+}
+
+// Registro enviado a POST /models/{name}/observe
+type observedRecord struct {
+	Establishment string `json:"establecimiento"`
+	Month         int    `json:"mes"`
+	Day           int    `json:"dia"`
+	Attended      int    `json:"atendidos"`
+	Attentions    int    `json:"atenciones"`
+}
+
+// Respuesta de POST /models/{name}/observe
+type observeResponse struct {
+	Learned  int   `json:"aprendidos"`
+	Observed int64 `json:"total"` // Registros aprendidos desde que inició el servidor
+}
+
+// POST /models/{name}/observe con una lista de registros: los aprende un
+// modelo incremental. Se valida toda la lista antes de aprender alguno.
+func (s *server) handleObserve(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	entry, release, err := tenantFrom(r.Context()).registry.Acquire(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	defer release()
+	model, ok := entry.Model.(incrementalModel)
+	if !ok {
+		writeError(w, http.StatusConflict, fmt.Errorf("el modelo %s no es incremental", name))
+		return
+	}
+
+	var records []observedRecord
+	if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("se espera una lista de registros con establecimiento, mes, dia, atendidos y atenciones"))
+		return
+	}
+	for i, rec := range records {
+		if rec.Month < 1 || rec.Month > 12 || rec.Day < 1 || rec.Day > 31 || rec.Attended < 0 || rec.Attentions < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("registro %d inválido", i))
+			return
+		}
+	}
+	for _, rec := range records {
+		model.Learn(Atencion{Mes: rec.Month, Dia: rec.Day, NombreEstablecimiento: rec.Establishment, Atendidos: rec.Attended, Atenciones: rec.Attentions})
+	}
+	onlineRecords.Add(float64(len(records)), tenantFrom(r.Context()).label(name))
+	writeJSON(w, http.StatusOK, observeResponse{Learned: len(records), Observed: model.Observed()})
+}
+
+// Subcomando "train-online": pasa un CSV registro por registro por un bosque
+// de Hoeffding, en orden de fecha como llegaría de un feed, y guarda el estado
+// final. Informa la precisión precuencial: cada registro se predice antes de
+// aprenderlo.
+func trainOnlineCommand(args []string) error {
+	fs := flag.NewFlagSet("train-online", flag.ContinueOnError)
+	dataPath := fs.String("datos", "atenciones_filtradas.csv", "archivo CSV de atenciones")
+	trees := fs.Int("arboles", 10, "número de árboles")
+	seed := fs.Int64("semilla", 1, "semilla del bagging en línea")
+	output := fs.String("o", "modelo_incremental.gob.gz", "archivo donde guardar el modelo")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *trees <= 0 {
+		return fmt.Errorf("número de árboles inválido: %d", *trees)
+	}
+
+	data, err := loadAtenciones(context.Background(), *dataPath)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		if data[i].Mes != data[j].Mes {
+			return data[i].Mes < data[j].Mes
+		}
+		return data[i].Dia < data[j].Dia
+	})
+	forest := NewOnlineForest(*trees, congestionThreshold, *seed)
+	start := time.Now()
+	correct, predicted := 0, 0
+	for _, att := range data {
+		if votes, total := forest.Vote(att); total > 0 {
+			predicted++
+			if decideVote(votes, total, tieOptimistic).Congested == (att.Atendidos > congestionThreshold) {
+				correct++
+			}
+		}
+		forest.Learn(att)
+	}
+	duration := time.Since(start)
+	fmt.Printf("%d registros aprendidos en %v (%.0f registros/s)\n", len(data), duration, float64(len(data))/duration.Seconds())
+	if predicted > 0 {
+		fmt.Printf("Precisión precuencial: %.4f (%d predicciones)\n", float64(correct)/float64(predicted), predicted)
+	}
+
+	rf := forest.Snapshot()
+	rf.Pipeline = NewPipeline(data, hoeffdingFeatures)
+	if err := rf.Save(*output); err != nil {
+		return err
+	}
+	fmt.Printf("Modelo guardado en %s\n", *output)
+	return nil
+}
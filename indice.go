@@ -0,0 +1,130 @@
+package main
+
+import "sync"
+
+// Índices del conjunto de datos cargado, para no recorrer todas las filas cada
+// vez que se necesitan las de un establecimiento o una fecha. Se construyen una
+// vez después de cargar (o filtrar) y no se modifican, así que varias goroutines
+// pueden consultarlos al mismo tiempo sin bloqueos.
+
+// Clave del índice por fecha (los datos no tienen año)
+type dateKey struct {
+	Month, Day int
+}
+
+// Índices de un conjunto de registros. Los IDs de fila son posiciones en el
+// slice indexado y cada lista está en orden creciente.
+type DatasetIndex struct {
+	data            []Atencion
+	byEstablishment map[string][]int32  // Establecimiento -> filas
+	byDate          map[dateKey][]int32 // (mes, día) -> filas
+	establishments  []string            // Establecimientos en orden de primera aparición
+}
+
+// Índices parciales de un tramo de filas
+type indexShard struct {
+	byEstablishment map[string][]int32
+	byDate          map[dateKey][]int32
+	establishments  []string
+}
+
+// Función que construye los índices repartiendo las filas en tramos que se
+// indexan en paralelo y luego se unen en orden
+func NewDatasetIndex(data []Atencion) *DatasetIndex {
+	var shards []*indexShard
+	var wg sync.WaitGroup
+	for _, r := range shardRanges(len(data)) {
+		shard := &indexShard{byEstablishment: make(map[string][]int32), byDate: make(map[dateKey][]int32)}
+		shards = append(shards, shard)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := r[0]; i < r[1]; i++ {
+				att := data[i]
+				rows, seen := shard.byEstablishment[att.NombreEstablecimiento]
+				if !seen {
+					shard.establishments = append(shard.establishments, att.NombreEstablecimiento)
+				}
+				shard.byEstablishment[att.NombreEstablecimiento] = append(rows, int32(i))
+				key := dateKey{att.Mes, att.Dia}
+				shard.byDate[key] = append(shard.byDate[key], int32(i))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Unir los tramos en orden mantiene las filas de cada lista en orden creciente
+	idx := &DatasetIndex{data: data, byEstablishment: make(map[string][]int32), byDate: make(map[dateKey][]int32)}
+	for _, shard := range shards {
+		for _, name := range shard.establishments {
+			rows, seen := idx.byEstablishment[name]
+			if !seen {
+				idx.establishments = append(idx.establishments, name)
+			}
+			idx.byEstablishment[name] = append(rows, shard.byEstablishment[name]...)
+		}
+		for key, rows := range shard.byDate {
+			idx.byDate[key] = append(idx.byDate[key], rows...)
+		}
+	}
+	return idx
+}
+
+// Número de filas indexadas
+func (idx *DatasetIndex) Len() int {
+	return len(idx.data)
+}
+
+// Función que retorna la fila con el ID indicado
+func (idx *DatasetIndex) Row(id int32) Atencion {
+	return idx.data[id]
+}
+
+// Función que retorna los establecimientos en orden de primera aparición.
+// El slice es compartido: no debe modificarse. Un índice nil no tiene ninguno.
+func (idx *DatasetIndex) Establishments() []string {
+	if idx == nil {
+		return nil
+	}
+	return idx.establishments
+}
+
+// Función que retorna los IDs de las filas de un establecimiento (nombre tal como aparece en los datos)
+func (idx *DatasetIndex) EstablishmentRows(name string) []int32 {
+	return idx.byEstablishment[name]
+}
+
+// Función que retorna los IDs de las filas de una fecha
+func (idx *DatasetIndex) DateRows(month, day int) []int32 {
+	return idx.byDate[dateKey{month, day}]
+}
+
+// Función que copia las filas indicadas en un slice nuevo
+func (idx *DatasetIndex) Select(ids []int32) []Atencion {
+	rows := make([]Atencion, len(ids))
+	for i, id := range ids {
+		rows[i] = idx.data[id]
+	}
+	return rows
+}
+
+// Función que retorna las filas de un establecimiento en una fecha, recorriendo
+// la más corta de las dos listas
+func (idx *DatasetIndex) EstablishmentDateRows(name string, month, day int) []Atencion {
+	byName, byDate := idx.EstablishmentRows(name), idx.DateRows(month, day)
+	var rows []Atencion
+	if len(byName) <= len(byDate) {
+		for _, id := range byName {
+			if att := idx.data[id]; att.Mes == month && att.Dia == day {
+				rows = append(rows, att)
+			}
+		}
+		return rows
+	}
+	for _, id := range byDate {
+		if att := idx.data[id]; att.NombreEstablecimiento == name {
+			rows = append(rows, att)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Control de la presión entre las goroutines que interpretan filas y la que las
+// recolecta. El canal entre ambas tiene un tamaño configurable y, cuando se
+// llena, la política de desborde decide si los productores esperan (bloquear)
+// o si las filas se escriben a un archivo temporal (disco) y se entregan
+// cuando el recolector se pone al día.
+
+// Métricas de la ingesta
+var (
+	channelOccupancy = NewHistogramVec("tp_carga_canal_ocupacion",
+		"Fracción ocupada del canal de registros, muestreada durante la carga",
+		[]float64{0.1, 0.25, 0.5, 0.75, 0.9, 1}, "politica")
+	spilledRecords = NewCounterVec("tp_carga_derramados_total",
+		"Registros escritos a disco porque el canal estaba lleno", "politica")
+)
+
+// Tamaño por defecto del canal de registros
+const defaultChannelSize = 100
+
+// Intervalo de muestreo de la ocupación del canal
+const occupancySampleInterval = 50 * time.Millisecond
+
+// Política cuando el canal de registros está lleno
+type OverflowPolicy int
+
+const (
+	OverflowBlock OverflowPolicy = iota // Los productores esperan a que haya lugar
+	OverflowSpill                       // Las filas que no caben se escriben a disco
+)
+
+func (p OverflowPolicy) String() string {
+	if p == OverflowSpill {
+		return "disco"
+	}
+	return "bloquear"
+}
+
+// Función que interpreta el nombre de una política de desborde
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch name {
+	case "", "bloquear":
+		return OverflowBlock, nil
+	case "disco":
+		return OverflowSpill, nil
+	}
+	return 0, fmt.Errorf("política de desborde desconocida %q (bloquear o disco)", name)
+}
+
+// Opciones del canal de ingesta
+type IngestOptions struct {
+	ChannelSize int            // Capacidad del canal en memoria (0 = 100)
+	Overflow    OverflowPolicy // Qué hacer cuando el canal está lleno
+	SpillDir    string         // Directorio del archivo de desborde (vacío = el temporal del sistema)
+	ChunkRows   int            // Filas por bloque de validación (0 = se adapta a la velocidad de la validación)
+}
+
+// Estadísticas del canal al terminar la carga
+type ingestStats struct {
+	MaxOccupancy float64 // Máxima fracción ocupada observada
+	Spilled      int64   // Filas que pasaron por disco
+}
+
+// Canal de ingesta: los productores envían por In y el recolector lee de Out.
+// Con la política de bloqueo ambos son el mismo canal.
+type ingestChannel struct {
+	In  chan<- Atencion
+	Out <-chan Atencion
+
+	out     chan Atencion
+	policy  OverflowPolicy
+	stop    chan struct{} // Detiene el muestreo de ocupación
+	sampled sync.WaitGroup
+	maxOcc  float64
+	spilled int64
+	err     error // Error del archivo de desborde
+}
+
+// Función que crea el canal según las opciones. Quien produce debe cerrar In
+// cuando termina; Out se cierra después de entregar todas las filas.
+func newIngestChannel(opts IngestOptions) (*ingestChannel, error) {
+	size := opts.ChannelSize
+	if size <= 0 {
+		size = defaultChannelSize
+	}
+	c := &ingestChannel{out: make(chan Atencion, size), policy: opts.Overflow, stop: make(chan struct{})}
+	c.Out = c.out
+	if opts.Overflow == OverflowSpill {
+		spill, err := os.CreateTemp(opts.SpillDir, "tp-desborde-*.bin")
+		if err != nil {
+			return nil, err
+		}
+		in := make(chan Atencion)
+		c.In = in
+		go c.relay(in, spill)
+	} else {
+		c.In = c.out
+	}
+
+	c.sampled.Add(1)
+	go c.sample()
+	return c, nil
+}
+
+// Goroutine que muestrea la ocupación del canal en memoria
+func (c *ingestChannel) sample() {
+	defer c.sampled.Done()
+	ticker := time.NewTicker(occupancySampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			occupancy := float64(len(c.out)) / float64(cap(c.out))
+			c.maxOcc = max(c.maxOcc, occupancy)
+			channelOccupancy.Observe(occupancy, c.policy.String())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Función que detiene el muestreo y retorna las estadísticas. Debe llamarse
+// después de que Out se cerró.
+func (c *ingestChannel) finish() (ingestStats, error) {
+	close(c.stop)
+	c.sampled.Wait()
+	return ingestStats{MaxOccupancy: c.maxOcc, Spilled: c.spilled}, c.err
+}
+
+// Goroutine que pasa las filas de in a out. Si out está lleno (o ya hay filas
+// en disco, para respetar el orden de llegada) la fila se agrega al archivo;
+// las filas del archivo se entregan en cuanto out tiene lugar.
+func (c *ingestChannel) relay(in <-chan Atencion, spill *os.File) {
+	defer func() {
+		spill.Close()
+		os.Remove(spill.Name())
+		close(c.out)
+	}()
+
+	var writeOff, readOff int64 // Posiciones de escritura y lectura en el archivo
+	var head *Atencion          // Siguiente fila a entregar desde el archivo
+	for in != nil || head != nil || readOff < writeOff {
+		if head == nil && readOff < writeOff {
+			att, n, err := readSpilled(spill, readOff)
+			if err != nil {
+				c.fail(err, in)
+				return
+			}
+			head, readOff = &att, readOff+n
+		}
+		var out chan Atencion
+		var next Atencion // El valor del case se evalúa aunque out sea nil
+		if head != nil {
+			out, next = c.out, *head // Solo se intenta enviar si hay una fila del archivo esperando
+		}
+
+		select {
+		case att, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			if head == nil {
+				select {
+				case c.out <- att:
+					continue
+				default: // Canal lleno: la fila va al archivo
+				}
+			}
+			n, err := writeSpilled(spill, writeOff, att)
+			if err != nil {
+				c.fail(err, in)
+				return
+			}
+			writeOff += n
+			c.spilled++
+			spilledRecords.Inc(c.policy.String())
+		case out <- next:
+			head = nil
+		}
+	}
+}
+
+// Función que registra un error del archivo de desborde y descarta lo que
+// sigan enviando los productores, para que no queden bloqueados
+func (c *ingestChannel) fail(err error, in <-chan Atencion) {
+	c.err = fmt.Errorf("archivo de desborde: %w", err)
+	for range in {
+	}
+}
+
+// Función que escribe una fila en el archivo de desborde y retorna los bytes escritos.
+// Formato: mes, día, atendidos, atenciones (int32) y el nombre con su largo (uint16).
+func writeSpilled(f *os.File, off int64, att Atencion) (int64, error) {
+	if len(att.NombreEstablecimiento) > 0xFFFF {
+		return 0, errors.New("nombre de establecimiento demasiado largo")
+	}
+	buf := make([]byte, 18+len(att.NombreEstablecimiento))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(int32(att.Mes)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(int32(att.Dia)))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(int32(att.Atendidos)))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(int32(att.Atenciones)))
+	binary.LittleEndian.PutUint16(buf[16:], uint16(len(att.NombreEstablecimiento)))
+	copy(buf[18:], att.NombreEstablecimiento)
+	n, err := f.WriteAt(buf, off)
+	return int64(n), err
+}
+
+// Función que lee la fila que empieza en off y retorna los bytes leídos
+func readSpilled(f *os.File, off int64) (Atencion, int64, error) {
+	var fixed [18]byte
+	if _, err := f.ReadAt(fixed[:], off); err != nil {
+		return Atencion{}, 0, err
+	}
+	name := make([]byte, binary.LittleEndian.Uint16(fixed[16:]))
+	if _, err := f.ReadAt(name, off+18); err != nil && !(err == io.EOF && len(name) == 0) {
+		return Atencion{}, 0, err
+	}
+	return Atencion{
+		Mes:                   int(int32(binary.LittleEndian.Uint32(fixed[0:]))),
+		Dia:                   int(int32(binary.LittleEndian.Uint32(fixed[4:]))),
+		Atendidos:             int(int32(binary.LittleEndian.Uint32(fixed[8:]))),
+		Atenciones:            int(int32(binary.LittleEndian.Uint32(fixed[12:]))),
+		NombreEstablecimiento: string(name),
+	}, int64(18 + len(name)), nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Inquilinos del servidor: cada red de salud tiene su propio espacio con sus
+// datos, sus modelos y sus claves de API, de modo que un solo despliegue
+// atiende a varios equipos regionales sin que uno vea ni pise los modelos de
+// otro. Sin archivo de inquilinos hay un único espacio abierto, sin claves.
+// En lugar de una clave se puede enviar un JWT firmado con TP_JWT_SECRETO
+// cuyos claims indican el inquilino y el perfil.
+//
+//	[{"nombre": "norte", "claves": ["..."], "claves_operador": ["..."], "datos": ["norte.csv"],
+//	  "directorio": "modelos/norte", "modelos": {"default": "modelos/norte/modelo.gob.gz"},
+//	  "cuota": {"modelos": 5, "arboles": 300, "trabajos": 2}}]
+
+// Cabecera alternativa a "Authorization: Bearer" para enviar la clave de API
+const apiKeyHeader = "X-API-Key"
+
+// Espacio aislado de un equipo
+type Tenant struct {
+	Name     string            `json:"nombre"`
+	Keys     []string          `json:"claves"`          // Claves de API de los analistas del inquilino
+	Operator []string          `json:"claves_operador"` // Claves de API de los operadores
+	Datasets []string          `json:"datos"`           // CSV con los que puede entrenar (el primero es el por defecto)
+	Dir      string            `json:"directorio"`      // Prefijo de las rutas de modelos que puede cargar (vacío = cualquiera)
+	Models   map[string]string `json:"modelos"`         // Modelos a cargar al iniciar, nombre -> ruta
+	Quota    TenantQuota       `json:"cuota"`
+
+	registry *ModelRegistry // Modelos del inquilino
+}
+
+// Límites de recursos de un inquilino (0 = sin límite)
+type TenantQuota struct {
+	Models int `json:"modelos"`  // Modelos registrados a la vez
+	Trees  int `json:"arboles"`  // Árboles por entrenamiento
+	Jobs   int `json:"trabajos"` // Entrenamientos en cola o en ejecución a la vez
+}
+
+// Quién hace una petición: inquilino, perfil y usuario para la auditoría
+type principal struct {
+	tenant *Tenant
+	role   Role
+	user   string // Sujeto del JWT, o la clave abreviada ("clave:1a2b3c4d")
+}
+
+// Inquilinos del servidor indexados por clave
+type tenantSet struct {
+	tenants   []*Tenant
+	byKey     map[string]principal
+	open      *Tenant // Único inquilino cuando no hay archivo (sin claves)
+	jwtSecret []byte  // Secreto para verificar JWT (nil = no se aceptan)
+}
+
+// Función que crea el espacio único, sin claves ni límites, que se usa sin archivo de inquilinos
+func openTenantSet() *tenantSet {
+	t := &Tenant{Name: "", registry: NewModelRegistry()}
+	return &tenantSet{tenants: []*Tenant{t}, open: t}
+}
+
+// Función que lee el archivo JSON de inquilinos y valida que nombres y claves no se repitan
+func LoadTenants(path string) (*tenantSet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []*Tenant
+	if err := json.Unmarshal(raw, &tenants); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("%s: no define ningún inquilino", path)
+	}
+
+	set := &tenantSet{tenants: tenants, byKey: make(map[string]principal)}
+	names := make(map[string]bool)
+	for _, t := range tenants {
+		if t.Name == "" || strings.Contains(t.Name, "/") {
+			return nil, fmt.Errorf("%s: nombre de inquilino inválido %q", path, t.Name)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("%s: inquilino repetido %s", path, t.Name)
+		}
+		names[t.Name] = true
+		if len(t.Keys) == 0 && len(t.Operator) == 0 {
+			return nil, fmt.Errorf("%s: el inquilino %s no tiene claves", path, t.Name)
+		}
+		for role, keys := range map[Role][]string{RoleAnalyst: t.Keys, RoleOperator: t.Operator} {
+			for _, key := range keys {
+				if key == "" {
+					return nil, fmt.Errorf("%s: el inquilino %s tiene una clave vacía", path, t.Name)
+				}
+				if _, ok := set.byKey[key]; ok {
+					return nil, fmt.Errorf("%s: clave repetida en el inquilino %s", path, t.Name)
+				}
+				set.byKey[key] = principal{tenant: t, role: role, user: keyUser(key)}
+			}
+		}
+		for name, modelPath := range t.Models {
+			if err := t.allowModelPath(modelPath); err != nil {
+				return nil, fmt.Errorf("%s: inquilino %s, modelo %s: %w", path, t.Name, name, err)
+			}
+		}
+		t.registry = NewModelRegistry()
+	}
+	return set, nil
+}
+
+// Función que identifica al inquilino y el perfil por la clave o el JWT de la petición
+func (s *tenantSet) authenticate(r *http.Request) (principal, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = bearer
+	}
+	if s.jwtSecret != nil && isJWT(key) {
+		return s.authenticateJWT(key)
+	}
+	if s.open != nil {
+		return principal{tenant: s.open, role: profile, user: processUser()}, nil // Sin inquilinos no se piden claves
+	}
+	if key == "" {
+		return principal{}, errors.New("falta la clave de API")
+	}
+	// La búsqueda en el mapa no es de tiempo constante; se confirma con la comparación
+	if found, ok := s.byKey[key]; ok {
+		for _, keys := range [][]string{found.tenant.Keys, found.tenant.Operator} {
+			for _, candidate := range keys {
+				if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+					return found, nil
+				}
+			}
+		}
+	}
+	return principal{}, errors.New("clave de API inválida")
+}
+
+// Función que identifica al inquilino y el perfil por los claims de un JWT
+func (s *tenantSet) authenticateJWT(token string) (principal, error) {
+	claims, err := verifyJWT(token, s.jwtSecret)
+	if err != nil {
+		return principal{}, err
+	}
+	if claims.Role == "" {
+		return principal{}, errors.New("el JWT no indica el rol")
+	}
+	role, err := ParseRole(claims.Role)
+	if err != nil {
+		return principal{}, err
+	}
+	user := claims.Subject
+	if user == "" {
+		user = "jwt"
+	}
+	if s.open != nil {
+		return principal{tenant: s.open, role: role, user: user}, nil
+	}
+	for _, t := range s.tenants {
+		if t.Name == claims.Tenant {
+			return principal{tenant: t, role: role, user: user}, nil
+		}
+	}
+	return principal{}, fmt.Errorf("inquilino desconocido en el JWT: %q", claims.Tenant)
+}
+
+// Middleware que rechaza las peticiones sin una clave válida y guarda el
+// inquilino, el perfil y el usuario en el contexto
+func (s *tenantSet) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		who, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tp"`)
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), tenantKey, who.tenant)
+		ctx = context.WithValue(ctx, roleKey, who.role)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, userKey, who.user)))
+	})
+}
+
+// Función que abrevia una clave de API para identificarla en la auditoría sin revelarla
+func keyUser(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "clave:" + hex.EncodeToString(sum[:4])
+}
+
+// Función que retorna el inquilino de la petición
+func tenantFrom(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey).(*Tenant)
+	return t
+}
+
+// Función que cierra los modelos de todos los inquilinos
+func (s *tenantSet) Close() {
+	for _, t := range s.tenants {
+		t.registry.Close()
+	}
+}
+
+// Función que retorna el nombre de un modelo para métricas y logs, con el
+// inquilino delante para que no se mezclen modelos de igual nombre
+func (t *Tenant) label(model string) string {
+	if t.Name == "" {
+		return model
+	}
+	return t.Name + "/" + model
+}
+
+// Función que resuelve el CSV de un entrenamiento: vacío es el del inquilino,
+// y con datos definidos solo se aceptan esos
+func (t *Tenant) dataset(path string) (string, error) {
+	if len(t.Datasets) == 0 {
+		if path == "" {
+			return "", errors.New("falta \"datos\"")
+		}
+		return path, nil
+	}
+	if path == "" {
+		return t.Datasets[0], nil
+	}
+	for _, allowed := range t.Datasets {
+		if path == allowed {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("el inquilino %s no puede entrenar con %s", t.Name, path)
+}
+
+// Función que verifica que una ruta de modelo esté dentro del directorio del inquilino
+func (t *Tenant) allowModelPath(path string) error {
+	if t.Dir == "" {
+		return nil
+	}
+	if isRemote(path) || isHTTP(path) {
+		if strings.HasPrefix(path, strings.TrimSuffix(t.Dir, "/")+"/") {
+			return nil
+		}
+	} else if rel, err := filepath.Rel(filepath.Clean(t.Dir), filepath.Clean(path)); err == nil && filepath.IsLocal(rel) {
+		return nil
+	}
+	return fmt.Errorf("la ruta %s está fuera del directorio %s", path, t.Dir)
+}
+
+// Función que verifica que el inquilino pueda registrar un modelo con ese nombre
+func (t *Tenant) checkModelQuota(name string) error {
+	if t.Quota.Models > 0 && !t.registry.Has(name) && t.registry.Len() >= t.Quota.Models {
+		return fmt.Errorf("el inquilino %s alcanzó su cuota de %d modelos", t.Name, t.Quota.Models)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Instantáneas del conjunto de datos ya validado. Interpretar el CSV completo en
+// cada sesión es lento; la instantánea guarda las filas válidas en gob y se
+// descarta sola cuando el archivo de origen cambia (tamaño o fecha de modificación).
+
+// Identificador y versión del formato de la instantánea
+const (
+	snapshotMagic   = "TPDS"
+	snapshotVersion = 1
+)
+
+// Cabecera de la instantánea: identifica el archivo de origen tal como estaba al guardarla
+type snapshotHeader struct {
+	Magic   string    // Identificador del formato
+	Version int       // Versión del formato
+	Source  string    // Ruta del CSV de origen
+	Size    int64     // Tamaño del CSV al guardar
+	ModTime time.Time // Fecha de modificación del CSV al guardar
+	SHA256  string    // Suma verificada con el manifiesto (vacío si no se verificó)
+	Records int       // Número de registros guardados
+}
+
+// Función que retorna la ruta de instantánea por defecto para un CSV, dentro del caché de descargas
+func defaultSnapshotPath(source string) (string, error) {
+	dir, err := downloadCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if !isHTTP(source) && !isRemote(source) {
+		if abs, err := filepath.Abs(source); err == nil {
+			source = abs
+		}
+	}
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(dir, "instantaneas", hex.EncodeToString(sum[:12])+".gob"), nil
+}
+
+// Función que carga los registros desde la instantánea si sigue vigente o, si
+// no, desde el CSV, y guarda una nueva instantánea. Retorna si se usó la instantánea.
+// Los archivos s3:// y gs:// no tienen fecha de modificación barata de consultar
+// y siempre se leen del CSV.
+func loadAtencionesSnapshot(ctx context.Context, source, snapshotPath string, opts LoadOptions) ([]Atencion, bool, error) {
+	check := opts.Check
+	local := source
+	if isHTTP(source) {
+		var err error
+		if local, err = fetchURL(ctx, source); err != nil { // La copia en caché es el origen
+			abortSinks(opts.Sinks, err)
+			return nil, false, err
+		}
+	}
+	if isRemote(local) || isGlob(local) { // Un patrón no tiene un archivo al que atar la instantánea
+		data, err := loadAtencionesWith(ctx, local, opts)
+		return data, false, err
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		abortSinks(opts.Sinks, err)
+		return nil, false, err
+	}
+	header := snapshotHeader{
+		Magic:   snapshotMagic,
+		Version: snapshotVersion,
+		Source:  source,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		SHA256:  strings.ToLower(check.SHA256),
+	}
+
+	if data, err := readSnapshot(snapshotPath, header, check); err == nil {
+		if opts.Report != nil {
+			*opts.Report = LoadReport{SHA256: header.SHA256, Records: len(data)}
+			if header.SHA256 == "" {
+				opts.Report.SHA256, _ = fileDigest(local) // Sin manifiesto la instantánea no guarda la suma
+			}
+		}
+		return data, true, feedSinks(opts.Sinks, data) // Los destinos reciben las mismas filas que al cargar el CSV
+	} else if !os.IsNotExist(err) {
+		log.Printf("No se usa la instantánea %s: %v", snapshotPath, err)
+	}
+
+	data, err := loadAtencionesWith(ctx, local, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	header.Records = len(data)
+	if err := writeSnapshot(snapshotPath, header, data); err != nil {
+		log.Printf("No se pudo guardar la instantánea %s: %v", snapshotPath, err) // Los datos ya están cargados
+	}
+	return data, false, nil
+}
+
+// Función que lee una instantánea si corresponde al archivo de origen actual
+func readSnapshot(path string, want snapshotHeader, check InputCheck) ([]Atencion, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(file))
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("cabecera inválida: %w", err)
+	}
+	switch {
+	case header.Magic != snapshotMagic || header.Version != snapshotVersion:
+		return nil, fmt.Errorf("formato %s v%d no soportado", header.Magic, header.Version)
+	case header.Source != want.Source || header.Size != want.Size || !header.ModTime.Equal(want.ModTime):
+		return nil, fmt.Errorf("%s cambió desde que se guardó", want.Source)
+	case check.SHA256 != "" && header.SHA256 != want.SHA256:
+		return nil, fmt.Errorf("no se guardó con la suma del manifiesto")
+	}
+
+	data := make([]Atencion, 0, header.Records)
+	if err := dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("registros inválidos: %w", err)
+	}
+	if len(data) != header.Records {
+		return nil, fmt.Errorf("tiene %d registros, se esperaban %d", len(data), header.Records)
+	}
+	return data, nil
+}
+
+// Función que guarda la instantánea en un archivo temporal y lo renombra, para
+// que una escritura interrumpida no deje una instantánea a medias
+func writeSnapshot(path string, header snapshotHeader, data []Atencion) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Sin efecto después del Rename
+
+	w := bufio.NewWriter(tmp)
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := enc.Encode(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interacciones entre características: el estadístico H de Friedman de cada
+// par mide qué parte de la variación de la dependencia parcial conjunta no se
+// explica por la suma de las dos dependencias parciales individuales. H cerca
+// de 0 indica que el efecto de una característica no depende del valor de la
+// otra; cerca de 1, que casi todo el efecto conjunto es interacción. El
+// establecimiento entra como una característica más (cambiarlo vuelve a pasar
+// la consulta por el pipeline, lo que cambia su grupo y lo imputado), así que
+// una H alta de Mes×Establecimiento indica que la estacionalidad cambia según
+// el establecimiento y que puede valer la pena un modelo por establecimiento.
+// El costo crece con el cuadrado de la muestra; los pares se calculan en paralelo.
+
+// Característica que cambia el establecimiento de la consulta
+const establishmentFeature = "Establecimiento"
+
+// Fuerza de la interacción de un par de características
+type interactionStrength struct {
+	A, B   string
+	H      float64 // Estadístico H de Friedman, entre 0 y 1 (0 si el par no cambia las predicciones)
+	Points int     // Combinaciones de valores distintas evaluadas
+}
+
+// Consultas de fondo con las que se calculan las dependencias parciales
+type interactionBackground struct {
+	model    Predictor
+	pipeline *Pipeline
+	raw      []Atencion // Consultas sin transformar: establecimiento, mes y día
+	names    []string   // Establecimientos, indexados por el valor de establishmentFeature
+}
+
+// Subcomando "feature-interactions": estadístico H de cada par de características
+func featureInteractionsCommand(args []string) error {
+	fs := flag.NewFlagSet("feature-interactions", flag.ContinueOnError)
+	modelPath := fs.String("modelo", "modelo.gob.gz", "archivo del modelo")
+	dataPath := fs.String("datos", "", "CSV de atenciones de donde tomar las consultas de fondo (vacío = calendario completo de los establecimientos del modelo)")
+	featureList := fs.String("caracteristicas", "", "características separadas por comas, incluido Establecimiento (vacío = las que usa el modelo y Establecimiento)")
+	sample := fs.Int("muestra", 200, "consultas de fondo como máximo (el costo crece con su cuadrado)")
+	seed := fs.Int64("semilla", 1, "semilla para elegir la muestra de fondo")
+	workers := fs.Int("paralelo", runtime.GOMAXPROCS(0), "pares que se calculan a la vez")
+	output := fs.String("o", "", "archivo CSV con los pares (vacío = salida estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sample < 2 || *workers <= 0 {
+		return errors.New("-muestra debe ser al menos 2 y -paralelo positivo")
+	}
+
+	model, err := OpenModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+	var history []Atencion
+	if *dataPath != "" {
+		if history, err = loadAtenciones(context.Background(), *dataPath); err != nil {
+			return withExitCode(exitLoadFailure, err)
+		}
+	}
+	pipeline := pipelineFor(model, nil)
+	if pipeline == nil && history != nil {
+		pipeline = NewPipeline(history, nil) // Modelo antiguo: el histórico sirve para imputar
+	}
+	queries, err := dependenceBackground(pipeline, history, *sample, *seed)
+	if err != nil {
+		return err
+	}
+	background := newInteractionBackground(model, pipeline, queries)
+
+	features, err := interactionFeatures(*featureList, model)
+	if err != nil {
+		return err
+	}
+	features = withoutCustomFeatures(features)
+	if len(features) < 2 {
+		return errors.New("se necesitan al menos dos características para medir interacciones")
+	}
+
+	start := time.Now()
+	pairs := background.interactions(features, *workers)
+	fmt.Fprintf(os.Stderr, "%d pares de %d características sobre %d consultas de fondo en %v\n",
+		len(pairs), len(features), len(queries), time.Since(start).Round(time.Millisecond))
+	reportSeasonalInteraction(os.Stderr, pairs)
+
+	if *output == "" {
+		return writeInteractionCSV(os.Stdout, pairs)
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	if err := writeInteractionCSV(w, pairs); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que interpreta la lista de características, que además de las
+// columnas de Atencion acepta Establecimiento. Sin lista usa las que usa el
+// modelo más el establecimiento.
+func interactionFeatures(list string, model Predictor) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		var features []string
+		if user, ok := model.(featureUser); ok {
+			features = user.UsedFeatures()
+		}
+		if len(features) == 0 {
+			features = defaultFeatures
+		}
+		return append(slices.Clone(features), establishmentFeature), nil
+	}
+	var columns []string
+	withEstablishment := false
+	for _, name := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), establishmentFeature) {
+			withEstablishment = true
+		} else {
+			columns = append(columns, name)
+		}
+	}
+	var features []string
+	if len(columns) > 0 {
+		parsed, err := ParseFeatures(strings.Join(columns, ","))
+		if err != nil {
+			return nil, err
+		}
+		features = parsed
+	}
+	if withEstablishment {
+		features = append(features, establishmentFeature)
+	}
+	return features, nil
+}
+
+// Función que arma el fondo a partir de las consultas ya transformadas,
+// recuperando de cada una el establecimiento, el mes y el día
+func newInteractionBackground(model Predictor, p *Pipeline, queries []Atencion) *interactionBackground {
+	b := &interactionBackground{model: model, pipeline: p, raw: make([]Atencion, len(queries))}
+	names := make(map[string]bool)
+	for i, att := range queries {
+		b.raw[i] = Atencion{Mes: att.Mes, Dia: att.Dia, NombreEstablecimiento: att.NombreEstablecimiento}
+		names[att.NombreEstablecimiento] = true
+	}
+	b.names = sortedKeys(names)
+	return b
+}
+
+// Función que retorna el valor de una característica en la consulta i del fondo
+func (b *interactionBackground) value(feature string, i int) int {
+	if feature == establishmentFeature {
+		index, _ := slices.BinarySearch(b.names, b.raw[i].NombreEstablecimiento)
+		return index
+	}
+	get, _ := featureAccessor(feature)
+	return get(b.pipeline.Transform(b.raw[i]))
+}
+
+// Función que calcula la dependencia parcial con las características fijadas
+// en los valores dados: la fracción promedio de votos de congestión sobre todo
+// el fondo. El establecimiento se fija antes de pasar la consulta por el
+// pipeline y las demás características después.
+func (b *interactionBackground) partial(features []string, values []int) float64 {
+	var sum float64
+	n := 0
+	for _, raw := range b.raw {
+		for j, feature := range features {
+			if feature == establishmentFeature {
+				raw.NombreEstablecimiento = b.names[values[j]]
+			}
+		}
+		att := b.pipeline.Transform(raw)
+		for j, feature := range features {
+			if set, ok := featureSetter(feature); ok {
+				set(&att, values[j])
+			}
+		}
+		votes, total := b.model.Vote(att)
+		if total == 0 {
+			continue // Ningún árbol votó: la consulta no cuenta
+		}
+		sum += float64(votes) / float64(total)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// Función que retorna la dependencia parcial de las características en cada
+// consulta del fondo, centrada en su promedio. Cada combinación de valores
+// distinta se calcula una sola vez; retorna también cuántas hubo.
+func (b *interactionBackground) centered(features []string) ([]float64, int) {
+	cache := make(map[[2]int]float64)
+	curve := make([]float64, len(b.raw))
+	var mean float64
+	for i := range b.raw {
+		var key [2]int
+		values := make([]int, len(features))
+		for j, feature := range features {
+			values[j] = b.value(feature, i)
+			key[j] = values[j]
+		}
+		pd, ok := cache[key]
+		if !ok {
+			pd = b.partial(features, values)
+			cache[key] = pd
+		}
+		curve[i] = pd
+		mean += pd
+	}
+	mean /= float64(len(curve))
+	for i := range curve {
+		curve[i] -= mean
+	}
+	return curve, len(cache)
+}
+
+// Función que calcula H para cada par de características. Primero se calculan
+// las dependencias individuales, una goroutine por característica, y después
+// las conjuntas, una por par, con hasta workers a la vez. El resultado queda
+// ordenado de mayor a menor H.
+func (b *interactionBackground) interactions(features []string, workers int) []interactionStrength {
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	single := make([][]float64, len(features))
+	for i, feature := range features {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			single[i], _ = b.centered([]string{feature})
+		}()
+	}
+	wg.Wait()
+
+	var pairs []interactionStrength
+	var indexes [][2]int
+	for i := range features {
+		for j := i + 1; j < len(features); j++ {
+			if nestedFeatures(features[i], features[j]) {
+				continue
+			}
+			pairs = append(pairs, interactionStrength{A: features[i], B: features[j]})
+			indexes = append(indexes, [2]int{i, j})
+		}
+	}
+	for k := range pairs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			i, j := indexes[k][0], indexes[k][1]
+			joint, points := b.centered([]string{features[i], features[j]})
+			var num, den float64
+			for n, pd := range joint {
+				d := pd - single[i][n] - single[j][n]
+				num += d * d
+				den += pd * pd
+			}
+			pairs[k].Points = points
+			if den > 0 && num/den > 1e-12 { // Por debajo es ruido de redondeo al centrar
+				pairs[k].H = math.Sqrt(min(num/den, 1))
+			}
+		}()
+	}
+	wg.Wait()
+	sort.SliceStable(pairs, func(a, c int) bool { return pairs[a].H > pairs[c].H })
+	return pairs
+}
+
+// Indica si una característica del par se deriva de la otra: el grupo sale del
+// establecimiento, así que fijar los dos a la vez no mide una interacción
+func nestedFeatures(a, b string) bool {
+	return (a == "Grupo" && b == establishmentFeature) || (a == establishmentFeature && b == "Grupo")
+}
+
+// Función que informa si la interacción del mes con el establecimiento es la
+// más fuerte, que es la que justifica entrenar un modelo por establecimiento
+func reportSeasonalInteraction(w io.Writer, pairs []interactionStrength) {
+	rank := slices.IndexFunc(pairs, func(p interactionStrength) bool {
+		return (p.A == "Mes" && p.B == establishmentFeature) || (p.A == establishmentFeature && p.B == "Mes")
+	})
+	if rank < 0 {
+		return
+	}
+	pair := pairs[rank]
+	switch {
+	case pair.H == 0:
+		fmt.Fprintln(w, "Mes×Establecimiento: el modelo no cambia sus predicciones con el establecimiento; "+
+			"un modelo por establecimiento (o la característica Grupo) podría captar diferencias que este no ve")
+	case rank == 0:
+		fmt.Fprintf(w, "Mes×Establecimiento: H = %.4f, la interacción más fuerte; "+
+			"un modelo por establecimiento podría valer la pena\n", pair.H)
+	default:
+		fmt.Fprintf(w, "Mes×Establecimiento: H = %.4f, puesto %d de %d; no domina las interacciones\n",
+			pair.H, rank+1, len(pairs))
+	}
+}
+
+// Función que escribe los pares en CSV, uno por fila
+func writeInteractionCSV(w io.Writer, pairs []interactionStrength) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"caracteristica_a", "caracteristica_b", "h", "combinaciones"})
+	for _, p := range pairs {
+		cw.Write([]string{p.A, p.B, strconv.FormatFloat(p.H, 'f', 4, 64), strconv.Itoa(p.Points)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
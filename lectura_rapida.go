@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Lectura de filas sin asignaciones: csv.Reader crea un string y un slice por
+// fila, y con millones de filas eso es la mayor parte del trabajo del recolector.
+// Las filas se leen como bytes y se copian al buffer de su bloque, que se
+// recicla con un sync.Pool; los números se convierten directamente desde los
+// bytes y los nombres de los establecimientos, que se repiten en todas las
+// filas, se internan, así que un nombre ya visto no asigna nada. Las filas con
+// comillas (campos con comas o saltos de línea) siguen pasando por csv.Reader.
+
+// Lector de filas: retorna cada fila sin el salto de línea; una fila con
+// comillas sin cerrar sigue en las líneas siguientes
+type rowReader struct {
+	br   *bufio.Reader
+	line []byte // Fila en curso, reutilizada entre llamadas
+}
+
+// Función que crea el lector de filas
+func newRowReader(r io.Reader) *rowReader {
+	return &rowReader{br: bufio.NewReaderSize(r, 64<<10)}
+}
+
+// Función que retorna la próxima fila no vacía. El slice vale hasta la
+// siguiente llamada.
+func (rr *rowReader) next() ([]byte, error) {
+	for {
+		rr.line = rr.line[:0]
+		for {
+			part, err := rr.br.ReadSlice('\n')
+			rr.line = append(rr.line, part...)
+			if err == bufio.ErrBufferFull {
+				continue // Fila más larga que el buffer
+			}
+			if err != nil && (err != io.EOF || len(rr.line) == 0) {
+				return nil, err
+			}
+			// Un campo entre comillas puede contener saltos de línea
+			if err == nil && bytes.Count(rr.line, []byte{'"'})%2 == 1 {
+				continue
+			}
+			break
+		}
+		line := bytes.TrimRight(rr.line, "\r\n")
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+// Bloque de filas: los bytes de todas las filas seguidos y dónde termina cada una
+type rowChunk struct {
+	data []byte
+	ends []int
+}
+
+// Bloques reciclados entre cargas y entre bloques de una misma carga
+var rowChunkPool = sync.Pool{New: func() any { return new(rowChunk) }}
+
+// Función que reserva lugar para rows filas de rowBytes bytes en promedio, para
+// que el bloque no crezca de a poco mientras se llena
+func (c *rowChunk) reserve(rows, rowBytes int) {
+	c.data = slices.Grow(c.data[:0], rows*rowBytes)
+	c.ends = slices.Grow(c.ends[:0], rows)
+}
+
+// Función que agrega una copia de una fila al bloque
+func (c *rowChunk) add(row []byte) {
+	c.data = append(c.data, row...)
+	c.ends = append(c.ends, len(c.data))
+}
+
+// Función que retorna el número de filas del bloque
+func (c *rowChunk) len() int {
+	return len(c.ends)
+}
+
+// Función que retorna la fila i del bloque
+func (c *rowChunk) row(i int) []byte {
+	start := 0
+	if i > 0 {
+		start = c.ends[i-1]
+	}
+	return c.data[start:c.ends[i]]
+}
+
+// Función que vacía el bloque y lo devuelve al pool
+func (c *rowChunk) release() {
+	c.data, c.ends = c.data[:0], c.ends[:0]
+	rowChunkPool.Put(c)
+}
+
+// Nombres de establecimientos internados: todas las filas de un mismo
+// establecimiento comparten el mismo string
+type nameInterner struct {
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+// Función que crea el internador
+func newNameInterner() *nameInterner {
+	return &nameInterner{names: make(map[string]string)}
+}
+
+// Función que retorna el string internado de un nombre. La búsqueda con
+// string(b) no asigna; solo un nombre nuevo se copia.
+func (n *nameInterner) intern(b []byte) string {
+	n.mu.RLock()
+	name, ok := n.names[string(b)]
+	n.mu.RUnlock()
+	if ok {
+		return name
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if name, ok := n.names[string(b)]; ok {
+		return name
+	}
+	name = string(b)
+	n.names[name] = name
+	return name
+}
+
+// Función que convierte un entero decimal desde bytes sin asignar. Ante algo
+// que no es un número (o podría desbordar) usa strconv.Atoi, que da el error.
+func parseDigits(b []byte) (int, error) {
+	digits := b
+	negative := len(b) > 0 && (b[0] == '-' || b[0] == '+')
+	if negative {
+		negative, digits = b[0] == '-', b[1:]
+	}
+	if len(digits) == 0 || len(digits) > 18 {
+		return strconv.Atoi(string(b))
+	}
+	n := 0
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return strconv.Atoi(string(b))
+		}
+		n = n*10 + int(c-'0')
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+// Error de una fila con menos columnas que las de su esquema
+var errShortRow = errors.New("fila con menos columnas que la cabecera")
+
+// Función que convierte una fila en una Atencion con el mapeo de columnas de su
+// esquema. Las filas sin comillas se dividen en el lugar; las demás se leen con
+// csv.Reader.
+func parseRow(row []byte, m recordMapper, names *nameInterner) (Atencion, error) {
+	if bytes.IndexByte(row, '"') >= 0 {
+		record, err := parseCSVRow(row)
+		if err != nil {
+			return Atencion{}, err
+		}
+		if len(record) < m.columns() {
+			return Atencion{}, errShortRow
+		}
+		att, ok := parseRecord(m.canonical(record))
+		if !ok {
+			return Atencion{}, errInvalidNumber
+		}
+		att.NombreEstablecimiento = names.intern([]byte(att.NombreEstablecimiento))
+		att.Anio = m.year
+		if m.Anio >= 0 {
+			if att.Anio, err = strconv.Atoi(record[m.Anio]); err != nil {
+				log.Printf("Error al convertir año: %v", err)
+				return Atencion{}, errInvalidNumber
+			}
+		}
+		return att, nil
+	}
+
+	var fields [maxSchemaColumns][]byte
+	rest, columns := row, m.columns()
+	for i := range columns {
+		comma := bytes.IndexByte(rest, ',')
+		if comma < 0 {
+			if i < columns-1 {
+				return Atencion{}, errShortRow
+			}
+			comma = len(rest)
+		}
+		fields[i] = rest[:comma]
+		rest = rest[min(comma+1, len(rest)):]
+	}
+
+	var att Atencion
+	var err error
+	if att.Mes, err = parseDigits(fields[m.Mes]); err != nil {
+		log.Printf("Error al convertir mes: %v", err)
+		return Atencion{}, errInvalidNumber
+	}
+	if att.Dia, err = parseDigits(fields[m.Dia]); err != nil {
+		log.Printf("Error al convertir dia: %v", err)
+		return Atencion{}, errInvalidNumber
+	}
+	if att.Atendidos, err = parseDigits(fields[m.Atendidos]); err != nil {
+		log.Printf("Error al número de atendidos: %v", err)
+		return Atencion{}, errInvalidNumber
+	}
+	if att.Atenciones, err = parseDigits(fields[m.Atenciones]); err != nil {
+		log.Printf("Error al número de atenciones: %v", err)
+		return Atencion{}, errInvalidNumber
+	}
+	att.Anio = m.year
+	if m.Anio >= 0 {
+		if att.Anio, err = parseDigits(fields[m.Anio]); err != nil {
+			log.Printf("Error al convertir año: %v", err)
+			return Atencion{}, errInvalidNumber
+		}
+	}
+	att.NombreEstablecimiento = names.intern(fields[m.Establishment])
+	return att, nil
+}
+
+// Error de una fila con un número inválido (ya informado en el log)
+var errInvalidNumber = errors.New("número inválido")
+
+// Función que lee una fila con comillas con csv.Reader
+func parseCSVRow(row []byte) ([]string, error) {
+	reader := csv.NewReader(bytes.NewReader(row))
+	reader.FieldsPerRecord = -1
+	record, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("fila CSV inválida %q: %w", strings.TrimSpace(string(row)), err)
+	}
+	return record, nil
+}
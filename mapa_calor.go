@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mapa de calor de la congestión de un mes: una matriz de establecimientos por
+// días con la probabilidad predicha (fracción de árboles que votan congestión)
+// en cada celda, una fila por establecimiento. El CSV se abre directo en Excel
+// o Sheets y se colorea con formato condicional para las reuniones de
+// planificación; con -separador ";" usa coma decimal, como espera Excel en
+// español.
+
+// Subcomando "heatmap": exporta la matriz establecimientos × días de un mes
+func heatmapCommand(args []string) error {
+	fs := flag.NewFlagSet("heatmap", flag.ContinueOnError)
+	modelPath := fs.String("modelo", "modelo.gob.gz", "archivo del modelo")
+	month := fs.Int("mes", int(time.Now().Month()), "mes a exportar (1-12)")
+	year := fs.Int("anio", time.Now().Year(), "año, para saber cuántos días tiene el mes")
+	dataPath := fs.String("datos", "", "CSV de atenciones de donde tomar los establecimientos (vacío = los del pipeline del modelo)")
+	establishmentList := fs.String("establecimientos", "", "establecimientos separados por comas, en el orden de las filas (vacío = todos, por nombre)")
+	separator := fs.String("separador", ",", "separador de columnas: \",\" o \";\" (con \";\" los decimales van con coma)")
+	decimals := fs.Int("decimales", 2, "decimales de cada probabilidad")
+	output := fs.String("o", "", "archivo CSV de la matriz (vacío = salida estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *month < 1 || *month > 12 {
+		return errors.New("mes inválido")
+	}
+	if *separator != "," && *separator != ";" {
+		return errors.New("-separador debe ser \",\" o \";\"")
+	}
+	if *decimals < 0 {
+		return errors.New("-decimales no puede ser negativo")
+	}
+
+	model, err := OpenModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+	var history []Atencion
+	if *dataPath != "" {
+		if history, err = loadAtenciones(context.Background(), *dataPath); err != nil {
+			return withExitCode(exitLoadFailure, err)
+		}
+	}
+	pipeline := pipelineFor(model, nil)
+	if pipeline == nil && history != nil {
+		pipeline = NewPipeline(history, nil) // Modelo antiguo: el histórico sirve para imputar
+	}
+	establishments := heatmapEstablishments(*establishmentList, history, pipeline)
+	if len(establishments) == 0 {
+		return errors.New("no hay establecimientos: indica un histórico con -datos o una lista con -establecimientos")
+	}
+
+	days := time.Date(*year, time.Month(*month)+1, 0, 0, 0, 0, 0, time.UTC).Day() // Último día del mes
+	matrix := heatmapMatrix(model, pipeline, establishments, *month, days)
+
+	if *output == "" {
+		return writeHeatmapCSV(os.Stdout, establishments, matrix, *separator, *decimals)
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	if err := writeHeatmapCSV(w, establishments, matrix, *separator, *decimals); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que elige las filas: la lista indicada, en su orden, o los
+// establecimientos del histórico o, sin él, los que conoce el pipeline
+func heatmapEstablishments(list string, history []Atencion, p *Pipeline) []string {
+	if strings.TrimSpace(list) != "" {
+		var establishments []string
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				establishments = append(establishments, name)
+			}
+		}
+		return establishments
+	}
+	names := make(map[string]bool)
+	for _, att := range history {
+		names[att.NombreEstablecimiento] = true
+	}
+	if len(names) == 0 && p != nil {
+		for _, name := range p.Establishments {
+			names[name] = true
+		}
+	}
+	return sortedKeys(names)
+}
+
+// Función que predice cada día del mes para cada establecimiento, todas las
+// consultas en paralelo, y retorna la probabilidad de congestión por fila y día
+func heatmapMatrix(model Predictor, p *Pipeline, establishments []string, month, days int) [][]float64 {
+	queries := make([]batchQuery, 0, len(establishments)*days)
+	for _, name := range establishments {
+		for day := 1; day <= days; day++ {
+			queries = append(queries, batchQuery{Establishment: name, Month: month, Day: day})
+		}
+	}
+	results := predictBatch(model, p, queries, 0)
+	matrix := make([][]float64, len(establishments))
+	for i := range matrix {
+		matrix[i] = make([]float64, days)
+		for d, r := range results[i*days : (i+1)*days] {
+			matrix[i][d] = ratio(r.Votes, r.Trees)
+		}
+	}
+	return matrix
+}
+
+// Función que escribe la matriz: la cabecera con los días y una fila por establecimiento
+func writeHeatmapCSV(w io.Writer, establishments []string, matrix [][]float64, separator string, decimals int) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = rune(separator[0])
+	header := []string{"establecimiento"}
+	for day := 1; len(matrix) > 0 && day <= len(matrix[0]); day++ {
+		header = append(header, strconv.Itoa(day))
+	}
+	cw.Write(header)
+	for i, name := range establishments {
+		record := []string{name}
+		for _, probability := range matrix[i] {
+			cell := strconv.FormatFloat(probability, 'f', decimals, 64)
+			if separator == ";" {
+				cell = strings.Replace(cell, ".", ",", 1)
+			}
+			record = append(record, cell)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Límite de árboles que se construyen a la vez según la memoria disponible.
+// Cada árbol trabaja sobre una copia del 80% de los datos más las divisiones
+// de cada nivel; con muchos árboles en paralelo eso puede superar la RAM. Un
+// semáforo deja construir solo los que caben y el resto espera su turno.
+
+// Fracción de la memoria disponible que se reserva para construir árboles
+const trainMemoryFraction = 0.8
+
+// Función que estima los bytes que ocupa construir un árbol con rows filas:
+// la muestra, las divisiones de cada nivel (que juntas pueden llegar a otro
+// tanto, con el crecimiento de los slices) y la permutación de índices
+func treeFootprint(rows int) int64 {
+	sample := int64(float64(rows)*0.8) * int64(unsafe.Sizeof(Atencion{}))
+	perm := int64(rows) * int64(unsafe.Sizeof(int(0)))
+	return 3*sample + perm
+}
+
+// Función que retorna la memoria disponible en bytes: lo que falta para el
+// límite de Go (GOMEMLIMIT) o MemAvailable del sistema, el menor de los que se
+// conozcan. Retorna -1 si no se conoce ninguno.
+func availableMemory() int64 {
+	available := int64(-1)
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 { // -1 no cambia el límite, solo lo consulta
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		available = max(0, limit-int64(stats.HeapAlloc))
+	}
+	if system := memAvailable(); system >= 0 && (available < 0 || system < available) {
+		available = system
+	}
+	return available
+}
+
+// Función que lee MemAvailable de /proc/meminfo (-1 fuera de Linux o si falla)
+func memAvailable() int64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return -1
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text()) // "MemAvailable:   1234567 kB"
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return -1
+			}
+			return kb << 10
+		}
+	}
+	return -1
+}
+
+// Función que decide cuántos de n árboles se construyen a la vez. Con un
+// límite explícito (> 0) se usa ese; si no, los que caben en la memoria
+// disponible, al menos uno.
+func treeConcurrency(n, rows, limit int) int {
+	if limit > 0 {
+		return max(1, min(n, limit))
+	}
+	available := availableMemory()
+	footprint := treeFootprint(rows)
+	if available < 0 || footprint == 0 {
+		return max(1, n) // Sin información de memoria no se limita
+	}
+	fits := int(float64(available) * trainMemoryFraction / float64(footprint))
+	return max(1, min(n, fits))
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Bot de mensajería: el personal de campo pide los pronósticos desde el
+// celular con mensajes como "congestión hospital loayza 15 julio" o
+// "congestión san juan mañana". El bot interpreta el mensaje, le pide la
+// predicción a un servidor en marcha (como ctl, con TP_CLAVE) y responde en
+// una línea. Hay dos plataformas:
+//
+//   - telegram: consulta los mensajes nuevos con getUpdates (sondeo largo, sin
+//     exponer un puerto) y responde con sendMessage. El token del bot va en
+//     TP_TELEGRAM_TOKEN y -chats limita qué chats pueden preguntar.
+//   - slack: atiende un comando de barra (/congestion ...) en -addr y responde
+//     en la misma petición. La firma de cada petición se verifica con el
+//     secreto de firma de la aplicación, en TP_SLACK_SECRETO.
+//
+// Con -datos el nombre del establecimiento se busca entre los del histórico,
+// sin distinguir mayúsculas ni tildes, así que alcanza con algunas palabras.
+
+// Antigüedad máxima de una petición firmada de Slack, contra reenvíos
+const slackMaxAge = 5 * time.Minute
+
+// Consulta interpretada de un mensaje
+type chatQuery struct {
+	Establishment string
+	Month, Day    int
+}
+
+// Bot: interpreta los mensajes y consulta al servidor
+type chatBot struct {
+	client *controlClient
+	model  string
+	names  []string // Establecimientos conocidos (vacío = se usa el texto del mensaje)
+}
+
+// Subcomando "bot": responde pronósticos por Telegram o Slack
+func botCommand(args []string) error {
+	fs := flag.NewFlagSet("bot", flag.ContinueOnError)
+	platform := fs.String("plataforma", "telegram", "plataforma de mensajería: telegram o slack")
+	serverURL := fs.String("servidor", "http://localhost:8080", "URL del servidor de predicciones o unix:/ruta/al/socket")
+	model := fs.String("modelo", defaultModelName, "modelo del servidor que responde")
+	dataPath := fs.String("datos", "", "CSV de atenciones con los nombres de los establecimientos (vacío = usar el texto del mensaje)")
+	addr := fs.String("addr", ":8090", "dirección donde escuchar el comando de Slack")
+	telegramAPI := fs.String("api-telegram", "https://api.telegram.org", "URL de la API de bots de Telegram (para un servidor propio de la API)")
+	chatList := fs.String("chats", "", "IDs de los chats de Telegram que pueden preguntar, separados por comas (vacío = todos)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	bot := &chatBot{client: newControlClient(*serverURL, 30*time.Second), model: *model}
+	if *dataPath != "" {
+		data, err := loadAtenciones(context.Background(), *dataPath)
+		if err != nil {
+			return withExitCode(exitLoadFailure, err)
+		}
+		names := make(map[string]bool)
+		for _, att := range data {
+			names[att.NombreEstablecimiento] = true
+		}
+		bot.names = sortedKeys(names)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	switch *platform {
+	case "telegram":
+		token := os.Getenv("TP_TELEGRAM_TOKEN")
+		if token == "" {
+			return errors.New("falta el token del bot en TP_TELEGRAM_TOKEN")
+		}
+		allowed, err := parseChatIDs(*chatList)
+		if err != nil {
+			return err
+		}
+		tg := &telegramBot{bot: bot, base: strings.TrimSuffix(*telegramAPI, "/") + "/bot" + token, allowed: allowed,
+			client: &http.Client{Timeout: telegramPoll + 10*time.Second}}
+		return tg.run(ctx)
+	case "slack":
+		secret := os.Getenv("TP_SLACK_SECRETO")
+		if secret == "" {
+			return errors.New("falta el secreto de firma de Slack en TP_SLACK_SECRETO")
+		}
+		return serveSlack(ctx, *addr, bot, []byte(secret))
+	}
+	return fmt.Errorf("plataforma desconocida %q (telegram o slack)", *platform)
+}
+
+// Función que responde un mensaje: la predicción o, si no se entiende, cómo preguntar
+func (b *chatBot) answer(text string) string {
+	query, err := parseChatQuery(text, b.names, time.Now())
+	if err != nil {
+		return fmt.Sprintf("No entendí la consulta: %v. Escribe por ejemplo «congestión hospital loayza 15 julio» o «congestión san juan mañana».", err)
+	}
+	values := url.Values{
+		"modelo":          {b.model},
+		"establecimiento": {query.Establishment},
+		"mes":             {strconv.Itoa(query.Month)},
+		"dia":             {strconv.Itoa(query.Day)},
+	}
+	var resp predictResponse
+	if err := b.client.call(http.MethodGet, "/predict?"+values.Encode(), nil, &resp); err != nil {
+		log.Printf("Bot: %q: %v", text, err)
+		return "No pude consultar el pronóstico en este momento; intenta de nuevo en unos minutos."
+	}
+	verdict := "sin congestión prevista"
+	if resp.Congested {
+		verdict = "congestión probable"
+	}
+	reply := fmt.Sprintf("%s, %d de %s: %s (%.0f%% de los árboles votan congestión).",
+		resp.Establishment, query.Day, monthNames[query.Month], verdict, 100*resp.Probability)
+	if resp.Fallback != "" {
+		reply += " El establecimiento no estaba en los datos de entrenamiento: es un pronóstico general."
+	}
+	if resp.Caveat != "" {
+		reply += " Atención: " + resp.Caveat + "."
+	}
+	return reply
+}
+
+// Función que interpreta un mensaje: una palabra inicial optativa
+// ("congestión", "/congestion"), las palabras del establecimiento y la fecha,
+// como "15 julio", "15 de julio", "15/7", "hoy" o "mañana"
+func parseChatQuery(text string, names []string, now time.Time) (chatQuery, error) {
+	words := strings.FieldsFunc(foldAccents(strings.ToLower(text)), func(r rune) bool {
+		return r == ' ' || r == ',' || r == '?' || r == '¿' || r == '.' || r == '\t' || r == '\n'
+	})
+	if len(words) > 0 && strings.TrimPrefix(words[0], "/") == "congestion" {
+		words = words[1:]
+	}
+
+	var q chatQuery
+	dateAt := -1 // Índice de la primera palabra de la fecha
+	for i, word := range words {
+		switch word {
+		case "hoy", "mañana", "manana":
+			date := now
+			if word != "hoy" {
+				date = now.AddDate(0, 0, 1)
+			}
+			q.Month, q.Day, dateAt = int(date.Month()), date.Day(), i
+		}
+		if day, month, ok := strings.Cut(word, "/"); ok {
+			d, errDay := strconv.Atoi(day)
+			m, errMonth := strconv.Atoi(strings.Split(month, "/")[0])
+			if errDay == nil && errMonth == nil {
+				q.Month, q.Day, dateAt = m, d, i
+			}
+		}
+		if month := slices.Index(monthNames[:], word); month > 0 && i > 0 {
+			day := i - 1
+			if words[day] == "de" && day > 0 {
+				day--
+			}
+			if d, err := strconv.Atoi(words[day]); err == nil {
+				q.Month, q.Day, dateAt = month, d, day
+			}
+		}
+		if dateAt >= 0 {
+			break
+		}
+	}
+	if dateAt < 0 {
+		return q, errors.New("falta la fecha")
+	}
+	if q.Month < 1 || q.Month > 12 || q.Day < 1 || q.Day > 31 {
+		return q, errors.New("fecha inválida")
+	}
+	establishment := words[:dateAt]
+	for n := len(establishment); n > 0 && (establishment[n-1] == "el" || establishment[n-1] == "para"); n-- {
+		establishment = establishment[:n-1] // "congestión san juan para el 15 de julio"
+	}
+	if len(establishment) == 0 {
+		return q, errors.New("falta el establecimiento")
+	}
+	name, err := matchEstablishment(establishment, names)
+	if err != nil {
+		return q, err
+	}
+	q.Establishment = name
+	return q, nil
+}
+
+// Función que busca el establecimiento cuyo nombre contiene todas las palabras
+// del mensaje. Sin nombres conocidos usa las palabras tal cual; si hay varios
+// candidatos, pide precisar.
+func matchEstablishment(words []string, names []string) (string, error) {
+	if len(names) == 0 {
+		return strings.Join(words, " "), nil
+	}
+	var matches []string
+	for _, name := range names {
+		nameWords := strings.Fields(foldAccents(strings.ToLower(name)))
+		if slices.Equal(nameWords, words) {
+			return name, nil // El nombre completo gana aunque sea parte de otros
+		}
+		if !slices.ContainsFunc(words, func(word string) bool { return !slices.Contains(nameWords, word) }) {
+			matches = append(matches, name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no conozco el establecimiento «%s»", strings.Join(words, " "))
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("«%s» puede ser %s", strings.Join(words, " "), examples(matches))
+}
+
+// Función que quita las tildes de un texto en minúsculas (la ñ se conserva)
+func foldAccents(s string) string {
+	return accentFolder.Replace(s)
+}
+
+var accentFolder = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u")
+
+// Espera máxima de cada consulta de mensajes nuevos a Telegram
+const telegramPoll = 30 * time.Second
+
+// Cliente de la API de bots de Telegram
+type telegramBot struct {
+	bot     *chatBot
+	base    string // https://api.telegram.org/bot<token>
+	client  *http.Client
+	allowed map[int64]bool // Chats que pueden preguntar (nil = todos)
+}
+
+// Mensaje nuevo recibido por getUpdates
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		MessageID int64  `json:"message_id"`
+		Text      string `json:"text"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"message"`
+}
+
+// Función que consulta los mensajes nuevos y los responde hasta que se cancela
+// ctx. Un error de red se reintenta después de una pausa.
+func (t *telegramBot) run(ctx context.Context) error {
+	log.Printf("Bot de Telegram esperando mensajes")
+	var offset int64
+	for ctx.Err() == nil {
+		var updates []telegramUpdate
+		err := t.call(ctx, "getUpdates", map[string]any{"offset": offset, "timeout": int(telegramPoll.Seconds())}, &updates)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Telegram: %v", err)
+				sleepContext(ctx, 5*time.Second)
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1 // Telegram descarta los anteriores al siguiente pedido
+			msg := update.Message
+			if msg == nil || msg.Text == "" {
+				continue
+			}
+			reply := fmt.Sprintf("Este chat (%d) no está autorizado para consultar pronósticos.", msg.Chat.ID)
+			if t.allowed == nil || t.allowed[msg.Chat.ID] {
+				reply = t.bot.answer(msg.Text)
+			}
+			err := t.call(ctx, "sendMessage", map[string]any{
+				"chat_id":             msg.Chat.ID,
+				"text":                reply,
+				"reply_to_message_id": msg.MessageID,
+			}, nil)
+			if err != nil {
+				log.Printf("Telegram: al responder al chat %d: %v", msg.Chat.ID, err)
+			}
+		}
+	}
+	log.Println("Bot detenido")
+	return nil
+}
+
+// Función que llama un método de la API de bots y decodifica su resultado en out
+func (t *telegramBot) call(ctx context.Context, method string, params map[string]any, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.base+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("%s: respuesta inválida (%s): %w", method, resp.Status, err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("%s: %s", method, envelope.Description)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
+
+// Función que interpreta la lista de chats autorizados (vacía = nil, todos)
+func parseChatIDs(list string) (map[int64]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	allowed := make(map[int64]bool)
+	for _, part := range strings.Split(list, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chat inválido: %q", part)
+		}
+		allowed[id] = true
+	}
+	return allowed, nil
+}
+
+// Función que atiende el comando de barra de Slack en addr hasta que se cancela ctx
+func serveSlack(ctx context.Context, addr string, bot *chatBot, secret []byte) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /slack", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := verifySlackSignature(r.Header, body, secret, time.Now()); err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// El texto del comando no trae la palabra del comando: se la agrega el usuario al escribir /congestion
+		writeJSON(w, http.StatusOK, map[string]string{"response_type": "ephemeral", "text": bot.answer(form.Get("text"))})
+	})
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	log.Printf("Bot de Slack escuchando en %s (POST /slack)", addr)
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// Función que verifica la firma de una petición de Slack: HMAC-SHA256 con el
+// secreto de firma sobre "v0:<timestamp>:<cuerpo>", con un timestamp reciente
+func verifySlackSignature(header http.Header, body, secret []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("falta el timestamp de la firma")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackMaxAge || age < -slackMaxAge {
+		return errors.New("petición firmada vencida")
+	}
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return errors.New("firma de Slack inválida")
+	}
+	return nil
+}
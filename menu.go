@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Acciones del menú. Cada opción pide sus datos y llama a la acción
+// correspondiente, que es la misma que ejecuta un guion (-script); así el menú,
+// los guiones y la grabación (-grabar) hacen exactamente lo mismo. Una acción
+// exitosa se guarda en la sesión y, si se está grabando, en el guion.
+
+var (
+	errNoRecords = errors.New("primero debes procesar los registros")
+	errNoModel   = errors.New("primero debes entrenar el algoritmo")
+)
+
+// Estado del menú
+type menu struct {
+	rf       *RandomForest
+	data     datasets // Conjuntos de registros procesados
+	session  *menuSession
+	recorder *scriptRecorder // Guion en el que se graban las acciones (nil = no se graba)
+	dataPath string          // Archivo que procesa la opción 1 al responder '.' (-datos del menú)
+}
+
+// Archivo de registros por defecto de la opción 1
+const defaultDataPath = "atenciones_filtradas.csv"
+
+// Función que muestra un error del menú como una oración
+func printMenuError(err error) {
+	msg := err.Error()
+	fmt.Println(strings.ToUpper(msg[:1]) + msg[1:])
+}
+
+// Opción 1: procesar los registros de un archivo o URL como un conjunto con
+// nombre (vacío = el del archivo), que pasa a ser el activo
+func (m *menu) loadRecords(path, name string) error {
+	recorded := name
+	if name == "" {
+		name = datasetName(path)
+	}
+	if existing := m.data.get(name); existing != nil {
+		if existing.Path != path {
+			return fmt.Errorf("ya hay un conjunto %s con los registros de %s", existing.Name, existing.Path)
+		}
+		fmt.Printf("Los registros de %s ya han sido procesados.\n", existing.Name)
+		return m.useDataset(existing.Name)
+	}
+	if !isHTTP(path) && !isRemote(path) && !isGlob(path) { // Las URL se descargan al caché y los patrones se expanden al cargar
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no existe el archivo %s; escribe la ruta de un CSV de atenciones o inicia el menú con -datos", path)
+		}
+	}
+	ds, err := processRecords(name, path)
+	if err != nil {
+		return fmt.Errorf("error al procesar los registros: %w", err)
+	}
+	m.data.add(ds)
+	if len(m.data.list) > 1 {
+		fmt.Printf("Conjunto activo: %s\n", ds.Name)
+	}
+	m.session.Datasets = append(m.session.Datasets, sessionDataset{Name: ds.Name, Path: path})
+	m.session.Active = ds.Name
+	m.session.save()
+	m.recorder.add("load", path, recorded)
+	return nil
+}
+
+// Opción 2: entrenar el bosque con los registros procesados
+func (m *menu) train(trees int, earlyStopping bool, features []string) error {
+	if m.data.active == nil {
+		return errNoRecords
+	}
+	if trees <= 0 {
+		return fmt.Errorf("número de árboles inválido: %d", trees)
+	}
+	if trainOnly := trainOnlyFeatures(features); len(trainOnly) > 0 {
+		fmt.Printf("Advertencia: %s no se conocen al predecir; las consultas las verán en cero.\n", strings.Join(trainOnly, ", "))
+	}
+	numTrees = trees
+	m.rf.Features = features
+	m.rf.DataSHA256 = m.data.active.SHA256
+	m.rf.EarlyStopping = EarlyStopping{
+		Enabled:   earlyStopping,
+		BatchSize: 10,
+		Patience:  3,
+		MinDelta:  0.001,
+	}
+
+	stopProfile := profileStep("entrenamiento")
+	start := time.Now()           // Iniciar el temporizador para el entrenamiento
+	m.rf.Train(m.data.records())  // Entrenar el bosque aleatorio con los registros del conjunto activo
+	duration := time.Since(start) // Calcular el tiempo de entrenamiento
+	stopProfile()
+	audit(context.Background(), auditTrain, "menú", nil, forestDetails(m.rf, numTrees, duration))
+	fmt.Printf("Algoritmo entrenado con %d árboles del conjunto %s en %v\n", len(m.rf.Trees), m.data.active.Name, duration)
+	fmt.Printf("Error OOB: %.4f\n", m.rf.OOBError)
+
+	// El modelo nuevo no está guardado: al continuar la sesión se reentrena
+	m.session.Trees, m.session.EarlyStopping, m.session.Features = trees, earlyStopping, features
+	m.session.ModelPath = ""
+	m.session.save()
+	m.recorder.add("train", strconv.Itoa(trees), yesNo(earlyStopping), strings.Join(features, ","))
+	return nil
+}
+
+// Opción 3: predecir la congestión de un establecimiento en una fecha
+func (m *menu) predict(establishment string, date time.Time) error {
+	if len(m.rf.Trees) == 0 {
+		return errNoModel
+	}
+	rf := m.rf
+	// Un modelo guardado sin pipeline usa uno armado con los registros procesados
+	if rf.Pipeline == nil {
+		rf.Pipeline = NewPipeline(m.data.records(), rf.Features)
+	}
+	m.session.Establishment = establishment
+	m.session.save()
+	m.recorder.add("predict", establishment, date.Format("02/01/2006"))
+
+	month, day := int(date.Month()), date.Day()
+	fmt.Printf("Fecha: %s %s.\n", weekdayNames[date.Weekday()], date.Format("02/01/2006"))
+	version := ""
+	if m.session.ModelPath != "" {
+		version, _ = modelFingerprint(m.session.ModelPath) // Sin huella se muestra como sin guardar
+	}
+	fmt.Printf("Modelo: %s.\n", newModelMetadata(rf, version))
+
+	// Realizamos la predicción usando el bosque aleatorio
+	query := queryAtencion(rf.Pipeline, establishment, month, day)
+	votes, total := rf.Vote(query)
+	decision := decideVote(votes, total, rf.Pipeline.tiePolicy())
+	switch {
+	case decision.Abstained:
+		fmt.Printf("Empate: %d de %d árboles votan congestión; no se decide para %s.\n", votes, total, establishment)
+	case decision.Congested:
+		fmt.Printf("El establecimiento %s estará congestionado.\n", establishment)
+	default:
+		fmt.Printf("El establecimiento %s no estará congestionado.\n", establishment)
+	}
+	if decision.Tie && !decision.Abstained {
+		fmt.Printf("Empate: %d de %d árboles votan congestión; resuelto como %s.\n", votes, total, rf.Pipeline.tiePolicy())
+	}
+	if total > 0 {
+		fmt.Printf("Congestión con %s (intervalo del 95%%).\n", jackknifeInterval(votes, total).Summary)
+	}
+	if ratio, ok := rf.AttentionRatio(query); ok {
+		fmt.Printf("Se esperan %.2f atenciones por atendido.\n", ratio)
+	}
+	if explanation, err := Explain(rf, query); err == nil {
+		fmt.Printf("Según los árboles, %s.\n", explanation.Summary)
+	}
+	fmt.Printf("Contrafactual: %s.\n", FindCounterfactual(rf, rf.Pipeline, establishment, month, day).Summary)
+
+	// Mostrar lo ocurrido ese mismo día en los registros, sin recorrerlos todos
+	if m.data.active == nil {
+		return nil // Modelo cargado sin registros procesados
+	}
+	index := m.data.active.Index
+	if history := index.EstablishmentDateRows(establishment, month, day); len(history) > 0 {
+		total := 0
+		for _, att := range history {
+			total += att.Atendidos
+		}
+		fmt.Printf("En los registros: %d atenciones ese día, con %d atendidos en promedio.\n", len(history), total/len(history))
+	}
+	// Días parecidos del mismo establecimiento como precedente del pronóstico
+	analogs := newAnalogIndex(index, 0).Nearest(query, 5, rf.Pipeline.ThresholdFor(establishment))
+	fmt.Printf("Precedentes: %s.\n", summarizeAnalogs(analogs))
+	for _, d := range analogs {
+		fmt.Printf("  %02d/%02d: %d atendidos\n", d.Day, d.Month, d.Attended)
+	}
+	return nil
+}
+
+// Opción 4: seguir entrenando el bosque existente sin empezar desde cero
+func (m *menu) addTrees(n int) error {
+	if len(m.rf.Trees) == 0 {
+		return errNoModel
+	}
+	start := time.Now()
+	added, err := m.rf.AddTrees(n)
+	audit(context.Background(), auditAddTrees, "menú", err, forestDetails(m.rf, n, time.Since(start)))
+	if err != nil {
+		return fmt.Errorf("error al agregar árboles: %w", err)
+	}
+	fmt.Printf("Se agregaron %d árboles (total %d) en %v\n", added, len(m.rf.Trees), time.Since(start))
+	fmt.Printf("Error OOB: %.4f\n", m.rf.OOBError)
+
+	m.session.Trees, m.session.EarlyStopping, m.session.Features = len(m.rf.Trees), m.rf.EarlyStopping.Enabled, m.rf.Features
+	m.session.ModelPath = ""
+	m.session.save()
+	m.recorder.add("add-trees", strconv.Itoa(n))
+	return nil
+}
+
+// Opción 5: guardar el bosque entrenado en disco
+func (m *menu) saveModel(path string) error {
+	if len(m.rf.Trees) == 0 {
+		return errNoModel
+	}
+	start := time.Now()
+	err := m.rf.Save(path)
+	audit(context.Background(), auditSaveModel, path, err, map[string]any{"arboles": len(m.rf.Trees), "error_oob": m.rf.OOBError})
+	if err != nil {
+		return fmt.Errorf("error al guardar el modelo: %w", err)
+	}
+	fmt.Printf("Modelo guardado en %s en %v\n", path, time.Since(start))
+	m.session.ModelPath = path
+	m.session.save()
+	m.recorder.add("save", path)
+	return nil
+}
+
+// Opción 6: cargar un bosque previamente guardado
+func (m *menu) loadModel(path string) error {
+	start := time.Now()
+	loaded, err := LoadModel(path)
+	audit(context.Background(), auditLoadModel, path, err, nil)
+	if err != nil {
+		return fmt.Errorf("error al cargar el modelo: %w", err)
+	}
+	m.rf = loaded
+	fmt.Printf("Modelo con %d árboles cargado en %v\n", len(m.rf.Trees), time.Since(start))
+	if err := checkLeakage(m.rf, m.rf.Pipeline); err != nil {
+		fmt.Printf("Advertencia: %v\n", err)
+	}
+	m.session.ModelPath = path
+	m.session.save()
+	m.recorder.add("load-model", path)
+	return nil
+}
+
+// Opción 7: exportar el bosque en el formato plano que se carga con mmap
+func (m *menu) exportFlat(path string) error {
+	if len(m.rf.Trees) == 0 {
+		return errNoModel
+	}
+	err := m.rf.SaveFlat(path)
+	audit(context.Background(), auditSaveModel, path, err, map[string]any{"arboles": len(m.rf.Trees), "formato": "plano"})
+	if err != nil {
+		return fmt.Errorf("error al exportar el modelo: %w", err)
+	}
+	fmt.Printf("Modelo plano guardado en %s\n", path)
+	m.recorder.add("export", path)
+	return nil
+}
+
+// Opción 8: quedarse solo con los registros del conjunto activo que cumplen
+// una expresión de filtro
+func (m *menu) filter(expr string) error {
+	ds := m.data.active
+	if ds == nil {
+		return errNoRecords
+	}
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	before := len(ds.Records)
+	invalidateStatistics(ds.Records)
+	ds.Records = filterAtenciones(ds.Records, filter)
+	ds.Index = NewDatasetIndex(ds.Records)
+	audit(context.Background(), auditFilter, expr, nil, map[string]any{"conjunto": ds.Name, "antes": before, "despues": len(ds.Records)})
+	fmt.Printf("Registros de %s que cumplen el filtro: %d de %d (%v)\n", ds.Name, len(ds.Records), before, time.Since(start))
+	if len(m.rf.Trees) > 0 {
+		fmt.Println("El modelo actual se entrenó con los registros anteriores; vuelve a entrenarlo si es necesario.")
+	}
+	m.recorder.addLine("filter " + expr) // La expresión va tal cual hasta el final de la línea
+	return nil
+}
+
+// Opción 10: consultar las operaciones registradas, opcionalmente de un solo tipo
+func (m *menu) showAudit(operation string) error {
+	if auditLog == nil {
+		return errors.New("la auditoría está desactivada; se activa con TP_AUDITORIA=<archivo>")
+	}
+	records, err := ReadAudit(auditLog.path, operation, 20)
+	if err != nil {
+		return fmt.Errorf("error al leer el registro de auditoría: %w", err)
+	}
+	printAudit(os.Stdout, records)
+	return nil
+}
+
+// Opción 11: elegir el conjunto de registros con el que se entrena, se predice
+// y se filtra
+func (m *menu) useDataset(name string) error {
+	ds := m.data.get(name)
+	if ds == nil {
+		return fmt.Errorf("conjunto desconocido %q (procesados: %s)", name, strings.Join(m.data.names(), ", "))
+	}
+	if ds != m.data.active {
+		m.data.active = ds
+		fmt.Printf("Conjunto activo: %s (%d registros)\n", ds.Name, len(ds.Records))
+		if len(m.rf.Trees) > 0 {
+			fmt.Println("El modelo actual se entrenó con otro conjunto; vuelve a entrenarlo si es necesario.")
+		}
+	}
+	m.session.Active = ds.Name
+	m.session.save()
+	m.recorder.add("use", ds.Name)
+	return nil
+}
+
+// Opción 12: comparar las estadísticas de los conjuntos indicados (nil = todos)
+func (m *menu) compareDatasets(names []string) error {
+	if m.data.active == nil {
+		return errNoRecords
+	}
+	list := m.data.list
+	if len(names) > 0 {
+		list = nil
+		for _, name := range names {
+			ds := m.data.get(name)
+			if ds == nil {
+				return fmt.Errorf("conjunto desconocido %q (procesados: %s)", name, strings.Join(m.data.names(), ", "))
+			}
+			list = append(list, ds)
+		}
+	}
+	printDatasetComparison(list, m.data.active)
+	m.recorder.add("compare", names...)
+	return nil
+}
+
+// Diferencias entre dos conjuntos procesados, como el subcomando diff
+func (m *menu) diffDatasets(beforeName, afterName string) error {
+	before, after := m.data.get(beforeName), m.data.get(afterName)
+	for i, ds := range []*dataset{before, after} {
+		if ds == nil {
+			return fmt.Errorf("conjunto desconocido %q (procesados: %s)", []string{beforeName, afterName}[i], strings.Join(m.data.names(), ", "))
+		}
+	}
+	writeDatasetDiff(os.Stdout, diffDatasets(before.Records, after.Records, 0.2), before.Name, after.Name)
+	m.recorder.add("diff", before.Name, after.Name)
+	return nil
+}
+
+// Función que escribe un sí o un no como en las preguntas del menú
+func yesNo(b bool) string {
+	if b {
+		return "s"
+	}
+	return "n"
+}
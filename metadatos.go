@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metadatos del modelo en cada predicción: la versión del modelo (el inicio del
+// SHA-256 de su archivo, la misma huella que usa el caché compartido), la suma
+// de los datos con los que se entrenó, la fecha del entrenamiento y el número de
+// árboles. Van en la respuesta y en cabeceras X-Modelo-* de la API, en columnas
+// de la salida de predict-batch y en el menú, así quien use un pronóstico sabe
+// siempre qué modelo lo produjo. Los modelos planos y los de Hoeffding no
+// guardan los datos ni la fecha de su entrenamiento.
+
+// Metadatos del modelo que produjo una predicción
+type ModelMetadata struct {
+	Version    string `json:"version_modelo"`         // Huella del archivo del modelo (vacío = sin guardar)
+	DataSHA256 string `json:"datos_sha256,omitempty"` // Suma de los datos de entrenamiento
+	TrainedAt  string `json:"entrenado,omitempty"`    // Fecha del entrenamiento (RFC 3339)
+	Trees      int    `json:"arboles_modelo"`
+}
+
+// Columnas de los metadatos en la salida de predict-batch
+var modelMetadataColumns = []string{"version_modelo", "datos_sha256", "entrenado", "arboles_modelo"}
+
+// Modelo que sabe con qué datos y cuándo se entrenó
+type trainingInfo interface {
+	TrainingMetadata() (dataSHA256 string, trainedAt time.Time)
+}
+
+// Función que retorna la suma de los datos y la fecha del entrenamiento del bosque
+func (rf *RandomForest) TrainingMetadata() (string, time.Time) {
+	return rf.DataSHA256, rf.TrainedAt
+}
+
+// Función que arma los metadatos de un modelo con la versión indicada
+func newModelMetadata(model Predictor, version string) *ModelMetadata {
+	meta := &ModelMetadata{Version: version, Trees: model.NumTrees()}
+	if info, ok := model.(trainingInfo); ok {
+		var trainedAt time.Time
+		meta.DataSHA256, trainedAt = info.TrainingMetadata()
+		if !trainedAt.IsZero() {
+			meta.TrainedAt = trainedAt.Format(time.RFC3339)
+		}
+	}
+	return meta
+}
+
+// Función que retorna los metadatos como columnas del CSV de predicciones
+func (m *ModelMetadata) record() []string {
+	return []string{m.Version, m.DataSHA256, m.TrainedAt, strconv.Itoa(m.Trees)}
+}
+
+// Función que agrega los metadatos a las cabeceras de una respuesta HTTP
+func (m *ModelMetadata) setHeaders(h http.Header) {
+	h.Set("X-Modelo-Version", m.Version)
+	h.Set("X-Modelo-Arboles", strconv.Itoa(m.Trees))
+	if m.DataSHA256 != "" {
+		h.Set("X-Modelo-Datos-Sha256", m.DataSHA256)
+	}
+	if m.TrainedAt != "" {
+		h.Set("X-Modelo-Entrenado", m.TrainedAt)
+	}
+}
+
+// Función que describe los metadatos en una línea, para el menú
+func (m *ModelMetadata) String() string {
+	version, data, trained := m.Version, m.DataSHA256, m.TrainedAt
+	if version == "" {
+		version = "sin guardar"
+	}
+	if data == "" {
+		data = "desconocidos"
+	} else if len(data) > 12 {
+		data = data[:12]
+	}
+	if trained == "" {
+		trained = "fecha desconocida"
+	}
+	return fmt.Sprintf("versión %s, %d árboles, entrenado %s con datos %s", version, m.Trees, trained, data)
+}
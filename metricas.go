@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Métricas del proceso expuestas en formato de texto de Prometheus.
+// Son deliberadamente simples: contadores e histogramas con etiquetas.
+// Si el cliente acepta OpenMetrics, los histogramas incluyen exemplars con el
+// ID de la última petición observada en cada cubeta.
+
+// Registro global de métricas
+var metrics = &metricRegistry{}
+
+type metricRegistry struct {
+	mu      sync.Mutex
+	metrics []metric // En orden de registro
+}
+
+// Métrica que sabe escribirse en formato de texto
+type metric interface {
+	write(w io.Writer, openMetrics bool)
+}
+
+func (r *metricRegistry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Función que escribe todas las métricas registradas
+func (r *metricRegistry) Write(w io.Writer, openMetrics bool) {
+	r.mu.Lock()
+	list := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range list {
+		m.write(w, openMetrics)
+	}
+	if openMetrics {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
+
+// Handler HTTP para GET /metrics
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+	metrics.Write(w, openMetrics)
+}
+
+// Contador con etiquetas
+type CounterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64 // Valor por combinación de etiquetas
+}
+
+// Constructor para un contador registrado globalmente
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	metrics.register(c)
+	return c
+}
+
+// Función que incrementa el contador para los valores de etiquetas dados
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Función que suma delta al contador para los valores de etiquetas dados
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer, openMetrics bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	family := c.name
+	if openMetrics {
+		family = strings.TrimSuffix(c.name, "_total") // OpenMetrics nombra la familia sin el sufijo
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, c.help, family)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labels, key, "", ""), c.values[key])
+	}
+}
+
+// Límites por defecto de los histogramas de latencia, en segundos
+var defaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Histograma con etiquetas
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogram
+}
+
+// Valores acumulados de una serie del histograma
+type histogram struct {
+	counts    []uint64   // Observaciones por cubeta (no acumuladas)
+	exemplars []exemplar // Última observación con ID de petición por cubeta (+Inf al final)
+	count     uint64
+	sum       float64
+}
+
+// Observación de ejemplo asociada a una petición
+type exemplar struct {
+	requestID string
+	value     float64
+}
+
+// Constructor para un histograma registrado globalmente
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+	metrics.register(h)
+	return h
+}
+
+// Función que registra una observación para los valores de etiquetas dados
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.ObserveExemplar(value, "", labelValues...)
+}
+
+// Función que registra una observación y recuerda el ID de la petición que la
+// produjo como exemplar de su cubeta
+func (h *HistogramVec) ObserveExemplar(value float64, requestID string, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets)), exemplars: make([]exemplar, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	if requestID != "" {
+		s.exemplars[i] = exemplar{requestID: requestID, value: value}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer, openMetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d%s\n", h.name, formatLabels(h.labels, key, "le", fmt.Sprint(bound)),
+				cumulative, s.exemplars[i].format(openMetrics))
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d%s\n", h.name, formatLabels(h.labels, key, "le", "+Inf"),
+			s.count, s.exemplars[len(h.buckets)].format(openMetrics))
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, formatLabels(h.labels, key, "", ""), s.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, "", ""), s.count)
+	}
+}
+
+// Función que formatea el exemplar al final de una línea de OpenMetrics
+func (e exemplar) format(openMetrics bool) string {
+	if !openMetrics || e.requestID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" # {request_id=%q} %g", e.requestID, e.value)
+}
+
+// Separador de valores de etiquetas dentro de la clave de una serie
+const labelSep = "\xff"
+
+func labelKey(values []string) string {
+	return strings.Join(values, labelSep)
+}
+
+// Función que arma el bloque {a="x",b="y"} de una serie
+func formatLabels(names []string, key string, extraName, extraValue string) string {
+	var parts []string
+	if len(names) > 0 {
+		values := strings.Split(key, labelSep)
+		for i, name := range names {
+			if i < len(values) {
+				parts = append(parts, fmt.Sprintf("%s=%q", name, values[i]))
+			}
+		}
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Función que calcula el percentil p (0-1) de una muestra ya ordenada
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
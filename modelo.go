@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Identificador y versión del formato de archivo del modelo
+const (
+	modelMagic   = "TPRF"
+	modelVersion = 1
+)
+
+// Cabecera que se escribe al inicio del archivo del modelo
+type modelHeader struct {
+	Magic    string    // Identificador del formato
+	Version  int       // Versión del formato
+	Trees    int       // Número de árboles del bosque
+	OOBError float64   // Error OOB al momento de guardar
+	Features []string  // Características permitidas al entrenar (vacío = las por defecto)
+	Pipeline *Pipeline // Preprocesamiento del entrenamiento (nil en modelos antiguos)
+	Imputer  *Imputer  // Promedios de modelos guardados antes de existir el pipeline
+
+	TrainedAt  time.Time // Momento del entrenamiento (cero en modelos antiguos)
+	DataSHA256 string    // Suma de los datos de entrenamiento (vacío = desconocida)
+}
+
+// Nodo serializado: los hijos se referencian por índice en lugar de punteros
+type savedNode struct {
+	Feature    string  // Característica de la división
+	Threshold  int     // Umbral de la división
+	Left       int32   // Índice del hijo izquierdo (-1 en las hojas)
+	Right      int32   // Índice del hijo derecho (-1 en las hojas)
+	IsLeaf     bool    // Indica si es un nodo hoja
+	Prediction bool    // Predicción de la hoja
+	Ratio      float64 // Atenciones por atendido de la hoja (0 en modelos antiguos)
+}
+
+// Registro del flujo del modelo: un nodo nuevo o la raíz de un árbol completo
+type savedRecord struct {
+	Node *savedNode // Nodo nuevo; recibe el siguiente índice disponible
+	Root int32      // Índice de la raíz de un árbol (cuando Node es nil)
+}
+
+// Codificador que deduplica subárboles idénticos mientras escribe
+type modelEncoder struct {
+	enc *gob.Encoder
+	ids map[savedNode]int32 // Índice asignado a cada nodo ya escrito
+}
+
+// Función que escribe un nodo en post-orden y retorna su índice.
+// Si un subárbol idéntico ya fue escrito se reutiliza su índice.
+func (e *modelEncoder) encodeNode(node *Node) (int32, error) {
+	rec := savedNode{Left: -1, Right: -1, IsLeaf: node.IsLeaf, Prediction: node.Prediction, Ratio: node.Ratio}
+	if !node.IsLeaf {
+		left, err := e.encodeNode(node.Left) // Los hijos se escriben antes que el padre
+		if err != nil {
+			return 0, err
+		}
+		right, err := e.encodeNode(node.Right)
+		if err != nil {
+			return 0, err
+		}
+		rec = savedNode{Feature: node.Feature, Threshold: node.Threshold, Left: left, Right: right}
+	}
+
+	if id, ok := e.ids[rec]; ok {
+		return id, nil // Subárbol repetido: no se vuelve a escribir
+	}
+	id := int32(len(e.ids))
+	e.ids[rec] = id
+	if err := e.enc.Encode(savedRecord{Node: &rec}); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Función para guardar el bosque en un archivo local o remoto (s3://, gs://,
+// almacen:).
+// Si la ruta termina en ".gz" el archivo se comprime con gzip.
+func (rf *RandomForest) Save(path string) error {
+	file, err := createOutput(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	defer file.Abort() // Sin efecto si el archivo ya se cerró correctamente
+	if stored, ok := file.(*storeOutput); ok {
+		stored.describe(rf)
+	}
+
+	buffered := bufio.NewWriter(file)
+	var w io.Writer = buffered
+	var zw *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		zw = gzip.NewWriter(buffered) // Comprimir el flujo del modelo
+		w = zw
+	}
+
+	e := &modelEncoder{enc: gob.NewEncoder(w), ids: make(map[savedNode]int32)}
+	header := modelHeader{Magic: modelMagic, Version: modelVersion, Trees: len(rf.Trees), OOBError: rf.OOBError, Features: rf.Features, Pipeline: rf.Pipeline,
+		TrainedAt: rf.TrainedAt, DataSHA256: rf.DataSHA256}
+	if err := e.enc.Encode(header); err != nil {
+		return err
+	}
+
+	// Escribir cada árbol: primero sus nodos nuevos y luego la referencia a su raíz
+	for _, tree := range rf.Trees {
+		root, err := e.encodeNode(tree.Root)
+		if err != nil {
+			return err
+		}
+		if err := e.enc.Encode(savedRecord{Root: root}); err != nil {
+			return err
+		}
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función para cargar un bosque guardado con Save.
+// El archivo se lee como flujo, así que nunca se mantiene completo en memoria;
+// los subárboles deduplicados se comparten entre árboles al reconstruirlos.
+func LoadModel(path string) (*RandomForest, error) {
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadModel(file)
+}
+
+// Función que lee un bosque guardado con Save desde un flujo (comprimido o no),
+// para cuando el modelo no está en un archivo, como en el navegador
+func ReadModel(r io.Reader) (*RandomForest, error) {
+	r, err := decompressIfNeeded(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	dec := gob.NewDecoder(r)
+
+	var header modelHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera del modelo: %w", err)
+	}
+	if header.Magic != modelMagic {
+		return nil, errors.New("el archivo no contiene un modelo válido")
+	}
+	if header.Version > modelVersion {
+		return nil, fmt.Errorf("versión de modelo no soportada: %d", header.Version)
+	}
+	// Los árboles se agregan a medida que se leen: la cantidad de la cabecera
+	// no se usa para reservar memoria, porque un archivo dañado puede traer cualquiera
+	if header.Trees < 0 || header.Trees > maxModelTrees {
+		return nil, fmt.Errorf("modelo corrupto: número de árboles inválido %d", header.Trees)
+	}
+
+	rf := &RandomForest{OOBError: header.OOBError, Features: header.Features, Pipeline: header.Pipeline,
+		TrainedAt: header.TrainedAt, DataSHA256: header.DataSHA256}
+	if rf.Pipeline == nil && header.Imputer != nil {
+		// Modelo con promedios pero sin pipeline: el resto toma los valores por defecto
+		rf.Pipeline = &Pipeline{CongestionThreshold: congestionThreshold, Features: header.Features, Imputer: header.Imputer}
+	}
+	var nodes []*Node // Nodos reconstruidos, indexados en el orden de escritura
+	for len(rf.Trees) < header.Trees {
+		var rec savedRecord
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("error al leer el modelo: %w", err)
+		}
+
+		if rec.Node == nil {
+			if !nodeIndexValid(rec.Root, len(nodes)) {
+				return nil, errors.New("modelo corrupto: raíz inexistente")
+			}
+			rf.Trees = append(rf.Trees, &DecisionTree{Root: nodes[rec.Root]})
+			continue
+		}
+
+		node := &Node{
+			Feature:    rec.Node.Feature,
+			Threshold:  rec.Node.Threshold,
+			IsLeaf:     rec.Node.IsLeaf,
+			Prediction: rec.Node.Prediction,
+			Ratio:      rec.Node.Ratio,
+		}
+		if !node.IsLeaf {
+			if !nodeIndexValid(rec.Node.Left, len(nodes)) || !nodeIndexValid(rec.Node.Right, len(nodes)) {
+				return nil, errors.New("modelo corrupto: hijo inexistente")
+			}
+			node.Left = nodes[rec.Node.Left]
+			node.Right = nodes[rec.Node.Right]
+		}
+		nodes = append(nodes, node)
+	}
+	return rf, nil
+}
+
+// Máximo de árboles que se acepta en la cabecera de un modelo guardado
+const maxModelTrees = 1 << 20
+
+// Función que verifica que un índice leído del archivo apunte a un nodo ya
+// reconstruido; un archivo corrupto puede traer índices negativos
+func nodeIndexValid(index int32, nodes int) bool {
+	return index >= 0 && int(index) < nodes
+}
+
+// Función que detecta la cabecera gzip y descomprime el flujo si corresponde
+func decompressIfNeeded(r *bufio.Reader) (io.Reader, error) {
+	magic, err := r.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(r)
+	}
+	return r, nil
+}
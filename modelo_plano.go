@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Formato plano del modelo: todos los nodos en un arreglo de registros de tamaño
+// fijo, pensado para mapearse en memoria y recorrerse sin decodificar.
+//
+//	cabecera (16 bytes): "TPFL", versión, número de árboles, número de nodos
+//	raíces:  un uint32 por árbol con el índice de su nodo raíz
+//	nodos:   flatNodeSize bytes por nodo (característica, flags, umbral, hijos;
+//	         las hojas llevan en lugar de los hijos sus atenciones por atendido)
+//	nombres: número de características y cada nombre con su longitud
+//	estado:  (desde la versión 2) longitud en un uint32 y el gob de flatState,
+//	         con el pipeline del entrenamiento, para que el bosque plano prediga
+//	         igual que el bosque del que salió
+const (
+	flatMagic      = "TPFL"
+	flatVersion    = 2
+	flatHeaderSize = 16
+	flatNodeSize   = 16
+)
+
+// Flags de cada nodo en el formato plano
+const (
+	flatLeaf       = 1 << 0 // El nodo es una hoja
+	flatPrediction = 1 << 1 // La hoja predice congestión
+)
+
+// Bosque en formato plano, normalmente respaldado por un archivo mapeado en memoria
+type FlatForest struct {
+	data      []byte               // Contenido del archivo
+	numTrees  int                  // Número de árboles
+	numNodes  int                  // Número total de nodos
+	nodesOff  int                  // Desplazamiento del arreglo de nodos
+	accessors []func(Atencion) int // Acceso a cada característica, por índice
+	names     []string             // Nombre de cada característica, por índice
+	release   func([]byte) error   // Libera el contenido (munmap o nada)
+	state     flatState            // Estado del entrenamiento (vacío en la versión 1)
+}
+
+// Estado del bosque que no está en los nodos: el mismo que guarda la cabecera
+// del formato gob
+type flatState struct {
+	Pipeline   *Pipeline // Umbral, características, imputación y política de empates (nil en modelos antiguos)
+	Features   []string  // Características permitidas al entrenar
+	OOBError   float64
+	TrainedAt  time.Time
+	DataSHA256 string
+}
+
+// Función que retorna la función de acceso a una característica por su nombre
+func featureAccessor(name string) (func(Atencion) int, bool) {
+	switch name {
+	case "Mes":
+		return func(att Atencion) int { return att.Mes }, true
+	case "Dia":
+		return func(att Atencion) int { return att.Dia }, true
+	case "Atendidos":
+		return func(att Atencion) int { return att.Atendidos }, true
+	case "Atenciones":
+		return func(att Atencion) int { return att.Atenciones }, true
+	case "Grupo":
+		return func(att Atencion) int { return att.Grupo }, true
+	case "Anio":
+		return func(att Atencion) int { return att.Anio }, true
+	case "Citas":
+		return func(att Atencion) int { return att.Citas }, true
+	}
+	if fn, ok := customFeature(name); ok {
+		return customAccessor(fn), true
+	}
+	return nil, false
+}
+
+// Función para guardar el bosque en formato plano
+func (rf *RandomForest) SaveFlat(path string) error {
+	// Asignar un índice a cada nodo; los nodos compartidos se escriben una sola vez
+	ids := make(map[*Node]uint32)
+	var order []*Node
+	var assign func(node *Node)
+	assign = func(node *Node) {
+		if _, ok := ids[node]; ok {
+			return
+		}
+		ids[node] = uint32(len(order))
+		order = append(order, node)
+		if !node.IsLeaf {
+			assign(node.Left)
+			assign(node.Right)
+		}
+	}
+	for _, tree := range rf.Trees {
+		assign(tree.Root)
+	}
+
+	// Tabla de nombres de características usadas por los nodos
+	featureIDs := make(map[string]uint8)
+	var names []string
+	for _, node := range order {
+		if node.IsLeaf {
+			continue
+		}
+		if _, ok := featureIDs[node.Feature]; !ok {
+			if len(names) == 255 {
+				return errors.New("demasiadas características para el formato plano")
+			}
+			featureIDs[node.Feature] = uint8(len(names))
+			names = append(names, node.Feature)
+		}
+	}
+
+	file, err := createOutput(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	defer file.Abort() // Sin efecto si el archivo ya se cerró correctamente
+	if stored, ok := file.(*storeOutput); ok {
+		stored.describe(rf)
+	}
+	w := bufio.NewWriter(file)
+
+	header := make([]byte, flatHeaderSize)
+	copy(header, flatMagic)
+	binary.LittleEndian.PutUint32(header[4:], flatVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(rf.Trees)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(order)))
+	w.Write(header)
+
+	buf := make([]byte, flatNodeSize)
+	for _, tree := range rf.Trees {
+		binary.LittleEndian.PutUint32(buf, ids[tree.Root])
+		w.Write(buf[:4])
+	}
+	for _, node := range order {
+		clear(buf)
+		if node.IsLeaf {
+			buf[1] = flatLeaf
+			if node.Prediction {
+				buf[1] |= flatPrediction
+			}
+			binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(node.Ratio))
+		} else {
+			buf[0] = featureIDs[node.Feature]
+			binary.LittleEndian.PutUint32(buf[4:], uint32(int32(node.Threshold)))
+			binary.LittleEndian.PutUint32(buf[8:], ids[node.Left])
+			binary.LittleEndian.PutUint32(buf[12:], ids[node.Right])
+		}
+		w.Write(buf)
+	}
+
+	w.WriteByte(byte(len(names)))
+	for _, name := range names {
+		w.WriteByte(byte(len(name)))
+		w.WriteString(name)
+	}
+
+	var state bytes.Buffer
+	err = gob.NewEncoder(&state).Encode(flatState{Pipeline: rf.Pipeline, Features: rf.Features, OOBError: rf.OOBError,
+		TrainedAt: rf.TrainedAt, DataSHA256: rf.DataSHA256})
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(state.Len()))
+	w.Write(buf[:4])
+	w.Write(state.Bytes())
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función para abrir un modelo en formato plano. En sistemas que lo permiten el
+// archivo se mapea en memoria, por lo que la carga es casi instantánea y varios
+// procesos que abren el mismo modelo comparten las mismas páginas. Un modelo
+// remoto (s3://, gs://) se descarga completo a memoria.
+func OpenFlatModel(path string) (*FlatForest, error) {
+	var data []byte
+	var release func([]byte) error
+	var err error
+	if isRemote(path) || isStoredModel(path) {
+		data, release, err = downloadFile(path)
+	} else {
+		data, release, err = mapFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ff, err := parseFlat(data)
+	if err != nil {
+		release(data)
+		return nil, err
+	}
+	ff.release = release
+	return ff, nil
+}
+
+// Función que valida la cabecera y la tabla de características del formato plano
+func parseFlat(data []byte) (*FlatForest, error) {
+	if len(data) < flatHeaderSize || string(data[:4]) != flatMagic {
+		return nil, errors.New("el archivo no contiene un modelo plano válido")
+	}
+	version := binary.LittleEndian.Uint32(data[4:])
+	if version > flatVersion {
+		return nil, fmt.Errorf("versión de modelo plano no soportada: %d", version)
+	}
+
+	ff := &FlatForest{
+		data:     data,
+		numTrees: int(binary.LittleEndian.Uint32(data[8:])),
+		numNodes: int(binary.LittleEndian.Uint32(data[12:])),
+	}
+	ff.nodesOff = flatHeaderSize + 4*ff.numTrees
+	namesOff := ff.nodesOff + flatNodeSize*ff.numNodes
+	if namesOff >= len(data) {
+		return nil, errors.New("modelo plano truncado")
+	}
+
+	// Leer la tabla de nombres de características
+	count := int(data[namesOff])
+	pos := namesOff + 1
+	for i := 0; i < count; i++ {
+		if pos >= len(data) || pos+1+int(data[pos]) > len(data) {
+			return nil, errors.New("modelo plano truncado")
+		}
+		name := string(data[pos+1 : pos+1+int(data[pos])])
+		accessor, ok := featureAccessor(name)
+		if !ok {
+			return nil, fmt.Errorf("característica desconocida en el modelo: %s", name)
+		}
+		ff.accessors = append(ff.accessors, accessor)
+		ff.names = append(ff.names, name)
+		pos += 1 + int(data[pos])
+	}
+
+	// Leer el estado del entrenamiento; la versión 1 no lo tiene
+	if version >= 2 {
+		if pos+4 > len(data) {
+			return nil, errors.New("modelo plano truncado")
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if size > len(data)-pos {
+			return nil, errors.New("modelo plano truncado")
+		}
+		if err := gob.NewDecoder(bytes.NewReader(data[pos : pos+size])).Decode(&ff.state); err != nil {
+			return nil, fmt.Errorf("error al leer el estado del modelo plano: %w", err)
+		}
+	}
+	return ff, nil
+}
+
+// Función que retorna el pipeline guardado con el bosque plano
+func (ff *FlatForest) QueryPipeline() *Pipeline {
+	return ff.state.Pipeline
+}
+
+// Función que retorna la suma de los datos y el momento del entrenamiento
+func (ff *FlatForest) TrainingMetadata() (string, time.Time) {
+	return ff.state.DataSHA256, ff.state.TrainedAt
+}
+
+// Número de árboles del bosque plano
+func (ff *FlatForest) NumTrees() int {
+	return ff.numTrees
+}
+
+// Función que recorre un árbol directamente sobre los bytes del archivo y
+// retorna su hoja. Los índices se validan durante el recorrido para no tener
+// que leer todo el archivo al abrirlo; un árbol corrupto simplemente no vota.
+func (ff *FlatForest) leaf(tree int, att Atencion) (node []byte, ok bool) {
+	index := int(binary.LittleEndian.Uint32(ff.data[flatHeaderSize+4*tree:]))
+	for steps := 0; steps <= ff.numNodes; steps++ {
+		if index >= ff.numNodes {
+			return nil, false
+		}
+		node := ff.data[ff.nodesOff+flatNodeSize*index:]
+		if node[1]&flatLeaf != 0 {
+			return node, true
+		}
+		if int(node[0]) >= len(ff.accessors) {
+			return nil, false
+		}
+		threshold := int(int32(binary.LittleEndian.Uint32(node[4:])))
+		if ff.accessors[node[0]](att) <= threshold {
+			index = int(binary.LittleEndian.Uint32(node[8:])) // Rama izquierda
+		} else {
+			index = int(binary.LittleEndian.Uint32(node[12:])) // Rama derecha
+		}
+	}
+	return nil, false // Ciclo en un modelo corrupto
+}
+
+// Función que retorna la predicción de un árbol del bosque plano
+func (ff *FlatForest) predictTree(tree int, att Atencion) (prediction bool, ok bool) {
+	node, ok := ff.leaf(tree, att)
+	return ok && node[1]&flatPrediction != 0, ok
+}
+
+// Función que promedia las atenciones por atendido de las hojas, como
+// RandomForest.AttentionRatio; los modelos planos de la versión 1 no las tienen
+func (ff *FlatForest) AttentionRatio(att Atencion) (float64, bool) {
+	sum, trees := 0.0, 0
+	for i := 0; i < ff.numTrees; i++ {
+		node, ok := ff.leaf(i, att)
+		if !ok {
+			continue
+		}
+		if ratio := math.Float64frombits(binary.LittleEndian.Uint64(node[8:])); ratio > 0 {
+			sum += ratio
+			trees++
+		}
+	}
+	if trees == 0 {
+		return 0, false
+	}
+	return math.Round(sum/float64(trees)*100) / 100, true
+}
+
+// Función que describe el recorrido de un árbol del bosque plano
+func (ff *FlatForest) TracePath(tree int, att Atencion) (bool, []string) {
+	var path []string
+	index := int(binary.LittleEndian.Uint32(ff.data[flatHeaderSize+4*tree:]))
+	for steps := 0; steps <= ff.numNodes && index < ff.numNodes; steps++ {
+		node := ff.data[ff.nodesOff+flatNodeSize*index:]
+		if node[1]&flatLeaf != 0 {
+			return node[1]&flatPrediction != 0, path
+		}
+		if int(node[0]) >= len(ff.accessors) {
+			break
+		}
+		value := ff.accessors[node[0]](att)
+		threshold := int(int32(binary.LittleEndian.Uint32(node[4:])))
+		path = append(path, pathStep(ff.names[node[0]], value, threshold))
+		if value <= threshold {
+			index = int(binary.LittleEndian.Uint32(node[8:]))
+		} else {
+			index = int(binary.LittleEndian.Uint32(node[12:]))
+		}
+	}
+	return false, append(path, "modelo corrupto")
+}
+
+// Función que cuenta los votos a favor de congestión de todos los árboles
+func (ff *FlatForest) Vote(att Atencion) (votes, total int) {
+	for i := 0; i < ff.numTrees; i++ {
+		prediction, ok := ff.predictTree(i, att)
+		if !ok {
+			continue
+		}
+		total++
+		if prediction {
+			votes++
+		}
+	}
+	return votes, total
+}
+
+// Predicción del bosque plano, con la misma interfaz que RandomForest
+func (ff *FlatForest) Predict(establishment string, month int, day int) bool {
+	votes, total := ff.Vote(queryAtencion(ff.state.Pipeline, establishment, month, day))
+	return decideVote(votes, total, ff.state.Pipeline.tiePolicy()).Congested
+}
+
+// Función para liberar el archivo mapeado en memoria
+func (ff *FlatForest) Close() error {
+	if ff.release == nil {
+		return nil
+	}
+	err := ff.release(ff.data)
+	ff.data, ff.release = nil, nil
+	return err
+}
+
+// Función que descarga un modelo remoto completo a memoria
+func downloadFile(path string) ([]byte, func([]byte) error, error) {
+	r, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func([]byte) error { return nil }, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFlatModelRoundTrip(t *testing.T) {
+	rf, data := trainTestForest(t, 15)
+	path := filepath.Join(t.TempDir(), "modelo.tpfl")
+	if err := rf.SaveFlat(path); err != nil {
+		t.Fatal(err)
+	}
+	ff, err := OpenFlatModel(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+
+	if ff.NumTrees() != len(rf.Trees) {
+		t.Fatalf("árboles: %d, se esperaban %d", ff.NumTrees(), len(rf.Trees))
+	}
+	assertSameVotes(t, rf, ff, rf.Pipeline, data)
+	p := ff.QueryPipeline()
+	if p == nil || p.CongestionThreshold != rf.Pipeline.CongestionThreshold || !slices.Equal(p.Features, rf.Pipeline.Features) {
+		t.Fatalf("pipeline del modelo plano: %+v, se esperaba el del bosque", p)
+	}
+	sum, trainedAt := ff.TrainingMetadata()
+	if wantSum, wantAt := rf.TrainingMetadata(); sum != wantSum || !trainedAt.Equal(wantAt) {
+		t.Errorf("metadatos: %q %v, se esperaba %q %v", sum, trainedAt, wantSum, wantAt)
+	}
+	for _, att := range data[:50] {
+		query := queryAtencion(rf.Pipeline, att.NombreEstablecimiento, att.Mes, att.Dia)
+		want, wantOK := rf.AttentionRatio(query)
+		got, gotOK := ff.AttentionRatio(query)
+		if want != got || wantOK != gotOK {
+			t.Fatalf("atenciones por atendido: %g %v, se esperaba %g %v", got, gotOK, want, wantOK)
+		}
+	}
+}
+
+// Con características que se imputan al predecir, el modelo plano tiene que
+// usar los mismos promedios que el bosque
+func TestFlatModelPredictsLikeForest(t *testing.T) {
+	data, err := loadAtencionesTest(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf := &RandomForest{Seed: 3, Features: []string{"Mes", "Dia", "Atendidos"}, Threshold: 15}
+	rf.TrainTrees(data, 10)
+	path := filepath.Join(t.TempDir(), "modelo.tpfl")
+	if err := rf.SaveFlat(path); err != nil {
+		t.Fatal(err)
+	}
+	ff, err := OpenFlatModel(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	for _, att := range data {
+		if want, got := rf.Predict(att.NombreEstablecimiento, att.Mes, att.Dia), ff.Predict(att.NombreEstablecimiento, att.Mes, att.Dia); want != got {
+			t.Fatalf("predicción para %s %d/%d: %v, se esperaba %v", att.NombreEstablecimiento, att.Dia, att.Mes, got, want)
+		}
+	}
+}
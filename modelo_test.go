@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"path/filepath"
+	"testing"
+)
+
+func TestModelRoundTrip(t *testing.T) {
+	rf, data := trainTestForest(t, 15)
+	for _, name := range []string{"modelo.gob", "modelo.gob.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := rf.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadModel(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(loaded.Trees) != len(rf.Trees) {
+				t.Fatalf("árboles cargados: %d, se esperaban %d", len(loaded.Trees), len(rf.Trees))
+			}
+			if loaded.OOBError != rf.OOBError || loaded.DataSHA256 != rf.DataSHA256 {
+				t.Errorf("metadatos distintos: OOB %g y %q, se esperaba %g y %q", loaded.OOBError, loaded.DataSHA256, rf.OOBError, rf.DataSHA256)
+			}
+			assertSameVotes(t, rf, loaded, rf.Pipeline, data)
+		})
+	}
+}
+
+func TestReadModelRejectsInvalidIndexes(t *testing.T) {
+	leaf := savedRecord{Node: &savedNode{Left: -1, Right: -1, IsLeaf: true}}
+	cases := map[string]struct {
+		trees   int
+		records []savedRecord
+	}{
+		"raíz negativa":     {1, []savedRecord{leaf, {Root: -1}}},
+		"raíz inexistente":  {1, []savedRecord{leaf, {Root: 1}}},
+		"hijo negativo":     {1, []savedRecord{leaf, {Node: &savedNode{Feature: "Mes", Left: -1, Right: 0}}, {Root: 1}}},
+		"hijo inexistente":  {1, []savedRecord{leaf, {Node: &savedNode{Feature: "Mes", Left: 0, Right: 5}}, {Root: 1}}},
+		"hijos negativos":   {1, []savedRecord{{Node: &savedNode{Feature: "Mes", Left: -2, Right: -3}}, {Root: 0}}},
+		"raíz muy negativa": {1, []savedRecord{leaf, {Root: -1 << 31}}},
+		"árboles negativos": {-1, []savedRecord{leaf, {Root: 0}}},
+		"árboles de más":    {1 << 62, []savedRecord{leaf, {Root: 0}}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := gob.NewEncoder(&buf)
+			if err := enc.Encode(modelHeader{Magic: modelMagic, Version: modelVersion, Trees: c.trees}); err != nil {
+				t.Fatal(err)
+			}
+			for _, rec := range c.records {
+				if err := enc.Encode(rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := ReadModel(&buf); err == nil {
+				t.Fatal("se esperaba un error por el modelo corrupto")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import "math"
+
+// Predicción conjunta: además de la congestión, cada hoja guarda cuántas
+// atenciones hubo por paciente atendido entre sus filas (la intensidad de las
+// consultas repetidas). El personal necesario depende de las dos cosas: un día
+// con pocos pacientes pero muchas atenciones por paciente también satura. El
+// bosque promedia la razón de las hojas a las que cae la consulta. Los modelos
+// guardados antes de que existiera, los planos y los incrementales no la tienen.
+
+// Modelo que predice también las atenciones por atendido
+type ratioPredictor interface {
+	AttentionRatio(att Atencion) (ratio float64, ok bool)
+}
+
+// Función que calcula las atenciones por atendido de las filas de una hoja
+// (razón de las sumas, para que los días con pocos atendidos no pesen de más).
+// Se redondea a dos decimales, que alcanzan para planificar y permiten que el
+// modelo guardado reutilice las hojas iguales.
+func attentionRatio(data []Atencion) float64 {
+	attended, attentions := 0, 0
+	for _, att := range data {
+		attended += att.Atendidos
+		attentions += att.Atenciones
+	}
+	if attended == 0 {
+		return 0
+	}
+	return math.Round(float64(attentions)/float64(attended)*100) / 100
+}
+
+// Función que retorna la hoja a la que cae una consulta
+func (dt *DecisionTree) leaf(att Atencion) *Node {
+	node := dt.Root
+	for !node.IsLeaf {
+		accessor, _ := featureAccessor(node.Feature)
+		if accessor(att) <= node.Threshold {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node
+}
+
+// Función que promedia las atenciones por atendido de las hojas de la consulta.
+// Retorna false si ningún árbol la tiene.
+func (rf *RandomForest) AttentionRatio(att Atencion) (float64, bool) {
+	sum, trees := 0.0, 0
+	for _, tree := range rf.Trees {
+		if ratio := tree.leaf(att).Ratio; ratio > 0 {
+			sum += ratio
+			trees++
+		}
+	}
+	if trees == 0 {
+		return 0, false
+	}
+	return math.Round(sum/float64(trees)*100) / 100, true
+}
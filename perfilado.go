@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Perfilado con pprof sin modificar el código: -cpuprofile y -memprofile antes
+// de cualquier subcomando (o del menú) escriben el perfil de CPU de toda la
+// ejecución y el de memoria al terminar. Con TP_PPROF=<directorio> además cada
+// entrenamiento (train, la opción 2 del menú o un guion) guarda su propio par de
+// perfiles, que muestran solo la construcción de los árboles. Se ven con
+// go tool pprof -http=:8080 <binario> <perfil>, que incluye el flame graph.
+
+// Archivos de los perfiles de toda la ejecución (vacío = no perfilar)
+var cpuProfilePath, memProfilePath string
+
+// Archivo del perfil de CPU en curso
+var cpuProfileFile *os.File
+
+// Función que empieza el perfil de CPU de toda la ejecución, si se pidió
+func startProfiling() error {
+	if cpuProfilePath == "" {
+		return nil
+	}
+	file, err := os.Create(cpuProfilePath)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+	cpuProfileFile = file
+	return nil
+}
+
+// Función que termina el perfil de CPU y escribe el de memoria, si se pidieron
+func stopProfiling() error {
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		if err := cpuProfileFile.Close(); err != nil {
+			return err
+		}
+		cpuProfileFile = nil
+	}
+	if memProfilePath == "" {
+		return nil
+	}
+	return writeHeapProfile(memProfilePath)
+}
+
+// Función que escribe el perfil de memoria: las asignaciones vivas después de
+// un GC y, con -sample_index=alloc_space, todas las hechas desde el inicio
+func writeHeapProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Función que empieza a perfilar una etapa si TP_PPROF indica un directorio.
+// Retorna la función que la termina y escribe <etapa>-<fecha>.cpu.pprof y
+// .mem.pprof; los errores solo se informan, para no interrumpir la etapa.
+func profileStep(step string) (stop func()) {
+	dir := os.Getenv("TP_PPROF")
+	if dir == "" {
+		return func() {}
+	}
+	base := filepath.Join(dir, step+"-"+time.Now().Format("20060102-150405"))
+	report := func(err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "No se pudo perfilar %s: %v\n", step, err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		report(err)
+		return func() {}
+	}
+
+	// Con -cpuprofile la CPU ya se está perfilando y solo puede haber un perfil
+	// a la vez; la etapa queda en el perfil de toda la ejecución
+	var cpuFile *os.File
+	if cpuProfileFile == nil {
+		file, err := os.Create(base + ".cpu.pprof")
+		if err == nil {
+			if err = pprof.StartCPUProfile(file); err != nil {
+				file.Close()
+			} else {
+				cpuFile = file
+			}
+		}
+		report(err)
+	}
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			report(cpuFile.Close())
+		}
+		report(writeHeapProfile(base + ".mem.pprof"))
+		fmt.Fprintf(os.Stderr, "Perfiles de %s guardados en %s.*.pprof\n", step, base)
+	}
+}
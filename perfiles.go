@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Perfiles de uso: los analistas pueden entrenar, ajustar, evaluar y publicar
+// modelos; los operadores solo pueden procesar registros y predecir, para que
+// nadie sin la formación necesaria reemplace por accidente el modelo de
+// producción. En la línea de comandos el perfil se elige con -perfil (o
+// TP_PERFIL) antes del subcomando; en el servidor viene de la clave de API o
+// del claim "rol" de un JWT.
+
+// Perfil de un usuario
+type Role string
+
+const (
+	RoleAnalyst  Role = "analista"
+	RoleOperator Role = "operador"
+)
+
+// Función que interpreta el nombre de un perfil (vacío = analista)
+func ParseRole(name string) (Role, error) {
+	switch Role(name) {
+	case "", RoleAnalyst:
+		return RoleAnalyst, nil
+	case RoleOperator:
+		return RoleOperator, nil
+	}
+	return "", fmt.Errorf("perfil desconocido %q (analista u operador)", name)
+}
+
+// Acción sujeta a permisos
+type Action int
+
+const (
+	ActionLoadData Action = iota // Procesar, filtrar y verificar registros
+	ActionPredict                // Predecir y consultar modelos y trabajos
+	ActionTrain                  // Entrenar, agregar árboles, ajustar y evaluar
+	ActionPublish                // Guardar, cargar, combinar o promover modelos
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionLoadData:
+		return "procesar registros"
+	case ActionPredict:
+		return "predecir"
+	case ActionTrain:
+		return "entrenar o evaluar modelos"
+	}
+	return "publicar modelos"
+}
+
+// Función que indica si el perfil puede realizar la acción
+func (r Role) Can(action Action) bool {
+	if r == RoleOperator {
+		return action == ActionLoadData || action == ActionPredict
+	}
+	return true
+}
+
+// Función que retorna un error si el perfil no puede realizar la acción
+func (r Role) check(action Action) error {
+	if !r.Can(action) {
+		return fmt.Errorf("el perfil %s no puede %s", r, action)
+	}
+	return nil
+}
+
+// Perfil de este proceso, elegido con -perfil o TP_PERFIL
+var profile = RoleAnalyst
+
+// Función que toma las opciones globales que preceden al subcomando, en
+// cualquier orden: -perfil (o la variable TP_PERFIL), las de perfilado de CPU y
+// memoria y -extensiones (o TP_EXTENSIONES), los plugins de características que
+// se cargan antes del subcomando. Retorna los argumentos restantes.
+func parseGlobalFlags(args []string) ([]string, error) {
+	name := os.Getenv("TP_PERFIL")
+	plugins := os.Getenv("TP_EXTENSIONES")
+	globals := map[string]*string{"perfil": &name, "cpuprofile": &cpuProfilePath, "memprofile": &memProfilePath, "extensiones": &plugins}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		target, ok := globals[flagName]
+		if !ok {
+			break // Opción del menú o del subcomando
+		}
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("falta el valor de -%s", flagName)
+			}
+			value, args = args[0], args[1:]
+		}
+		*target = value
+	}
+	role, err := ParseRole(name)
+	if err != nil {
+		return nil, err
+	}
+	profile = role
+	if err := loadFeaturePlugins(plugins); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// Función que retorna el perfil de la petición
+func roleFrom(ctx context.Context) Role {
+	if role, ok := ctx.Value(roleKey).(Role); ok {
+		return role
+	}
+	return profile // Sin autenticación rige el perfil del proceso
+}
+
+// Función que envuelve un handler para que solo lo usen los perfiles que
+// pueden realizar la acción
+func requireAction(action Action, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := roleFrom(r.Context()).check(action); err != nil {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Claims que se leen de un JWT
+type jwtClaims struct {
+	Subject string `json:"sub"`
+	Tenant  string `json:"inquilino"` // Debe existir si el servidor usa inquilinos
+	Role    string `json:"rol"`
+	Expires int64  `json:"exp"` // Segundos Unix (0 = no vence)
+}
+
+// Función que indica si el token tiene la forma de un JWT
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Función que verifica la firma HS256 y el vencimiento de un JWT y retorna sus claims
+func verifyJWT(token string, secret []byte) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("JWT mal formado")
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, errors.New("JWT mal formado")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil || header.Alg != "HS256" {
+		return claims, errors.New("JWT con algoritmo no soportado (se espera HS256)")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errors.New("JWT mal formado")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return claims, errors.New("firma del JWT inválida")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, errors.New("JWT mal formado")
+	}
+	if claims.Expires != 0 && time.Now().Unix() >= claims.Expires {
+		return claims, errors.New("JWT vencido")
+	}
+	return claims, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Prioridades del servidor: las predicciones individuales (GET /predict, que
+// esperan el menú y las páginas) no deben quedar detrás del proceso nocturno.
+// Toda la CPU del servidor se reparte en ranuras: cada árbol de un
+// reentrenamiento y cada consulta de un lote ocupan una mientras se calculan,
+// y al liberarse una ranura la toma primero una predicción interactiva que
+// esté esperando. Además el trabajo en segundo plano (lotes y entrenamientos)
+// nunca ocupa las ranuras reservadas, de modo que una predicción interactiva
+// no espera a que termine un árbol. Las ranuras se toman del contexto: fuera
+// del servidor (train, predict-batch, el menú) no hay planificador y todo
+// corre sin esperar.
+
+// Prioridad de un trabajo
+type workPriority int
+
+const (
+	priorityInteractive workPriority = iota // Predicciones individuales
+	priorityBackground                      // Lotes y entrenamientos
+)
+
+// Nombres de las prioridades para las métricas
+var workPriorityNames = [...]string{"interactiva", "segundo_plano"}
+
+// Espera por una ranura, por prioridad
+var schedulerWait = NewHistogramVec("tp_planificador_espera_segundos",
+	"Espera por una ranura de CPU del servidor, por prioridad",
+	[]float64{0.0001, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}, "prioridad")
+
+// Planificador de ranuras con prioridad
+type workScheduler struct {
+	mu       sync.Mutex
+	slots    int                // Ranuras en total
+	reserved int                // Ranuras que solo usan las predicciones interactivas
+	busy     int                // Ranuras ocupadas
+	waiting  [2][]chan struct{} // Trabajos esperando, por prioridad y en orden de llegada
+}
+
+// Función que crea un planificador con slots ranuras (0 = número de CPUs), de
+// las que reserved quedan para las predicciones interactivas (-1 = una cuarta
+// parte, al menos una)
+func newWorkScheduler(slots, reserved int) *workScheduler {
+	if slots <= 0 {
+		slots = runtime.GOMAXPROCS(0)
+	}
+	if reserved < 0 {
+		reserved = max(1, slots/4)
+	}
+	return &workScheduler{slots: max(slots, 2), reserved: min(reserved, max(slots, 2)-1)}
+}
+
+// Función que indica si hay una ranura libre para la prioridad; se llama con el lock tomado
+func (s *workScheduler) available(p workPriority) bool {
+	if p == priorityBackground {
+		return s.busy < s.slots-s.reserved
+	}
+	return s.busy < s.slots
+}
+
+// Función que espera una ranura y retorna la función que la libera. Si ctx se
+// cancela antes, retorna la causa.
+func (s *workScheduler) acquire(ctx context.Context, p workPriority) (func(), error) {
+	start := time.Now()
+	s.mu.Lock()
+	// Se respeta el orden: nadie se adelanta a los que esperan con su misma prioridad o una mayor
+	if s.available(p) && !s.queuedAhead(p) {
+		s.busy++
+		s.mu.Unlock()
+		schedulerWait.Observe(0, workPriorityNames[p])
+		return s.release, nil
+	}
+	ready := make(chan struct{})
+	s.waiting[p] = append(s.waiting[p], ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		schedulerWait.Observe(time.Since(start).Seconds(), workPriorityNames[p])
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, c := range s.waiting[p] {
+			if c == ready {
+				s.waiting[p] = append(s.waiting[p][:i], s.waiting[p][i+1:]...)
+				return nil, context.Cause(ctx)
+			}
+		}
+		// La ranura llegó junto con la cancelación: se devuelve
+		s.busy--
+		s.wake()
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Indica si hay trabajos esperando con la misma prioridad o una mayor; se llama con el lock tomado
+func (s *workScheduler) queuedAhead(p workPriority) bool {
+	for q := priorityInteractive; q <= p; q++ {
+		if len(s.waiting[q]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Función que libera una ranura
+func (s *workScheduler) release() {
+	s.mu.Lock()
+	s.busy--
+	s.wake()
+	s.mu.Unlock()
+}
+
+// Función que entrega las ranuras libres a los que esperan, primero a las
+// predicciones interactivas; se llama con el lock tomado
+func (s *workScheduler) wake() {
+	for p := range s.waiting {
+		for len(s.waiting[p]) > 0 && s.available(workPriority(p)) {
+			s.busy++
+			close(s.waiting[p][0])
+			s.waiting[p] = s.waiting[p][1:]
+		}
+	}
+}
+
+// Clave del contexto con el planificador y la prioridad del trabajo
+type workPriorityKey struct{}
+
+// Planificador y prioridad guardados en el contexto
+type scheduledWork struct {
+	scheduler *workScheduler
+	priority  workPriority
+}
+
+// Función que retorna un contexto cuyo trabajo toma ranuras del planificador
+// con la prioridad indicada (un planificador nil no limita nada)
+func withWorkPriority(ctx context.Context, s *workScheduler, p workPriority) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, workPriorityKey{}, scheduledWork{s, p})
+}
+
+// Función que espera una ranura para el trabajo del contexto y retorna la
+// función que la libera; sin planificador en el contexto no espera
+func acquireWork(ctx context.Context) (func(), error) {
+	work, ok := ctx.Value(workPriorityKey{}).(scheduledWork)
+	if !ok {
+		return func() {}, nil
+	}
+	return work.scheduler.acquire(ctx, work.priority)
+}
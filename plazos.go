@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Plazos de las operaciones largas (entrenar, predecir por lote, evaluar): la
+// operación corre con un contexto que vence al cumplirse el plazo y deja de
+// repartir trabajo nuevo (el árbol o la consulta en curso termina). Qué pasa
+// con lo completado lo decide la política: fallar descarta el resultado y
+// termina con código 7; parcial conserva lo que alcanzó a terminar (los árboles
+// ya entrenados, los bloques ya escritos, los registros ya evaluados).
+
+// Políticas al vencer el plazo
+const (
+	onTimeoutFail    = "fallar"
+	onTimeoutPartial = "parcial"
+)
+
+// Error con el que se cancela una operación que superó su plazo
+type timeoutError struct {
+	Operation string
+	Limit     time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s superó el plazo de %v", e.Operation, e.Limit)
+}
+
+func (e *timeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// Plazo de una operación y política al vencer
+type OperationTimeout struct {
+	Operation string        // Nombre de la operación para los mensajes
+	Limit     time.Duration // Tiempo máximo (0 = sin plazo)
+	Policy    string        // fallar o parcial
+}
+
+// Función que define las opciones -plazo y -al-vencer de un subcomando; kept
+// describe lo que se conserva con la política parcial
+func (t *OperationTimeout) register(fs *flag.FlagSet, operation, kept string) {
+	t.Operation = operation
+	fs.DurationVar(&t.Limit, "plazo", 0, "tiempo máximo de "+operation+", p. ej. 30m (0 = sin límite)")
+	fs.StringVar(&t.Policy, "al-vencer", onTimeoutFail, "al vencer el plazo: fallar o parcial (conservar "+kept+")")
+}
+
+// Función que valida el plazo y la política
+func (t OperationTimeout) check() error {
+	if t.Limit < 0 {
+		return fmt.Errorf("plazo inválido: %v", t.Limit)
+	}
+	if t.Policy != onTimeoutFail && t.Policy != onTimeoutPartial {
+		return fmt.Errorf("política al vencer el plazo inválida: %q (fallar o parcial)", t.Policy)
+	}
+	return nil
+}
+
+// Función que retorna un contexto que se cancela al vencer el plazo, con un
+// timeoutError como causa
+func (t OperationTimeout) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.Limit <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, t.Limit, &timeoutError{Operation: t.Operation, Limit: t.Limit})
+}
+
+// Función que indica si err es el vencimiento del plazo y la política pide
+// conservar lo completado
+func (t OperationTimeout) partial(err error) bool {
+	return t.Policy == onTimeoutPartial && timedOut(err)
+}
+
+// Función que retorna el plazo de un pedido al servidor: el del servidor, uno
+// menor si el pedido lo indica y la política del pedido si la trae
+func (t OperationTimeout) request(limit, policy string) (OperationTimeout, error) {
+	if limit != "" {
+		d, err := time.ParseDuration(limit)
+		if err != nil || d <= 0 {
+			return t, fmt.Errorf("plazo inválido: %q", limit)
+		}
+		if t.Limit > 0 && d > t.Limit {
+			return t, fmt.Errorf("el plazo %v supera el máximo del servidor (%v)", d, t.Limit)
+		}
+		t.Limit = d
+	}
+	if policy != "" {
+		t.Policy = policy
+	}
+	return t, t.check()
+}
+
+// Función que indica si err viene del vencimiento de un plazo
+func timedOut(err error) bool {
+	var timeout *timeoutError
+	return errors.As(err, &timeout)
+}
+
+// Función que asocia a err el código de salida del plazo vencido si lo es, o
+// code si no
+func withTimeoutExitCode(code int, err error) error {
+	if timedOut(err) {
+		code = exitTimeout
+	}
+	return withExitCode(code, err)
+}
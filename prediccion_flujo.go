@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// Predicción por lote en flujo: POST /predict/batch lee las consultas del
+// cuerpo de a bloques y escribe cada bloque de resultados apenas se calcula,
+// una línea JSON por consulta y en el mismo orden, sin armar la respuesta
+// entera en memoria. El cliente empieza a leer con el primer bloque y la
+// memoria del servidor queda acotada por el tamaño del bloque, no por el del
+// lote. Como el estado 200 ya se envió, un error a mitad del lote se informa
+// con una última línea {"error": "..."}.
+
+// Filas por bloque por defecto y máximo
+const (
+	streamChunkRows    = 1000
+	maxStreamChunkRows = 100000
+)
+
+// Predicciones entregadas en flujo
+var streamPredictions = NewCounterVec("tp_lote_predicciones_total",
+	"Predicciones entregadas por POST /predict/batch", "modelo")
+
+// Consulta de una línea del cuerpo en NDJSON
+type streamQuery struct {
+	Establishment string `json:"establecimiento"`
+	Month         int    `json:"mes"`
+	Day           int    `json:"dia"`
+	Atendidos     *int   `json:"atendidos,omitempty"`  // Valor conocido que reemplaza al imputado
+	Atenciones    *int   `json:"atenciones,omitempty"` // Valor conocido que reemplaza al imputado
+	Citas         *int   `json:"citas,omitempty"`      // Citas programadas, si no salen de la agenda del servidor
+}
+
+// Resultado de una línea de la respuesta
+type streamResult struct {
+	Establishment string `json:"establecimiento"`
+	Month         int    `json:"mes"`
+	Day           int    `json:"dia"`
+	Congested     bool   `json:"congestionado"`
+	Votes         int    `json:"votos"`
+	Trees         int    `json:"arboles"`
+	Tie           string `json:"empate,omitempty"`       // Política con la que se resolvió un empate
+	Abstained     bool   `json:"sin_decision,omitempty"` // Empate sin decisión, con empates=abstenerse
+	Fallback      string `json:"desconocido,omitempty"`  // Respaldo si el establecimiento no estaba en el entrenamiento
+	Caveat        string `json:"advertencia,omitempty"`  // Si los datos del establecimiento son de baja calidad
+}
+
+// Origen de consultas que lee un objeto JSON por línea
+type ndjsonQueries struct {
+	dec  *json.Decoder
+	line int
+}
+
+// Función que lee hasta n consultas; retorna io.EOF cuando no quedan más
+func (q *ndjsonQueries) next(n int) ([]batchQuery, error) {
+	queries := make([]batchQuery, 0, n)
+	for len(queries) < n {
+		var query streamQuery
+		err := q.dec.Decode(&query)
+		if err == io.EOF {
+			if len(queries) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		q.line++
+		if err != nil {
+			return nil, fmt.Errorf("consulta %d: %w", q.line, err)
+		}
+		if query.Month < 1 || query.Month > 12 {
+			return nil, fmt.Errorf("consulta %d: mes inválido %d", q.line, query.Month)
+		}
+		if query.Day < 1 || query.Day > 31 {
+			return nil, fmt.Errorf("consulta %d: día inválido %d", q.line, query.Day)
+		}
+		values := map[string]*int{"atendidos": query.Atendidos, "atenciones": query.Atenciones, "citas": query.Citas}
+		known, err := parseKnownValues(func(name string) string {
+			if v := values[name]; v != nil {
+				return strconv.Itoa(*v)
+			}
+			return ""
+		})
+		if err != nil {
+			return nil, fmt.Errorf("consulta %d: %w", q.line, err)
+		}
+		queries = append(queries, batchQuery{Establishment: query.Establishment, Month: query.Month, Day: query.Day, Known: known})
+	}
+	return queries, nil
+}
+
+// Función que retorna el origen de consultas según el tipo del cuerpo: CSV
+// con la cabecera de predict-batch si es text/csv, NDJSON si no
+func streamQuerySource(r *http.Request) (querySource, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		return newQueryReader(r.Body)
+	}
+	return &ndjsonQueries{dec: json.NewDecoder(r.Body)}, nil
+}
+
+// POST /predict/batch?modelo=...&bloque=n[&empates=]: predice las consultas
+// del cuerpo (NDJSON, o CSV con Content-Type text/csv) y responde en NDJSON a
+// medida que se calculan los bloques
+func (s *server) handlePredictStream(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("modelo")
+	if name == "" {
+		name = defaultModelName
+	}
+	chunkRows := streamChunkRows
+	if value := r.URL.Query().Get("bloque"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxStreamChunkRows {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("bloque inválido: %q (entre 1 y %d)", value, maxStreamChunkRows))
+			return
+		}
+		chunkRows = n
+	}
+	ties, err := ParseTiePolicy(r.URL.Query().Get("empates"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if s.rejectDraining(w) {
+		return
+	}
+	s.predicting.Add(1)
+	defer s.predicting.Add(-1)
+
+	tenant := tenantFrom(r.Context())
+	entry, release, err := tenant.registry.Acquire(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	defer release()
+
+	queries, err := streamQuerySource(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Con HTTP/1.1 el servidor deja de leer el cuerpo al empezar la respuesta
+	// si no se pide lo contrario (con HTTP/2 no hace falta y falla sin efecto)
+	controller := http.NewResponseController(w)
+	controller.EnableFullDuplex()
+
+	ctx := withWorkPriority(r.Context(), s.scheduler, priorityBackground) // Detrás de las predicciones individuales
+	pipeline := pipelineFor(entry.Model, s.pipeline)
+	if r.URL.Query().Get("empates") != "" {
+		pipeline = withTiePolicy(pipeline, ties)
+	}
+	label := tenant.label(entry.Name)
+	enc := json.NewEncoder(w)
+	written := 0
+	for {
+		chunk, err := queries.next(chunkRows)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			endStream(w, written, err)
+			return
+		}
+		s.bookings.fillQueries(chunk, 0)
+		results, err := predictBatchContext(ctx, entry.Model, pipeline, chunk, 0)
+		if err != nil {
+			return // El cliente se fue
+		}
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			newModelMetadata(entry.Model, entry.Fingerprint).setHeaders(w.Header())
+		}
+		for _, result := range results {
+			q := result.Query
+			if err := enc.Encode(streamResult{q.Establishment, q.Month, q.Day, result.Congested, result.Votes, result.Trees, result.Tie, result.Abstained, result.Fallback, result.Caveat}); err != nil {
+				return
+			}
+		}
+		written += len(results)
+		streamPredictions.Add(float64(len(results)), label)
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+	if written == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson") // Lote vacío: respuesta vacía
+		w.WriteHeader(http.StatusOK)
+	}
+	logf(ctx, "Modelo %s: %d predicciones en flujo", label, written)
+}
+
+// Función que informa un error de las consultas: con el código de estado si
+// todavía no se escribió nada, o con una última línea si no
+func endStream(w http.ResponseWriter, written int, err error) {
+	if written == 0 {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "respondidas": written})
+}
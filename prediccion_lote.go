@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Consulta de una predicción por lote
+type batchQuery struct {
+	Establishment string
+	Month, Day    int
+	Tags          *dateTags   // Calendario de la fecha, solo al expandir un rango
+	Known         knownValues // Valores que reemplazan a los imputados (nil = ninguno)
+}
+
+// Origen de las consultas de predict-batch: un CSV o un rango de fechas
+type querySource interface {
+	next(n int) ([]batchQuery, error)
+}
+
+// Resultado de una predicción por lote
+type batchResult struct {
+	Query     batchQuery
+	Congested bool
+	Votes     int
+	Trees     int
+	Tie       string         // Política con la que se resolvió un empate ("" si no hubo)
+	Abstained bool           // Empate sin decisión: Congested no vale
+	Fallback  string         // Respaldo usado si el establecimiento no estaba en el entrenamiento ("" si estaba)
+	Caveat    string         // Advertencia si los datos del establecimiento son de baja calidad
+	Detail    *VoteBreakdown // Desglose de los votos, con -detalle (nil = sin columnas de desglose)
+	Model     *ModelMetadata // Modelo que hizo la predicción (nil = sin columnas de metadatos)
+}
+
+// Función que predice un conjunto de consultas con un grupo fijo de workers.
+// Los resultados quedan en el mismo orden que las consultas.
+func predictBatch(model Predictor, p *Pipeline, queries []batchQuery, workers int) []batchResult {
+	results, _ := predictBatchContext(context.Background(), model, p, queries, workers)
+	return results
+}
+
+// Igual que predictBatch, pero deja de repartir consultas cuando se cancela
+// ctx y retorna la causa; las consultas sin predecir quedan vacías
+func predictBatchContext(ctx context.Context, model Predictor, p *Pipeline, queries []batchQuery, workers int) ([]batchResult, error) {
+	results := make([]batchResult, len(queries))
+	err := predictBatchEach(ctx, model, p, queries, workers, func(_, i int, r batchResult) {
+		results[i] = r
+	})
+	return results, err
+}
+
+// Función que retorna el número de workers de predicción (0 = número de CPUs)
+func batchWorkers(workers int) int {
+	if workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return workers
+}
+
+// Función que predice las consultas con un grupo fijo de workers y entrega el
+// resultado de la consulta i a fn, junto con el número del worker que lo
+// calculó (de 0 a workers-1) para que cada uno acumule en lo suyo sin bloqueos.
+// Si ctx se cancela no se reparten más consultas y se retorna la causa. En el
+// servidor cada consulta toma una ranura del planificador (ver planificador.go).
+func predictBatchEach(ctx context.Context, model Predictor, p *Pipeline, queries []batchQuery, workers int, fn func(worker, i int, r batchResult)) error {
+	workers = batchWorkers(workers)
+	indexes := make(chan int, workers) // Índices de consultas pendientes
+
+	var wg sync.WaitGroup
+	var skipped atomic.Bool // Consultas repartidas que no se predijeron por la cancelación
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				release, err := acquireWork(ctx)
+				if err != nil {
+					skipped.Store(true)
+					continue
+				}
+				q := queries[i]
+				att := q.Known.apply(queryAtencion(p, q.Establishment, q.Month, q.Day))
+				votes, total, fallback := voteQuery(model, p, q.Establishment, att)
+				release()
+				decision := decideVote(votes, total, p.tiePolicy())
+				fn(w, i, batchResult{Query: q, Congested: decision.Congested, Votes: votes, Trees: total,
+					Tie: decision.tieLabel(p.tiePolicy()), Abstained: decision.Abstained, Fallback: fallback, Caveat: p.Caveat(q.Establishment)})
+			}
+		}()
+	}
+	sent := 0
+feed:
+	for ; sent < len(queries); sent++ {
+		select {
+		case indexes <- sent:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if sent < len(queries) || skipped.Load() {
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+// Manifiesto de progreso de una predicción por lote. Se actualiza después de
+// cada bloque escrito, de modo que una ejecución interrumpida pueda reanudarse.
+type batchManifest struct {
+	Input       string    `json:"entrada"`
+	Model       string    `json:"modelo"`
+	ChunkSize   int       `json:"tamano_bloque"`
+	Detail      bool      `json:"detalle,omitempty"` // Con las columnas de -detalle
+	Chunks      int       `json:"bloques_completados"`
+	RowsRead    int       `json:"filas_leidas"`
+	OutputBytes int64     `json:"bytes_salida"`
+	Complete    bool      `json:"completo"`
+	Updated     time.Time `json:"actualizado"`
+}
+
+// Función que lee el manifiesto; retorna nil si no existe
+func readManifest(path string) (*batchManifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m batchManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("manifiesto inválido: %w", err)
+	}
+	return &m, nil
+}
+
+// Función que guarda el manifiesto de forma atómica (archivo temporal y rename)
+func (m *batchManifest) save(path string) error {
+	m.Updated = time.Now()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Lector de consultas de un CSV con columnas establecimiento, mes y dia, y
+// opcionalmente atendidos, atenciones y citas con valores conocidos
+type queryReader struct {
+	reader                    *csv.Reader
+	establishment, month, day int            // Posición de cada columna
+	known                     map[string]int // Posición de las columnas de valores conocidos, por nombre
+}
+
+// Función que crea un lector de consultas ubicando las columnas por la cabecera
+func newQueryReader(r io.Reader) (*queryReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la cabecera: %w", err)
+	}
+
+	qr := &queryReader{reader: reader, establishment: -1, month: -1, day: -1}
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "establecimiento", "nombre_establecimiento", "nombre_estaclecimiento":
+			qr.establishment = i
+		case "mes":
+			qr.month = i
+		case "dia", "día":
+			qr.day = i
+		case "atendidos", "atenciones", "citas":
+			if qr.known == nil {
+				qr.known = make(map[string]int)
+			}
+			qr.known[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+	}
+	if qr.establishment < 0 || qr.month < 0 || qr.day < 0 {
+		return nil, errors.New("la cabecera debe tener las columnas establecimiento, mes y dia")
+	}
+	return qr, nil
+}
+
+// Función que lee hasta n consultas; retorna io.EOF cuando no quedan más
+func (qr *queryReader) next(n int) ([]batchQuery, error) {
+	queries := make([]batchQuery, 0, n)
+	for len(queries) < n {
+		record, err := qr.reader.Read()
+		if err == io.EOF {
+			if len(queries) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		month, err := strconv.Atoi(record[qr.month])
+		if err != nil {
+			return nil, fmt.Errorf("mes inválido %q: %w", record[qr.month], err)
+		}
+		day, err := strconv.Atoi(record[qr.day])
+		if err != nil {
+			return nil, fmt.Errorf("día inválido %q: %w", record[qr.day], err)
+		}
+		known, err := parseKnownValues(func(name string) string {
+			if i, ok := qr.known[name]; ok {
+				return record[i]
+			}
+			return ""
+		})
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, batchQuery{Establishment: record[qr.establishment], Month: month, Day: day, Known: known})
+	}
+	return queries, nil
+}
+
+// Cabecera del archivo de resultados
+var batchOutputHeader = []string{"establecimiento", "mes", "dia", "congestionado", "votos", "arboles", "desconocido", "advertencia", "empate"}
+
+// Función que convierte un resultado en una fila del CSV de salida; las
+// consultas de un rango agregan las columnas de calendario, -detalle las del
+// desglose de los votos y, al final, van los metadatos del modelo. Un empate
+// sin decisión deja vacía la columna congestionado.
+func (r batchResult) record() []string {
+	congested := strconv.FormatBool(r.Congested)
+	if r.Abstained {
+		congested = ""
+	}
+	record := []string{
+		r.Query.Establishment,
+		strconv.Itoa(r.Query.Month),
+		strconv.Itoa(r.Query.Day),
+		congested,
+		strconv.Itoa(r.Votes),
+		strconv.Itoa(r.Trees),
+		r.Fallback,
+		r.Caveat,
+		r.Tie,
+	}
+	if r.Query.Tags != nil {
+		record = append(record, r.Query.Tags.record()...)
+	}
+	if r.Detail != nil {
+		record = append(record, r.Detail.record()...)
+	}
+	if r.Model != nil {
+		record = append(record, r.Model.record()...)
+	}
+	return record
+}
+
+// Subcomando "predict-batch": predice todas las consultas de un CSV escribiendo
+// los resultados por bloques. Si se interrumpe, volver a ejecutarlo con los mismos
+// argumentos continúa desde el último bloque completado.
+func predictBatchCommand(args []string) error {
+	fs := flag.NewFlagSet("predict-batch", flag.ContinueOnError)
+	modelPath := fs.String("modelo", "modelo.gob.gz", "archivo del modelo")
+	input := fs.String("entrada", "", "CSV con las columnas establecimiento, mes y dia")
+	from := fs.String("desde", "", "en lugar de -entrada, primera fecha del rango a predecir (AAAA-MM-DD)")
+	to := fs.String("hasta", "", "última fecha del rango (AAAA-MM-DD)")
+	establishmentList := fs.String("establecimientos", "", "establecimientos del rango separados por comas (vacío = los del pipeline del modelo)")
+	holidaysPath := fs.String("feriados", "", "CSV con las columnas fecha y nombre de los feriados, para etiquetar el rango")
+	output := fs.String("salida", "predicciones.csv", "CSV de resultados")
+	chunkSize := fs.Int("bloque", 10000, "filas por bloque entre puntos de control")
+	workers := fs.Int("workers", 0, "goroutines de predicción (0 = número de CPUs)")
+	retries := fs.Int("reintentos", 3, "reintentos por bloque si falla la escritura")
+	restart := fs.Bool("reiniciar", false, "ignorar el progreso guardado y empezar de cero")
+	allowLeakage := fs.Bool("permitir-fuga", false, "usar un modelo que divide por características que no se conocen al predecir")
+	allowSchema := fs.Bool("permitir-esquema", false, "usar un modelo cuyo esquema no coincide con el del histórico")
+	historyPath := fs.String("historico", "", "CSV de atenciones para armar el pipeline si el modelo no trae el suyo")
+	bookingsPath := fs.String("citas", "", "agenda de citas programadas (CSV o conexión SQL) para las consultas sin columna citas")
+	bookingsTable := fs.String("tabla-citas", defaultBookingsTable, "tabla de la agenda con una conexión SQL en -citas")
+	var writerOpts WriterOptions
+	fs.IntVar(&writerOpts.Workers, "escritores", 0, "goroutines que formatean la salida (0 = número de CPUs)")
+	fs.IntVar(&writerOpts.Pending, "pendientes", 0, "sub-bloques formateados en espera de escritura (0 = 2 por escritor)")
+	fs.IntVar(&writerOpts.BufferSize, "buffer", 1<<20, "tamaño en bytes del buffer de escritura")
+	sqlConn := fs.String("sql", "", "escribir en una base de datos en lugar de -salida (postgres://..., mysql://... o sqlite:ruta.db)")
+	tableName := fs.String("tabla", "predicciones", "tabla de resultados con -sql")
+	year := fs.Int("anio", time.Now().Year(), "año de las fechas que se guardan con -sql")
+	modelVersion := fs.String("version-modelo", "", "versión del modelo que se guarda en cada predicción (vacío = inicio del SHA-256 del modelo)")
+	detail := fs.Bool("detalle", false, "agregar los votos sin congestión, los árboles que no votaron, el margen y, con hasta 200 árboles, el voto de cada uno")
+	ties := fs.String("empates", "", "decisión ante un empate en la votación: optimista, pesimista, azar o abstenerse (vacío = la del modelo)")
+	var timeout OperationTimeout
+	timeout.register(fs, "la predicción", "los bloques ya escritos, que se reanudan al repetir el comando")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := timeout.check(); err != nil {
+		return err
+	}
+	ranged := *from != "" || *to != ""
+	switch {
+	case ranged && *input != "":
+		return errors.New("-entrada y -desde/-hasta son alternativas; usa solo una")
+	case ranged && (*from == "" || *to == ""):
+		return errors.New("el rango necesita -desde y -hasta")
+	case !ranged && *input == "":
+		return errors.New("falta el archivo de entrada (-entrada) o el rango (-desde y -hasta)")
+	}
+	outputSet := false
+	fs.Visit(func(f *flag.Flag) { outputSet = outputSet || f.Name == "salida" })
+	if *sqlConn != "" && outputSet {
+		return errors.New("-sql reemplaza a -salida; usa solo una")
+	}
+	if *sqlConn != "" && *detail {
+		return errors.New("-detalle solo se puede usar con -salida")
+	}
+	tiePolicy, err := ParseTiePolicy(*ties)
+	if err != nil {
+		return err
+	}
+	// Una salida remota se escribe primero en un archivo local, que conserva el
+	// manifiesto para poder reanudar, y se sube cuando la predicción termina
+	remoteOutput := ""
+	if isRemote(*output) {
+		remoteOutput, *output = *output, path.Base(*output)
+	}
+
+	model, err := OpenModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+	history, err := loadPipeline(*historyPath)
+	if err != nil {
+		return err
+	}
+	pipeline := pipelineFor(model, history)
+	if *ties != "" {
+		pipeline = withTiePolicy(pipeline, tiePolicy)
+	}
+	if *sqlConn != "" && pipeline.tiePolicy() == tieAbstain {
+		return errors.New("los empates sin decisión solo se pueden escribir con -salida; usa otra política con -empates")
+	}
+	if err := checkLeakage(model, pipeline); err != nil {
+		if !*allowLeakage {
+			return fmt.Errorf("%w; usa -permitir-fuga para predecir igualmente", err)
+		}
+		log.Printf("Advertencia: %v", err)
+	}
+	if err := reportSchema(checkSchema(model, history), *allowSchema); err != nil {
+		return err
+	}
+
+	version := *modelVersion
+	if version == "" {
+		if version, err = modelFingerprint(*modelPath); err != nil {
+			return err
+		}
+	}
+	metadata := newModelMetadata(model, version)
+	fmt.Printf("Modelo: %s\n", metadata)
+
+	// Con -sql los bloques van a la tabla y el manifiesto queda junto a su nombre
+	destination, manifestPath := *output, *output+".manifest.json"
+	var table *sqlTable
+	if *sqlConn != "" {
+		if table, err = openSQLTable(context.Background(), *sqlConn, *tableName, *year, version); err != nil {
+			return err
+		}
+		defer table.Close()
+		destination, manifestPath = "la tabla "+*tableName, *tableName+".manifest.json"
+	}
+
+	// Recuperar el progreso de una ejecución anterior con los mismos parámetros
+	source := *input
+	if ranged {
+		source = fmt.Sprintf("%s a %s (%s)", *from, *to, *establishmentList)
+	}
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if manifest != nil && !*restart {
+		if manifest.Input != source || manifest.Model != *modelPath || manifest.ChunkSize != *chunkSize || manifest.Detail != *detail {
+			return errors.New("el progreso guardado corresponde a otros parámetros; usa -reiniciar")
+		}
+		if manifest.Complete {
+			fmt.Printf("La predicción ya estaba completa: %d filas en %s\n", manifest.RowsRead, destination)
+			return uploadOutput(*output, remoteOutput)
+		}
+		fmt.Printf("Reanudando desde el bloque %d (%d filas)\n", manifest.Chunks, manifest.RowsRead)
+	} else {
+		manifest = &batchManifest{Input: source, Model: *modelPath, ChunkSize: *chunkSize, Detail: *detail}
+	}
+
+	var queries querySource
+	header := slices.Clone(batchOutputHeader)
+	if ranged {
+		calendar, err := loadHolidays(*holidaysPath)
+		if err != nil {
+			return err
+		}
+		var establishments []string
+		for _, name := range strings.Split(*establishmentList, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				establishments = append(establishments, name)
+			}
+		}
+		if len(establishments) == 0 && pipeline != nil {
+			establishments = sortedKeys(pipeline.Establishments)
+			for i, key := range establishments {
+				establishments[i] = pipeline.Establishments[key]
+			}
+		}
+		if queries, err = newRangeQueries(*from, *to, establishments, calendar); err != nil {
+			return err
+		}
+		header = append(header, calendarOutputColumns...)
+	} else {
+		in, err := openInput(context.Background(), *input)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		if queries, err = newQueryReader(bufio.NewReader(in)); err != nil {
+			return err
+		}
+	}
+	if manifest.RowsRead > 0 {
+		if _, err := queries.next(manifest.RowsRead); err != nil { // Saltar las filas ya procesadas
+			return fmt.Errorf("error al saltar las filas procesadas: %w", err)
+		}
+	}
+
+	if *detail {
+		header = append(header, voteDetailColumns...)
+	}
+	header = append(header, modelMetadataColumns...)
+
+	var out *os.File
+	var ow *OrderedWriter // Un solo escritor con sus workers para todos los bloques
+	if table == nil {
+		if out, err = openBatchOutput(*output, manifest, header); err != nil {
+			return err
+		}
+		defer out.Close()
+		ow = NewOrderedWriter(out, writerOpts)
+		defer ow.Close()
+	}
+
+	var bookings *Bookings
+	if *bookingsPath != "" {
+		if bookings, err = loadBookings(context.Background(), *bookingsPath, *bookingsTable); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := timeout.context(context.Background())
+	defer cancel()
+	start := time.Now()
+	for {
+		chunk, err := queries.next(*chunkSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		bookings.fillQueries(chunk, *year)
+
+		results, err := predictBatchContext(ctx, model, pipeline, chunk, *workers)
+		if timeout.partial(err) {
+			// El bloque a medias se descarta: el manifiesto queda en el último completo
+			log.Printf("Advertencia: %v; quedan %d filas escritas en %s y el resto se predice al repetir el comando",
+				err, manifest.RowsRead, destination)
+			return nil
+		}
+		if err != nil {
+			return withTimeoutExitCode(exitError, err)
+		}
+		for i := range results {
+			results[i].Model = metadata
+			if *detail {
+				q := results[i].Query
+				results[i].Detail = voteBreakdown(model, queryAtencion(pipeline, q.Establishment, q.Month, q.Day), pipeline.tiePolicy())
+			}
+		}
+		if table != nil {
+			err = table.upsertWithRetry(context.Background(), manifest.Chunks, results, *retries)
+		} else {
+			err = writeChunkWithRetry(ow, out, manifest, results, *retries)
+		}
+		if err != nil {
+			return err
+		}
+		manifest.Chunks++
+		manifest.RowsRead += len(chunk)
+		if err := manifest.save(manifestPath); err != nil {
+			return err
+		}
+	}
+
+	manifest.Complete = true
+	if err := manifest.save(manifestPath); err != nil {
+		return err
+	}
+	fmt.Printf("Predicciones escritas en %s: %d filas en %v\n", destination, manifest.RowsRead, time.Since(start))
+	if table != nil {
+		return nil
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return uploadOutput(*output, remoteOutput)
+}
+
+// Función que sube el archivo de resultados a su destino remoto (si lo hay)
+func uploadOutput(local, remote string) error {
+	if remote == "" {
+		return nil
+	}
+	in, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(context.Background(), remote)
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Resultados subidos a %s\n", remote)
+	return nil
+}
+
+// Función que abre el archivo de salida: lo crea con cabecera o, al reanudar,
+// lo recorta al último bloque confirmado en el manifiesto
+func openBatchOutput(path string, manifest *batchManifest, header []string) (*os.File, error) {
+	if manifest.OutputBytes == 0 {
+		out, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		w := csv.NewWriter(out)
+		w.Write(header)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			out.Close()
+			return nil, err
+		}
+		offset, err := out.Seek(0, io.SeekCurrent)
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		manifest.OutputBytes = offset
+		return out, nil
+	}
+
+	out, err := os.OpenFile(path, os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Descartar lo escrito después del último punto de control
+	if err := out.Truncate(manifest.OutputBytes); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if _, err := out.Seek(manifest.OutputBytes, io.SeekStart); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// Función que escribe un bloque de resultados y lo confirma en disco. Si falla,
+// vuelve al último punto de control y reintenta con espera creciente.
+func writeChunkWithRetry(ow *OrderedWriter, out *os.File, manifest *batchManifest, results []batchResult, retries int) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Reintentando el bloque %d (intento %d): %v", manifest.Chunks, attempt, err)
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+			ow.Reset(out)
+			if err = out.Truncate(manifest.OutputBytes); err != nil {
+				continue
+			}
+			if _, err = out.Seek(manifest.OutputBytes, io.SeekStart); err != nil {
+				continue
+			}
+		}
+
+		if err = writeChunk(ow, out, results); err != nil {
+			continue
+		}
+		var offset int64
+		if offset, err = out.Seek(0, io.SeekCurrent); err != nil {
+			continue
+		}
+		manifest.OutputBytes = offset
+		return nil
+	}
+	return fmt.Errorf("no se pudo escribir el bloque %d: %w", manifest.Chunks, err)
+}
+
+// Función que escribe las filas de un bloque con el escritor ordenado de out y
+// fuerza su escritura a disco. El bloque se reparte en sub-bloques que los
+// workers del escritor convierten en filas y formatean en paralelo.
+func writeChunk(ow *OrderedWriter, out *os.File, results []batchResult) error {
+	subSize := max(1, (len(results)+runtime.GOMAXPROCS(0)-1)/runtime.GOMAXPROCS(0))
+	for start := 0; start < len(results); start += subSize {
+		part := results[start:min(start+subSize, len(results))]
+		ow.WriteRows(len(part), func(i int) []string { return part[i].record() })
+	}
+	if err := ow.Flush(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
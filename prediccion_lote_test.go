@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Una ejecución interrumpida a mitad de un bloque se reanuda desde el último
+// bloque confirmado y deja la misma salida que una ejecución sin cortes
+func TestPredictBatchResume(t *testing.T) {
+	rf, data := trainTestForest(t, 10)
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "modelo.gob.gz")
+	if err := rf.Save(modelPath); err != nil {
+		t.Fatal(err)
+	}
+	var queries strings.Builder
+	queries.WriteString("establecimiento,mes,dia\n")
+	for _, att := range data[:100] {
+		fmt.Fprintf(&queries, "%s,%d,%d\n", att.NombreEstablecimiento, att.Mes, att.Dia)
+	}
+	input := filepath.Join(dir, "consultas.csv")
+	if err := os.WriteFile(input, []byte(queries.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(output string) []byte {
+		t.Helper()
+		if err := predictBatchCommand([]string{"-modelo", modelPath, "-entrada", input, "-salida", output, "-bloque", "15"}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	want := run(filepath.Join(dir, "completo.csv"))
+	if lines := bytes.Count(want, []byte("\n")); lines != 101 {
+		t.Fatalf("filas de salida: %d, se esperaban 101", lines)
+	}
+
+	// Simular un corte después del tercer bloque, con parte del cuarto escrita
+	output := filepath.Join(dir, "reanudado.csv")
+	run(output)
+	manifest, err := readManifest(output + ".manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := 0
+	for line := 0; line < 1+3*15; line++ {
+		offset += bytes.IndexByte(want[offset:], '\n') + 1
+	}
+	manifest.Complete, manifest.Chunks, manifest.RowsRead, manifest.OutputBytes = false, 3, 3*15, int64(offset)
+	if err := manifest.save(output + ".manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	partial := append(append([]byte{}, want[:offset]...), "fila,a,medias"...)
+	if err := os.WriteFile(output, partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := run(output); !bytes.Equal(got, want) {
+		t.Fatalf("la salida reanudada difiere:\n%s\nse esperaba:\n%s", got, want)
+	}
+	if manifest, err = readManifest(output + ".manifest.json"); err != nil || !manifest.Complete || manifest.RowsRead != 100 {
+		t.Fatalf("manifiesto final: %+v, %v", manifest, err)
+	}
+}
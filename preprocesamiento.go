@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Pipeline de preprocesamiento que se guarda junto con el bosque. Contiene todo
+// lo que se usó al entrenar para transformar una fila cruda, de modo que un
+// modelo cargado puntúe igual que en el momento del entrenamiento sin depender
+// de variables globales.
+type Pipeline struct {
+	CongestionThreshold int                    // Atendidos a partir de los cuales la fila se considera congestionada
+	Features            []string               // Características por las que pudieron dividir los árboles
+	Establishments      map[string]string      // Nombre normalizado -> nombre tal como aparece en los datos
+	Imputer             *Imputer               // Promedios para imputar las características de solo entrenamiento
+	Forecaster          *VolumeForecaster      // Pronóstico de atendidos para los días siguientes a los datos (nil = solo promedios)
+	Clusters            *DemandClusters        // Grupos de demanda de los establecimientos (nil si no se usa Grupo)
+	Capacities          *Capacities            // Capacidades declaradas (nil = CongestionThreshold para todos)
+	Winsorizer          *Winsorizer            // Topes de atendidos con los que se recortaron los datos (nil = sin recorte)
+	Years               yearRange              // Años de los datos de entrenamiento (cero si no traen año)
+	CongestedRate       float64                // Fracción de registros de entrenamiento congestionados (0 si no se calculó)
+	Quality             map[string]dataQuality // Calidad de los datos de entrenamiento por nombre normalizado (nil si no se calculó)
+	Ranges              map[string][2]int      // Rango de Citas y las características propias en los datos de entrenamiento (nil si no hay)
+	Ties                tiePolicy              // Decisión ante un empate en la votación (ver empates.go)
+}
+
+// Función que arma el pipeline a partir de los datos de entrenamiento
+func NewPipeline(data []Atencion, features []string) *Pipeline {
+	p := &Pipeline{
+		CongestionThreshold: congestionThreshold,
+		Features:            features,
+		Establishments:      make(map[string]string),
+		Imputer:             NewImputer(data),
+		Years:               yearsOf(data),
+	}
+	if len(p.Features) == 0 {
+		p.Features = defaultFeatures
+	}
+	p.Ranges = featureRanges(data, p.Features)
+	if slices.Contains(p.Features, "Grupo") {
+		p.Clusters = ClusterEstablishments(data, defaultDemandClusters, 1)
+	}
+	for _, att := range data {
+		key := normalizeEstablishment(att.NombreEstablecimiento)
+		if _, ok := p.Establishments[key]; !ok {
+			p.Establishments[key] = att.NombreEstablecimiento
+		}
+	}
+	return p
+}
+
+// Función que normaliza el nombre de un establecimiento: mayúsculas y espacios simples
+func normalizeEstablishment(name string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(name)), " ")
+}
+
+// Función que transforma una fila cruda como se hizo al entrenar: el nombre se
+// lleva al que aparece en los datos, se le asigna su grupo de demanda y el
+// último año de los datos si no trae año, y se imputan las características que
+// faltan, con el pronóstico de volumen si cubre la fecha. Con un pipeline nil la
+// fila queda igual.
+func (p *Pipeline) Transform(att Atencion) Atencion {
+	if p == nil {
+		return att
+	}
+	if name, ok := p.Establishments[normalizeEstablishment(att.NombreEstablecimiento)]; ok {
+		att.NombreEstablecimiento = name
+	}
+	att.Grupo = p.Clusters.Group(att.NombreEstablecimiento)
+	if att.Anio == 0 {
+		att.Anio = p.Years.Last
+	}
+	att, _ = p.Forecaster.Fill(p.Imputer.Fill(att))
+	return att
+}
+
+// Indica si el establecimiento estaba en los datos de entrenamiento. Sin
+// pipeline o sin sus nombres (modelos antiguos) no se puede saber y se lo da
+// por conocido.
+func (p *Pipeline) Known(establishment string) bool {
+	if p == nil || len(p.Establishments) == 0 {
+		return true
+	}
+	_, ok := p.Establishments[normalizeEstablishment(establishment)]
+	return ok
+}
+
+// Indica si una fila corresponde a un día congestionado según el umbral del
+// pipeline o la capacidad de su establecimiento
+func (p *Pipeline) Congested(att Atencion) bool {
+	return float64(att.Atendidos) > p.Limit(att.NombreEstablecimiento)
+}
+
+// Modelo que guarda su propio pipeline
+type pipelineProvider interface {
+	QueryPipeline() *Pipeline
+}
+
+// Función que retorna el pipeline guardado con el bosque
+func (rf *RandomForest) QueryPipeline() *Pipeline {
+	return rf.Pipeline
+}
+
+// Función que elige el pipeline de una consulta: el del modelo si lo tiene,
+// si no el calculado aparte con un histórico (que puede ser nil)
+func pipelineFor(model Predictor, fallback *Pipeline) *Pipeline {
+	if provider, ok := model.(pipelineProvider); ok {
+		if p := provider.QueryPipeline(); p != nil {
+			return p
+		}
+	}
+	return fallback
+}
+
+// Función que construye la consulta de una predicción pasada por el pipeline
+func queryAtencion(p *Pipeline, establishment string, month, day int) Atencion {
+	return p.Transform(Atencion{Mes: month, Dia: day, NombreEstablecimiento: establishment})
+}
+
+// Función que carga un CSV histórico y arma un pipeline con él (ruta vacía = nil).
+// Sirve para modelos guardados antes de que el pipeline se guardara con el bosque.
+func loadPipeline(path string) (*Pipeline, error) {
+	if path == "" {
+		return nil, nil
+	}
+	start := time.Now()
+	data, err := loadAtenciones(context.Background(), path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo cargar el histórico: %w", err)
+	}
+	p := NewPipeline(data, nil)
+	fmt.Printf("Histórico para imputar: %d registros de %d establecimientos en %v\n", len(data), len(p.Establishments), time.Since(start))
+	return p, nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Pronóstico del volumen de pacientes: para cada establecimiento se ajusta un
+// modelo de Holt-Winters aditivo con tendencia amortiguada y estacionalidad
+// semanal sobre la serie diaria de Atendidos. Los datos no tienen año, así que
+// la serie va del primer al último día del calendario con datos y el pronóstico
+// es para los días que siguen al último (pasado diciembre, el año siguiente).
+// Dentro del horizonte, el pronóstico reemplaza al promedio mensual del
+// imputador como demanda esperada de las consultas al clasificador; más allá,
+// la tendencia deja de ser confiable y se vuelve al promedio.
+
+// Parámetros de Holt-Winters
+const (
+	forecastSeason  = 7    // Días de la estacionalidad semanal
+	forecastDamping = 0.98 // Amortiguación de la tendencia (φ): a largo plazo el pronóstico se aplana
+)
+
+// Grillas de las constantes de suavizado: se elige la combinación con menor
+// error de pronóstico a un día sobre la propia serie
+var (
+	forecastAlphas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7}
+	forecastBetas  = []float64{0, 0.01, 0.05, 0.1, 0.2}
+	forecastGammas = []float64{0.01, 0.05, 0.1, 0.2, 0.3}
+)
+
+// Modelo de Holt-Winters ajustado a la serie de un establecimiento
+type HoltWinters struct {
+	Alpha, Beta, Gamma float64                 // Suavizado del nivel, la tendencia y la estacionalidad
+	Level, Trend       float64                 // Estado al final de la serie
+	Season             [forecastSeason]float64 // Efecto de cada día de la semana, indexado por día del calendario módulo 7
+	LastDay            int                     // Último día del calendario (1-366) con datos
+	RMSE               float64                 // Error del pronóstico a un día sobre la serie
+}
+
+// Pronósticos de todos los establecimientos, guardados en el pipeline
+type VolumeForecaster struct {
+	Horizon int                     // Días después del último dato en los que se usa el pronóstico
+	Models  map[string]*HoltWinters // Por nombre de establecimiento tal como aparece en los datos
+}
+
+// Función que ajusta un modelo por establecimiento, en paralelo. Los
+// establecimientos con menos de dos semanas de datos quedan sin modelo y sus
+// consultas se imputan con el promedio.
+func NewVolumeForecaster(data []Atencion, horizon int) *VolumeForecaster {
+	series := make(map[string]map[int]float64)
+	for _, att := range data {
+		days, ok := series[att.NombreEstablecimiento]
+		if !ok {
+			days = make(map[int]float64)
+			series[att.NombreEstablecimiento] = days
+		}
+		days[calendarDay(att.Mes, att.Dia)] += float64(att.Atendidos)
+	}
+	names := sortedKeys(series)
+	models := make([]*HoltWinters, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			models[i] = fitHoltWinters(series[name])
+		}()
+	}
+	wg.Wait()
+
+	f := &VolumeForecaster{Horizon: horizon, Models: make(map[string]*HoltWinters)}
+	for i, name := range names {
+		if models[i] != nil {
+			f.Models[name] = models[i]
+		}
+	}
+	return f
+}
+
+// Función que ajusta Holt-Winters a los atendidos por día del calendario
+// probando todas las constantes de la grilla. Retorna nil con menos de dos
+// semanas entre el primer y el último día.
+func fitHoltWinters(days map[int]float64) *HoltWinters {
+	first, last := 367, 0
+	for day := range days {
+		first, last = min(first, day), max(last, day)
+	}
+	if last-first+1 < 2*forecastSeason {
+		return nil
+	}
+	// Los días sin datos quedan en NaN y el modelo los reemplaza por su pronóstico
+	series := make([]float64, last-first+1)
+	for i := range series {
+		if value, ok := days[first+i]; ok {
+			series[i] = value
+		} else {
+			series[i] = math.NaN()
+		}
+	}
+
+	var best *HoltWinters
+	for _, alpha := range forecastAlphas {
+		for _, beta := range forecastBetas {
+			for _, gamma := range forecastGammas {
+				hw := &HoltWinters{Alpha: alpha, Beta: beta, Gamma: gamma}
+				hw.run(series, first)
+				if best == nil || hw.RMSE < best.RMSE {
+					best = hw
+				}
+			}
+		}
+	}
+	return best
+}
+
+// Función que recorre la serie actualizando el estado y acumula el error del
+// pronóstico a un día desde la segunda semana. La primera semana inicializa el
+// nivel con su promedio y la estacionalidad con las diferencias a ese promedio.
+func (hw *HoltWinters) run(series []float64, first int) {
+	sum, count := 0.0, 0
+	for _, y := range series[:forecastSeason] {
+		if !math.IsNaN(y) {
+			sum += y
+			count++
+		}
+	}
+	if count > 0 {
+		hw.Level = sum / float64(count)
+	}
+	hw.Trend = 0
+	for i, y := range series[:forecastSeason] {
+		if !math.IsNaN(y) {
+			hw.Season[(first+i)%forecastSeason] = y - hw.Level
+		}
+	}
+
+	squared, observed := 0.0, 0
+	for i := forecastSeason; i < len(series); i++ {
+		slot := (first + i) % forecastSeason
+		predicted := hw.Level + forecastDamping*hw.Trend + hw.Season[slot]
+		y := series[i]
+		if math.IsNaN(y) {
+			y = predicted
+		} else {
+			squared += (y - predicted) * (y - predicted)
+			observed++
+		}
+		level := hw.Alpha*(y-hw.Season[slot]) + (1-hw.Alpha)*(hw.Level+forecastDamping*hw.Trend)
+		hw.Trend = hw.Beta*(level-hw.Level) + (1-hw.Beta)*forecastDamping*hw.Trend
+		hw.Level = level
+		hw.Season[slot] = hw.Gamma*(y-level) + (1-hw.Gamma)*hw.Season[slot]
+	}
+	hw.LastDay = first + len(series) - 1
+	if observed > 0 {
+		hw.RMSE = math.Sqrt(squared / float64(observed))
+	}
+}
+
+// Función que pronostica los atendidos h días después del último dato (nunca negativos)
+func (hw *HoltWinters) Forecast(h int) float64 {
+	damped, phi := 0.0, 1.0
+	for i := 0; i < h; i++ {
+		phi *= forecastDamping
+		damped += phi
+	}
+	return max(0, hw.Level+damped*hw.Trend+hw.Season[(hw.LastDay+h)%forecastSeason])
+}
+
+// Función que retorna cuántos días después del último dato cae una fecha: si
+// no es posterior en el mismo año, es del año siguiente
+func (hw *HoltWinters) horizon(month, day int) int {
+	h := calendarDay(month, day) - hw.LastDay
+	if h <= 0 {
+		h += 366
+	}
+	return h
+}
+
+// Función que completa una consulta ya imputada con el pronóstico, si el
+// establecimiento tiene modelo y la fecha está dentro del horizonte. Atenciones
+// se escala con la proporción que ya traía la consulta. Retorna false si no se usó.
+func (f *VolumeForecaster) Fill(att Atencion) (Atencion, bool) {
+	if f == nil {
+		return att, false
+	}
+	hw, ok := f.Models[att.NombreEstablecimiento]
+	if !ok {
+		return att, false
+	}
+	h := hw.horizon(att.Mes, att.Dia)
+	if h > f.Horizon {
+		return att, false
+	}
+	expected := hw.Forecast(h)
+	if att.Atendidos > 0 {
+		att.Atenciones = int(math.Round(expected * float64(att.Atenciones) / float64(att.Atendidos)))
+	}
+	att.Atendidos = int(math.Round(expected))
+	return att, true
+}
+
+// Función que combina los pronósticos de dos pipelines: ante un mismo
+// establecimiento gana el primero. Un pronosticador nil se toma como ausente.
+func (f *VolumeForecaster) merge(other *VolumeForecaster) *VolumeForecaster {
+	if f == nil {
+		return other
+	}
+	if other == nil {
+		return f
+	}
+	merged := &VolumeForecaster{Horizon: min(f.Horizon, other.Horizon), Models: make(map[string]*HoltWinters)}
+	for _, source := range []*VolumeForecaster{other, f} {
+		for name, hw := range source.Models {
+			merged.Models[name] = hw
+		}
+	}
+	return merged
+}
+
+// Fila del pronóstico de volumen
+type volumeForecast struct {
+	Establishment string
+	Month, Day    int
+	Expected      float64
+	Votes, Trees  int // Votos del clasificador (Trees = 0 sin modelo)
+}
+
+// Subcomando "forecast-volume": pronostica los atendidos de los próximos días
+// de cada establecimiento y, con -modelo, si estarán congestionados
+func forecastVolumeCommand(args []string) error {
+	fs := flag.NewFlagSet("forecast-volume", flag.ContinueOnError)
+	dataPath := fs.String("datos", "atenciones_filtradas.csv", "archivo CSV de atenciones")
+	days := fs.Int("dias", 14, "días a pronosticar después del último dato")
+	modelPath := fs.String("modelo", "", "modelo que clasifica los días pronosticados (vacío = solo el volumen)")
+	output := fs.String("o", "", "archivo CSV del pronóstico (vacío = salida estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *days <= 0 || *days > 366 {
+		return fmt.Errorf("número de días inválido: %d", *days)
+	}
+
+	data, err := loadAtenciones(context.Background(), *dataPath)
+	if err != nil {
+		return err
+	}
+	var model Predictor
+	if *modelPath != "" {
+		if model, err = OpenModel(*modelPath); err != nil {
+			return err
+		}
+		if closer, ok := model.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+
+	start := time.Now()
+	forecaster := NewVolumeForecaster(data, *days)
+	if len(forecaster.Models) == 0 {
+		return errors.New("ningún establecimiento tiene dos semanas de datos para pronosticar")
+	}
+	fmt.Fprintf(os.Stderr, "%d establecimientos ajustados en %v\n", len(forecaster.Models), time.Since(start).Round(time.Millisecond))
+
+	// Las consultas al clasificador pasan por su pipeline y luego toman el
+	// pronóstico como demanda esperada
+	pipeline := pipelineFor(model, NewPipeline(data, nil))
+	var rows []volumeForecast
+	for _, name := range sortedKeys(forecaster.Models) {
+		hw := forecaster.Models[name]
+		fmt.Fprintf(os.Stderr, "  %s: α=%.2f β=%.2f γ=%.2f, error %.1f atendidos\n", name, hw.Alpha, hw.Beta, hw.Gamma, hw.RMSE)
+		for h := 1; h <= *days; h++ {
+			month, day := calendarDate(hw.LastDay + h)
+			row := volumeForecast{Establishment: name, Month: month, Day: day, Expected: hw.Forecast(h)}
+			if model != nil {
+				att, _ := forecaster.Fill(queryAtencion(pipeline, name, month, day))
+				row.Votes, row.Trees = model.Vote(att)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if *output == "" {
+		return writeVolumeCSV(os.Stdout, rows, model != nil)
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	if err := writeVolumeCSV(w, rows, model != nil); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que retorna el mes y el día de un día del calendario; pasado el 366
+// sigue en el año siguiente
+func calendarDate(day int) (month, dayOfMonth int) {
+	date := time.Date(2000, time.January, (day-1)%366+1, 0, 0, 0, 0, time.UTC)
+	return int(date.Month()), date.Day()
+}
+
+// Función que escribe el pronóstico en CSV; con clasificador agrega los votos
+func writeVolumeCSV(w io.Writer, rows []volumeForecast, classified bool) error {
+	cw := csv.NewWriter(w)
+	header := []string{"establecimiento", "mes", "dia", "atendidos_esperados"}
+	if classified {
+		header = append(header, "congestionado", "votos", "arboles")
+	}
+	cw.Write(header)
+	for _, r := range rows {
+		record := []string{r.Establishment, strconv.Itoa(r.Month), strconv.Itoa(r.Day), strconv.FormatFloat(r.Expected, 'f', 1, 64)}
+		if classified {
+			record = append(record, strconv.FormatBool(r.Trees > 0 && r.Votes > r.Trees/2), strconv.Itoa(r.Votes), strconv.Itoa(r.Trees))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prueba de carga del servidor de predicciones: envía predicciones a un ritmo
+// fijo (lazo abierto: no espera a que termine una para mandar la siguiente) y
+// reporta percentiles de latencia y tasa de errores, para dimensionar el
+// servicio de la red de hospitales. Con -modelo predice en el proceso, sin
+// HTTP, para separar el costo del modelo del costo del servidor.
+
+// Resultado de una predicción de la prueba
+type loadResult struct {
+	latency time.Duration
+	outcome string // Código HTTP, "ok" en el proceso, o el tipo de error
+	failed  bool
+}
+
+// Resultados acumulados de una prueba de carga
+type loadStats struct {
+	mu       sync.Mutex
+	results  []loadResult
+	dropped  int // Predicciones no enviadas porque se alcanzó la concurrencia máxima
+	duration time.Duration
+}
+
+func (s *loadStats) add(r loadResult) {
+	s.mu.Lock()
+	s.results = append(s.results, r)
+	s.mu.Unlock()
+}
+
+// Función del subcomando loadtest
+func loadtestCommand(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	serverURL := fs.String("servidor", "http://localhost:8080", "URL del servidor")
+	modelPath := fs.String("modelo", "", "predecir con este modelo en el proceso en lugar de usar el servidor")
+	modelName := fs.String("nombre", defaultModelName, "modelo del servidor al que se piden predicciones")
+	rps := fs.Float64("rps", 100, "predicciones por segundo")
+	duration := fs.Duration("duracion", 30*time.Second, "duración de la prueba")
+	concurrency := fs.Int("concurrencia", 256, "predicciones en curso como máximo (las que excedan se descartan y se informan)")
+	timeout := fs.Duration("timeout", 5*time.Second, "tiempo máximo de cada petición")
+	facilityList := fs.String("establecimientos", "", "establecimientos separados por comas, elegidos al azar en cada consulta")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *rps <= 0 || *duration <= 0 || *concurrency <= 0 {
+		return errors.New("-rps, -duracion y -concurrencia deben ser positivos")
+	}
+	var facilities []string
+	if *facilityList != "" {
+		facilities = strings.Split(*facilityList, ",")
+	}
+
+	var predict func(ctx context.Context, establishment string, month, day int) loadResult
+	target := *serverURL
+	if *modelPath != "" {
+		model, err := OpenModel(*modelPath)
+		if err != nil {
+			return err
+		}
+		if closer, ok := model.(io.Closer); ok {
+			defer closer.Close()
+		}
+		pipeline := pipelineFor(model, nil)
+		predict = func(ctx context.Context, establishment string, month, day int) loadResult {
+			start := time.Now()
+			model.Vote(queryAtencion(pipeline, establishment, month, day))
+			return loadResult{latency: time.Since(start), outcome: "ok"}
+		}
+		target = *modelPath
+	} else {
+		client := &http.Client{
+			Timeout:   *timeout,
+			Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency},
+		}
+		predict = httpPredictor(client, *serverURL, *modelName, os.Getenv("TP_CLAVE"))
+	}
+
+	fmt.Printf("Prueba de carga contra %s: %.0f predicciones/s durante %v\n", target, *rps, *duration)
+	stats := runLoadTest(*rps, *duration, *concurrency, facilities, predict)
+	printLoadReport(os.Stdout, stats, *rps)
+	return nil
+}
+
+// Función que retorna un predictor que consulta GET /predict en el servidor
+func httpPredictor(client *http.Client, serverURL, model, key string) func(context.Context, string, int, int) loadResult {
+	base := strings.TrimSuffix(serverURL, "/") + "/predict"
+	return func(ctx context.Context, establishment string, month, day int) loadResult {
+		query := url.Values{"modelo": {model}, "mes": {strconv.Itoa(month)}, "dia": {strconv.Itoa(day)}}
+		if establishment != "" {
+			query.Set("establecimiento", establishment)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"?"+query.Encode(), nil)
+		if err != nil {
+			return loadResult{outcome: "petición inválida", failed: true}
+		}
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			outcome := "error de red"
+			if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+				outcome = "timeout"
+			}
+			return loadResult{latency: time.Since(start), outcome: outcome, failed: true}
+		}
+		io.Copy(io.Discard, resp.Body) // Leer la respuesta completa para reutilizar la conexión
+		resp.Body.Close()
+		return loadResult{latency: time.Since(start), outcome: strconv.Itoa(resp.StatusCode), failed: resp.StatusCode != http.StatusOK}
+	}
+}
+
+// Función que envía predicciones a ritmo constante durante la duración
+// indicada y espera a que terminen las que quedaron en curso
+func runLoadTest(rps float64, duration time.Duration, concurrency int, facilities []string,
+	predict func(context.Context, string, int, int) loadResult) *loadStats {
+
+	stats := &loadStats{}
+	slots := make(chan struct{}, concurrency)
+	// Con ritmos altos el ticker no alcanza a marcar cada envío: en cada marca
+	// se envían las predicciones que ya deberían haber salido
+	ticker := time.NewTicker(max(time.Duration(float64(time.Second)/rps), time.Millisecond))
+	defer ticker.Stop()
+	deadline := time.After(duration)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	sent := 0
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+		}
+		for due := int(time.Since(start).Seconds()*rps) - sent; due > 0; due-- {
+			sent++
+			select {
+			case slots <- struct{}{}:
+			default:
+				stats.mu.Lock()
+				stats.dropped++
+				stats.mu.Unlock()
+				continue
+			}
+			establishment := ""
+			if len(facilities) > 0 {
+				establishment = facilities[rand.Intn(len(facilities))]
+			}
+			month, day := rand.Intn(12)+1, rand.Intn(28)+1
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				stats.add(predict(context.Background(), establishment, month, day))
+			}()
+		}
+	}
+	wg.Wait()
+	stats.duration = time.Since(start)
+	return stats
+}
+
+// Función que escribe el reporte de la prueba: ritmo logrado, errores y percentiles de latencia
+func printLoadReport(w io.Writer, stats *loadStats, rps float64) {
+	total := len(stats.results)
+	latencies := make([]float64, 0, total)
+	outcomes := make(map[string]int)
+	failed := 0
+	for _, r := range stats.results {
+		outcomes[r.outcome]++
+		if r.failed {
+			failed++
+			continue
+		}
+		latencies = append(latencies, float64(r.latency.Nanoseconds())/1e6)
+	}
+	slices.Sort(latencies)
+
+	fmt.Fprintf(w, "Predicciones: %d en %v (%.1f/s de %.0f/s pedidas)\n", total, stats.duration.Round(time.Millisecond), float64(total)/stats.duration.Seconds(), rps)
+	if stats.dropped > 0 {
+		fmt.Fprintf(w, "Descartadas por concurrencia máxima: %d (el servidor no da abasto o hay que subir -concurrencia)\n", stats.dropped)
+	}
+	errorRate := 0.0
+	if total > 0 {
+		errorRate = float64(failed) / float64(total)
+	}
+	fmt.Fprintf(w, "Errores: %d (%.2f%%)\n", failed, 100*errorRate)
+	for _, outcome := range sortedKeys(outcomes) {
+		fmt.Fprintf(w, "  %-14s %d\n", outcome, outcomes[outcome])
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Latencia de las exitosas (ms):")
+	fmt.Fprintf(w, "  p50 %.3f  p90 %.3f  p95 %.3f  p99 %.3f  máx %.3f\n",
+		percentile(latencies, 0.50), percentile(latencies, 0.90), percentile(latencies, 0.95), percentile(latencies, 0.99), latencies[len(latencies)-1])
+}
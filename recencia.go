@@ -0,0 +1,91 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// Datos de varios años: la capacidad de los hospitales cambia con el tiempo y
+// los patrones viejos no deberían pesar tanto como los recientes. El año puede
+// usarse como característica (Anio) y, con un factor de recencia d entre 0 y 1,
+// cada registro entra en la muestra de un árbol con peso d^(último año - su
+// año): con d = 0.5 un registro del año anterior pesa la mitad. La muestra sigue
+// siendo del 80% sin reemplazo, elegida con el método de Efraimidis-Spirakis, y
+// los registros que quedan afuera siguen siendo los OOB. Los registros sin año
+// pesan 1.
+
+// Primer y último año de los registros (0 = sin año)
+type yearRange struct {
+	First, Last int
+}
+
+// Función que retorna el rango de años de los registros, sin contar los de año desconocido
+func yearsOf(data []Atencion) yearRange {
+	var r yearRange
+	for _, att := range data {
+		if att.Anio == 0 {
+			continue
+		}
+		if r.First == 0 || att.Anio < r.First {
+			r.First = att.Anio
+		}
+		r.Last = max(r.Last, att.Anio)
+	}
+	return r
+}
+
+// Función que retorna el rango que cubre a los dos rangos
+func (r yearRange) union(other yearRange) yearRange {
+	if r.First == 0 {
+		return other
+	}
+	if other.First == 0 {
+		return r
+	}
+	return yearRange{First: min(r.First, other.First), Last: max(r.Last, other.Last)}
+}
+
+// Indica si los registros abarcan más de un año
+func (r yearRange) multiYear() bool {
+	return r.First > 0 && r.First < r.Last
+}
+
+// Función que retorna el peso de recencia de cada registro, o nil si no hay
+// que ponderar (sin factor o con un solo año)
+func recencyWeights(data []Atencion, decay float64) []float64 {
+	years := yearsOf(data)
+	if decay <= 0 || decay >= 1 || !years.multiYear() {
+		return nil
+	}
+	weights := make([]float64, len(data))
+	for i, att := range data {
+		weights[i] = 1
+		if att.Anio > 0 {
+			weights[i] = math.Pow(decay, float64(years.Last-att.Anio))
+		}
+	}
+	return weights
+}
+
+// Función que toma una muestra del 80% de los datos sin reemplazo donde cada
+// registro entra con probabilidad proporcional a su peso. Retorna la muestra y
+// los índices de las filas que quedaron fuera (OOB), como sampleData.
+func sampleWeighted(data []Atencion, weights []float64, rng *rand.Rand) ([]Atencion, []int) {
+	trainSize := int(float64(len(data)) * 0.8)
+	// Efraimidis-Spirakis: se eligen las filas con las claves u^(1/w) más
+	// grandes, o lo que es lo mismo, las de menor -ln(u)/w
+	keys := make([]float64, len(data))
+	order := make([]int, len(data))
+	for i := range data {
+		keys[i] = -math.Log(1-rng.Float64()) / weights[i]
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int { return cmp.Compare(keys[a], keys[b]) })
+	subData := make([]Atencion, trainSize)
+	for i, idx := range order[:trainSize] {
+		subData[i] = data[idx]
+	}
+	return subData, order[trainSize:]
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subcomando "reconcile": compara predicciones pasadas con los datos reales una
+// vez que llegan. Une ambos por establecimiento, mes y día, calcula la precisión
+// realizada y señala los grupos (mes, día de la semana, establecimiento) en los
+// que el modelo se equivoca siempre en la misma dirección.
+func reconcileCommand(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	predictionsPath := fs.String("predicciones", "", "historial JSONL del servidor o CSV de predict-batch")
+	actualsPath := fs.String("reales", "", "CSV de atenciones con los datos reales")
+	year := fs.Int("anio", 0, "año de los datos, para agrupar por día de la semana (0 = no agrupar)")
+	threshold := fs.Int("umbral", congestionThreshold, "promedio de atendidos a partir del cual un día real está congestionado")
+	minGroup := fs.Int("min", 20, "predicciones mínimas de un grupo para evaluar su sesgo")
+	maxBias := fs.Float64("sesgo", 0.1, "diferencia entre la tasa predicha y la real a partir de la cual se reporta un sesgo")
+	manifestPath := fs.String("manifiesto", "", "manifiesto JSON con la suma SHA-256 y el esquema esperados de -reales")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *predictionsPath == "" || *actualsPath == "" {
+		return errors.New("faltan -predicciones o -reales")
+	}
+
+	check, err := manifestCheck(*manifestPath, *actualsPath)
+	if err != nil {
+		return err
+	}
+	predictions, err := readPredictions(*predictionsPath)
+	if err != nil {
+		return err
+	}
+	data, err := loadAtencionesWith(context.Background(), *actualsPath, LoadOptions{Check: check})
+	if err != nil {
+		return err
+	}
+
+	report := reconcile(predictions, aggregateActuals(data, func(string) int { return *threshold }), *year)
+	report.print(os.Stdout, *minGroup, *maxBias)
+	return nil
+}
+
+// Clave de unión entre predicciones y datos reales
+type dayKey struct {
+	Establishment string
+	Month, Day    int
+}
+
+// Función que resume los datos reales por establecimiento y fecha: un día está
+// congestionado si el promedio de atendidos supera el umbral del establecimiento,
+// igual que en las hojas
+func aggregateActuals(data []Atencion, threshold func(establishment string) int) map[dayKey]bool {
+	sums := GroupBy(data, func(att Atencion) dayKey {
+		return dayKey{normalizeEstablishment(att.NombreEstablecimiento), att.Mes, att.Dia}
+	}).Aggregate(Sum(atendidosValue), Count())
+	actuals := make(map[dayKey]bool, len(sums))
+	for key, sum := range sums {
+		actuals[key] = int(sum[0])/int(sum[1]) > threshold(key.Establishment) // División entera, como en las hojas
+	}
+	return actuals
+}
+
+// Función que lee las predicciones del historial del servidor (un JSON por
+// línea) o del CSV que escribe predict-batch, según el primer carácter
+func readPredictions(path string) ([]PredictionRecord, error) {
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("archivo de predicciones vacío: %w", err)
+	}
+
+	var records []PredictionRecord
+	if first[0] == '{' {
+		dec := json.NewDecoder(r)
+		for {
+			var rec PredictionRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				return records, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("historial inválido: %w", err)
+			}
+			if rec.Abstained {
+				continue // Empate sin decisión: no hay predicción que comparar
+			}
+			records = append(records, rec)
+		}
+	}
+
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"establecimiento", "mes", "dia", "congestionado"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("al CSV de predicciones le falta la columna %s", name)
+		}
+	}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := columns["empate"]; ok && row[i] == tieAbstain.String() {
+			continue // Empate sin decisión: no hay predicción que comparar
+		}
+		month, err1 := strconv.Atoi(row[columns["mes"]])
+		day, err2 := strconv.Atoi(row[columns["dia"]])
+		congested, err3 := strconv.ParseBool(row[columns["congestionado"]])
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return nil, fmt.Errorf("fila de predicción inválida %v: %w", row, err)
+		}
+		records = append(records, PredictionRecord{
+			Establishment: row[columns["establecimiento"]],
+			Month:         month,
+			Day:           day,
+			Congested:     congested,
+		})
+	}
+}
+
+// Aciertos y tasas de congestión de un grupo de predicciones
+type reconcileGroup struct {
+	Predictions  int // Predicciones con dato real
+	Correct      int // Predicciones acertadas
+	PredictedPos int // Predicciones de congestión
+	ActualPos    int // Días realmente congestionados
+}
+
+func (g *reconcileGroup) add(predicted, actual bool) {
+	g.Predictions++
+	if predicted == actual {
+		g.Correct++
+	}
+	if predicted {
+		g.PredictedPos++
+	}
+	if actual {
+		g.ActualPos++
+	}
+}
+
+// Diferencia entre la tasa de congestión predicha y la real: positiva si el
+// modelo sobreestima la congestión, negativa si la subestima
+func (g *reconcileGroup) bias() float64 {
+	return float64(g.PredictedPos-g.ActualPos) / float64(g.Predictions)
+}
+
+// Resultado de la reconciliación
+type reconcileReport struct {
+	Total          reconcileGroup
+	Unmatched      int                        // Predicciones sin dato real
+	TruePositives  int                        // Congestión predicha y real
+	FalsePositives int                        // Congestión predicha pero no real
+	FalseNegatives int                        // Congestión real no predicha
+	Groups         map[string]*reconcileGroup // Grupos por "dimensión: valor"
+}
+
+// Nombres de los días de la semana
+var weekdayNames = [...]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"}
+
+// Función que une las predicciones con los datos reales y acumula los grupos
+func reconcile(predictions []PredictionRecord, actuals map[dayKey]bool, year int) *reconcileReport {
+	report := &reconcileReport{Groups: make(map[string]*reconcileGroup)}
+	group := func(name string) *reconcileGroup {
+		g, ok := report.Groups[name]
+		if !ok {
+			g = &reconcileGroup{}
+			report.Groups[name] = g
+		}
+		return g
+	}
+
+	for _, p := range predictions {
+		actual, ok := actuals[dayKey{normalizeEstablishment(p.Establishment), p.Month, p.Day}]
+		if !ok {
+			report.Unmatched++
+			continue
+		}
+		report.Total.add(p.Congested, actual)
+		switch {
+		case p.Congested && actual:
+			report.TruePositives++
+		case p.Congested:
+			report.FalsePositives++
+		case actual:
+			report.FalseNegatives++
+		}
+
+		group("mes: "+strconv.Itoa(p.Month)).add(p.Congested, actual)
+		group(versionGroup(p)).add(p.Congested, actual)
+		group("establecimiento: "+p.Establishment).add(p.Congested, actual)
+		if year > 0 {
+			weekday := time.Date(year, time.Month(p.Month), p.Day, 0, 0, 0, 0, time.UTC).Weekday()
+			group("día de la semana: "+weekdayNames[weekday]).add(p.Congested, actual)
+		}
+	}
+	return report
+}
+
+// Prefijo de los grupos por versión del modelo
+const versionGroupPrefix = "versión: "
+
+// Función que arma el grupo de la versión que atendió una predicción; las del
+// canario se agrupan aparte porque el candidato no tiene versión hasta promoverse
+func versionGroup(p PredictionRecord) string {
+	if p.Variant == canaryVariant {
+		return versionGroupPrefix + p.Model + " canario"
+	}
+	return versionGroupPrefix + p.Model + " v" + strconv.Itoa(p.Version)
+}
+
+// Función que muestra el resumen y los grupos con sesgo sistemático
+func (r *reconcileReport) print(w io.Writer, minGroup int, maxBias float64) {
+	fmt.Fprintf(w, "Predicciones con dato real: %d (sin dato real: %d)\n", r.Total.Predictions, r.Unmatched)
+	if r.Total.Predictions == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Precisión realizada: %.4f\n", float64(r.Total.Correct)/float64(r.Total.Predictions))
+	fmt.Fprintf(w, "Verdaderos positivos: %d, falsos positivos: %d, falsos negativos: %d\n",
+		r.TruePositives, r.FalsePositives, r.FalseNegatives)
+	fmt.Fprintf(w, "Tasa de congestión predicha: %.4f, real: %.4f\n",
+		float64(r.Total.PredictedPos)/float64(r.Total.Predictions), float64(r.Total.ActualPos)/float64(r.Total.Predictions))
+
+	// Con más de una versión (p. ej. durante un canario) se comparan entre sí
+	var versions []string
+	for name := range r.Groups {
+		if strings.HasPrefix(name, versionGroupPrefix) {
+			versions = append(versions, name)
+		}
+	}
+	if len(versions) > 1 {
+		sort.Strings(versions)
+		fmt.Fprintln(w, "\nPor versión del modelo:")
+		for _, name := range versions {
+			g := r.Groups[name]
+			fmt.Fprintf(w, "  %-40s precisión %.4f, tasa predicha %.4f, real %.4f (%d predicciones)\n",
+				strings.TrimPrefix(name, versionGroupPrefix), float64(g.Correct)/float64(g.Predictions),
+				float64(g.PredictedPos)/float64(g.Predictions), float64(g.ActualPos)/float64(g.Predictions), g.Predictions)
+		}
+	}
+
+	// Grupos con suficientes predicciones cuyo sesgo supera el máximo, de mayor a menor
+	var biased []string
+	for name, g := range r.Groups {
+		if g.Predictions >= minGroup && math.Abs(g.bias()) >= maxBias {
+			biased = append(biased, name)
+		}
+	}
+	sort.Slice(biased, func(i, j int) bool {
+		return math.Abs(r.Groups[biased[i]].bias()) > math.Abs(r.Groups[biased[j]].bias())
+	})
+
+	if len(biased) == 0 {
+		fmt.Fprintln(w, "No se encontraron sesgos sistemáticos.")
+		return
+	}
+	fmt.Fprintln(w, "\nSesgos sistemáticos:")
+	for _, name := range biased {
+		g := r.Groups[name]
+		direction := "sobreestima"
+		if g.bias() < 0 {
+			direction = "subestima"
+		}
+		fmt.Fprintf(w, "  %-40s %s la congestión en %.0f%% (precisión %.4f, %d predicciones)\n",
+			name, direction, math.Abs(g.bias())*100, float64(g.Correct)/float64(g.Predictions), g.Predictions)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Recorte de valores extremos (winsorización): un error de carga como 9999
+// atendidos mueve el promedio de las hojas y los promedios del imputador. Con
+// un percentil (por ejemplo 0.99) se calcula, para cada establecimiento, el
+// valor de Atendidos en ese percentil y los registros que lo superan se llevan
+// a ese valor antes de entrenar. Los topes se guardan en el pipeline para saber
+// con qué datos se entrenó el modelo. Un establecimiento con menos de
+// 1/(1-percentil) registros no se recorta: su percentil es su máximo.
+
+// Topes de Atendidos por establecimiento, guardados en el pipeline
+type Winsorizer struct {
+	Percentile float64        // Percentil de los topes (0-1)
+	Caps       map[string]int // Nombre del establecimiento -> tope de Atendidos
+	Capped     map[string]int // Registros recortados por establecimiento al entrenar
+}
+
+// Función que calcula el tope de cada establecimiento con sus atendidos
+// ordenados de las estadísticas compartidas
+func NewWinsorizer(data []Atencion, percentileValue float64) *Winsorizer {
+	stats := statisticsFor(data)
+	w := &Winsorizer{Percentile: percentileValue, Caps: make(map[string]int, len(stats.Establishments)), Capped: make(map[string]int)}
+	for name, e := range stats.Establishments {
+		w.Caps[name] = int(percentile(e.Attended, percentileValue))
+	}
+	return w
+}
+
+// Función que retorna una copia de los registros con Atendidos recortado al
+// tope de su establecimiento y cuenta los registros recortados
+func (w *Winsorizer) Apply(data []Atencion) []Atencion {
+	capped := make([]Atencion, len(data))
+	for i, att := range data {
+		if limit, ok := w.Caps[att.NombreEstablecimiento]; ok && att.Atendidos > limit {
+			att.Atendidos = limit
+			w.Capped[att.NombreEstablecimiento]++
+		}
+		capped[i] = att
+	}
+	return capped
+}
+
+// Función que escribe cuántos registros se recortaron, con los
+// establecimientos con más registros recortados primero
+func (w *Winsorizer) Print(out io.Writer) {
+	names := sortedKeys(w.Capped)
+	total := 0
+	for _, name := range names {
+		total += w.Capped[name]
+	}
+	fmt.Fprintf(out, "Recorte al percentil %g: %d registros recortados en %d de %d establecimientos\n",
+		w.Percentile, total, len(names), len(w.Caps))
+	sort.SliceStable(names, func(i, j int) bool { return w.Capped[names[i]] > w.Capped[names[j]] })
+	for _, name := range names[:min(len(names), 10)] {
+		fmt.Fprintf(out, "  %-40s %5d registros sobre %d atendidos\n", name, w.Capped[name], w.Caps[name])
+	}
+	if len(names) > 10 {
+		fmt.Fprintf(out, "  ... y %d establecimientos más\n", len(names)-10)
+	}
+}
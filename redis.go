@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cliente mínimo de Redis con el protocolo RESP, suficiente para el caché
+// compartido de predicciones (GET y SET con vencimiento). Mantiene un grupo de
+// conexiones abiertas; una conexión que falla se descarta y se abre otra.
+
+// Conexiones libres que se conservan abiertas
+const redisPoolSize = 16
+
+// Cliente de Redis
+type redisClient struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+	timeout  time.Duration // Tiempo máximo de cada comando si ctx no tiene plazo
+	idle     chan *redisConn
+}
+
+// Conexión con su lector de respuestas
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Error devuelto por el servidor de Redis (respuesta "-ERR ...")
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// Constructor a partir de una URL redis://[usuario:clave@]host:puerto[/db][?timeout=100ms]
+// (rediss:// para TLS)
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("URL de Redis inválida: %s", rawURL)
+	}
+	c := &redisClient{
+		addr:    u.Host,
+		useTLS:  u.Scheme == "rediss",
+		timeout: 100 * time.Millisecond,
+		idle:    make(chan *redisConn, redisPoolSize),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+		if c.password == "" { // redis://clave@host
+			c.username, c.password = "", c.username
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("base de Redis inválida: %s", db)
+		}
+	}
+	if timeout := u.Query().Get("timeout"); timeout != "" {
+		if c.timeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("timeout de Redis inválido: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Función que ejecuta un comando y retorna la respuesta: string, int64, nil
+// (valor inexistente), []any o redisError
+func (c *redisClient) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.timeout)
+	}
+	conn.SetDeadline(deadline)
+	reply, err := conn.command(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close() // El estado de la conexión es desconocido
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+// Función que toma una conexión libre o abre una nueva, autenticada y con la base elegida
+func (c *redisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var raw net.Conn
+	var err error
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: host}}
+		raw, err = dialer.DialContext(ctx, "tcp", c.addr)
+	} else {
+		raw, err = (&net.Dialer{}).DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: raw, reader: bufio.NewReader(raw)}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := conn.command(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.command("SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Función que devuelve una conexión al grupo (o la cierra si está lleno)
+func (c *redisClient) put(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Función que cierra las conexiones libres
+func (c *redisClient) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Función que envía un comando como arreglo de cadenas y lee su respuesta
+func (conn *redisConn) command(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return nil, err
+	}
+	return conn.readReply()
+}
+
+// Función que lee una respuesta RESP
+func (conn *redisConn) readReply() (any, error) {
+	line, err := conn.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: respuesta vacía")
+	}
+	switch kind, rest := line[0], line[1:]; kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err // $-1: el valor no existe
+		}
+		buf := make([]byte, n+2) // Contenido más "\r\n"
+		if _, err := io.ReadFull(conn.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = conn.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: respuesta desconocida %q", line)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Modelo capaz de votar por la congestión de una atención.
+// Lo implementan RandomForest y FlatForest.
+type Predictor interface {
+	Vote(att Atencion) (votes, total int) // Votos a favor de congestión y árboles que votaron
+	NumTrees() int                        // Número de árboles del modelo
+}
+
+// Función que decide la congestión por mayoría de votos, con la política de
+// desempate del pipeline del modelo
+func predictWith(model Predictor, att Atencion) bool {
+	votes, total := model.Vote(att)
+	return decideVote(votes, total, pipelineFor(model, nil).tiePolicy()).Congested
+}
+
+// Función que abre un modelo detectando su formato: plano (mmap), sustituto
+// JSON de rules -sustituto o gob
+func OpenModel(path string) (Predictor, error) {
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(flatMagic))
+	_, err = io.ReadFull(bufio.NewReader(file), magic)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el modelo: %w", err)
+	}
+
+	if string(magic) == flatMagic {
+		return OpenFlatModel(path)
+	}
+	if magic[0] == '{' {
+		return OpenSurrogate(path)
+	}
+	return LoadModel(path)
+}
+
+// Función que identifica el contenido de un archivo de modelo por el inicio de
+// su SHA-256 (o por su ruta, si es remoto). En el almacén la suma ya está en
+// los metadatos de la versión.
+func modelFingerprint(path string) (string, error) {
+	if isStoredModel(path) {
+		info, err := statStoredModel(context.Background(), path)
+		if err != nil {
+			return "", err
+		}
+		return info.SHA256[:12], nil
+	}
+	if isRemote(path) || isHTTP(path) {
+		return path, nil
+	}
+	sum, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+	return sum[:12], nil
+}
+
+// Modelo registrado con un nombre
+type ModelEntry struct {
+	Name     string    // Nombre del modelo (por ejemplo, la región de salud)
+	Model    Predictor // Modelo que atiende las predicciones
+	Source   string    // Archivo o datos de los que proviene el modelo
+	Version  int       // Versión; aumenta cada vez que se reemplaza el modelo
+	LoadedAt time.Time // Momento en que se cargó o entrenó
+	Restored int       // Versión que se restauró con un rollback (0 si no lo es)
+
+	Fingerprint string // Identifica el contenido del modelo entre réplicas (clave del caché compartido)
+
+	inFlight sync.WaitGroup // Predicciones en curso que usan este modelo
+}
+
+// Registro concurrente de los modelos servidos por nombre
+type ModelRegistry struct {
+	mu       sync.RWMutex             // Protege los mapas de modelos
+	models   map[string]*ModelEntry   // Modelo vigente por nombre
+	shadows  map[string]*Shadow       // Candidato en modo sombra por nombre
+	canaries map[string]*Canary       // Candidato que atiende una parte del tráfico por nombre
+	previous map[string][]*ModelEntry // Versiones reemplazadas por nombre, la más reciente al final
+
+	retiring sync.WaitGroup // Modelos reemplazados que esperan para cerrarse
+}
+
+// Versiones anteriores que se conservan abiertas por modelo para poder volver a ellas
+const maxPreviousVersions = 3
+
+// Constructor para un registro de modelos vacío
+func NewModelRegistry() *ModelRegistry {
+	return &ModelRegistry{
+		models:   make(map[string]*ModelEntry),
+		shadows:  make(map[string]*Shadow),
+		canaries: make(map[string]*Canary),
+		previous: make(map[string][]*ModelEntry),
+	}
+}
+
+// Función que obtiene un modelo para usarlo. El llamador debe invocar la función
+// retornada al terminar, para que el modelo pueda liberarse si se reemplaza.
+func (r *ModelRegistry) Acquire(name string) (*ModelEntry, func(), error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.models[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("modelo no encontrado: %s", name)
+	}
+	entry.inFlight.Add(1) // Se hace con el lock tomado para no competir con Set
+	return entry, entry.inFlight.Done, nil
+}
+
+// Función que registra un modelo con un nombre, reemplazando al anterior. El
+// modelo reemplazado queda entre las versiones anteriores para un rollback; la
+// más vieja se cierra cuando terminan las predicciones que la usan.
+func (r *ModelRegistry) Set(name string, model Predictor, source, fingerprint string) *ModelEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.set(name, model, source, fingerprint)
+}
+
+// Igual que Set, con el lock ya tomado
+func (r *ModelRegistry) set(name string, model Predictor, source, fingerprint string) *ModelEntry {
+	old := r.models[name]
+	entry := &ModelEntry{Name: name, Model: model, Source: source, Version: 1, LoadedAt: time.Now(), Fingerprint: fingerprint}
+	if old != nil {
+		entry.Version = old.Version + 1
+		history := append(r.previous[name], old)
+		if len(history) > maxPreviousVersions {
+			r.retire(history[0])
+			history = history[1:]
+		}
+		r.previous[name] = history
+	}
+	r.models[name] = entry
+	return entry
+}
+
+// Función que vuelve atómicamente a la versión anterior de un modelo. La
+// versión restaurada recibe un número nuevo y la que se reemplaza se cierra
+// (no queda disponible para otro rollback).
+func (r *ModelRegistry) Rollback(name string) (*ModelEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.models[name]
+	if !ok {
+		return nil, fmt.Errorf("modelo no encontrado: %s", name)
+	}
+	history := r.previous[name]
+	if len(history) == 0 {
+		return nil, fmt.Errorf("el modelo %s no tiene una versión anterior", name)
+	}
+	prev := history[len(history)-1]
+	r.previous[name] = history[:len(history)-1]
+
+	// Entrada nueva: la anterior no tiene predicciones en curso, pero su número de versión ya se usó
+	entry := &ModelEntry{
+		Name:     name,
+		Model:    prev.Model,
+		Source:   prev.Source,
+		Version:  current.Version + 1,
+		LoadedAt: prev.LoadedAt,
+		Restored: prev.Version,
+
+		Fingerprint: prev.Fingerprint,
+	}
+	r.models[name] = entry
+	r.retire(current)
+	return entry, nil
+}
+
+// Función que retorna las versiones anteriores disponibles para un rollback, la más reciente primero
+func (r *ModelRegistry) PreviousVersions(name string) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := r.previous[name]
+	versions := make([]int, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		versions = append(versions, history[i].Version)
+	}
+	return versions
+}
+
+// Función que cierra un modelo cuando terminan las predicciones que lo usan
+func (r *ModelRegistry) retire(entry *ModelEntry) {
+	r.retiring.Add(1)
+	go func() {
+		defer r.retiring.Done()
+		entry.inFlight.Wait() // Esperar a que nadie use el modelo
+		if closer, ok := entry.Model.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+}
+
+// Función que pone un modelo candidato en sombra junto al modelo principal
+func (r *ModelRegistry) SetShadow(name string, model Predictor, source, fingerprint string) (*Shadow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.models[name]; !ok {
+		return nil, fmt.Errorf("modelo no encontrado: %s", name)
+	}
+	if _, ok := r.canaries[name]; ok {
+		return nil, fmt.Errorf("el modelo %s ya tiene un candidato en canario", name)
+	}
+	shadow := &Shadow{
+		Entry: &ModelEntry{Name: name, Model: model, Source: source, LoadedAt: time.Now(), Fingerprint: fingerprint},
+		Since: time.Now(),
+	}
+	if old, ok := r.shadows[name]; ok {
+		r.retire(old.Entry)
+	}
+	r.shadows[name] = shadow
+	return shadow, nil
+}
+
+// Función que obtiene el candidato en sombra de un modelo, si lo hay.
+// Igual que en Acquire, el llamador debe invocar la función retornada.
+func (r *ModelRegistry) AcquireShadow(name string) (*Shadow, func(), bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	shadow, ok := r.shadows[name]
+	if !ok {
+		return nil, nil, false
+	}
+	shadow.Entry.inFlight.Add(1)
+	return shadow, shadow.Entry.inFlight.Done, true
+}
+
+// Función que retorna el candidato en sombra sin reservarlo (para reportes)
+func (r *ModelRegistry) Shadow(name string) (*Shadow, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	shadow, ok := r.shadows[name]
+	return shadow, ok
+}
+
+// Función que descarta el candidato en sombra de un modelo
+func (r *ModelRegistry) RemoveShadow(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shadow, ok := r.shadows[name]
+	if ok {
+		delete(r.shadows, name)
+		r.retire(shadow.Entry)
+	}
+	return ok
+}
+
+// Error de promover un candidato que fue reemplazado después de revisar su reporte
+var errCandidateReplaced = errors.New("el candidato cambió después de revisar su reporte; vuelve a intentarlo")
+
+// Función que convierte el candidato en sombra en el modelo principal, solo
+// si sigue siendo checked (el candidato cuyo reporte se revisó). La
+// comprobación y el reemplazo se hacen con el mismo lock, así que un
+// candidato puesto en sombra entre medio nunca se promueve sin revisar.
+func (r *ModelRegistry) PromoteShadow(name string, checked *Shadow) (*ModelEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shadow, ok := r.shadows[name]
+	if !ok {
+		return nil, fmt.Errorf("el modelo %s no tiene candidato en sombra", name)
+	}
+	if shadow != checked {
+		return nil, fmt.Errorf("modelo %s: %w", name, errCandidateReplaced)
+	}
+	delete(r.shadows, name)
+
+	// El candidato deja de estar en sombra; su modelo pasa a ser el principal
+	return r.set(name, shadow.Entry.Model, shadow.Entry.Source, shadow.Entry.Fingerprint), nil
+}
+
+// Función que pone un modelo candidato en canario: atiende el porcentaje
+// indicado de las predicciones. Reemplaza al canario anterior, si lo hay.
+func (r *ModelRegistry) SetCanary(name string, model Predictor, source, fingerprint string, percent float64) (*Canary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.models[name]; !ok {
+		return nil, fmt.Errorf("modelo no encontrado: %s", name)
+	}
+	if _, ok := r.shadows[name]; ok {
+		return nil, fmt.Errorf("el modelo %s ya tiene un candidato en sombra", name)
+	}
+	canary := &Canary{
+		Entry: &ModelEntry{Name: name, Model: model, Source: source, LoadedAt: time.Now(), Fingerprint: fingerprint},
+		Since: time.Now(),
+	}
+	canary.percent.Store(percentToBasisPoints(percent))
+	if old, ok := r.canaries[name]; ok {
+		r.retire(old.Entry)
+	}
+	r.canaries[name] = canary
+	return canary, nil
+}
+
+// Función que obtiene el canario de un modelo para atender una predicción.
+// Igual que en Acquire, el llamador debe invocar la función retornada.
+func (r *ModelRegistry) AcquireCanary(name string) (*Canary, func(), bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	canary, ok := r.canaries[name]
+	if !ok {
+		return nil, nil, false
+	}
+	canary.Entry.inFlight.Add(1)
+	return canary, canary.Entry.inFlight.Done, true
+}
+
+// Función que retorna el canario sin reservarlo (para reportes y ajustes)
+func (r *ModelRegistry) Canary(name string) (*Canary, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	canary, ok := r.canaries[name]
+	return canary, ok
+}
+
+// Función que descarta el canario de un modelo; todo el tráfico vuelve al principal
+func (r *ModelRegistry) RemoveCanary(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	canary, ok := r.canaries[name]
+	if ok {
+		delete(r.canaries, name)
+		r.retire(canary.Entry)
+	}
+	return ok
+}
+
+// Función que convierte el canario en el modelo principal, solo si sigue
+// siendo checked, con el mismo lock (ver PromoteShadow)
+func (r *ModelRegistry) PromoteCanary(name string, checked *Canary) (*ModelEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	canary, ok := r.canaries[name]
+	if !ok {
+		return nil, fmt.Errorf("el modelo %s no tiene candidato en canario", name)
+	}
+	if canary != checked {
+		return nil, fmt.Errorf("modelo %s: %w", name, errCandidateReplaced)
+	}
+	delete(r.canaries, name)
+	return r.set(name, canary.Entry.Model, canary.Entry.Source, canary.Entry.Fingerprint), nil
+}
+
+// Función que retira todos los modelos y candidatos y espera a que se cierren.
+// Se usa al detener el servidor, cuando ya no llegan predicciones nuevas.
+func (r *ModelRegistry) Close() {
+	r.mu.Lock()
+	for name, entry := range r.models {
+		delete(r.models, name)
+		r.retire(entry)
+	}
+	for name, shadow := range r.shadows {
+		delete(r.shadows, name)
+		r.retire(shadow.Entry)
+	}
+	for name, canary := range r.canaries {
+		delete(r.canaries, name)
+		r.retire(canary.Entry)
+	}
+	for name, history := range r.previous {
+		delete(r.previous, name)
+		for _, entry := range history {
+			r.retire(entry)
+		}
+	}
+	r.mu.Unlock()
+	r.retiring.Wait()
+}
+
+// Función que indica si hay un modelo registrado con ese nombre
+func (r *ModelRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.models[name]
+	return ok
+}
+
+// Número de modelos registrados
+func (r *ModelRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.models)
+}
+
+// Función que lista los modelos registrados ordenados por nombre
+func (r *ModelRegistry) List() []*ModelEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]*ModelEntry, 0, len(r.models))
+	for _, entry := range r.models {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
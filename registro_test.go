@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPromoteShadowOnlyPromotesCheckedCandidate(t *testing.T) {
+	r := NewModelRegistry()
+	r.Set("modelo", &RandomForest{}, "principal.gob", "")
+	checked, err := r.SetShadow("modelo", &RandomForest{}, "revisado.gob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Otro candidato reemplaza al revisado antes de la promoción
+	if _, err := r.SetShadow("modelo", &RandomForest{}, "reemplazo.gob", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.PromoteShadow("modelo", checked); !errors.Is(err, errCandidateReplaced) {
+		t.Fatalf("error: %v, se esperaba errCandidateReplaced", err)
+	}
+
+	current, ok := r.Shadow("modelo")
+	if !ok {
+		t.Fatal("el candidato nuevo tiene que seguir en sombra")
+	}
+	entry, err := r.PromoteShadow("modelo", current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Source != "reemplazo.gob" || entry.Version != 2 {
+		t.Fatalf("promovido %s v%d, se esperaba reemplazo.gob v2", entry.Source, entry.Version)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reglas legibles: el bosque se resume en un árbol sustituto poco profundo,
+// entrenado para imitar las predicciones del bosque (no los datos) sobre
+// consultas de fondo, y cada hoja se escribe como una regla SI-ENTONCES en
+// castellano. Las reglas se ordenan con las de congestión primero y, dentro de
+// cada clase, de la más a la menos segura. La fidelidad (fracción de consultas
+// en las que el sustituto coincide con el bosque) dice cuánto se puede confiar
+// en que las reglas cuentan lo que hace el modelo. A diferencia de los árboles
+// del bosque, que eligen los cortes al azar, el sustituto elige en cada nodo el
+// corte que más reduce la impureza de Gini; las características se evalúan en
+// paralelo.
+
+// Nodo del árbol sustituto
+type ruleNode struct {
+	Feature     string    `json:"caracteristica,omitempty"` // "" en las hojas
+	Threshold   int       `json:"umbral,omitempty"`         // Las consultas con valor <= Threshold van a la izquierda
+	Left        *ruleNode `json:"izquierda,omitempty"`
+	Right       *ruleNode `json:"derecha,omitempty"`
+	Queries     int       `json:"consultas"`    // Consultas de fondo que llegan al nodo
+	Probability float64   `json:"probabilidad"` // Fracción promedio de votos de congestión del bosque en esas consultas
+	Congested   bool      `json:"congestion"`   // Predicción mayoritaria del bosque en esas consultas
+}
+
+// Regla de una hoja del sustituto
+type forestRule struct {
+	Conditions  []string
+	Congested   bool
+	Probability float64
+	Coverage    float64 // Fracción de las consultas de fondo a las que se aplica
+}
+
+// Consulta de fondo con la predicción del bosque
+type ruleSample struct {
+	att         Atencion
+	probability float64
+	congested   bool
+}
+
+// Subcomando "rules": resume el bosque en reglas SI-ENTONCES
+func rulesCommand(args []string) error {
+	fs := flag.NewFlagSet("rules", flag.ContinueOnError)
+	modelPath := fs.String("modelo", "modelo.gob.gz", "archivo del modelo")
+	dataPath := fs.String("datos", "", "CSV de atenciones de donde tomar las consultas de fondo (vacío = calendario completo de los establecimientos del modelo)")
+	featureList := fs.String("caracteristicas", "", "características de las reglas separadas por comas (vacío = las que usa el modelo)")
+	depth := fs.Int("profundidad", 3, "condiciones por regla como máximo")
+	minLeaf := fs.Float64("min-hoja", 0.02, "fracción mínima de las consultas de fondo que cubre cada regla")
+	sample := fs.Int("muestra", 5000, "consultas de fondo como máximo")
+	seed := fs.Int64("semilla", 1, "semilla para elegir la muestra de fondo")
+	output := fs.String("o", "", "archivo de las reglas (vacío = salida estándar)")
+	surrogatePath := fs.String("sustituto", "", "guardar además el árbol sustituto como un JSON independiente para predecir sin el bosque (ver sustituto.go)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *depth < 1 || *sample <= 0 {
+		return errors.New("-profundidad y -muestra deben ser positivos")
+	}
+	if *minLeaf <= 0 || *minLeaf >= 0.5 {
+		return fmt.Errorf("fracción mínima por regla inválida: %g (debe estar entre 0 y 0.5)", *minLeaf)
+	}
+
+	model, err := OpenModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+	var history []Atencion
+	if *dataPath != "" {
+		if history, err = loadAtenciones(context.Background(), *dataPath); err != nil {
+			return withExitCode(exitLoadFailure, err)
+		}
+	}
+	pipeline := pipelineFor(model, nil)
+	if pipeline == nil && history != nil {
+		pipeline = NewPipeline(history, nil) // Modelo antiguo: el histórico sirve para imputar
+	}
+	background, err := dependenceBackground(pipeline, history, *sample, *seed)
+	if err != nil {
+		return err
+	}
+	features, err := ParseFeatures(*featureList)
+	if err != nil {
+		return err
+	}
+	if features == nil {
+		if user, ok := model.(featureUser); ok {
+			features = user.UsedFeatures()
+		}
+		if len(features) == 0 {
+			features = defaultFeatures
+		}
+	}
+
+	start := time.Now()
+	samples := make([]ruleSample, len(background))
+	ties := pipelineFor(model, nil).tiePolicy()
+	for i, att := range background {
+		votes, total := model.Vote(att)
+		samples[i] = ruleSample{att: att, probability: ratio(votes, total), congested: decideVote(votes, total, ties).Congested}
+	}
+	minQueries := max(1, int(*minLeaf*float64(len(samples))))
+	root := growRuleTree(samples, features, *depth, minQueries)
+	agree := 0
+	for _, s := range samples {
+		if root.predict(s.att) == s.congested {
+			agree++
+		}
+	}
+	rules := root.rules(len(samples), ruleDomains(samples, features))
+	fidelity := ratio(agree, len(samples))
+	fmt.Fprintf(os.Stderr, "%d reglas sobre %d consultas de fondo en %v\n", len(rules), len(samples), time.Since(start).Round(time.Millisecond))
+	if *surrogatePath != "" {
+		surrogate := &Surrogate{Format: surrogateFormat, Features: features, Fidelity: fidelity, Queries: len(samples), Model: *modelPath, Root: root}
+		size, err := surrogate.Save(*surrogatePath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Sustituto guardado en %s: %d bytes, fidelidad %.1f%%\n", *surrogatePath, size, 100*fidelity)
+	}
+
+	if *output == "" {
+		return writeRules(os.Stdout, rules, fidelity)
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	if err := writeRules(w, rules, fidelity); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que arma el árbol sustituto: en cada nodo, mientras quede
+// profundidad y las consultas no coincidan todas, busca el mejor corte de cada
+// característica en paralelo y se queda con el de menor impureza
+func growRuleTree(samples []ruleSample, features []string, depth, minQueries int) *ruleNode {
+	node := &ruleNode{Queries: len(samples)}
+	congested := 0
+	for _, s := range samples {
+		node.Probability += s.probability
+		if s.congested {
+			congested++
+		}
+	}
+	node.Probability /= float64(len(samples))
+	node.Congested = congested*2 > len(samples)
+	if depth == 0 || congested == 0 || congested == len(samples) || len(samples) < 2*minQueries {
+		return node
+	}
+
+	type split struct {
+		threshold int
+		impurity  float64
+		ok        bool
+	}
+	splits := make([]split, len(features))
+	var wg sync.WaitGroup
+	for i, feature := range features {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			threshold, impurity, ok := bestRuleSplit(samples, feature, minQueries)
+			splits[i] = split{threshold, impurity, ok}
+		}()
+	}
+	wg.Wait()
+	best := -1
+	for i, s := range splits {
+		if s.ok && (best < 0 || s.impurity < splits[best].impurity) {
+			best = i
+		}
+	}
+	if best < 0 || splits[best].impurity >= gini(congested, len(samples))*float64(len(samples)) {
+		return node // Ningún corte mejora la hoja
+	}
+
+	get, _ := featureAccessor(features[best])
+	var left, right []ruleSample
+	for _, s := range samples {
+		if get(s.att) <= splits[best].threshold {
+			left = append(left, s)
+		} else {
+			right = append(right, s)
+		}
+	}
+	node.Feature, node.Threshold = features[best], splits[best].threshold
+	node.Left = growRuleTree(left, features, depth-1, minQueries)
+	node.Right = growRuleTree(right, features, depth-1, minQueries)
+	return node
+}
+
+// Función que busca el corte de una característica con menor impureza de
+// Gini ponderada que deja al menos minQueries consultas de cada lado
+func bestRuleSplit(samples []ruleSample, feature string, minQueries int) (threshold int, impurity float64, ok bool) {
+	get, _ := featureAccessor(feature)
+	type point struct {
+		value     int
+		congested bool
+	}
+	points := make([]point, len(samples))
+	total := 0
+	for i, s := range samples {
+		points[i] = point{get(s.att), s.congested}
+		if s.congested {
+			total++
+		}
+	}
+	sort.Slice(points, func(a, b int) bool { return points[a].value < points[b].value })
+	leftCongested := 0
+	for i := 0; i < len(points)-1; i++ {
+		if points[i].congested {
+			leftCongested++
+		}
+		if points[i].value == points[i+1].value {
+			continue // Solo se corta entre valores distintos
+		}
+		n := i + 1
+		if n < minQueries || len(points)-n < minQueries {
+			continue
+		}
+		candidate := gini(leftCongested, n)*float64(n) + gini(total-leftCongested, len(points)-n)*float64(len(points)-n)
+		if !ok || candidate < impurity {
+			threshold, impurity, ok = points[i].value, candidate, true
+		}
+	}
+	return threshold, impurity, ok
+}
+
+// Impureza de Gini de un nodo con positives de n consultas congestionadas
+func gini(positives, n int) float64 {
+	p := ratio(positives, n)
+	return 2 * p * (1 - p)
+}
+
+// Función que predice una consulta con el árbol sustituto
+func (n *ruleNode) predict(att Atencion) bool {
+	for n.Feature != "" {
+		get, _ := featureAccessor(n.Feature)
+		if get(att) <= n.Threshold {
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	return n.Congested
+}
+
+// Función que retorna el mínimo y el máximo de cada característica en el fondo
+func ruleDomains(samples []ruleSample, features []string) map[string][2]int {
+	domains := make(map[string][2]int, len(features))
+	for _, feature := range features {
+		get, _ := featureAccessor(feature)
+		for i, s := range samples {
+			v := get(s.att)
+			d := domains[feature]
+			if i == 0 {
+				d = [2]int{v, v}
+			}
+			d[0], d[1] = min(d[0], v), max(d[1], v)
+			domains[feature] = d
+		}
+	}
+	return domains
+}
+
+// Función que convierte cada hoja en una regla, juntando las condiciones de
+// una misma característica en un intervalo, y las ordena
+func (n *ruleNode) rules(total int, domains map[string][2]int) []forestRule {
+	var rules []forestRule
+	var walk func(node *ruleNode, bounds map[string][2]int, order []string)
+	walk = func(node *ruleNode, bounds map[string][2]int, order []string) {
+		if node.Feature == "" {
+			rule := forestRule{Congested: node.Congested, Probability: node.Probability, Coverage: ratio(node.Queries, total)}
+			for _, feature := range order {
+				rule.Conditions = append(rule.Conditions, describeInterval(feature, bounds[feature], domains[feature]))
+			}
+			rules = append(rules, rule)
+			return
+		}
+		if !slices.Contains(order, node.Feature) {
+			order = append(slices.Clone(order), node.Feature)
+		}
+		b, ok := bounds[node.Feature]
+		if !ok {
+			b = domains[node.Feature]
+		}
+		left, right := cloneBounds(bounds), cloneBounds(bounds)
+		left[node.Feature] = [2]int{b[0], min(b[1], node.Threshold)}
+		right[node.Feature] = [2]int{max(b[0], node.Threshold+1), b[1]}
+		walk(node.Left, left, order)
+		walk(node.Right, right, order)
+	}
+	walk(n, map[string][2]int{}, nil)
+	sort.SliceStable(rules, func(a, b int) bool {
+		if rules[a].Congested != rules[b].Congested {
+			return rules[a].Congested
+		}
+		if rules[a].Congested {
+			return rules[a].Probability > rules[b].Probability
+		}
+		return rules[a].Probability < rules[b].Probability
+	})
+	return rules
+}
+
+// Función que copia los intervalos de un camino del árbol
+func cloneBounds(bounds map[string][2]int) map[string][2]int {
+	clone := make(map[string][2]int, len(bounds)+1)
+	for feature, b := range bounds {
+		clone[feature] = b
+	}
+	return clone
+}
+
+// Función que describe en castellano que una característica está en el
+// intervalo [lo, hi], omitiendo los extremos que coinciden con su dominio
+func describeInterval(feature string, interval, domain [2]int) string {
+	lo, hi := interval[0], interval[1]
+	value := func(v int) string { return fmt.Sprint(v) }
+	switch feature {
+	case "Mes":
+		value = func(v int) string { return monthNames[max(1, min(v, 12))] }
+	case "Dia":
+		value = func(v int) string { return fmt.Sprintf("el %d", v) }
+	}
+	name, ok := featureDescriptions[feature]
+	if !ok {
+		name = feature
+	}
+	switch {
+	case lo == hi:
+		return fmt.Sprintf("%s es %s", name, value(lo))
+	case lo <= domain[0]:
+		return fmt.Sprintf("%s es hasta %s", name, value(hi))
+	case hi >= domain[1]:
+		return fmt.Sprintf("%s es desde %s", name, value(lo))
+	}
+	if feature == "Dia" {
+		return fmt.Sprintf("%s es del %d al %d", name, lo, hi)
+	}
+	return fmt.Sprintf("%s es de %s a %s", name, value(lo), value(hi))
+}
+
+// Función que escribe las reglas numeradas, con la fidelidad del sustituto al final
+func writeRules(w io.Writer, rules []forestRule, fidelity float64) error {
+	for i, rule := range rules {
+		condition := "SIEMPRE"
+		if len(rule.Conditions) > 0 {
+			condition = "SI " + strings.Join(rule.Conditions, " Y ")
+		}
+		verdict := "sin congestión"
+		if rule.Congested {
+			verdict = "congestión"
+		}
+		fmt.Fprintf(w, "%d. %s ENTONCES %s (%.0f%% de los árboles votan congestión; %.0f%% de los días)\n",
+			i+1, condition, verdict, 100*rule.Probability, 100*rule.Coverage)
+	}
+	_, err := fmt.Fprintf(w, "\nLas reglas coinciden con el bosque en el %.1f%% de los días.\n", 100*fidelity)
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Relleno del calendario: un establecimiento sin fila en un día (cerrado, o sin
+// reporte) no aparece en los datos, y eso sesga los promedios del imputador y
+// deja huecos en las series. Con esta pasada, entre el primer y el último día
+// con datos de cada establecimiento se agrega una fila por cada día que falta,
+// con ceros (el establecimiento estuvo cerrado) o con el promedio histórico de
+// ese establecimiento en ese mes. Los datos no tienen año, así que el 29 de
+// febrero nunca se agrega: solo existe en los años bisiestos.
+
+// Modos de relleno del calendario
+const (
+	gapFillNone    = ""         // Sin relleno
+	gapFillZero    = "ceros"    // Filas con cero atendidos y cero atenciones
+	gapFillImputed = "promedio" // Filas con el promedio del establecimiento en el mes
+)
+
+// Día del calendario del 29 de febrero (el calendario es de un año bisiesto)
+var leapDay = calendarDay(2, 29)
+
+// Resultado del relleno de un establecimiento
+type gapFill struct {
+	Establishment string
+	First, Last   int        // Primer y último día del calendario con datos
+	Added         []Atencion // Filas agregadas, en orden de fecha
+}
+
+// Resumen del relleno, por establecimiento
+type GapReport struct {
+	Mode  string
+	Fills []gapFill // Ordenados por nombre de establecimiento
+}
+
+// Función que valida el modo de relleno
+func checkGapFillMode(mode string) error {
+	switch mode {
+	case gapFillNone, gapFillZero, gapFillImputed:
+		return nil
+	}
+	return fmt.Errorf("relleno del calendario desconocido %q (ceros o promedio)", mode)
+}
+
+// Función que completa los días que faltan de cada establecimiento. Cada
+// establecimiento se recorre en su goroutine; las filas agregadas van al final
+// de los registros, que no se modifican.
+func fillCalendarGaps(data []Atencion, mode string) ([]Atencion, *GapReport) {
+	report := &GapReport{Mode: mode}
+	if mode == gapFillNone {
+		return data, report
+	}
+	days := make(map[string]map[int]bool)
+	for _, att := range data {
+		seen, ok := days[att.NombreEstablecimiento]
+		if !ok {
+			seen = make(map[int]bool)
+			days[att.NombreEstablecimiento] = seen
+		}
+		seen[calendarDay(att.Mes, att.Dia)] = true
+	}
+	var imputer *Imputer
+	if mode == gapFillImputed {
+		imputer = NewImputer(data)
+	}
+
+	names := sortedKeys(days)
+	report.Fills = make([]gapFill, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Fills[i] = fillEstablishmentGaps(name, days[name], imputer)
+		}()
+	}
+	wg.Wait()
+
+	filled := make([]Atencion, len(data), len(data)+report.Added())
+	copy(filled, data)
+	for _, fill := range report.Fills {
+		filled = append(filled, fill.Added...)
+	}
+	return filled, report
+}
+
+// Función que retorna las filas que faltan entre el primer y el último día con
+// datos de un establecimiento. Con imputador nil las filas van en cero.
+func fillEstablishmentGaps(name string, seen map[int]bool, imputer *Imputer) gapFill {
+	fill := gapFill{Establishment: name, First: 367, Last: 0}
+	for day := range seen {
+		fill.First, fill.Last = min(fill.First, day), max(fill.Last, day)
+	}
+	for day := fill.First; day <= fill.Last; day++ {
+		if seen[day] || day == leapDay {
+			continue
+		}
+		month, dayOfMonth := calendarDate(day)
+		att := Atencion{Mes: month, Dia: dayOfMonth, NombreEstablecimiento: name}
+		if imputer != nil {
+			att = imputer.Fill(att)
+		}
+		fill.Added = append(fill.Added, att)
+	}
+	return fill
+}
+
+// Función que retorna el total de filas agregadas
+func (r *GapReport) Added() int {
+	total := 0
+	for _, fill := range r.Fills {
+		total += len(fill.Added)
+	}
+	return total
+}
+
+// Función que escribe cuántas filas se agregaron, con los establecimientos que
+// tenían más huecos primero
+func (r *GapReport) Print(w io.Writer) {
+	fills := make([]gapFill, 0, len(r.Fills))
+	for _, fill := range r.Fills {
+		if len(fill.Added) > 0 {
+			fills = append(fills, fill)
+		}
+	}
+	fmt.Fprintf(w, "Relleno del calendario (%s): %d filas agregadas en %d de %d establecimientos\n",
+		r.Mode, r.Added(), len(fills), len(r.Fills))
+	sort.SliceStable(fills, func(i, j int) bool { return len(fills[i].Added) > len(fills[j].Added) })
+	for _, fill := range fills[:min(len(fills), 10)] {
+		firstMonth, firstDay := calendarDate(fill.First)
+		lastMonth, lastDay := calendarDate(fill.Last)
+		fmt.Fprintf(w, "  %-40s %5d días agregados entre el %d/%d y el %d/%d\n",
+			fill.Establishment, len(fill.Added), firstDay, firstMonth, lastDay, lastMonth)
+	}
+	if len(fills) > 10 {
+		fmt.Fprintf(w, "  ... y %d establecimientos más\n", len(fills)-10)
+	}
+}
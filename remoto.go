@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entrada y salida de archivos que pueden estar en disco o en almacenamiento de
+// objetos (s3://bucket/clave y gs://bucket/clave). Las descargas y subidas se
+// hacen por flujo, sin tener el archivo completo en memoria, y se reintentan.
+
+// Número de reintentos de cada descarga o tramo de subida
+const remoteRetries = 3
+
+// Tamaño de los tramos de subida: múltiplo de 256 KiB (GCS) y mayor que 5 MiB (S3)
+const uploadPartSize = 8 << 20
+
+// Almacenamiento de objetos remoto
+type objectStore interface {
+	get(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, error)
+	newUpload(ctx context.Context, bucket, key string) (chunkUploader, error)
+	version(ctx context.Context, bucket, key string) (string, error) // Identificador que cambia con cada escritura
+}
+
+// Subida por tramos en curso
+type chunkUploader interface {
+	uploadPart(ctx context.Context, part []byte, final bool) error
+	complete(ctx context.Context) error
+	abort(ctx context.Context)
+}
+
+// Función que indica si la ruta corresponde a un objeto remoto
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// Función que separa una URI remota en su almacenamiento, bucket y clave
+func parseRemote(path string) (objectStore, string, string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, "", "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, "", "", fmt.Errorf("ruta remota inválida %q, se espera esquema://bucket/clave", path)
+	}
+	store, err := objectStoreFor(u.Scheme)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return store, u.Host, key, nil
+}
+
+// Función que crea el cliente del almacenamiento de un esquema (s3 o gs)
+func objectStoreFor(scheme string) (objectStore, error) {
+	switch scheme {
+	case "s3":
+		return newS3ClientFromEnv()
+	case "gs":
+		return newGCSClientFromEnv()
+	}
+	return nil, fmt.Errorf("almacenamiento de objetos desconocido: %s", scheme)
+}
+
+// Error de un objeto que no existe, para reconocerlo con errors.Is
+var errObjectNotFound = errors.New("el objeto no existe")
+
+// Función que marca el error de una respuesta 404 como objeto inexistente
+func objectError(status int, err error) error {
+	if status == http.StatusNotFound {
+		return fmt.Errorf("%w (%w)", err, errObjectNotFound)
+	}
+	return err
+}
+
+// Función que sube un objeto completo en un solo tramo
+func putObject(ctx context.Context, store objectStore, bucket, key string, data []byte) error {
+	upload, err := store.newUpload(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := upload.uploadPart(ctx, data, true); err != nil {
+		upload.abort(context.WithoutCancel(ctx))
+		return err
+	}
+	return upload.complete(ctx)
+}
+
+// Función que descarga un objeto completo
+func getObject(ctx context.Context, store objectStore, bucket, key string) ([]byte, error) {
+	body, err := store.get(ctx, bucket, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// Función que abre un archivo local o remoto para leerlo. Las URL HTTP(S) se
+// descargan primero al caché local.
+func openInput(ctx context.Context, path string) (io.ReadCloser, error) {
+	if isHTTP(path) {
+		local, err := fetchURL(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(local)
+	}
+	if isStoredModel(path) {
+		return openStoredModel(ctx, path)
+	}
+	if !isRemote(path) {
+		return os.Open(path)
+	}
+	store, bucket, key, err := parseRemote(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &remoteReader{ctx: ctx, path: path, fetch: func(offset int64) (io.ReadCloser, error) {
+		return store.get(ctx, bucket, key, offset)
+	}}
+	if err := r.reopen(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Función que retorna la versión actual de un objeto remoto (ETag en S3,
+// generación en GCS, número de versión en el almacén) sin descargarlo
+func remoteVersion(ctx context.Context, path string) (string, error) {
+	if isStoredModel(path) {
+		info, err := statStoredModel(ctx, path)
+		return strconv.Itoa(info.Version), err
+	}
+	store, bucket, key, err := parseRemote(path)
+	if err != nil {
+		return "", err
+	}
+	return store.version(ctx, bucket, key)
+}
+
+// Lector de un objeto remoto que, si la conexión se corta, vuelve a pedir el
+// objeto desde el último byte leído
+type remoteReader struct {
+	ctx    context.Context
+	path   string
+	fetch  func(offset int64) (io.ReadCloser, error)
+	body   io.ReadCloser
+	offset int64
+}
+
+// Función que (re)abre la descarga en el desplazamiento actual, con reintentos
+func (r *remoteReader) reopen(cause error) error {
+	err := cause
+	for attempt := 0; attempt <= remoteRetries; attempt++ {
+		if attempt > 0 || cause != nil {
+			log.Printf("Reintentando la descarga de %s desde el byte %d: %v", r.path, r.offset, err)
+			if werr := sleepContext(r.ctx, time.Duration(attempt+1)*time.Second); werr != nil {
+				return werr
+			}
+		}
+		if r.body, err = r.fetch(r.offset); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (r *remoteReader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		return 0, io.ErrClosedPipe
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	// La conexión se cortó a mitad del objeto: continuar desde donde quedó
+	r.body.Close()
+	r.body = nil
+	if rerr := r.reopen(err); rerr != nil {
+		return n, rerr
+	}
+	return n, nil
+}
+
+func (r *remoteReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// Archivo de salida local o remoto. Close confirma lo escrito; Abort lo
+// descarta si todavía no se confirmó (en remoto el objeto no llega a crearse).
+type outputFile interface {
+	io.WriteCloser
+	Abort()
+}
+
+// Función que crea un archivo local o remoto para escribirlo
+func createOutput(ctx context.Context, path string) (outputFile, error) {
+	if isStoredModel(path) {
+		return createStoredModel(ctx, path)
+	}
+	if !isRemote(path) {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &localOutput{File: file}, nil
+	}
+	store, bucket, key, err := parseRemote(path)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := store.newUpload(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteWriter{ctx: ctx, path: path, upload: upload, buf: make([]byte, 0, uploadPartSize)}, nil
+}
+
+// Archivo local como salida
+type localOutput struct {
+	*os.File
+	closed bool
+}
+
+func (l *localOutput) Close() error {
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.File.Close()
+}
+
+func (l *localOutput) Abort() {
+	l.Close()
+}
+
+// Escritor que acumula tramos y los sube a medida que se llenan
+type remoteWriter struct {
+	ctx    context.Context
+	path   string
+	upload chunkUploader
+	buf    []byte
+	done   bool
+	err    error
+}
+
+func (w *remoteWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		if len(w.buf) == cap(w.buf) {
+			if w.err = w.send(false); w.err != nil {
+				return written - len(p), w.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Función que sube el tramo acumulado con reintentos
+func (w *remoteWriter) send(final bool) error {
+	var err error
+	for attempt := 0; attempt <= remoteRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Reintentando la subida de %s (intento %d): %v", w.path, attempt, err)
+			if werr := sleepContext(w.ctx, time.Duration(attempt)*time.Second); werr != nil {
+				return werr
+			}
+		}
+		if err = w.upload.uploadPart(w.ctx, w.buf, final); err == nil {
+			w.buf = w.buf[:0]
+			return nil
+		}
+	}
+	return fmt.Errorf("no se pudo subir %s: %w", w.path, err)
+}
+
+// Función que sube el último tramo y confirma el objeto
+func (w *remoteWriter) Close() error {
+	if w.done {
+		return w.err
+	}
+	w.done = true
+	if w.err == nil {
+		w.err = w.send(true)
+	}
+	if w.err == nil {
+		w.err = w.upload.complete(w.ctx)
+	}
+	if w.err != nil {
+		w.upload.abort(context.WithoutCancel(w.ctx))
+	}
+	return w.err
+}
+
+func (w *remoteWriter) Abort() {
+	if !w.done {
+		w.done = true
+		w.upload.abort(context.WithoutCancel(w.ctx))
+	}
+}
+
+// Función que espera d o hasta que se cancele el contexto
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
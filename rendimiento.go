@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+)
+
+// Micro-benchmarks de los caminos críticos: lectura de registros, división y
+// construcción de árboles, predicción individual y por lote. Cada uno repite n
+// veces su operación; las funciones Benchmark* de rendimiento_test.go los
+// ejecutan con go test -bench y el subcomando "bench" con su propio medidor,
+// para compararlos entre versiones sin el paquete testing en el binario. Los
+// datos salen del generador sintético con una semilla fija, así que todas las
+// ejecuciones miden lo mismo. -o guarda los resultados en JSON y -base compara
+// con un JSON anterior, para ver si un cambio empeoró algún camino.
+
+// Benchmark con su nombre, en el orden en que se ejecutan
+type namedBenchmark struct {
+	name  string
+	fn    func(f *benchFixture, n int) error
+	bytes bool // Si cada operación procesa el CSV completo (para informar MB/s)
+}
+
+// Benchmarks disponibles
+var benchmarks = []namedBenchmark{
+	{"BenchmarkParseRecords", benchmarkParseRecords, true},
+	{"BenchmarkSplitData", benchmarkSplitData, false},
+	{"BenchmarkBuildTree", benchmarkBuildTree, false},
+	{"BenchmarkPredict", benchmarkPredict, false},
+	{"BenchmarkPredictBatch", benchmarkPredictBatch, false},
+}
+
+// Tamaño por defecto de los datos sintéticos y del bosque de los benchmarks
+const (
+	benchFacilities = 50
+	benchDays       = 365
+	benchTrees      = 100
+)
+
+// Función que retorna las opciones del generador para los datos de los benchmarks
+func benchGenerateOptions(facilities, days int) GenerateOptions {
+	return GenerateOptions{Facilities: facilities, Days: days, Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Pattern: "weekly", Noise: 0.2, Seed: 1}
+}
+
+// Datos compartidos por los benchmarks, preparados una vez
+type benchFixture struct {
+	csvPath string        // CSV sintético en un directorio temporal
+	csvSize int64         // Tamaño del CSV en bytes
+	data    []Atencion    // Registros leídos del CSV
+	forest  *RandomForest // Bosque entrenado con los registros
+	queries []batchQuery  // Consultas de predicción, una por establecimiento y día
+}
+
+// Función que genera el CSV, lo lee y entrena el bosque de los benchmarks
+func newBenchFixture(dir string, opts GenerateOptions, trees int) (*benchFixture, error) {
+	var csvData bytes.Buffer
+	if _, err := GenerateAttendances(&csvData, opts); err != nil {
+		return nil, err
+	}
+	f := &benchFixture{csvPath: filepath.Join(dir, "atenciones.csv"), csvSize: int64(csvData.Len())}
+	if err := os.WriteFile(f.csvPath, csvData.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+	var err error
+	if f.data, err = loadAtenciones(context.Background(), f.csvPath); err != nil {
+		return nil, err
+	}
+	f.forest = &RandomForest{}
+	f.forest.TrainTrees(f.data, trees)
+	for _, att := range f.data[:min(len(f.data), 1000)] {
+		f.queries = append(f.queries, batchQuery{Establishment: att.NombreEstablecimiento, Month: att.Mes, Day: att.Dia})
+	}
+	return f, nil
+}
+
+// Lectura y validación concurrente del CSV completo
+func benchmarkParseRecords(f *benchFixture, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := loadAtenciones(context.Background(), f.csvPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// División de todos los registros por mes
+func benchmarkSplitData(f *benchFixture, n int) error {
+	dt := NewDecisionTree()
+	for i := 0; i < n; i++ {
+		dt.splitData(f.data, "Mes", 6)
+	}
+	return nil
+}
+
+// Construcción de un árbol con todos los registros
+func benchmarkBuildTree(f *benchFixture, n int) error {
+	for i := 0; i < n; i++ {
+		dt := NewDecisionTree()
+		dt.Features = f.forest.Pipeline.Features
+		dt.CongestionThreshold = f.forest.Pipeline.CongestionThreshold
+		dt.Train(f.data)
+	}
+	return nil
+}
+
+// Predicción de una consulta con el bosque completo
+func benchmarkPredict(f *benchFixture, n int) error {
+	for i := 0; i < n; i++ {
+		q := f.queries[i%len(f.queries)]
+		f.forest.Predict(q.Establishment, q.Month, q.Day)
+	}
+	return nil
+}
+
+// Predicción de las consultas con el grupo de workers de predict-batch
+func benchmarkPredictBatch(f *benchFixture, n int) error {
+	for i := 0; i < n; i++ {
+		predictBatch(f.forest, f.forest.Pipeline, f.queries, 0)
+	}
+	return nil
+}
+
+// Función que ejecuta un benchmark con cada vez más repeticiones, como go test
+// -bench, hasta que una pasada dura al menos minTime, y mide tiempo y asignaciones
+func runBenchmark(bm namedBenchmark, f *benchFixture, minTime time.Duration) (benchRecord, error) {
+	for n := 1; ; {
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		if err := bm.fn(f, n); err != nil {
+			return benchRecord{}, fmt.Errorf("%s falló: %w", bm.name, err)
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if elapsed >= minTime || n >= 1e9 {
+			record := benchRecord{
+				Name:        bm.name,
+				Iterations:  n,
+				NsPerOp:     elapsed.Nanoseconds() / int64(n),
+				BytesPerOp:  int64(after.TotalAlloc-before.TotalAlloc) / int64(n),
+				AllocsPerOp: int64(after.Mallocs-before.Mallocs) / int64(n),
+			}
+			if bm.bytes && elapsed > 0 {
+				record.MBPerSecond = float64(f.csvSize) * float64(n) / 1e6 / elapsed.Seconds()
+			}
+			return record, nil
+		}
+		// Estimar las repeticiones que alcanzan minTime, con un 20% de margen y
+		// sin crecer más de 100 veces por pasada
+		next := 100 * n
+		if elapsed > 0 {
+			next = int(1.2 * float64(n) * float64(minTime) / float64(elapsed))
+		}
+		n = min(max(next, n+1), 100*n, 1e9)
+	}
+}
+
+// Resultado de un benchmark, guardado con -o
+type benchRecord struct {
+	Name        string  `json:"nombre"`
+	Iterations  int     `json:"iteraciones"`
+	NsPerOp     int64   `json:"ns_por_op"`
+	BytesPerOp  int64   `json:"bytes_por_op"`
+	AllocsPerOp int64   `json:"allocs_por_op"`
+	MBPerSecond float64 `json:"mb_por_segundo,omitempty"`
+}
+
+// Función que lee los resultados de una ejecución anterior, por nombre
+func readBenchBaseline(path string) (map[string]benchRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []benchRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("resultados anteriores inválidos en %s: %w", path, err)
+	}
+	baseline := make(map[string]benchRecord, len(records))
+	for _, r := range records {
+		baseline[r.Name] = r
+	}
+	return baseline, nil
+}
+
+// Subcomando "bench": ejecuta los benchmarks y muestra ns/op y allocs/op
+func benchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	pattern := fs.String("filtro", ".", "expresión regular de los benchmarks a ejecutar")
+	duration := fs.Duration("tiempo", time.Second, "tiempo mínimo de cada benchmark")
+	facilities := fs.Int("establecimientos", benchFacilities, "establecimientos del CSV sintético")
+	days := fs.Int("dias", benchDays, "días del CSV sintético")
+	trees := fs.Int("arboles", benchTrees, "árboles del bosque de los benchmarks de predicción")
+	output := fs.String("o", "", "archivo JSON donde guardar los resultados")
+	baselinePath := fs.String("base", "", "JSON de una ejecución anterior con el que comparar")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	filter, err := regexp.Compile(*pattern)
+	if err != nil {
+		return fmt.Errorf("filtro inválido: %w", err)
+	}
+	if *trees <= 0 {
+		return fmt.Errorf("número de árboles inválido: %d", *trees)
+	}
+	var baseline map[string]benchRecord
+	if *baselinePath != "" {
+		if baseline, err = readBenchBaseline(*baselinePath); err != nil {
+			return err
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "tp-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	fixture, err := newBenchFixture(dir, benchGenerateOptions(*facilities, *days), *trees)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Datos: %d registros (%d bytes), bosque de %d árboles\n", len(fixture.data), fixture.csvSize, len(fixture.forest.Trees))
+
+	var records []benchRecord
+	for _, bm := range benchmarks {
+		if !filter.MatchString(bm.name) {
+			continue
+		}
+		record, err := runBenchmark(bm, fixture, *duration)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+
+		line := fmt.Sprintf("%-24s %8d\t%10d ns/op", bm.name, record.Iterations, record.NsPerOp)
+		if record.MBPerSecond > 0 {
+			line += fmt.Sprintf("\t%7.2f MB/s", record.MBPerSecond)
+		}
+		line += fmt.Sprintf("\t%8d B/op\t%8d allocs/op", record.BytesPerOp, record.AllocsPerOp)
+		if previous, ok := baseline[bm.name]; ok && previous.NsPerOp > 0 {
+			line += fmt.Sprintf("\t%+.1f%% ns/op", 100*float64(record.NsPerOp-previous.NsPerOp)/float64(previous.NsPerOp))
+		}
+		fmt.Println(line)
+	}
+	if len(records) == 0 {
+		return errors.New("ningún benchmark coincide con el filtro")
+	}
+	if *output == "" {
+		return nil
+	}
+	if err := writeJSONOutput(*output, records); err != nil {
+		return err
+	}
+	fmt.Printf("Resultados guardados en %s\n", *output)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+// Datos de los benchmarks, preparados una vez para todas las funciones Benchmark*
+var (
+	benchOnce     sync.Once
+	benchDir      string
+	benchShared   *benchFixture
+	benchSetupErr error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
+
+// Función que ejecuta un benchmark de rendimiento.go con b.N repeticiones
+func runNamedBenchmark(b *testing.B, fn func(f *benchFixture, n int) error, bytes bool) {
+	benchOnce.Do(func() {
+		if benchDir, benchSetupErr = os.MkdirTemp("", "tp-bench-"); benchSetupErr == nil {
+			benchShared, benchSetupErr = newBenchFixture(benchDir, benchGenerateOptions(benchFacilities, benchDays), benchTrees)
+		}
+	})
+	if benchSetupErr != nil {
+		b.Fatal(benchSetupErr)
+	}
+	if bytes {
+		b.SetBytes(benchShared.csvSize)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := fn(benchShared, b.N); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkParseRecords(b *testing.B) { runNamedBenchmark(b, benchmarkParseRecords, true) }
+func BenchmarkSplitData(b *testing.B)    { runNamedBenchmark(b, benchmarkSplitData, false) }
+func BenchmarkBuildTree(b *testing.B)    { runNamedBenchmark(b, benchmarkBuildTree, false) }
+func BenchmarkPredict(b *testing.B)      { runNamedBenchmark(b, benchmarkPredict, false) }
+func BenchmarkPredictBatch(b *testing.B) { runNamedBenchmark(b, benchmarkPredictBatch, false) }
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Nombres de los meses para los reportes
+var monthNames = [...]string{"", "enero", "febrero", "marzo", "abril", "mayo", "junio",
+	"julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"}
+
+// Subcomando "forecast-report": genera el pronóstico de congestión de un mes
+// para cada establecimiento, en Markdown o en HTML listo para imprimir a PDF.
+func forecastReportCommand(args []string) error {
+	fs := flag.NewFlagSet("forecast-report", flag.ContinueOnError)
+	modelPath := fs.String("modelo", "modelo.gob.gz", "archivo del modelo")
+	month := fs.Int("mes", int(time.Now().Month()), "mes a pronosticar (1-12)")
+	year := fs.Int("anio", time.Now().Year(), "año, para saber cuántos días tiene el mes")
+	dataPath := fs.String("datos", "", "CSV histórico para la comparación (vacío = sin comparación)")
+	format := fs.String("formato", "markdown", "formato del reporte: markdown o html")
+	output := fs.String("o", "", "archivo del reporte (vacío = salida estándar)")
+	anomaly := fs.Float64("anomalia", 0.25, "diferencia entre la tasa pronosticada y la histórica que se reporta como anomalía")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *month < 1 || *month > 12 {
+		return errors.New("mes inválido")
+	}
+	if *format != "markdown" && *format != "html" {
+		return fmt.Errorf("formato desconocido %q (markdown o html)", *format)
+	}
+
+	model, err := OpenModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	if closer, ok := model.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	var history []Atencion
+	if *dataPath != "" {
+		if history, err = loadAtenciones(context.Background(), *dataPath); err != nil {
+			return err
+		}
+	}
+	pipeline := pipelineFor(model, nil)
+	if pipeline == nil && history != nil {
+		pipeline = NewPipeline(history, nil) // Modelo antiguo: el histórico sirve para imputar
+	}
+
+	report, err := buildForecastReport(model, pipeline, history, *modelPath, *year, *month, *anomaly)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return report.render(os.Stdout, *format)
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := bufio.NewWriter(file)
+	if err := report.render(w, *format); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que escribe el reporte en el formato indicado (markdown o html)
+func (r *forecastReport) render(w io.Writer, format string) error {
+	if format == "html" {
+		return htmlReportTemplate.Execute(w, r)
+	}
+	return markdownReportTemplate.Execute(w, r)
+}
+
+// Título del reporte, usado también como asunto al enviarlo
+func (r *forecastReport) Title() string {
+	return fmt.Sprintf("Pronóstico de congestión: %s %d", strings.ToUpper(r.MonthName[:1])+r.MonthName[1:], r.Year)
+}
+
+// Pronóstico de un establecimiento para el mes
+type forecastRow struct {
+	Establishment   string
+	ExpectedDays    float64 // Suma de las probabilidades diarias de congestión
+	CongestedDays   int     // Días en los que la mayoría de los árboles predice congestión
+	PeakDay         int     // Día con mayor probabilidad
+	PeakProbability float64 // Probabilidad del día pico
+	HistoricalDays  int     // Días congestionados de ese mes en el histórico
+	ObservedDays    int     // Días de ese mes con datos en el histórico
+}
+
+// Tasa de días congestionados pronosticada
+func (r forecastRow) ForecastRate(days int) float64 {
+	return r.ExpectedDays / float64(days)
+}
+
+// Tasa de días congestionados en el histórico (-1 sin datos)
+func (r forecastRow) HistoricalRate() float64 {
+	if r.ObservedDays == 0 {
+		return -1
+	}
+	return float64(r.HistoricalDays) / float64(r.ObservedDays)
+}
+
+// Reporte mensual completo
+type forecastReport struct {
+	Model      string
+	Month      int
+	MonthName  string
+	Year       int
+	Days       int
+	Generated  time.Time
+	HasHistory bool
+	Rows       []forecastRow
+	Anomalies  []string
+}
+
+// Función que predice todos los días del mes para cada establecimiento y los
+// compara con el mismo mes del histórico
+func buildForecastReport(model Predictor, pipeline *Pipeline, history []Atencion, modelPath string, year, month int, anomaly float64) (*forecastReport, error) {
+	days := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day() // Último día del mes
+
+	// Establecimientos: los del histórico o, sin él, los que conoce el pipeline
+	threshold := func(string) int { return congestionThreshold }
+	names := make(map[string]bool)
+	for _, att := range history {
+		names[att.NombreEstablecimiento] = true
+	}
+	if pipeline != nil {
+		threshold = pipeline.ThresholdFor
+		if len(names) == 0 {
+			for _, name := range pipeline.Establishments {
+				names[name] = true
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no hay establecimientos: indica un histórico con -datos")
+	}
+	establishments := sortedKeys(names)
+
+	// Una consulta por establecimiento y día, predichas en paralelo
+	queries := make([]batchQuery, 0, len(establishments)*days)
+	for _, name := range establishments {
+		for day := 1; day <= days; day++ {
+			queries = append(queries, batchQuery{Establishment: name, Month: month, Day: day})
+		}
+	}
+	results := predictBatch(model, pipeline, queries, 0)
+
+	// Días congestionados de ese mes en el histórico, por establecimiento
+	actuals := aggregateActuals(history, threshold)
+
+	report := &forecastReport{
+		Model:      modelPath,
+		Month:      month,
+		MonthName:  monthNames[month],
+		Year:       year,
+		Days:       days,
+		Generated:  time.Now(),
+		HasHistory: len(history) > 0,
+	}
+	for i, name := range establishments {
+		row := forecastRow{Establishment: name}
+		for _, r := range results[i*days : (i+1)*days] {
+			probability := 0.0
+			if r.Trees > 0 {
+				probability = float64(r.Votes) / float64(r.Trees)
+			}
+			row.ExpectedDays += probability
+			if r.Congested {
+				row.CongestedDays++
+			}
+			if probability > row.PeakProbability || row.PeakDay == 0 {
+				row.PeakDay, row.PeakProbability = r.Query.Day, probability
+			}
+			if congested, ok := actuals[dayKey{normalizeEstablishment(name), month, r.Query.Day}]; ok {
+				row.ObservedDays++
+				if congested {
+					row.HistoricalDays++
+				}
+			}
+		}
+		report.Rows = append(report.Rows, row)
+
+		// Anomalías: pronóstico muy distinto del histórico o establecimiento sin historia
+		if report.HasHistory {
+			historical := row.HistoricalRate()
+			switch {
+			case historical < 0:
+				report.Anomalies = append(report.Anomalies, fmt.Sprintf("%s no tiene datos de %s en el histórico", name, monthNames[month]))
+			case math.Abs(row.ForecastRate(days)-historical) >= anomaly:
+				report.Anomalies = append(report.Anomalies, fmt.Sprintf("%s: se pronostican %.1f días congestionados frente a %d de %d en el histórico",
+					name, row.ExpectedDays, row.HistoricalDays, row.ObservedDays))
+			}
+		}
+	}
+
+	// Primero los establecimientos con más días congestionados esperados
+	sort.SliceStable(report.Rows, func(i, j int) bool {
+		return report.Rows[i].ExpectedDays > report.Rows[j].ExpectedDays
+	})
+	return report, nil
+}
+
+// Funciones disponibles en las plantillas
+var reportFuncs = map[string]any{
+	"pct":  func(x float64) string { return fmt.Sprintf("%.0f%%", x*100) },
+	"f1":   func(x float64) string { return fmt.Sprintf("%.1f", x) },
+	"date": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+}
+
+var markdownReportTemplate = template.Must(template.New("markdown").Funcs(reportFuncs).Parse(`# {{.Title}}
+
+Generado el {{date .Generated}} con el modelo ` + "`{{.Model}}`" + `.
+
+| Establecimiento | Días congestionados esperados | Días con mayoría | Día pico | Probabilidad pico |{{if .HasHistory}} Histórico |{{end}}
+|---|---:|---:|---:|---:|{{if .HasHistory}}---:|{{end}}
+{{- $days := .Days}}{{$history := .HasHistory}}
+{{range .Rows}}| {{.Establishment}} | {{f1 .ExpectedDays}} de {{$days}} | {{.CongestedDays}} | {{.PeakDay}} | {{pct .PeakProbability}} |{{if $history}} {{if ge .HistoricalRate 0.0}}{{.HistoricalDays}} de {{.ObservedDays}}{{else}}sin datos{{end}} |{{end}}
+{{end}}
+{{- if .Anomalies}}
+## Anomalías
+
+{{range .Anomalies}}- {{.}}
+{{end}}{{end}}`))
+
+var htmlReportTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #999; padding: 4px 8px; }
+td.n { text-align: right; }
+tr { page-break-inside: avoid; }
+@page { size: A4; margin: 1.5cm; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generado el {{date .Generated}} con el modelo <code>{{.Model}}</code>.</p>
+{{- $days := .Days}}{{$history := .HasHistory}}
+<table>
+<tr><th>Establecimiento</th><th>Días congestionados esperados</th><th>Días con mayoría</th><th>Día pico</th><th>Probabilidad pico</th>{{if $history}}<th>Histórico</th>{{end}}</tr>
+{{range .Rows}}<tr><td>{{.Establishment}}</td><td class="n">{{f1 .ExpectedDays}} de {{$days}}</td><td class="n">{{.CongestedDays}}</td><td class="n">{{.PeakDay}}</td><td class="n">{{pct .PeakProbability}}</td>{{if $history}}<td class="n">{{if ge .HistoricalRate 0.0}}{{.HistoricalDays}} de {{.ObservedDays}}{{else}}sin datos{{end}}</td>{{end}}</tr>
+{{end}}</table>
+{{- if .Anomalies}}
+<h2>Anomalías</h2>
+<ul>
+{{range .Anomalies}}<li>{{.}}</li>
+{{end}}</ul>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Rollback en un solo comando: si el modelo recién publicado se comporta mal,
+// "tpconcurrente rollback default" le pide al servidor que vuelva a la versión
+// anterior, que sigue abierta en el registro, sin tener que buscar y recargar el
+// archivo a mano. La clave de API se toma de TP_CLAVE para que no quede en el
+// historial de la terminal.
+
+// Función del subcomando rollback
+func rollbackCommand(args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	serverURL := fs.String("servidor", "http://localhost:8080", "URL del servidor o unix:/ruta/al/socket")
+	timeout := fs.Duration("timeout", 30*time.Second, "tiempo máximo de espera de la respuesta")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: tpconcurrente rollback [opciones] [modelo]")
+		fmt.Fprintln(fs.Output(), "Vuelve a la versión anterior del modelo (por defecto \"default\") en un servidor en marcha.")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return errors.New("se espera un solo modelo")
+	}
+	name := defaultModelName
+	if len(positional) == 1 {
+		name = positional[0]
+	}
+
+	var info modelInfo
+	client := newControlClient(*serverURL, *timeout)
+	if err := client.call(http.MethodPost, "/models/"+url.PathEscape(name)+"/rollback", nil, &info); err != nil {
+		return err
+	}
+	fmt.Printf("Modelo %s: se restauró la versión %d como versión %d (%s, %d árboles)\n",
+		info.Name, info.Restored, info.Version, info.Source, info.Trees)
+	if len(info.Previous) > 0 {
+		fmt.Printf("Versiones anteriores disponibles: %v\n", info.Previous)
+	}
+	return nil
+}
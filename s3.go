@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cliente mínimo de S3 firmado con AWS Signature Version 4. Las credenciales se
+// toman de las variables estándar AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN y AWS_REGION. Con AWS_ENDPOINT_URL se usa otro servicio
+// compatible (por ejemplo MinIO) con rutas del estilo endpoint/bucket/clave.
+type s3Client struct {
+	accessKey, secretKey, token string
+	region                      string
+	endpoint                    string // Vacío = endpoint de AWS para la región
+	client                      *http.Client
+}
+
+// Función que crea el cliente a partir de las variables de entorno
+func newS3ClientFromEnv() (*s3Client, error) {
+	c := &s3Client{
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		region:    os.Getenv("AWS_REGION"),
+		endpoint:  strings.TrimSuffix(os.Getenv("AWS_ENDPOINT_URL"), "/"),
+		client:    &http.Client{},
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, errors.New("s3: faltan AWS_ACCESS_KEY_ID o AWS_SECRET_ACCESS_KEY")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	return c, nil
+}
+
+// Función que arma la URL de un objeto
+func (c *s3Client) objectURL(bucket, key string) string {
+	path := "/" + s3EncodePath(key)
+	if c.endpoint != "" {
+		return c.endpoint + "/" + bucket + path
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", bucket, c.region, path)
+}
+
+// Función que envía una petición firmada sobre un objeto. Las respuestas de
+// error se convierten en un error con el detalle que devuelve S3.
+func (c *s3Client) do(ctx context.Context, method, bucket, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	target := c.objectURL(bucket, key)
+	if len(query) > 0 {
+		target += "?" + s3CanonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	sum := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, objectError(resp.StatusCode, fmt.Errorf("s3: %s %s/%s respondió %s: %s", method, bucket, key, resp.Status, detail))
+	}
+	return resp, nil
+}
+
+// Función que sube un objeto completo
+func (c *s3Client) Put(ctx context.Context, bucket, key, contentType string, body []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, bucket, key, nil, http.Header{"Content-Type": {contentType}}, body)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Función que firma la petición con AWS Signature Version 4
+func (c *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.token)
+	}
+
+	// Cabeceras firmadas: host y todas las x-amz-*, más content-type si está
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := sortedKeys(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Función que codifica una clave para la ruta como lo exige SigV4: todo salvo
+// los caracteres no reservados y "/"
+func s3EncodePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if ch == '/' || ch == '-' || ch == '_' || ch == '.' || ch == '~' ||
+			('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// Función que arma la query canónica: claves ordenadas y valores codificados
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+strings.ReplaceAll(url.QueryEscape(value), "+", "%20"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Función que descarga un objeto desde el desplazamiento indicado
+func (c *s3Client) get(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.do(ctx, http.MethodGet, bucket, key, nil, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Función que retorna el ETag del objeto con una petición HEAD
+func (c *s3Client) version(ctx context.Context, bucket, key string) (string, error) {
+	resp, err := c.do(ctx, http.MethodHead, bucket, key, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("s3: %s/%s no informa ETag", bucket, key)
+	}
+	return strings.Trim(etag, `"`), nil
+}
+
+// Subida multiparte de S3: cada parte se sube por separado y al final se
+// confirma la lista de partes
+type s3Upload struct {
+	client      *s3Client
+	bucket, key string
+	uploadID    string
+	etags       []string // ETag de cada parte subida, en orden
+}
+
+func (c *s3Client) newUpload(ctx context.Context, bucket, key string) (chunkUploader, error) {
+	resp, err := c.do(ctx, http.MethodPost, bucket, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("s3: respuesta inválida al iniciar la subida: %w", err)
+	}
+	return &s3Upload{client: c, bucket: bucket, key: key, uploadID: result.UploadID}, nil
+}
+
+// Función que sube una parte. Salvo la última, deben tener al menos 5 MiB.
+func (u *s3Upload) uploadPart(ctx context.Context, part []byte, final bool) error {
+	if final && len(part) == 0 && len(u.etags) > 0 {
+		return nil // La última parte ya se subió
+	}
+	query := url.Values{
+		"partNumber": {strconv.Itoa(len(u.etags) + 1)},
+		"uploadId":   {u.uploadID},
+	}
+	resp, err := u.client.do(ctx, http.MethodPut, u.bucket, u.key, query, nil, part)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	u.etags = append(u.etags, resp.Header.Get("ETag"))
+	return nil
+}
+
+// Función que confirma la subida con la lista de partes
+func (u *s3Upload) complete(ctx context.Context) error {
+	var body bytes.Buffer
+	body.WriteString("<CompleteMultipartUpload>")
+	for i, etag := range u.etags {
+		fmt.Fprintf(&body, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, html.EscapeString(etag))
+	}
+	body.WriteString("</CompleteMultipartUpload>")
+	resp, err := u.client.do(ctx, http.MethodPost, u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, nil, body.Bytes())
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Función que cancela la subida para que S3 descarte las partes
+func (u *s3Upload) abort(ctx context.Context) {
+	if resp, err := u.client.do(ctx, http.MethodDelete, u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, nil, nil); err == nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Códigos de salida para usar los subcomandos y los guiones en integración
+// continua: además del error genérico, una falla al cargar los registros, una
+// falla al entrenar y un modelo que no alcanza la precisión mínima terminan
+// con códigos distintos, para que el pipeline sepa qué pasó sin leer la salida,
+// y lo mismo una operación que superó su -plazo con la política fallar y unos
+// datos nuevos que difieren demasiado de los anteriores (diff -fallar).
+// train puede además escribir el resultado en JSON con -resultado.
+const (
+	exitOK             = 0
+	exitError          = 1 // Cualquier otro error
+	exitUsage          = 2 // Opciones o subcomando inválidos
+	exitLeak           = 3 // Goroutines que no terminaron al salir
+	exitLoadFailure    = 4 // No se pudieron cargar los registros
+	exitTrainFailure   = 5 // No se pudo entrenar el modelo
+	exitBelowThreshold = 6 // El modelo no alcanza la precisión mínima
+	exitTimeout        = 7 // La operación superó su plazo
+	exitDataShift      = 8 // Los datos nuevos difieren de los anteriores más de lo tolerado
+)
+
+// Error con el código de salida con el que debe terminar el proceso
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// Función que asocia un código de salida a un error (nil sigue siendo nil)
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{code: code, err: err}
+}
+
+// Función que retorna el código de salida de un error de un subcomando
+func exitCodeFor(err error) int {
+	var coded *exitCodeError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return exitError
+}
+
+// Resultado de un entrenamiento, para leerlo desde la integración continua
+type trainResult struct {
+	Status      string          `json:"estado"` // ok, error_carga, error_entrenamiento, bajo_umbral, plazo_vencido o error
+	Code        int             `json:"codigo"`
+	Error       string          `json:"error,omitempty"`
+	Data        string          `json:"datos"`
+	Records     int             `json:"registros"`
+	Trees       int             `json:"arboles"`
+	Partial     bool            `json:"parcial,omitempty"`   // Venció el plazo y se guardaron los árboles ya entrenados
+	OOBError    *float64        `json:"error_oob,omitempty"` // Ausente si no se pudo calcular
+	Accuracy    *float64        `json:"precision,omitempty"` // 1 - error OOB
+	MinAccuracy float64         `json:"precision_minima,omitempty"`
+	Holdout     *holdoutMetrics `json:"reserva,omitempty"` // Evaluación de los registros reservados con -reserva
+	Model       string          `json:"modelo,omitempty"`  // Vacío si el modelo no se guardó
+	Duration    float64         `json:"duracion_segundos"`
+	Finished    time.Time       `json:"terminado"`
+}
+
+// Estado de cada código de salida en el resultado
+var exitStatuses = map[int]string{
+	exitOK:             "ok",
+	exitLoadFailure:    "error_carga",
+	exitTrainFailure:   "error_entrenamiento",
+	exitBelowThreshold: "bajo_umbral",
+	exitTimeout:        "plazo_vencido",
+}
+
+// Función que completa el resultado con el error del entrenamiento (nil = ok)
+// y lo escribe en path
+func (r *trainResult) write(path string, err error) error {
+	r.Code = exitOK
+	if err != nil {
+		r.Code, r.Error = exitCodeFor(err), err.Error()
+	}
+	r.Status = exitStatuses[r.Code]
+	if r.Status == "" {
+		r.Status = "error"
+	}
+	r.Finished = time.Now()
+	return writeJSONOutput(path, r)
+}
+
+// Función que escribe un valor como JSON indentado en un archivo local o remoto
+func writeJSONOutput(path string, v any) error {
+	file, err := createOutput(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Modelos seguidos en almacenamiento de objetos: con -seguir el servidor no
+// necesita nada en disco. Al iniciar descarga el modelo publicado en S3 o GCS
+// y después consulta periódicamente su versión (ETag o generación); cuando
+// cambia, lo vuelve a cargar. Así varias réplicas sin estado detrás de un
+// balanceador toman el mismo modelo y publicar uno nuevo es subirlo a esa
+// clave, sin redesplegar. POST /models/{nombre}/refresh fuerza la consulta, para
+// usarlo desde una notificación del almacenamiento. Un modelo del almacén
+// (almacen:nombre) se sigue igual: su versión es la última guardada.
+
+// Métrica de las recargas de modelos seguidos
+var modelReloads = NewCounterVec("tp_modelos_recargados_total",
+	"Consultas de modelos seguidos en almacenamiento remoto por resultado (sin_cambios, recargado o error)", "modelo", "resultado")
+
+// Modelo seguido en almacenamiento remoto
+type modelWatch struct {
+	name string
+	path string
+
+	mu      sync.Mutex // Evita recargar dos veces a la vez (sondeo y aviso)
+	version string     // Versión del objeto que está cargada
+}
+
+// Función que consulta la versión del objeto y, si cambió, carga el modelo y
+// lo registra. Retorna si se recargó.
+func (s *server) refreshWatch(ctx context.Context, w *modelWatch, origin string) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tenant := s.tenants.open
+	version, err := remoteVersion(ctx, w.path)
+	if err != nil {
+		modelReloads.Inc(w.name, "error")
+		return false, err
+	}
+	if version == w.version {
+		modelReloads.Inc(w.name, "sin_cambios")
+		return false, nil
+	}
+
+	details := map[string]any{"ruta": w.path, "version_objeto": version, "origen": origin}
+	model, _, err := s.openModel(w.path)
+	if err != nil {
+		modelReloads.Inc(w.name, "error")
+		audit(ctx, auditLoadModel, w.name, err, details)
+		return false, err
+	}
+	// La huella incluye la versión del objeto: la ruta sola no cambia al publicar
+	entry := tenant.registry.Set(w.name, model, w.path, w.path+"@"+version)
+	w.version = version
+	modelReloads.Inc(w.name, "recargado")
+	details["version"] = entry.Version
+	audit(ctx, auditLoadModel, w.name, nil, details)
+	logf(ctx, "Modelo %s v%d cargado desde %s (versión del objeto %s, %d árboles)", w.name, entry.Version, w.path, version, model.NumTrees())
+	return true, nil
+}
+
+// Función que consulta los modelos seguidos cada intervalo hasta que se cancela ctx
+func (s *server) pollWatches(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, w := range s.watches {
+			if _, err := s.refreshWatch(ctx, w, "sondeo"); err != nil && ctx.Err() == nil {
+				log.Printf("No se pudo actualizar el modelo %s desde %s: %v", w.name, w.path, err)
+			}
+		}
+	}
+}
+
+// Respuesta de POST /models/{name}/refresh
+type refreshResponse struct {
+	Updated bool      `json:"actualizado"`
+	Model   modelInfo `json:"modelo"`
+}
+
+// POST /models/{name}/refresh: consulta ya el objeto de un modelo seguido y lo
+// recarga si cambió
+func (s *server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	watch, ok := s.watches[name]
+	if !ok || tenantFrom(r.Context()) != s.tenants.open {
+		writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no se sigue en almacenamiento remoto", name))
+		return
+	}
+	updated, err := s.refreshWatch(r.Context(), watch, "aviso")
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	entry, release, err := s.tenants.open.registry.Acquire(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	release()
+	writeJSON(w, http.StatusOK, refreshResponse{Updated: updated, Model: newModelInfo(entry)})
+}
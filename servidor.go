@@ -0,0 +1,1061 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Nombre del modelo usado cuando una petición no indica ninguno
+const defaultModelName = "default"
+
+// Lista de modelos de la línea de comandos en formato nombre=ruta
+type modelFlags map[string]string
+
+func (m modelFlags) String() string {
+	parts := make([]string, 0, len(m))
+	for name, path := range m {
+		parts = append(parts, name+"="+path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m modelFlags) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok {
+		name, path = defaultModelName, value // Sin nombre se usa el modelo por defecto
+	}
+	if name == "" || path == "" {
+		return fmt.Errorf("formato inválido %q, se espera nombre=ruta", value)
+	}
+	m[name] = path
+	return nil
+}
+
+// Servidor HTTP de predicciones
+type server struct {
+	tenants      *tenantSet             // Inquilinos, cada uno con sus modelos
+	shadowPolicy ShadowPolicy           // Criterios para promover un candidato en sombra
+	canaryPolicy CanaryPolicy           // Criterios para promover un canario
+	history      *PredictionHistory     // Historial de predicciones (nil si no se registra)
+	allowLeakage bool                   // Aceptar modelos que dividen por características que no se conocen al predecir
+	allowSchema  bool                   // Aceptar modelos cuyo esquema no coincide con el del histórico
+	traceTrees   bool                   // Atender X-Trace-Trees; lo decide quien opera el servidor, no el cliente
+	pipeline     *Pipeline              // Pipeline para modelos que no traen el suyo
+	jobs         *TrainQueue            // Entrenamientos pendientes y terminados
+	cache        PredictionCache        // Caché de predicciones (nil si no hay)
+	watches      map[string]*modelWatch // Modelos seguidos en almacenamiento remoto, por nombre
+	pollInterval time.Duration          // Intervalo de consulta de los modelos seguidos
+	analogs      *analogIndex           // Histórico donde buscar días análogos al explicar (nil si no hay)
+	analogCount  int                    // Días análogos por explicación
+	bookings     *Bookings              // Agenda de citas de los días consultados (nil si no hay)
+	socket       string                 // Socket unix donde también se atiende la API (vacío = ninguno)
+	trainTimeout OperationTimeout       // Plazo máximo de los entrenamientos y política por defecto al vencer
+	scheduler    *workScheduler         // Ranuras de CPU con prioridad para las predicciones interactivas
+	started      time.Time              // Momento en que se inició el servidor
+
+	draining   atomic.Bool  // Sin predicciones ni entrenamientos nuevos, para sacar la réplica del balanceador
+	predicting atomic.Int64 // Predicciones en curso
+
+	background sync.WaitGroup // Predicciones en sombra que siguen después de responder y sondeo de modelos seguidos
+}
+
+// Subcomando "serve": carga los modelos indicados y atiende peticiones HTTP
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "dirección en la que escucha el servidor")
+	socket := fs.String("socket", "", "socket unix donde también se atiende la API, para ctl (solo el usuario del servidor puede usarlo)")
+	models := modelFlags{}
+	fs.Var(models, "model", "modelo a servir como nombre=ruta (se puede repetir)")
+	minShadow := fs.Int("shadow-min", 100, "predicciones mínimas en sombra antes de promover")
+	maxDisagreement := fs.Float64("shadow-max-desacuerdo", 0.05, "tasa máxima de desacuerdo para promover")
+	maxLatency := fs.Float64("shadow-max-latencia", 1.5, "máximo p95 del candidato respecto del principal")
+	var canaryPolicy CanaryPolicy
+	fs.IntVar(&canaryPolicy.MinPredictions, "canario-min", 100, "predicciones mínimas del canario antes de promover")
+	fs.Float64Var(&canaryPolicy.MaxRateDifference, "canario-max-diferencia", 0.05, "diferencia máxima entre las tasas de congestión predichas")
+	fs.Float64Var(&canaryPolicy.MaxLatencyRatio, "canario-max-latencia", 1.5, "máximo p95 del canario respecto del principal")
+	historyPath := fs.String("historial", "", "archivo donde registrar cada predicción (JSON por línea)")
+	allowLeakage := fs.Bool("permitir-fuga", false, "aceptar modelos que dividen por características que no se conocen al predecir")
+	allowSchema := fs.Bool("permitir-esquema", false, "aceptar modelos cuyo esquema no coincide con el del histórico")
+	traceTrees := fs.Bool("trazar-arboles", false, "atender la cabecera X-Trace-Trees, que registra el recorrido de cada árbol (para diagnóstico; sin esta opción se ignora)")
+	pipelinePath := fs.String("historico", "", "CSV de atenciones para armar el pipeline si el modelo no trae el suyo")
+	tenantsPath := fs.String("inquilinos", "", "archivo JSON con los inquilinos, sus claves, datos, modelos y cuotas")
+	cacheSpec := fs.String("cache", "", "caché de predicciones: memoria[:entradas] o redis://host:puerto[/db] para compartirlo entre réplicas")
+	cacheTTL := fs.Duration("cache-ttl", time.Hour, "tiempo que se conserva cada predicción en el caché")
+	follow := modelFlags{}
+	fs.Var(follow, "seguir", "modelo publicado en S3, GCS o el almacén como nombre=s3://bucket/clave o nombre=almacen:modelo, que se recarga cuando cambia (se puede repetir)")
+	pollInterval := fs.Duration("sondeo", time.Minute, "intervalo de consulta de los modelos de -seguir")
+	precedentsPath := fs.String("precedentes", "", "CSV de atenciones donde buscar los días análogos al explicar una predicción")
+	bookingsPath := fs.String("citas", "", "agenda de citas programadas (CSV o conexión postgres://, mysql:// o sqlite:) para las consultas que no traen citas")
+	bookingsTable := fs.String("tabla-citas", defaultBookingsTable, "tabla de la agenda con una conexión SQL en -citas")
+	precedentsYear := fs.Int("precedentes-anio", 0, "año de -precedentes, para preferir el mismo día de la semana (0 = no comparar)")
+	analogCount := fs.Int("analogos", 5, "días análogos por explicación")
+	incremental := fs.String("incremental", "", "nombre de un modelo incremental que aprende de POST /models/{nombre}/observe")
+	incrementalTrees := fs.Int("incremental-arboles", 10, "árboles del modelo incremental")
+	trainTimeout := OperationTimeout{Operation: "el entrenamiento"}
+	fs.DurationVar(&trainTimeout.Limit, "plazo-entrenamiento", 0, "tiempo máximo de cada entrenamiento; los pedidos pueden indicar uno menor (0 = sin límite)")
+	fs.StringVar(&trainTimeout.Policy, "al-vencer-entrenamiento", onTimeoutFail, "al vencer el plazo: fallar o parcial (registrar el modelo con los árboles ya entrenados)")
+	slots := fs.Int("ranuras", 0, "ranuras de CPU para predicciones y entrenamientos (0 = número de CPUs)")
+	reservedSlots := fs.Int("ranuras-interactivas", -1, "ranuras reservadas para GET /predict, que los lotes y entrenamientos no usan (-1 = una cuarta parte)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *slots < 0 || *reservedSlots < -1 {
+		return errors.New("-ranuras y -ranuras-interactivas no pueden ser negativas")
+	}
+	if err := trainTimeout.check(); err != nil {
+		return err
+	}
+	if *tenantsPath != "" && (len(models) > 0 || len(follow) > 0) {
+		return errors.New("con -inquilinos los modelos se indican en el archivo de inquilinos")
+	}
+	if *tenantsPath != "" && *precedentsPath != "" {
+		return errors.New("-precedentes no se puede usar con -inquilinos: los inquilinos verían los datos de los demás")
+	}
+	if *tenantsPath != "" && *bookingsPath != "" {
+		return errors.New("-citas no se puede usar con -inquilinos: los inquilinos verían los datos de los demás")
+	}
+	if _, ok := models[*incremental]; ok && *incremental != "" {
+		return fmt.Errorf("el modelo %s está a la vez en -model y en -incremental", *incremental)
+	}
+	if *incrementalTrees <= 0 {
+		return fmt.Errorf("número de árboles incrementales inválido: %d", *incrementalTrees)
+	}
+	if *analogCount <= 0 {
+		return fmt.Errorf("cantidad de días análogos inválida: %d", *analogCount)
+	}
+	for name, path := range follow {
+		if !isRemote(path) && !isStoredModel(path) {
+			return fmt.Errorf("-seguir %s: se espera una ruta s3://, gs:// o almacen:, no %s", name, path)
+		}
+		if _, ok := models[name]; ok {
+			return fmt.Errorf("el modelo %s está a la vez en -model y en -seguir", name)
+		}
+	}
+	if *pollInterval <= 0 {
+		return errors.New("-sondeo debe ser positivo")
+	}
+
+	s := &server{
+		shadowPolicy: ShadowPolicy{
+			MinPredictions:  *minShadow,
+			MaxDisagreement: *maxDisagreement,
+			MaxLatencyRatio: *maxLatency,
+		},
+		canaryPolicy: canaryPolicy,
+		allowLeakage: *allowLeakage,
+		allowSchema:  *allowSchema,
+		traceTrees:   *traceTrees,
+		watches:      make(map[string]*modelWatch),
+		pollInterval: *pollInterval,
+		analogCount:  *analogCount,
+		socket:       *socket,
+		trainTimeout: trainTimeout,
+		scheduler:    newWorkScheduler(*slots, *reservedSlots),
+		started:      time.Now(),
+	}
+	pipeline, err := loadPipeline(*pipelinePath)
+	if err != nil {
+		return err
+	}
+	s.pipeline = pipeline
+	if *precedentsPath != "" {
+		data, err := loadAtenciones(context.Background(), *precedentsPath)
+		if err != nil {
+			return fmt.Errorf("no se pudo cargar -precedentes: %w", err)
+		}
+		s.analogs = newAnalogIndex(NewDatasetIndex(data), *precedentsYear)
+		fmt.Printf("Precedentes: %d registros de %d establecimientos\n", len(data), len(s.analogs.names))
+	}
+	if *bookingsPath != "" {
+		if s.bookings, err = loadBookings(context.Background(), *bookingsPath, *bookingsTable); err != nil {
+			return fmt.Errorf("no se pudo cargar -citas: %w", err)
+		}
+	}
+	if s.cache, err = NewPredictionCache(*cacheSpec, *cacheTTL); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		defer s.cache.Close()
+	}
+	s.tenants = openTenantSet()
+	if *tenantsPath != "" {
+		if s.tenants, err = LoadTenants(*tenantsPath); err != nil {
+			return err
+		}
+	} else {
+		s.tenants.open.Models = models
+	}
+	if secret := os.Getenv("TP_JWT_SECRETO"); secret != "" {
+		s.tenants.jwtSecret = []byte(secret)
+	}
+	for _, t := range s.tenants.tenants {
+		for name, path := range t.Models {
+			model, fingerprint, err := s.openModel(path)
+			if err != nil {
+				return fmt.Errorf("no se pudo cargar el modelo %s: %w", t.label(name), err)
+			}
+			t.registry.Set(name, model, path, fingerprint)
+			log.Printf("Modelo %s cargado desde %s (%d árboles)", t.label(name), path, model.NumTrees())
+		}
+	}
+	for name, path := range follow {
+		watch := &modelWatch{name: name, path: path}
+		if _, err := s.refreshWatch(context.Background(), watch, "inicio"); err != nil {
+			return fmt.Errorf("no se pudo cargar el modelo %s: %w", name, err)
+		}
+		s.watches[name] = watch
+	}
+	if *incremental != "" {
+		threshold := congestionThreshold
+		if s.pipeline != nil {
+			threshold = s.pipeline.CongestionThreshold
+		}
+		s.tenants.open.registry.Set(*incremental, NewOnlineForest(*incrementalTrees, threshold, time.Now().UnixNano()), "incremental", "")
+		log.Printf("Modelo incremental %s con %d árboles", *incremental, *incrementalTrees)
+	}
+	s.jobs = NewTrainQueue(s.runTrainJob)
+
+	if *historyPath != "" {
+		history, err := OpenPredictionHistory(*historyPath)
+		if err != nil {
+			return err
+		}
+		defer history.Close()
+		s.history = history
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return s.serve(ctx, *addr)
+}
+
+// Función que atiende peticiones hasta que se cancela ctx. Al detenerse espera
+// las peticiones en curso, las predicciones en sombra, el entrenamiento en curso
+// y el cierre de los modelos, para no dejar goroutines vivas.
+func (s *server) serve(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.routes(), ConnContext: markControlSocket}
+	listeners := 1
+	errc := make(chan error, 2)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	log.Printf("Servidor escuchando en %s", addr)
+	if s.socket != "" {
+		ln, err := listenSocket(s.socket)
+		if err != nil {
+			srv.Close()
+			<-errc
+			return err
+		}
+		listeners++
+		go func() {
+			errc <- srv.Serve(ln)
+		}()
+		log.Printf("Servidor escuchando en el socket %s", s.socket)
+	}
+	if len(s.watches) > 0 {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			s.pollWatches(ctx, s.pollInterval)
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		srv.Close()
+		for ; listeners > 1; listeners-- {
+			<-errc
+		}
+		return err // No se pudo escuchar en la dirección
+	case <-ctx.Done():
+	}
+	log.Println("Deteniendo el servidor...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	for ; listeners > 0; listeners-- {
+		<-errc // ListenAndServe y Serve retornan ErrServerClosed
+	}
+	s.background.Wait()
+	s.jobs.Close() // Los trabajos en cola se cancelan
+	s.tenants.Close()
+	return err
+}
+
+// Función que abre un modelo y lo rechaza si depende de características que no
+// se conocen al predecir y no hay promedios para imputarlas, salvo que el servidor
+// se haya iniciado con -permitir-fuga, o si su esquema no coincide con el del
+// histórico, salvo con -permitir-esquema. Retorna también la huella del archivo.
+func (s *server) openModel(path string) (Predictor, string, error) {
+	fingerprint, err := modelFingerprint(path)
+	if err != nil {
+		return nil, "", err
+	}
+	model, err := OpenModel(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkLeakage(model, pipelineFor(model, s.pipeline)); err != nil {
+		if !s.allowLeakage {
+			if closer, ok := model.(io.Closer); ok {
+				closer.Close()
+			}
+			return nil, "", err
+		}
+		log.Printf("Advertencia: %s: %v", path, err)
+	}
+	schema := checkSchema(model, s.pipeline)
+	for _, warning := range schema.Warnings {
+		log.Printf("Advertencia: %s: %s", path, warning)
+	}
+	if err := schema.err(); err != nil {
+		if !s.allowSchema {
+			if closer, ok := model.(io.Closer); ok {
+				closer.Close()
+			}
+			return nil, "", fmt.Errorf("%w; usa -permitir-esquema para cargarlo igualmente", err)
+		}
+		log.Printf("Advertencia: %s: %v", path, err)
+	}
+	return model, fingerprint, nil
+}
+
+// Función que registra las rutas de la API
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", s.tenants.middleware(s.apiRoutes()))
+	mux.HandleFunc("GET /metrics", metricsHandler)
+	return requestIDMiddleware(mux, s.traceTrees)
+}
+
+// Función que registra las rutas que requieren identificar al inquilino
+func (s *server) apiRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /models", s.handleModels)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /drain", requireAction(ActionPublish, s.handleDrain))
+	mux.HandleFunc("DELETE /drain", requireAction(ActionPublish, s.handleDrain))
+	mux.HandleFunc("GET /predict", s.handlePredict)
+	mux.HandleFunc("POST /predict/batch", s.handlePredictStream)
+	mux.HandleFunc("POST /models/{name}/load", requireAction(ActionPublish, s.handleLoad))
+	mux.HandleFunc("POST /models/{name}/train", requireAction(ActionTrain, s.handleTrain))
+	mux.HandleFunc("POST /train", requireAction(ActionTrain, s.handleTrainJob))
+	mux.HandleFunc("GET /jobs", s.handleJobs)
+	mux.HandleFunc("GET /jobs/{id}", s.handleJob)
+	mux.HandleFunc("POST /models/{name}/shadow", requireAction(ActionPublish, s.handleShadowSet))
+	mux.HandleFunc("GET /models/{name}/shadow", s.handleShadowReport)
+	mux.HandleFunc("DELETE /models/{name}/shadow", requireAction(ActionPublish, s.handleShadowRemove))
+	mux.HandleFunc("POST /models/{name}/shadow/promote", requireAction(ActionPublish, s.handleShadowPromote))
+	mux.HandleFunc("POST /models/{name}/canary", requireAction(ActionPublish, s.handleCanarySet))
+	mux.HandleFunc("GET /models/{name}/canary", s.handleCanaryReport)
+	mux.HandleFunc("DELETE /models/{name}/canary", requireAction(ActionPublish, s.handleCanaryRemove))
+	mux.HandleFunc("POST /models/{name}/canary/promote", requireAction(ActionPublish, s.handleCanaryPromote))
+	mux.HandleFunc("POST /models/{name}/rollback", requireAction(ActionPublish, s.handleRollback))
+	mux.HandleFunc("POST /models/{name}/observe", requireAction(ActionLoadData, s.handleObserve))
+	mux.HandleFunc("POST /models/{name}/refresh", requireAction(ActionPublish, s.handleRefresh))
+	return mux
+}
+
+// Información pública de un modelo registrado
+type modelInfo struct {
+	Name     string    `json:"nombre"`
+	Version  int       `json:"version"`
+	Trees    int       `json:"arboles"`
+	Source   string    `json:"origen"`
+	LoadedAt time.Time `json:"cargado"`
+	Restored int       `json:"restaurada,omitempty"` // Versión que se restauró, si vino de un rollback
+	Previous []int     `json:"anteriores,omitempty"` // Versiones a las que se puede volver
+}
+
+func newModelInfo(entry *ModelEntry) modelInfo {
+	return modelInfo{
+		Name:     entry.Name,
+		Version:  entry.Version,
+		Trees:    entry.Model.NumTrees(),
+		Source:   entry.Source,
+		LoadedAt: entry.LoadedAt,
+		Restored: entry.Restored,
+	}
+}
+
+// GET /models: lista los modelos registrados
+func (s *server) handleModels(w http.ResponseWriter, r *http.Request) {
+	registry := tenantFrom(r.Context()).registry
+	entries := registry.List()
+	infos := make([]modelInfo, 0, len(entries))
+	for _, entry := range entries {
+		info := newModelInfo(entry)
+		info.Previous = registry.PreviousVersions(entry.Name)
+		infos = append(infos, info)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// Respuesta de una predicción
+type predictResponse struct {
+	Model          string              `json:"modelo"`
+	Version        int                 `json:"version"`
+	Establishment  string              `json:"establecimiento"`
+	Month          int                 `json:"mes"`
+	Day            int                 `json:"dia"`
+	Congested      bool                `json:"congestionado"`
+	Votes          int                 `json:"votos"`
+	Trees          int                 `json:"arboles"`
+	Tie            string              `json:"empate,omitempty"`                  // Política con la que se resolvió un empate en la votación
+	Abstained      bool                `json:"sin_decision,omitempty"`            // Empate sin decisión, con empates=abstenerse
+	Fallback       string              `json:"desconocido,omitempty"`             // Respaldo si el establecimiento no estaba en el entrenamiento
+	Caveat         string              `json:"advertencia,omitempty"`             // Si los datos del establecimiento son de baja calidad
+	Known          knownValues         `json:"valores_conocidos,omitempty"`       // Valores de la consulta que reemplazaron a los imputados
+	Probability    float64             `json:"probabilidad"`                      // Fracción de árboles que votan congestión
+	Dispersion     float64             `json:"desvio_arboles"`                    // Desvío de los votos entre árboles
+	AttentionRatio float64             `json:"atenciones_por_atendido,omitempty"` // Predicción conjunta, si el modelo la guarda en las hojas
+	Interval       *ConfidenceInterval `json:"intervalo,omitempty"`               // Intervalo jackknife, con intervalo=true
+	Variant        string              `json:"variante,omitempty"`                // Con un canario activo: "principal" o "canario"
+	Explanation    *Explanation        `json:"explicacion,omitempty"`             // Aportes de cada característica, con explicar=true
+	Counterfactual *Counterfactual     `json:"contrafactual,omitempty"`           // Cambios cercanos que invierten la predicción, con contrafactual=true
+	Detail         *VoteBreakdown      `json:"detalle,omitempty"`                 // Votos por clase y por árbol, con detalle=true
+	Metadata       *ModelMetadata      `json:"metadatos_modelo"`                  // Versión, datos y fecha de entrenamiento del modelo que respondió
+}
+
+// GET /predict?modelo=&establecimiento=&mes=&dia=[&atendidos=][&atenciones=][&citas=][&empates=][&intervalo=true][&explicar=true][&contrafactual=true][&detalle=true]:
+// predice con el modelo elegido, con los atendidos, atenciones o citas
+// indicados (o las citas de la agenda de -citas) en lugar de los imputados,
+// resuelve un empate con la política indicada (o la del modelo),
+// y, si se pide, agrega el intervalo de la probabilidad, explica qué
+// características pesaron, qué cambio cercano invertiría la predicción o cómo
+// votó cada árbol
+func (s *server) handlePredict(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("modelo")
+	if name == "" {
+		name = defaultModelName
+	}
+	month, err := strconv.Atoi(query.Get("mes"))
+	if err != nil || month < 1 || month > 12 {
+		writeError(w, http.StatusBadRequest, errors.New("mes inválido"))
+		return
+	}
+	day, err := strconv.Atoi(query.Get("dia"))
+	if err != nil || day < 1 || day > 31 {
+		writeError(w, http.StatusBadRequest, errors.New("día inválido"))
+		return
+	}
+	known, err := parseKnownValues(query.Get)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	known = s.bookings.fill(known, query.Get("establecimiento"), 0, month, day)
+	ties, err := ParseTiePolicy(query.Get("empates"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if s.rejectDraining(w) {
+		return
+	}
+	s.predicting.Add(1)
+	defer s.predicting.Add(-1)
+
+	tenant := tenantFrom(r.Context())
+	entry, release, err := tenant.registry.Acquire(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	defer release()
+
+	// La predicción toma una ranura antes que los lotes y entrenamientos que esperan
+	ctx := r.Context()
+	releaseSlot, err := s.scheduler.acquire(ctx, priorityInteractive)
+	if err != nil {
+		return // El cliente se fue
+	}
+	defer releaseSlot()
+	att := known.apply(queryAtencion(pipelineFor(entry.Model, s.pipeline), query.Get("establecimiento"), month, day))
+	// Si hay un canario y la consulta le corresponde, la responde el candidato
+	variant := "" // Sin canario no se distingue la variante en el historial
+	canary, releaseCanary, hasCanary := tenant.registry.AcquireCanary(entry.Name)
+	if hasCanary {
+		defer releaseCanary()
+		variant = "principal"
+		if canary.routes(att) {
+			entry, variant = canary.Entry, canaryVariant
+			att = known.apply(queryAtencion(pipelineFor(entry.Model, s.pipeline), query.Get("establecimiento"), month, day))
+		}
+	}
+	// Con un candidato en sombra no se usa el caché, para comparar ambos modelos en todas las predicciones
+	shadow, releaseShadow, hasShadow := tenant.registry.AcquireShadow(entry.Name)
+	_, incremental := entry.Model.(incrementalModel) // Cambia con cada registro: el caché quedaría viejo
+	pipeline := pipelineFor(entry.Model, s.pipeline)
+	unseen := !pipeline.Known(query.Get("establecimiento"))                             // El caché no guarda el respaldo
+	useCache := s.cache != nil && !hasShadow && !incremental && !unseen && known == nil // La clave no incluye los valores conocidos
+	var cacheKey string
+	start := time.Now()
+	votes, total, cached := 0, 0, false
+	fallback := ""
+	if useCache {
+		cacheKey = predictionCacheKey(tenant.Name, entry, att)
+		votes, total, cached = s.cache.Get(ctx, cacheKey)
+	}
+	if unseen {
+		votes, total, fallback = voteUnseen(entry.Model, pipeline, att)
+	} else if !cached {
+		votes, total = voteTraced(ctx, entry.Model, att)
+		if useCache {
+			s.cache.Set(ctx, cacheKey, votes, total)
+		}
+	}
+	latency := time.Since(start)
+	label := tenant.label(entry.Name)
+	predictionLatency.ObserveExemplar(latency.Seconds(), requestID(ctx), label, cmp.Or(variant, "principal"))
+	if query.Get("empates") == "" {
+		ties = pipeline.tiePolicy()
+	}
+	decision := decideVote(votes, total, ties)
+	congested := decision.Congested
+	if hasCanary {
+		canary.record(variant == canaryVariant, congested, latency)
+		canaryPredictions.Inc(label, variant)
+	}
+	var explanation *Explanation
+	if query.Get("explicar") == "true" {
+		if explanation, err = Explain(entry.Model, att); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if s.analogs != nil {
+			threshold := congestionThreshold
+			if p := pipelineFor(entry.Model, s.pipeline); p != nil {
+				threshold = p.ThresholdFor(att.NombreEstablecimiento)
+			}
+			explanation.Analogs = s.analogs.Nearest(att, s.analogCount, threshold)
+			explanation.Precedent = summarizeAnalogs(explanation.Analogs)
+		}
+	}
+	var interval *ConfidenceInterval
+	if query.Get("intervalo") == "true" {
+		interval = jackknifeInterval(votes, total)
+	}
+	var counterfactual *Counterfactual
+	if query.Get("contrafactual") == "true" {
+		counterfactual = FindCounterfactual(entry.Model, withTiePolicy(pipelineFor(entry.Model, s.pipeline), ties), query.Get("establecimiento"), month, day)
+	}
+	var detail *VoteBreakdown
+	if query.Get("detalle") == "true" {
+		detail = voteBreakdown(entry.Model, att, ties)
+	}
+
+	// Si hay un candidato en sombra, también calcula la predicción sin afectar la respuesta
+	if hasShadow {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			runShadow(context.WithoutCancel(ctx), label, shadow, releaseShadow, att, congested, latency)
+		}()
+	}
+
+	err = s.history.Record(PredictionRecord{
+		Time:          start,
+		RequestID:     requestID(ctx),
+		Tenant:        tenant.Name,
+		Model:         entry.Name,
+		Version:       entry.Version,
+		Establishment: att.NombreEstablecimiento,
+		Month:         month,
+		Day:           day,
+		Congested:     congested,
+		Votes:         votes,
+		Trees:         total,
+		Tie:           decision.tieLabel(ties),
+		Abstained:     decision.Abstained,
+		LatencyMs:     float64(latency.Microseconds()) / 1000,
+		Cached:        cached,
+		Variant:       variant,
+	})
+	if err != nil {
+		logf(ctx, "Error al registrar la predicción: %v", err)
+	}
+
+	probability, dispersion := voteDispersion(votes, total)
+	var ratio float64 // Queda fuera de la respuesta si el modelo no la predice
+	if predictor, ok := entry.Model.(ratioPredictor); ok {
+		ratio, _ = predictor.AttentionRatio(att)
+	}
+	metadata := newModelMetadata(entry.Model, entry.Fingerprint)
+	metadata.setHeaders(w.Header())
+	writeJSON(w, http.StatusOK, predictResponse{
+		Model:          entry.Name,
+		Version:        entry.Version,
+		Establishment:  att.NombreEstablecimiento,
+		Month:          month,
+		Day:            day,
+		Congested:      congested,
+		Votes:          votes,
+		Trees:          total,
+		Tie:            decision.tieLabel(ties),
+		Abstained:      decision.Abstained,
+		Fallback:       fallback,
+		Caveat:         pipeline.Caveat(att.NombreEstablecimiento),
+		Known:          known,
+		Probability:    probability,
+		Dispersion:     dispersion,
+		AttentionRatio: ratio,
+		Interval:       interval,
+		Variant:        variant,
+		Explanation:    explanation,
+		Counterfactual: counterfactual,
+		Detail:         detail,
+		Metadata:       metadata,
+	})
+}
+
+// POST /models/{name}/load con {"ruta": "..."}: carga o reemplaza un modelo
+func (s *server) handleLoad(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"ruta"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		writeError(w, http.StatusBadRequest, errors.New("se espera {\"ruta\": \"...\"}"))
+		return
+	}
+	tenant, name := tenantFrom(r.Context()), r.PathValue("name")
+	if err := tenant.allowModelPath(req.Path); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	if err := tenant.checkModelQuota(name); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	model, fingerprint, err := s.openModel(req.Path)
+	if err != nil {
+		audit(r.Context(), auditLoadModel, name, err, map[string]any{"ruta": req.Path})
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	entry := tenant.registry.Set(name, model, req.Path, fingerprint)
+	audit(r.Context(), auditLoadModel, name, nil, map[string]any{"ruta": req.Path, "version": entry.Version, "arboles": model.NumTrees()})
+	logf(r.Context(), "Modelo %s v%d cargado desde %s", tenant.label(entry.Name), entry.Version, req.Path)
+	writeJSON(w, http.StatusOK, newModelInfo(entry))
+}
+
+// POST /models/{name}/train con {"datos": "...", "arboles": n}: entrena un
+// modelo nuevo con un CSV y lo registra. Los demás modelos siguen atendiendo.
+// El entrenamiento pasa por la misma cola que POST /train y la respuesta espera
+// a que termine.
+func (s *server) handleTrain(w http.ResponseWriter, r *http.Request) {
+	var req trainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("se espera {\"datos\": \"...\", \"arboles\": n}"))
+		return
+	}
+	req.Model = r.PathValue("name")
+	job, ok := s.submitTrain(w, r, req)
+	if !ok {
+		return
+	}
+
+	select {
+	case <-job.done:
+	case <-r.Context().Done():
+		return // El cliente se fue; el trabajo sigue y se puede consultar en /jobs
+	}
+	info, err := job.Result()
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// POST /train con {"modelo": "...", "datos": "...", "arboles": n}: encola un
+// entrenamiento y responde enseguida con el ID del trabajo
+func (s *server) handleTrainJob(w http.ResponseWriter, r *http.Request) {
+	var req trainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("se espera {\"modelo\": \"...\", \"datos\": \"...\", \"arboles\": n}"))
+		return
+	}
+	if req.Model == "" {
+		req.Model = defaultModelName
+	}
+	job, ok := s.submitTrain(w, r, req)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, s.jobs.Report(job))
+}
+
+// Función que valida el pedido y lo encola. Si falla escribe el error y retorna false.
+func (s *server) submitTrain(w http.ResponseWriter, r *http.Request, req trainRequest) (*TrainJob, bool) {
+	if s.rejectDraining(w) {
+		return nil, false
+	}
+	tenant := tenantFrom(r.Context())
+	filter, features, err := req.parse(tenant, s.allowLeakage)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	timeout, err := s.trainTimeout.request(req.Timeout, req.Policy)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	job, err := s.jobs.Submit(r.Context(), req, filter, features, timeout)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return nil, false
+	}
+	logf(r.Context(), "Trabajo %s: entrenar %s con %d árboles (en cola)", job.ID, tenant.label(req.Model), req.Trees)
+	return job, true
+}
+
+// GET /jobs: estado de los trabajos de entrenamiento
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.jobs.List(tenantFrom(r.Context())))
+}
+
+// GET /jobs/{id}: estado y avance de un trabajo de entrenamiento
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.Get(tenantFrom(r.Context()), r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("trabajo no encontrado: %s", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.jobs.Report(job))
+}
+
+// Función que ejecuta un trabajo de la cola: carga los datos, entrena el
+// bosque informando el avance y registra el modelo. Si vence el plazo con la
+// política parcial se registra el bosque con los árboles ya entrenados.
+func (s *server) runTrainJob(ctx context.Context, job *TrainJob) error {
+	start := time.Now()
+	ctx = withWorkPriority(ctx, s.scheduler, priorityBackground) // Cada árbol cede su turno a las predicciones interactivas
+	ctx, span := startSpan(job.context(ctx), "reentrenamiento")
+	span.SetAttr("modelo", job.Tenant.label(job.Request.Model))
+	span.SetAttr("request_id", job.RequestID)
+	span.SetAttr("trabajo", job.ID)
+	defer span.End()
+	limited, cancel := job.timeout.context(ctx)
+	defer cancel()
+
+	var report LoadReport
+	data, err := loadAtencionesWith(limited, job.Request.Data, LoadOptions{Report: &report})
+	audit(ctx, auditLoadData, job.Request.Data, err, loadDetails(report))
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	if job.filter != nil {
+		data = filterAtenciones(data, job.filter)
+	}
+	if len(data) == 0 {
+		err := errors.New("no hay registros para entrenar")
+		span.SetError(err)
+		return err
+	}
+	job.update(func(j *TrainJob) { j.records = len(data) })
+
+	rf := &RandomForest{Features: job.features, DataSHA256: report.SHA256}
+	rf.progress = func(trained int) {
+		job.update(func(j *TrainJob) { j.trained = trained })
+	}
+	trainErr := rf.TrainTreesContext(limited, data, job.Request.Trees)
+	details := forestDetails(rf, job.Request.Trees, time.Since(start))
+	details["trabajo"], details["datos"], details["filtro"], details["registros"] = job.ID, job.Request.Data, job.Request.Filter, len(data)
+	if trainErr != nil && (!job.timeout.partial(trainErr) || len(rf.Trees) == 0) {
+		audit(ctx, auditTrain, job.Request.Model, trainErr, details)
+		span.SetError(trainErr)
+		return trainErr
+	}
+	if trainErr != nil {
+		logf(ctx, "Trabajo %s: %v; se registra el modelo con %d de %d árboles", job.ID, trainErr, len(rf.Trees), job.Request.Trees)
+		details["parcial"] = true
+		job.update(func(j *TrainJob) { j.partial = true })
+	}
+
+	// Mientras el trabajo esperaba pudieron registrarse otros modelos del inquilino
+	if err := job.Tenant.checkModelQuota(job.Request.Model); err != nil {
+		audit(ctx, auditTrain, job.Request.Model, err, details)
+		span.SetError(err)
+		return err
+	}
+	entry := job.Tenant.registry.Set(job.Request.Model, rf, job.Request.Data, "trabajo:"+job.ID) // Cada entrenamiento da un bosque distinto
+	details["version"] = entry.Version
+	audit(ctx, auditTrain, entry.Name, nil, details)
+	info := newModelInfo(entry)
+	job.update(func(j *TrainJob) {
+		j.oobError = rf.OOBError
+		j.model = &info
+	})
+	logf(ctx, "Trabajo %s: modelo %s v%d entrenado con %d registros en %v", job.ID, job.Tenant.label(entry.Name), entry.Version, len(data), time.Since(start))
+	return nil
+}
+
+// POST /models/{name}/shadow con {"ruta": "..."}: pone un candidato en sombra
+func (s *server) handleShadowSet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"ruta"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		writeError(w, http.StatusBadRequest, errors.New("se espera {\"ruta\": \"...\"}"))
+		return
+	}
+	tenant := tenantFrom(r.Context())
+	if err := tenant.allowModelPath(req.Path); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	model, fingerprint, err := s.openModel(req.Path)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	name := r.PathValue("name")
+	shadow, err := tenant.registry.SetShadow(name, model, req.Path, fingerprint)
+	if err != nil {
+		if closer, ok := model.(io.Closer); ok {
+			closer.Close()
+		}
+		writeError(w, registryErrorStatus(tenant.registry, name), err)
+		return
+	}
+	audit(r.Context(), auditShadow, name, nil, map[string]any{"ruta": req.Path, "arboles": model.NumTrees()})
+	logf(r.Context(), "Modelo %s: candidato %s en modo sombra", tenant.label(name), req.Path)
+	writeJSON(w, http.StatusOK, shadow.Report(name, s.shadowPolicy))
+}
+
+// GET /models/{name}/shadow: reporte de la comparación con el candidato
+func (s *server) handleShadowReport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	shadow, ok := tenantFrom(r.Context()).registry.Shadow(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no tiene candidato en sombra", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, shadow.Report(name, s.shadowPolicy))
+}
+
+// DELETE /models/{name}/shadow: descarta el candidato
+func (s *server) handleShadowRemove(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !tenantFrom(r.Context()).registry.RemoveShadow(name) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no tiene candidato en sombra", name))
+		return
+	}
+	audit(r.Context(), auditUnshadow, name, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /models/{name}/shadow/promote[?forzar=true]: promueve el candidato si el
+// reporte indica que es seguro, o siempre si se fuerza
+func (s *server) handleShadowPromote(w http.ResponseWriter, r *http.Request) {
+	tenant, name := tenantFrom(r.Context()), r.PathValue("name")
+	shadow, ok := tenant.registry.Shadow(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no tiene candidato en sombra", name))
+		return
+	}
+	report := shadow.Report(name, s.shadowPolicy)
+	forced := r.URL.Query().Get("forzar") == "true"
+	if !report.SafeToPromote && !forced {
+		writeError(w, http.StatusConflict, fmt.Errorf("candidato no promovido: %s", report.Reason))
+		return
+	}
+
+	entry, err := tenant.registry.PromoteShadow(name, shadow)
+	if errors.Is(err, errCandidateReplaced) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	audit(r.Context(), auditPromote, name, nil, map[string]any{
+		"ruta":            entry.Source,
+		"version":         entry.Version,
+		"forzada":         forced,
+		"predicciones":    report.Predictions,
+		"tasa_desacuerdo": report.DisagreementRate,
+		"candidato_p95":   report.ShadowP95Ms,
+	})
+	logf(r.Context(), "Modelo %s v%d: candidato %s promovido", tenant.label(entry.Name), entry.Version, entry.Source)
+	writeJSON(w, http.StatusOK, newModelInfo(entry))
+}
+
+// POST /models/{name}/rollback: vuelve a la versión anterior del modelo
+func (s *server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	tenant, name := tenantFrom(r.Context()), r.PathValue("name")
+	entry, err := tenant.registry.Rollback(name)
+	if err != nil {
+		audit(r.Context(), auditRollback, name, err, nil)
+		status := http.StatusConflict
+		if !tenant.registry.Has(name) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	audit(r.Context(), auditRollback, name, nil, map[string]any{
+		"ruta":        entry.Source,
+		"version":     entry.Version,
+		"restaurada":  entry.Restored,
+		"reemplazada": entry.Version - 1,
+	})
+	logf(r.Context(), "Modelo %s v%d: rollback a la versión %d (%s)", tenant.label(entry.Name), entry.Version, entry.Restored, entry.Source)
+	info := newModelInfo(entry)
+	info.Previous = tenant.registry.PreviousVersions(name)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// Función que elige el código de un error del registro: 404 si el modelo no
+// existe, 409 si existe pero la operación choca con su estado
+func registryErrorStatus(registry *ModelRegistry, name string) int {
+	if !registry.Has(name) {
+		return http.StatusNotFound
+	}
+	return http.StatusConflict
+}
+
+// POST /models/{name}/canary con {"ruta": "...", "porcentaje": n}: pone un
+// candidato en canario. Sin "ruta" solo cambia el porcentaje del canario actual.
+func (s *server) handleCanarySet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path    string   `json:"ruta"`
+		Percent *float64 `json:"porcentaje"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Percent == nil || *req.Percent < 0 || *req.Percent > 100 {
+		writeError(w, http.StatusBadRequest, errors.New("se espera {\"ruta\": \"...\", \"porcentaje\": n} con n entre 0 y 100"))
+		return
+	}
+	tenant, name := tenantFrom(r.Context()), r.PathValue("name")
+	if req.Path == "" {
+		canary, ok := tenant.registry.Canary(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no tiene candidato en canario", name))
+			return
+		}
+		canary.SetPercent(*req.Percent)
+		audit(r.Context(), auditCanary, name, nil, map[string]any{"ruta": canary.Entry.Source, "porcentaje": *req.Percent})
+		logf(r.Context(), "Modelo %s: canario %s al %.2f%%", tenant.label(name), canary.Entry.Source, *req.Percent)
+		writeJSON(w, http.StatusOK, canary.Report(name, s.canaryPolicy))
+		return
+	}
+	if err := tenant.allowModelPath(req.Path); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	model, fingerprint, err := s.openModel(req.Path)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	canary, err := tenant.registry.SetCanary(name, model, req.Path, fingerprint, *req.Percent)
+	if err != nil {
+		if closer, ok := model.(io.Closer); ok {
+			closer.Close()
+		}
+		writeError(w, registryErrorStatus(tenant.registry, name), err)
+		return
+	}
+	audit(r.Context(), auditCanary, name, nil, map[string]any{"ruta": req.Path, "porcentaje": *req.Percent, "arboles": model.NumTrees()})
+	logf(r.Context(), "Modelo %s: candidato %s en canario al %.2f%%", tenant.label(name), req.Path, *req.Percent)
+	writeJSON(w, http.StatusOK, canary.Report(name, s.canaryPolicy))
+}
+
+// GET /models/{name}/canary: compara el canario con el modelo principal
+func (s *server) handleCanaryReport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	canary, ok := tenantFrom(r.Context()).registry.Canary(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no tiene candidato en canario", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, canary.Report(name, s.canaryPolicy))
+}
+
+// DELETE /models/{name}/canary: descarta el canario y todo el tráfico vuelve al principal
+func (s *server) handleCanaryRemove(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !tenantFrom(r.Context()).registry.RemoveCanary(name) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no tiene candidato en canario", name))
+		return
+	}
+	audit(r.Context(), auditUncanary, name, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /models/{name}/canary/promote[?forzar=true]: promueve el canario si el
+// reporte indica que es seguro, o siempre si se fuerza
+func (s *server) handleCanaryPromote(w http.ResponseWriter, r *http.Request) {
+	tenant, name := tenantFrom(r.Context()), r.PathValue("name")
+	canary, ok := tenant.registry.Canary(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("el modelo %s no tiene candidato en canario", name))
+		return
+	}
+	report := canary.Report(name, s.canaryPolicy)
+	forced := r.URL.Query().Get("forzar") == "true"
+	if !report.SafeToPromote && !forced {
+		writeError(w, http.StatusConflict, fmt.Errorf("canario no promovido: %s", report.Reason))
+		return
+	}
+
+	entry, err := tenant.registry.PromoteCanary(name, canary)
+	if errors.Is(err, errCandidateReplaced) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	audit(r.Context(), auditPromote, name, nil, map[string]any{
+		"ruta":            entry.Source,
+		"version":         entry.Version,
+		"forzada":         forced,
+		"variante":        canaryVariant,
+		"porcentaje":      report.Percent,
+		"predicciones":    report.Canary.Predictions,
+		"diferencia_tasa": report.RateDifference,
+		"canario_p95":     report.Canary.P95Ms,
+	})
+	logf(r.Context(), "Modelo %s v%d: canario %s promovido", tenant.label(entry.Name), entry.Version, entry.Source)
+	writeJSON(w, http.StatusOK, newModelInfo(entry))
+}
+
+// Función que escribe una respuesta JSON
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Función que escribe un error en formato JSON
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sesión del menú: después de cada paso se guarda en un archivo chico qué
+// conjuntos de registros se procesaron y cuál está activo, cómo se entrenó, qué modelo se guardó o cargó y el
+// último establecimiento consultado. Al iniciar, el menú ofrece continuar la
+// sesión anterior: vuelve a procesar los mismos conjuntos (desde la
+// instantánea si no cambiaron) y recupera el modelo, cargándolo o
+// reentrenándolo con la misma configuración. TP_SESION cambia la ruta del
+// archivo; por defecto está en el directorio de configuración del usuario.
+
+// Estado guardado de la sesión del menú
+type menuSession struct {
+	Datasets      []sessionDataset `json:"conjuntos,omitempty"`
+	Active        string           `json:"activo,omitempty"` // Nombre del conjunto activo
+	DataPath      string           `json:"datos,omitempty"`  // Registros de las sesiones anteriores a los conjuntos
+	Trees         int              `json:"arboles,omitempty"`
+	EarlyStopping bool             `json:"parada_temprana,omitempty"`
+	Features      []string         `json:"caracteristicas,omitempty"`
+	ModelPath     string           `json:"modelo,omitempty"` // Último modelo guardado o cargado (vacío = el entrenado no se guardó)
+	Establishment string           `json:"establecimiento,omitempty"`
+	Saved         time.Time        `json:"guardada"`
+	disabled      bool             // Los guiones no leen ni guardan la sesión
+}
+
+// Conjunto de registros procesado en la sesión
+type sessionDataset struct {
+	Name string `json:"nombre"`
+	Path string `json:"datos"`
+}
+
+// Función que retorna la ruta del archivo de sesión
+func sessionPath() (string, error) {
+	if path := os.Getenv("TP_SESION"); path != "" {
+		return path, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "tpconcurrente", "sesion.json"), nil
+}
+
+// Función que lee la sesión anterior; retorna nil si no hay
+func loadSession() (*menuSession, error) {
+	path, err := sessionPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s menuSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("sesión guardada inválida en %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Función que guarda la sesión. Un error solo se informa: perder la sesión no
+// debe interrumpir el menú.
+func (s *menuSession) save() {
+	if s.disabled {
+		return
+	}
+	path, err := sessionPath()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		s.Saved = time.Now()
+		var data []byte
+		if data, err = json.MarshalIndent(s, "", "  "); err == nil {
+			tmp := path + ".tmp"
+			if err = os.WriteFile(tmp, data, 0o644); err == nil {
+				err = os.Rename(tmp, path)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Println("No se pudo guardar la sesión:", err)
+	}
+}
+
+// Función que describe la sesión para la pregunta de si continuarla
+func (s *menuSession) describe() string {
+	var parts []string
+	for _, ds := range s.Datasets {
+		parts = append(parts, fmt.Sprintf("registros %s de %s", ds.Name, ds.Path))
+	}
+	if s.DataPath != "" {
+		parts = append(parts, "registros de "+s.DataPath)
+	}
+	if len(s.Datasets) > 1 {
+		parts = append(parts, "conjunto activo "+s.Active)
+	}
+	switch {
+	case s.ModelPath != "":
+		parts = append(parts, "modelo "+s.ModelPath)
+	case s.Trees > 0:
+		parts = append(parts, fmt.Sprintf("modelo de %d árboles sin guardar", s.Trees))
+	}
+	if s.Establishment != "" {
+		parts = append(parts, "última consulta a "+s.Establishment)
+	}
+	if len(parts) == 0 {
+		return "sin registros ni modelo"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Función que ofrece continuar la sesión anterior y, si se acepta, procesa sus
+// registros y recupera su modelo con las mismas acciones que las opciones del
+// menú (y que por lo tanto se graban). Sin sesión anterior, o si no se
+// continúa, empieza una nueva.
+func (m *menu) resumeSession() {
+	m.session = &menuSession{}
+	previous, err := loadSession()
+	if err != nil {
+		fmt.Println(err)
+	}
+	if previous == nil {
+		return
+	}
+	fmt.Printf("Sesión anterior del %s: %s.\n", previous.Saved.Format("02/01/2006 15:04"), previous.describe())
+	fmt.Print("¿Continuar sesión anterior? (s/n): ")
+	if answer := readLine(); answer != "s" && answer != "S" {
+		return
+	}
+
+	datasets := previous.Datasets
+	if previous.DataPath != "" {
+		datasets = append(datasets, sessionDataset{Path: previous.DataPath})
+	}
+	for _, ds := range datasets {
+		if err := m.loadRecords(ds.Path, ds.Name); err != nil {
+			printMenuError(err)
+		}
+	}
+	if previous.Active != "" && m.data.get(previous.Active) != nil {
+		if err := m.useDataset(previous.Active); err != nil {
+			printMenuError(err)
+		}
+	}
+	switch {
+	case previous.ModelPath != "":
+		err = m.loadModel(previous.ModelPath)
+	case previous.Trees > 0 && m.data.active != nil && profile.Can(ActionTrain):
+		// El modelo no se había guardado: se reentrena con la misma configuración
+		err = m.train(previous.Trees, previous.EarlyStopping, previous.Features)
+	}
+	if err != nil {
+		printMenuError(err)
+	}
+	m.session.Establishment = previous.Establishment
+	m.session.save()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Métricas de predicción y del modo sombra
+var (
+	predictionLatency = NewHistogramVec("tp_prediccion_latencia_segundos",
+		"Latencia del recorrido del bosque por predicción", defaultBuckets, "modelo", "variante")
+	shadowPredictions = NewCounterVec("tp_sombra_predicciones_total",
+		"Predicciones calculadas también por el modelo candidato", "modelo")
+	shadowDisagreements = NewCounterVec("tp_sombra_desacuerdos_total",
+		"Predicciones en las que el candidato no coincide con el modelo principal", "modelo")
+)
+
+// Tamaño de la ventana de latencias usada en el reporte del modo sombra
+const shadowLatencyWindow = 1024
+
+// Modelo candidato que corre en sombra junto al modelo principal: recibe todas
+// las predicciones pero sus respuestas solo se comparan, nunca se devuelven.
+type Shadow struct {
+	Entry *ModelEntry // Modelo candidato
+	Since time.Time   // Momento en que empezó a correr en sombra
+
+	mu             sync.Mutex
+	predictions    int       // Predicciones comparadas
+	disagreements  int       // Predicciones en las que ambos modelos difieren
+	servingLatency []float64 // Últimas latencias del modelo principal (segundos)
+	shadowLatency  []float64 // Últimas latencias del candidato (segundos)
+}
+
+// Criterios para considerar que un candidato es seguro de promover
+type ShadowPolicy struct {
+	MinPredictions  int     // Predicciones mínimas antes de decidir
+	MaxDisagreement float64 // Tasa máxima de desacuerdo permitida
+	MaxLatencyRatio float64 // Máximo p95 del candidato respecto del principal
+}
+
+// Función que registra el resultado de comparar una predicción
+func (s *Shadow) record(disagree bool, serving, shadow time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.predictions++
+	if disagree {
+		s.disagreements++
+	}
+	s.servingLatency = appendWindow(s.servingLatency, serving.Seconds())
+	s.shadowLatency = appendWindow(s.shadowLatency, shadow.Seconds())
+}
+
+// Función que agrega un valor a una ventana, descartando el más antiguo si está llena
+func appendWindow(window []float64, value float64) []float64 {
+	if len(window) == shadowLatencyWindow {
+		copy(window, window[1:])
+		window = window[:len(window)-1]
+	}
+	return append(window, value)
+}
+
+// Resumen del modo sombra
+type ShadowReport struct {
+	Model            string    `json:"modelo"`
+	Candidate        string    `json:"candidato"`
+	Since            time.Time `json:"desde"`
+	Predictions      int       `json:"predicciones"`
+	Disagreements    int       `json:"desacuerdos"`
+	DisagreementRate float64   `json:"tasa_desacuerdo"`
+	ServingP50Ms     float64   `json:"principal_p50_ms"`
+	ServingP95Ms     float64   `json:"principal_p95_ms"`
+	ShadowP50Ms      float64   `json:"candidato_p50_ms"`
+	ShadowP95Ms      float64   `json:"candidato_p95_ms"`
+	SafeToPromote    bool      `json:"seguro_promover"`
+	Reason           string    `json:"motivo"`
+}
+
+// Función que resume la comparación y decide si el candidato puede promoverse
+func (s *Shadow) Report(model string, policy ShadowPolicy) ShadowReport {
+	s.mu.Lock()
+	serving := append([]float64(nil), s.servingLatency...)
+	shadow := append([]float64(nil), s.shadowLatency...)
+	report := ShadowReport{
+		Model:         model,
+		Candidate:     s.Entry.Source,
+		Since:         s.Since,
+		Predictions:   s.predictions,
+		Disagreements: s.disagreements,
+	}
+	s.mu.Unlock()
+
+	sort.Float64s(serving)
+	sort.Float64s(shadow)
+	report.ServingP50Ms = percentile(serving, 0.50) * 1000
+	report.ServingP95Ms = percentile(serving, 0.95) * 1000
+	report.ShadowP50Ms = percentile(shadow, 0.50) * 1000
+	report.ShadowP95Ms = percentile(shadow, 0.95) * 1000
+	if report.Predictions > 0 {
+		report.DisagreementRate = float64(report.Disagreements) / float64(report.Predictions)
+	}
+
+	switch {
+	case report.Predictions < policy.MinPredictions:
+		report.Reason = fmt.Sprintf("faltan predicciones: %d de %d", report.Predictions, policy.MinPredictions)
+	case report.DisagreementRate > policy.MaxDisagreement:
+		report.Reason = fmt.Sprintf("tasa de desacuerdo %.3f mayor a %.3f", report.DisagreementRate, policy.MaxDisagreement)
+	case report.ServingP95Ms > 0 && report.ShadowP95Ms > policy.MaxLatencyRatio*report.ServingP95Ms:
+		report.Reason = fmt.Sprintf("latencia p95 del candidato %.3fms frente a %.3fms", report.ShadowP95Ms, report.ServingP95Ms)
+	default:
+		report.SafeToPromote = true
+		report.Reason = "el candidato cumple los criterios"
+	}
+	return report
+}
+
+// Función que calcula la predicción del candidato y la compara con la del
+// modelo principal. Se ejecuta en su propia goroutine para no agregar latencia.
+func runShadow(ctx context.Context, name string, shadow *Shadow, release func(), att Atencion, servingCongested bool, servingLatency time.Duration) {
+	defer release()
+
+	start := time.Now()
+	votes, total := shadow.Entry.Model.Vote(att)
+	congested := decideVote(votes, total, pipelineFor(shadow.Entry.Model, nil).tiePolicy()).Congested
+	latency := time.Since(start)
+
+	predictionLatency.ObserveExemplar(latency.Seconds(), requestID(ctx), name, "sombra")
+	shadowPredictions.Inc(name)
+	disagree := congested != servingCongested
+	if disagree {
+		shadowDisagreements.Inc(name)
+		logf(ctx, "Sombra %s: desacuerdo para %q %d/%d (principal=%v, candidato=%v)",
+			name, att.NombreEstablecimiento, att.Dia, att.Mes, servingCongested, congested)
+	}
+	shadow.record(disagree, servingLatency, latency)
+}
@@ -0,0 +1,6 @@
+//go:build mysql
+
+package main
+
+// Driver de MySQL para la salida -sql de predict-batch
+import _ "github.com/go-sql-driver/mysql"
@@ -0,0 +1,6 @@
+//go:build postgres
+
+package main
+
+// Driver de PostgreSQL (pgx) para la salida -sql de predict-batch
+import _ "github.com/jackc/pgx/v5/stdlib"
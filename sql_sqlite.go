@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package main
+
+// Driver de SQLite (sin cgo) para la salida -sql de predict-batch
+import _ "modernc.org/sqlite"
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Destinos adicionales de los registros durante la carga. Cada registro válido
+// se reparte (fan-out) a todos los destinos registrados además del slice en
+// memoria, así una sola pasada por el archivo alimenta estadísticas, detección
+// de anomalías o un archivo crudo. Cada destino corre en su propia goroutine
+// con su propio canal, de modo que uno lento no frena a los demás más allá de
+// su buffer.
+
+// Destino de los registros de una carga
+type RecordSink interface {
+	Name() string              // Nombre para los mensajes de error
+	Consume(att Atencion)      // Recibe un registro; siempre desde la misma goroutine
+	Close(loadErr error) error // Se llama después del último registro; loadErr indica si la carga falló
+}
+
+// Registros que cada destino puede tener pendientes antes de frenar la carga
+const sinkBuffer = 1024
+
+// Reparto de los registros a varios destinos
+type fanOut struct {
+	channels []chan Atencion
+	wg       sync.WaitGroup
+}
+
+// Función que inicia una goroutine por destino
+func newFanOut(sinks []RecordSink) *fanOut {
+	f := &fanOut{channels: make([]chan Atencion, len(sinks))}
+	for i, sink := range sinks {
+		ch := make(chan Atencion, sinkBuffer)
+		f.channels[i] = ch
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			for att := range ch {
+				sink.Consume(att)
+			}
+		}()
+	}
+	return f
+}
+
+// Función que envía un registro a todos los destinos
+func (f *fanOut) send(att Atencion) {
+	for _, ch := range f.channels {
+		ch <- att
+	}
+}
+
+// Función que cierra los canales, espera a que los destinos consuman lo
+// pendiente y los cierra informando el resultado de la carga. Retorna sus errores.
+func (f *fanOut) close(sinks []RecordSink, loadErr error) error {
+	for _, ch := range f.channels {
+		close(ch)
+	}
+	f.wg.Wait()
+	errs := make([]error, len(sinks))
+	for i, sink := range sinks {
+		if err := sink.Close(loadErr); err != nil {
+			errs[i] = fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Función que reparte a los destinos registros que ya están en memoria (por
+// ejemplo, leídos de una instantánea) y los cierra
+func feedSinks(sinks []RecordSink, data []Atencion) error {
+	if len(sinks) == 0 {
+		return nil
+	}
+	fan := newFanOut(sinks)
+	for _, att := range data {
+		fan.send(att)
+	}
+	return fan.close(sinks, nil)
+}
+
+// Función que cierra los destinos de una carga que falló antes de empezar
+func abortSinks(sinks []RecordSink, loadErr error) {
+	for _, sink := range sinks {
+		sink.Close(loadErr)
+	}
+}
+
+// Estadísticas acumuladas durante la carga
+type LoadStats struct {
+	Records        int
+	Atendidos      int
+	Atenciones     int
+	ByMonth        [13]int        // Registros por mes (índice 1-12)
+	Establishments map[string]int // Registros por establecimiento
+}
+
+func NewLoadStats() *LoadStats {
+	return &LoadStats{Establishments: make(map[string]int)}
+}
+
+func (s *LoadStats) Name() string { return "estadísticas" }
+
+func (s *LoadStats) Consume(att Atencion) {
+	s.Records++
+	s.Atendidos += att.Atendidos
+	s.Atenciones += att.Atenciones
+	if att.Mes >= 1 && att.Mes <= 12 {
+		s.ByMonth[att.Mes]++
+	}
+	s.Establishments[att.NombreEstablecimiento]++
+}
+
+func (s *LoadStats) Close(error) error { return nil }
+
+// Función que escribe el resumen de las estadísticas
+func (s *LoadStats) Print(w io.Writer) {
+	if s.Records == 0 {
+		fmt.Fprintln(w, "Estadísticas: sin registros")
+		return
+	}
+	fmt.Fprintf(w, "Estadísticas: %d registros de %d establecimientos, %.2f atendidos y %.2f atenciones en promedio\n",
+		s.Records, len(s.Establishments), float64(s.Atendidos)/float64(s.Records), float64(s.Atenciones)/float64(s.Records))
+	var months []string
+	for month := 1; month <= 12; month++ {
+		months = append(months, fmt.Sprintf("%s %d", monthNames[month][:3], s.ByMonth[month]))
+	}
+	fmt.Fprintf(w, "  Por mes: %s\n", strings.Join(months, ", "))
+}
+
+// Detector de anomalías en línea: un registro es anómalo si sus atendidos
+// superan en más de Sigmas desviaciones estándar el promedio que llevaba su
+// establecimiento hasta ese momento (algoritmo de Welford, sin guardar las filas)
+type AnomalyDetector struct {
+	Sigmas     float64 // Desviaciones estándar a partir de las que se marca un registro
+	MinSamples int     // Registros previos del establecimiento antes de evaluar
+	MaxReport  int     // Anomalías que se conservan para mostrar
+
+	running   map[string]*runningStat
+	Anomalies []LoadAnomaly
+	Total     int // Anomalías encontradas (aunque no se conserven todas)
+}
+
+// Promedio y varianza en línea
+type runningStat struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+// Registro marcado como anómalo
+type LoadAnomaly struct {
+	Record Atencion
+	Mean   float64 // Promedio del establecimiento antes del registro
+	StdDev float64
+}
+
+func NewAnomalyDetector(sigmas float64) *AnomalyDetector {
+	return &AnomalyDetector{Sigmas: sigmas, MinSamples: 30, MaxReport: 20, running: make(map[string]*runningStat)}
+}
+
+func (d *AnomalyDetector) Name() string { return "anomalías" }
+
+func (d *AnomalyDetector) Consume(att Atencion) {
+	stat, ok := d.running[att.NombreEstablecimiento]
+	if !ok {
+		stat = &runningStat{}
+		d.running[att.NombreEstablecimiento] = stat
+	}
+	value := float64(att.Atendidos)
+	if stat.n >= d.MinSamples {
+		std := math.Sqrt(stat.m2 / float64(stat.n-1))
+		if std > 0 && value > stat.mean+d.Sigmas*std {
+			d.Total++
+			if len(d.Anomalies) < d.MaxReport {
+				d.Anomalies = append(d.Anomalies, LoadAnomaly{Record: att, Mean: stat.mean, StdDev: std})
+			}
+		}
+	}
+	stat.n++
+	delta := value - stat.mean
+	stat.mean += delta / float64(stat.n)
+	stat.m2 += delta * (value - stat.mean)
+}
+
+func (d *AnomalyDetector) Close(error) error {
+	sort.Slice(d.Anomalies, func(i, j int) bool { return d.Anomalies[i].Record.Atendidos > d.Anomalies[j].Record.Atendidos })
+	return nil
+}
+
+// Función que escribe las anomalías encontradas
+func (d *AnomalyDetector) Print(w io.Writer) {
+	fmt.Fprintf(w, "Anomalías (atendidos > promedio + %.1f σ): %d\n", d.Sigmas, d.Total)
+	for _, a := range d.Anomalies {
+		fmt.Fprintf(w, "  %s %d/%d: %d atendidos (promedio %.1f, σ %.1f)\n",
+			a.Record.NombreEstablecimiento, a.Record.Dia, a.Record.Mes, a.Record.Atendidos, a.Mean, a.StdDev)
+	}
+}
+
+// Archivo crudo con los registros válidos, en el mismo formato CSV de entrada.
+// Si la ruta termina en ".gz" se comprime.
+type archiveSink struct {
+	path string
+	out  outputFile
+	buf  *bufio.Writer
+	zw   *gzip.Writer
+	w    *csv.Writer
+}
+
+// Función que crea el archivo crudo (local o remoto) con la cabecera del esquema vigente
+func newArchiveSink(ctx context.Context, path string) (*archiveSink, error) {
+	out, err := createOutput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	a := &archiveSink{path: path, out: out, buf: bufio.NewWriter(out)}
+	var w io.Writer = a.buf
+	if strings.HasSuffix(path, ".gz") {
+		a.zw = gzip.NewWriter(a.buf)
+		w = a.zw
+	}
+	a.w = csv.NewWriter(w)
+	a.w.Write(inputSchemas[defaultSchemaVersion].Columns)
+	return a, nil
+}
+
+func (a *archiveSink) Name() string { return "archivo " + a.path }
+
+func (a *archiveSink) Consume(att Atencion) {
+	a.w.Write([]string{
+		strconv.Itoa(att.Mes),
+		strconv.Itoa(att.Dia),
+		att.NombreEstablecimiento,
+		strconv.Itoa(att.Atendidos),
+		strconv.Itoa(att.Atenciones),
+	})
+}
+
+func (a *archiveSink) Close(loadErr error) error {
+	if loadErr != nil {
+		a.out.Abort() // La carga falló: no dejar un archivo con datos incompletos o sin verificar
+		return nil
+	}
+	a.w.Flush()
+	err := a.w.Error()
+	if a.zw != nil && err == nil {
+		err = a.zw.Close()
+	}
+	if err == nil {
+		err = a.buf.Flush()
+	}
+	if err != nil {
+		a.out.Abort() // No dejar un archivo incompleto
+		return err
+	}
+	return a.out.Close()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Sustituto independiente: el árbol de rules -sustituto se guarda como un JSON
+// de pocos KB, con las características que necesita y su fidelidad al bosque,
+// para que los equipos de las postas con poca capacidad puedan predecir sin
+// conexión y sin cargar el bosque. Es un árbol de decisión común: en cada
+// nodo, si el valor de la característica es <= umbral se sigue por la
+// izquierda. OpenModel lo reconoce y lo usa como un modelo de un solo árbol.
+
+// Versión del formato del sustituto
+const surrogateFormat = "sustituto/1"
+
+// Artefacto del sustituto
+type Surrogate struct {
+	Format   string    `json:"formato"`
+	Features []string  `json:"caracteristicas"` // Características que usa el árbol
+	Fidelity float64   `json:"fidelidad"`       // Fracción de las consultas de fondo en las que coincide con el bosque
+	Queries  int       `json:"consultas_fondo"` // Consultas de fondo con las que se armó
+	Model    string    `json:"modelo"`          // Modelo del que se obtuvo
+	Root     *ruleNode `json:"arbol"`
+}
+
+// Función que escribe el sustituto en path (local o remoto) y retorna su tamaño en bytes
+func (s *Surrogate) Save(path string) (int, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return 0, err
+	}
+	file, err := createOutput(context.Background(), path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Abort()
+	if _, err := file.Write(data); err != nil {
+		return 0, err
+	}
+	return len(data), file.Close()
+}
+
+// Función que lee un sustituto guardado con Save
+func OpenSurrogate(path string) (*Surrogate, error) {
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	var s Surrogate
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("sustituto inválido: %w", err)
+	}
+	if s.Format != surrogateFormat {
+		return nil, fmt.Errorf("formato de sustituto desconocido %q", s.Format)
+	}
+	if err := s.Root.check(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Función que verifica que cada nodo interno tenga una característica
+// conocida y sus dos hijos
+func (n *ruleNode) check() error {
+	if n == nil {
+		return fmt.Errorf("sustituto inválido: falta un nodo")
+	}
+	if n.Feature == "" {
+		return nil
+	}
+	if _, ok := featureAccessor(n.Feature); !ok {
+		return fmt.Errorf("sustituto inválido: característica desconocida %q", n.Feature)
+	}
+	if err := n.Left.check(); err != nil {
+		return err
+	}
+	return n.Right.check()
+}
+
+// Voto del sustituto: un solo árbol
+func (s *Surrogate) Vote(att Atencion) (votes, total int) {
+	if s.Root.predict(att) {
+		return 1, 1
+	}
+	return 0, 1
+}
+
+func (s *Surrogate) NumTrees() int {
+	return 1
+}
+
+// Función que retorna las características que usa el sustituto
+func (s *Surrogate) UsedFeatures() []string {
+	return s.Features
+}
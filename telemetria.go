@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trazas de OpenTelemetry exportadas por OTLP/HTTP en JSON. Se activan con las
+// variables estándar OTEL_EXPORTER_OTLP_TRACES_ENDPOINT u OTEL_EXPORTER_OTLP_ENDPOINT;
+// sin ellas los spans no hacen nada y no tienen costo.
+
+// Span de una etapa del proceso
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+	attrs    map[string]any
+	err      error
+}
+
+// Clave del span activo en el contexto
+type spanKey struct{}
+
+// Exportador global (nil si la telemetría está desactivada)
+var tracer *spanExporter
+
+// Función que inicia un span hijo del span activo en el contexto
+func startSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{name: name, start: time.Now(), attrs: make(map[string]any)}
+	rand.Read(span.spanID[:])
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Función que agrega un atributo al span
+func (s *Span) SetAttr(key string, value any) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+// Función que marca el span como fallido
+func (s *Span) SetError(err error) {
+	if s != nil {
+		s.err = err
+	}
+}
+
+// Función que termina el span y lo encola para exportarlo
+func (s *Span) End() {
+	if s != nil {
+		tracer.enqueue(s, time.Now())
+	}
+}
+
+// Exportador que agrupa spans y los envía por lotes al colector
+type spanExporter struct {
+	endpoint string
+	client   *http.Client
+	spans    chan otlpSpan
+	done     chan struct{}
+	once     sync.Once
+
+	// mu protege closed: los envíos toman el lock de lectura y el cierre el de
+	// escritura, así nunca se envía a un canal cerrado
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Función que activa la telemetría si el entorno indica un colector OTLP
+func initTracing() {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	tracer = &spanExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		spans:    make(chan otlpSpan, 1024),
+		done:     make(chan struct{}),
+	}
+	go tracer.run()
+}
+
+// Función que envía los spans pendientes y detiene el exportador
+func shutdownTracing() {
+	if tracer == nil {
+		return
+	}
+	tracer.once.Do(func() {
+		tracer.mu.Lock()
+		tracer.closed = true
+		close(tracer.spans)
+		tracer.mu.Unlock()
+		<-tracer.done
+	})
+}
+
+func (e *spanExporter) enqueue(s *Span, end time.Time) {
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              1, // SPAN_KIND_INTERNAL
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+	}
+	if s.parentID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for key, value := range s.attrs {
+		span.Attributes = append(span.Attributes, otlpAttribute(key, value))
+	}
+	if s.err != nil {
+		span.Status = &otlpStatus{Code: 2, Message: s.err.Error()} // STATUS_CODE_ERROR
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		// Los spans que terminan después de detener el exportador se descartan
+		return
+	}
+	select {
+	case e.spans <- span:
+	default:
+		// Si el colector no da abasto se descartan spans antes que frenar el trabajo
+	}
+}
+
+// Goroutine que envía los spans cada pocos segundos o al llenar un lote
+func (e *spanExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var batch []otlpSpan
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				e.export(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= 512 {
+				e.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.export(batch)
+			batch = nil
+		}
+	}
+}
+
+// Función que envía un lote de spans al colector en formato OTLP/JSON
+func (e *spanExporter) export(batch []otlpSpan) {
+	if len(batch) == 0 {
+		return
+	}
+	body, _ := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []any{otlpAttribute("service.name", "tpconcurrente")},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "tpconcurrente"},
+				"spans": batch,
+			}},
+		}},
+	})
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error al exportar trazas: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("El colector de trazas respondió %s", resp.Status)
+	}
+}
+
+// Span en el formato JSON de OTLP
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []any       `json:"attributes,omitempty"`
+	Status            *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// Función que convierte un atributo al formato clave/valor de OTLP
+func otlpAttribute(key string, value any) map[string]any {
+	var v map[string]any
+	switch x := value.(type) {
+	case int:
+		v = map[string]any{"intValue": strconv.Itoa(x)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": x}
+	case bool:
+		v = map[string]any{"boolValue": x}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(x)}
+	}
+	return map[string]any{"key": key, "value": v}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Los spans que terminan después de detener el exportador se descartan sin
+// enviar a un canal cerrado
+func TestSpanEndAfterShutdown(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", collector.URL)
+	initTracing()
+	defer func() { tracer = nil }()
+
+	_, span := startSpan(context.Background(), "prueba")
+	shutdownTracing()
+	span.End()
+	shutdownTracing()
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
-	"encoding/csv"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"math/rand"
 	"os"
-	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,26 +22,37 @@ type Atencion struct {
 	NombreEstablecimiento string // Nombre del establecimiento de salud
 	Atendidos             int    // Número de pacientes atendidos
 	Atenciones            int    // Número total de atenciones
+	Grupo                 int    // Grupo de demanda del establecimiento (0 = sin agrupar), lo completa el pipeline
+	Anio                  int    // Año de la atención (0 = desconocido)
+	Citas                 int    // Citas programadas para ese día (0 = sin dato), las completa la agenda
 }
 
 // Nodo del árbol de decisión
 type Node struct {
-	Feature    string // Característica en la que se basará la división (e.g., Mes, Dia)
-	Threshold  int    // Umbral de división para la característica
-	Left       *Node  // Rama izquierda (datos que cumplen la condición)
-	Right      *Node  // Rama derecha (datos que no cumplen la condición)
-	IsLeaf     bool   // Indica si es un nodo hoja
-	Prediction bool   // Predicción para este nodo (true = congestionado, false = no congestionado)
+	Feature    string  // Característica en la que se basará la división (e.g., Mes, Dia)
+	Threshold  int     // Umbral de división para la característica
+	Left       *Node   // Rama izquierda (datos que cumplen la condición)
+	Right      *Node   // Rama derecha (datos que no cumplen la condición)
+	IsLeaf     bool    // Indica si es un nodo hoja
+	Prediction bool    // Predicción para este nodo (true = congestionado, false = no congestionado)
+	Ratio      float64 // Atenciones por atendido de la hoja (0 = sin dato)
 }
 
 // Estructura del árbol de decisión
 type DecisionTree struct {
-	Root *Node // Nodo raíz del árbol
+	Root                *Node    // Nodo raíz del árbol
+	Features            []string // Características sobre las que puede dividir (nil = las por defecto)
+	CongestionThreshold int      // Promedio de atendidos a partir del cual una hoja predice congestión
+
+	limit  func(establishment string) float64 // Umbral de cada establecimiento (nil = CongestionThreshold para todos)
+	years  yearRange                          // Años de los datos, para los umbrales de Anio
+	ranges map[string][2]int                  // Rango de Citas y las características propias, para sus umbrales
+	rng    *rand.Rand                         // Generador de las divisiones (nil = el global)
 }
 
 // Constructor para un nuevo árbol de decisión
 func NewDecisionTree() *DecisionTree {
-	return &DecisionTree{Root: &Node{}} // Inicializa un nuevo árbol con un nodo raíz vacío
+	return &DecisionTree{Root: &Node{}, CongestionThreshold: congestionThreshold} // Inicializa un nuevo árbol con un nodo raíz vacío
 }
 
 // Función para entrenar un árbol de decisión con datos
@@ -51,6 +66,7 @@ func (dt *DecisionTree) buildTree(data []Atencion, depth int) *Node {
 		return &Node{
 			IsLeaf:     true,                    // Este es un nodo hoja
 			Prediction: dt.makePrediction(data), // Se hace una predicción basada en los datos
+			Ratio:      attentionRatio(data),    // Y la intensidad de las consultas repetidas
 		}
 	}
 
@@ -71,15 +87,39 @@ func (dt *DecisionTree) buildTree(data []Atencion, depth int) *Node {
 
 // Función para seleccionar una característica y umbral aleatorio
 func (dt *DecisionTree) selectFeatureAndThreshold() (string, int) {
-	features := []string{"Mes", "Dia", "Atendidos", "Atenciones"} // Características posibles
-	feature := features[rand.Intn(len(features))]                 // Selección aleatoria de una característica
-	threshold := rand.Intn(12) + 1                                // Generar un umbral aleatorio entre 1 y 12
+	features := dt.Features // Características permitidas para este árbol
+	if len(features) == 0 {
+		features = defaultFeatures // Sin selección solo se usan las conocidas al predecir
+	}
+	feature := features[dt.intn(len(features))] // Selección aleatoria de una característica
+	threshold := dt.intn(12) + 1                // Generar un umbral aleatorio entre 1 y 12
+	if feature == "Anio" && dt.years.multiYear() {
+		threshold = dt.years.First + dt.intn(dt.years.Last-dt.years.First) // Del primer año al penúltimo
+	}
+	if r, ok := dt.ranges[feature]; ok && r[1] > r[0] {
+		// Del mínimo al penúltimo valor de los datos; la diferencia se calcula sin
+		// signo porque r[1]-r[0] puede no caber en un int
+		span := uint(r[1]) - uint(r[0])
+		threshold = r[0] + dt.intn(int(min(span, math.MaxInt)))
+	}
 	return feature, threshold
 }
 
+// Función que retorna un entero al azar en [0, n) con el generador del árbol
+func (dt *DecisionTree) intn(n int) int {
+	if dt.rng == nil {
+		return rand.Intn(n)
+	}
+	return dt.rng.Intn(n)
+}
+
 // Función para dividir los datos basados en la característica y umbral
 func (dt *DecisionTree) splitData(data []Atencion, feature string, threshold int) ([]Atencion, []Atencion) {
 	var left, right []Atencion // Inicializar slices para los datos divididos
+	get, ok := featureAccessor(feature)
+	if !ok {
+		get = func(Atencion) int { return 0 }
+	}
 	for _, att := range data {
 		switch feature {
 		case "Mes":
@@ -106,6 +146,30 @@ func (dt *DecisionTree) splitData(data []Atencion, feature string, threshold int
 			} else {
 				right = append(right, att)
 			}
+		case "Grupo":
+			if att.Grupo <= threshold {
+				left = append(left, att)
+			} else {
+				right = append(right, att)
+			}
+		case "Anio":
+			if att.Anio <= threshold {
+				left = append(left, att)
+			} else {
+				right = append(right, att)
+			}
+		case "Citas":
+			if att.Citas <= threshold {
+				left = append(left, att)
+			} else {
+				right = append(right, att)
+			}
+		default: // Característica propia
+			if get(att) <= threshold {
+				left = append(left, att)
+			} else {
+				right = append(right, att)
+			}
 		}
 	}
 	return left, right // Retornar los datos divididos
@@ -117,6 +181,14 @@ func (dt *DecisionTree) makePrediction(data []Atencion) bool {
 		// Si no hay datos, devolvemos false o alguna predicción por defecto
 		return false
 	}
+	if dt.limit != nil {
+		// Carga promedio: los atendidos de cada fila sobre el umbral de su establecimiento
+		load := 0.0
+		for _, att := range data {
+			load += float64(att.Atendidos) / dt.limit(att.NombreEstablecimiento)
+		}
+		return load > float64(len(data))
+	}
 
 	total := 0
 	for _, att := range data {
@@ -124,10 +196,13 @@ func (dt *DecisionTree) makePrediction(data []Atencion) bool {
 	}
 	avg := total / len(data) // Calcular el promedio
 
-	// Considerar congestión si el promedio de "Atendidos" es mayor a 20
-	return avg > 20
+	// Considerar congestión si el promedio de "Atendidos" es mayor al umbral
+	return avg > dt.CongestionThreshold
 }
 
+// Umbral por defecto de pacientes atendidos a partir del cual se considera congestión
+const congestionThreshold = 20
+
 // Predicción del árbol para un nuevo conjunto de datos
 func (dt *DecisionTree) Predict(att Atencion) bool {
 	node := dt.Root    // Comenzar desde la raíz
@@ -157,6 +232,31 @@ func (dt *DecisionTree) Predict(att Atencion) bool {
 			} else {
 				node = node.Right
 			}
+		case "Grupo":
+			if att.Grupo <= node.Threshold {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+		case "Anio":
+			if att.Anio <= node.Threshold {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+		case "Citas":
+			if att.Citas <= node.Threshold {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+		default: // Característica propia; si no está registrada vale 0
+			get, ok := featureAccessor(node.Feature)
+			if ok && get(att) > node.Threshold {
+				node = node.Right
+			} else {
+				node = node.Left
+			}
 		}
 	}
 	return node.Prediction // Retornar la predicción del nodo hoja
@@ -164,49 +264,410 @@ func (dt *DecisionTree) Predict(att Atencion) bool {
 
 // Estructura del bosque aleatorio
 type RandomForest struct {
-	Trees []*DecisionTree // Slice que contiene los árboles de decisión
-	mu    sync.Mutex      // Mutex para sincronización de acceso concurrente
+	Trees         []*DecisionTree     // Slice que contiene los árboles de decisión
+	EarlyStopping EarlyStopping       // Configuración de la parada temprana por error OOB
+	OOBError      float64             // Último error out-of-bag calculado (-1 si no se pudo calcular)
+	Features      []string            // Características que pueden usar los árboles (nil = las por defecto)
+	Pipeline      *Pipeline           // Preprocesamiento usado al entrenar, guardado con el modelo
+	MaxParallel   int                 // Árboles que se construyen a la vez (0 = los que quepan en memoria)
+	Capacities    *Capacities         // Capacidad declarada de los establecimientos (nil = umbral fijo para todos)
+	Winsorize     float64             // Percentil por establecimiento al que se recortan los atendidos (0 = sin recorte)
+	RecencyDecay  float64             // Peso de cada año respecto del siguiente en las muestras (0 = sin ponderar)
+	Threshold     int                 // Atendidos a partir de los cuales una fila está congestionada (0 = congestionThreshold)
+	TrainedAt     time.Time           // Momento del entrenamiento desde cero
+	DataSHA256    string              // Suma de los datos de entrenamiento (vacío = desconocida)
+	Seed          int64               // Semilla de los árboles; con la misma, los mismos árboles (0 = al azar)
+	Strategy      concurrencyStrategy // Cómo se reparte la construcción de los árboles (ver estrategias.go)
+	Ties          tiePolicy           // Decisión ante un empate, que se guarda en el pipeline y rige el error OOB (ver empates.go)
+	mu            sync.Mutex          // Mutex para sincronización de acceso concurrente
+
+	data     []Atencion       // Datos de entrenamiento conservados para poder seguir agregando árboles
+	oobVotes []int32          // Votos OOB a favor de congestión acumulados por fila
+	oobCount []int32          // Número de árboles para los que cada fila quedó fuera de la muestra
+	weights  []float64        // Peso de recencia de cada fila en las muestras (nil = uniforme)
+	progress func(int)        // Se llama con el total de árboles cada vez que se agrega uno (puede ser nil)
+	monitor  *pipelineMonitor // Si no es nil, mide las esperas en los canales del entrenamiento
+}
+
+// Configuración de la parada temprana basada en el error OOB
+type EarlyStopping struct {
+	Enabled   bool    // Indica si se usa la parada temprana
+	BatchSize int     // Árboles que se entrenan entre cada evaluación del error OOB
+	Patience  int     // Lotes consecutivos sin mejora tolerados antes de detenerse
+	MinDelta  float64 // Mejora mínima del error OOB para considerarla una mejora
 }
 
-// Función para entrenar un bosque aleatorio
+// Resultado del entrenamiento de un árbol junto con sus predicciones OOB
+type treeResult struct {
+	tree  *DecisionTree // Árbol entrenado
+	oob   []int         // Índices de las filas que no participaron en su entrenamiento
+	votes []bool        // Predicción del árbol para cada fila OOB
+}
+
+// Función para entrenar un bosque aleatorio desde cero con numTrees árboles
 func (rf *RandomForest) Train(data []Atencion) {
-	var wg sync.WaitGroup
-	rf.Trees = make([]*DecisionTree, 0, numTrees)     // Inicializamos el slice de árboles con capacidad para numTrees
-	treeChannel := make(chan *DecisionTree, numTrees) // Canal para enviar los árboles entrenados
+	rf.TrainTrees(data, numTrees)
+}
 
-	// Entrenar los árboles en paralelo
-	for i := 0; i < numTrees; i++ {
-		wg.Add(1) // Aumentar el contador de goroutines
-		go func() {
-			defer wg.Done() // Decrementar el contador al finalizar
+// Función para entrenar un bosque aleatorio desde cero con n árboles
+func (rf *RandomForest) TrainTrees(data []Atencion, n int) {
+	rf.TrainTreesContext(context.Background(), data, n)
+}
 
-			subData := sampleData(data) // Obtener una muestra de datos
-			tree := NewDecisionTree()   // Crear un nuevo árbol
-			tree.Train(subData)         // Entrenar el árbol con los datos muestreados
-			treeChannel <- tree         // Enviar el árbol entrenado al canal
-		}()
+// Igual que TrainTrees, pero las etapas del entrenamiento se registran como
+// spans hijos del span activo en ctx. Si ctx se cancela no se empiezan más
+// árboles: el bosque queda con los ya entrenados y se retorna la causa.
+func (rf *RandomForest) TrainTreesContext(ctx context.Context, data []Atencion, n int) error {
+	quality := assessQuality(data) // Con los valores sin recortar, que son los que tienen los atípicos
+	var winsorizer *Winsorizer
+	if rf.Winsorize > 0 {
+		winsorizer = NewWinsorizer(data, rf.Winsorize)
+		data = winsorizer.Apply(data) // Los árboles y los promedios ven los valores recortados
+	}
+	rf.Trees = make([]*DecisionTree, 0, n) // Inicializamos el slice de árboles con capacidad para n
+	rf.data = data                         // Guardamos los datos para el warm start
+	rf.weights = recencyWeights(data, rf.RecencyDecay)
+	rf.TrainedAt = time.Now()
+	rf.oobVotes = make([]int32, len(data)) // Reiniciamos los acumuladores OOB
+	rf.oobCount = make([]int32, len(data))
+	rf.OOBError = -1
+	rf.Pipeline = NewPipeline(data, rf.Features) // Umbral, codificación e imputación del entrenamiento
+	if rf.Threshold > 0 {
+		rf.Pipeline.CongestionThreshold = rf.Threshold
+	}
+	rf.Pipeline.Ties = rf.Ties
+	rf.Pipeline.Clusters.Label(data) // Con la característica Grupo, el de cada registro
+	rf.Pipeline.Capacities = rf.Capacities
+	rf.Pipeline.Winsorizer = winsorizer
+	congested := 0
+	for _, att := range data {
+		if rf.Pipeline.Congested(att) {
+			congested++
+		}
 	}
+	rf.Pipeline.CongestedRate = ratio(congested, len(data))
+	rf.Pipeline.Quality = quality
 
-	// Recolectar los árboles entrenados
+	if len(data) == 0 {
+		return nil // Con datos vacíos no se agrega ningún árbol
+	}
+	_, err := rf.AddTreesContext(ctx, n)
+	return err
+}
+
+// Número de árboles del bosque
+func (rf *RandomForest) NumTrees() int {
+	return len(rf.Trees)
+}
+
+// Función para agregar n árboles a un bosque ya entrenado (warm start).
+// Si la parada temprana está activa se entrena por lotes y se detiene cuando el
+// error OOB deja de mejorar. Retorna el número de árboles realmente agregados.
+func (rf *RandomForest) AddTrees(n int) (int, error) {
+	return rf.AddTreesContext(context.Background(), n)
+}
+
+// Igual que AddTrees, registrando el entrenamiento como spans hijos de ctx.
+// Si ctx se cancela retorna los árboles agregados hasta entonces y la causa.
+func (rf *RandomForest) AddTreesContext(ctx context.Context, n int) (added int, err error) {
+	if len(rf.data) == 0 {
+		return 0, errors.New("el bosque no tiene datos de entrenamiento")
+	}
+	ctx, span := startSpan(ctx, "entrenar_bosque")
+	span.SetAttr("registros", len(rf.data))
+	span.SetAttr("arboles_pedidos", n)
+	defer func() {
+		span.SetAttr("arboles_agregados", added)
+		span.SetAttr("error_oob", rf.OOBError)
+		span.End()
+	}()
+
+	// Sin parada temprana se entrenan todos los árboles en un solo lote
+	if !rf.EarlyStopping.Enabled {
+		added = rf.trainBatch(ctx, n)
+		rf.OOBError = rf.evaluateOOB(ctx)
+		if added < n {
+			return added, context.Cause(ctx)
+		}
+		return added, nil
+	}
+
+	batchSize := rf.EarlyStopping.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10 // Tamaño de lote por defecto
+	}
+
+	best := rf.OOBError // Mejor error OOB visto hasta ahora
+	withoutImprovement := 0
+	for added < n {
+		size := min(batchSize, n-added)
+		trained := rf.trainBatch(ctx, size)
+		added += trained
+		rf.OOBError = rf.evaluateOOB(ctx)
+		if trained < size {
+			return added, context.Cause(ctx)
+		}
+
+		if best < 0 || best-rf.OOBError > rf.EarlyStopping.MinDelta {
+			best = rf.OOBError // El error mejoró lo suficiente
+			withoutImprovement = 0
+			continue
+		}
+		withoutImprovement++
+		if withoutImprovement >= rf.EarlyStopping.Patience {
+			break // El error dejó de mejorar: parada temprana
+		}
+	}
+	return added, nil
+}
+
+// Función que entrena n árboles en paralelo y los agrega al bosque, repartidos
+// según rf.Strategy. Un límite de paralelismo evita agotar la memoria; los
+// demás árboles esperan su turno. Si ctx se cancela, los que esperan ya no se
+// construyen; retorna cuántos se agregaron. Los árboles se agregan en el orden
+// de su posición, no en el que terminan, para que el bosque no dependa de la
+// estrategia.
+func (rf *RandomForest) trainBatch(ctx context.Context, n int) int {
+	parallel := treeConcurrency(n, len(rf.data), rf.MaxParallel)
+	if parallel < n && rf.MaxParallel <= 0 {
+		log.Printf("Memoria limitada: se construyen %d de %d árboles a la vez", parallel, n)
+	}
+	base := len(rf.Trees) // Posición en el bosque del primer árbol del lote
+
+	// Entrenar los árboles según la estrategia, enviando cada uno al canal
+	treeChannel := make(chan indexedTree, n) // Canal para enviar los árboles entrenados
+	var treeProbe *channelProbe
+	switch rf.Strategy {
+	case strategyPipeline:
+		treeProbe = rf.monitor.channel("predicción OOB", "recolección de árboles", n, 1, 1)
+	case strategyPool:
+		treeProbe = rf.monitor.channel("construcción", "recolección de árboles", n, poolWorkers(parallel), 1)
+	case strategySequential:
+		treeProbe = rf.monitor.channel("construcción", "recolección de árboles", n, 1, 1)
+	default:
+		treeProbe = rf.monitor.channel("construcción", "recolección de árboles", n, parallel, 1)
+	}
+	treeProbe.toCollector()
 	go func() {
-		wg.Wait()          // Esperar a que todas las goroutines terminen
+		if rf.Strategy == strategyPipeline {
+			rf.buildTreesPipeline(ctx, base, n, parallel, treeChannel, treeProbe)
+		} else {
+			rf.Strategy.each(n, parallel, func(i int) {
+				if ctx.Err() != nil {
+					return // Plazo vencido o entrenamiento cancelado
+				}
+				release, err := acquireWork(ctx) // En el servidor, después de las predicciones interactivas
+				if err != nil {
+					return
+				}
+				defer release()
+				_, span := startSpan(ctx, "entrenar_arbol")
+				span.SetAttr("paralelos", parallel)
+				defer span.End()
+				sendProbed(treeProbe, treeChannel, indexedTree{i, rf.buildTree(rf.treeRand(base + i))})
+			})
+		}
 		close(treeChannel) // Cerrar el canal
 	}()
 
-	for tree := range treeChannel {
-		rf.mu.Lock()                      // Bloquear el acceso al slice de árboles
-		rf.Trees = append(rf.Trees, tree) // Agregar el árbol entrenado al slice
-		rf.mu.Unlock()                    // Desbloquear el acceso
+	// Recolectar los árboles entrenados
+	trees := make([]*DecisionTree, n)
+	added := 0
+	for {
+		result, ok := recvProbed(treeProbe, treeChannel)
+		if !ok {
+			break
+		}
+		trees[result.index] = result.tree
+		rf.mu.Lock()                     // Bloquear el acceso a los votos OOB
+		for j, idx := range result.oob { // Acumular los votos OOB de cada fila
+			rf.oobCount[idx]++
+			if result.votes[j] {
+				rf.oobVotes[idx]++
+			}
+		}
+		rf.mu.Unlock() // Desbloquear el acceso
+		added++
+		if rf.progress != nil {
+			rf.progress(base + added) // Informar el avance fuera del lock
+		}
+	}
+	rf.mu.Lock()
+	for _, tree := range trees {
+		if tree != nil { // Los que no se construyeron por la cancelación quedan vacíos
+			rf.Trees = append(rf.Trees, tree)
+		}
 	}
+	rf.mu.Unlock()
+	return added
+}
+
+// Árbol entrenado junto con su posición en el lote
+type indexedTree struct {
+	index int
+	treeResult
 }
 
-// Función que toma una muestra aleatoria de los datos
-func sampleData(data []Atencion) []Atencion {
+// Árbol a medio construir que pasa entre las etapas del pipeline
+type treeStage struct {
+	index   int
+	rng     *rand.Rand
+	subData []Atencion
+	result  treeResult
+}
+
+// Función que construye n árboles en tres etapas unidas por canales: una
+// goroutine toma las muestras, parallel workers (como en pool) construyen los
+// árboles y otra goroutine predice las filas OOB y envía el resultado a out
+func (rf *RandomForest) buildTreesPipeline(ctx context.Context, base, n, parallel int, out chan<- indexedTree, outProbe *channelProbe) {
+	samples := make(chan treeStage, 1)
+	built := make(chan treeStage, 1)
+	workers := poolWorkers(parallel)
+	samplesProbe := rf.monitor.channel("muestreo", "construcción", cap(samples), 1, workers)
+	builtProbe := rf.monitor.channel("construcción", "predicción OOB", cap(built), workers, 1)
+	go func() {
+		defer close(samples)
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			rng := rf.treeRand(base + i)
+			subData, oob := rf.sample(rng)
+			sendProbed(samplesProbe, samples, treeStage{index: i, rng: rng, subData: subData, result: treeResult{oob: oob}})
+		}
+	}()
+	go func() {
+		defer close(built)
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					s, ok := recvProbed(samplesProbe, samples)
+					if !ok {
+						break
+					}
+					if ctx.Err() != nil {
+						continue // Se descarta, pero se sigue vaciando el canal
+					}
+					release, err := acquireWork(ctx)
+					if err != nil {
+						continue
+					}
+					_, span := startSpan(ctx, "entrenar_arbol")
+					span.SetAttr("paralelos", parallel)
+					s.result.tree = rf.trainTree(s.rng, s.subData)
+					span.End()
+					release()
+					s.subData = nil // La muestra ya no hace falta
+					sendProbed(builtProbe, built, s)
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+	for {
+		s, ok := recvProbed(builtProbe, built)
+		if !ok {
+			break
+		}
+		s.result.votes = rf.oobVotesOf(s.result.tree, s.result.oob)
+		sendProbed(outProbe, out, indexedTree{s.index, s.result})
+	}
+}
+
+// Función que entrena un árbol con una muestra de los datos y predice las
+// filas que quedaron fuera de ella, con el generador aleatorio rng
+func (rf *RandomForest) buildTree(rng *rand.Rand) treeResult {
+	subData, oob := rf.sample(rng) // Obtener una muestra de datos y las filas OOB
+	tree := rf.trainTree(rng, subData)
+	return treeResult{tree: tree, oob: oob, votes: rf.oobVotesOf(tree, oob)}
+}
+
+// Función que entrena un árbol con la configuración del pipeline del bosque
+func (rf *RandomForest) trainTree(rng *rand.Rand, subData []Atencion) *DecisionTree {
+	tree := NewDecisionTree()            // Crear un nuevo árbol
+	tree.Features = rf.Pipeline.Features // Limitar las divisiones a las características elegidas
+	tree.CongestionThreshold = rf.Pipeline.CongestionThreshold
+	tree.limit = rf.Pipeline.limitFunc()
+	tree.years = rf.Pipeline.Years
+	tree.ranges = rf.Pipeline.Ranges
+	tree.rng = rng
+	tree.Train(subData) // Entrenar el árbol con los datos muestreados
+	tree.rng = nil      // El generador no se comparte con quien use el árbol después
+	return tree
+}
+
+// Función que predice las filas que el árbol no vio durante el entrenamiento
+func (rf *RandomForest) oobVotesOf(tree *DecisionTree, oob []int) []bool {
+	votes := make([]bool, len(oob))
+	for j, idx := range oob {
+		votes[j] = tree.Predict(rf.data[idx])
+	}
+	return votes
+}
+
+// Función que calcula el error OOB registrándolo como la etapa de evaluación
+func (rf *RandomForest) evaluateOOB(ctx context.Context) float64 {
+	_, span := startSpan(ctx, "evaluar_oob")
+	defer span.End()
+	oobErr := rf.oobError()
+	span.SetAttr("error_oob", oobErr)
+	return oobErr
+}
+
+// Función que calcula el error out-of-bag con los votos acumulados. Los
+// empates se resuelven con la política del pipeline y las filas sin decisión
+// no se cuentan.
+func (rf *RandomForest) oobError() float64 {
+	wrong, evaluated := 0, 0
+	ties := rf.Pipeline.tiePolicy()
+	for i, count := range rf.oobCount {
+		if count == 0 {
+			continue // La fila participó en el entrenamiento de todos los árboles
+		}
+		decision := decideVote(int(rf.oobVotes[i]), int(count), ties) // Voto mayoritario de los árboles OOB
+		if decision.Abstained {
+			continue
+		}
+		if decision.Congested != rf.Pipeline.Congested(rf.data[i]) {
+			wrong++
+		}
+		evaluated++
+	}
+	if evaluated == 0 {
+		return -1
+	}
+	return float64(wrong) / float64(evaluated)
+}
+
+// Función que toma la muestra de un árbol: ponderada por recencia si el bosque
+// tiene pesos, uniforme si no
+func (rf *RandomForest) sample(rng *rand.Rand) ([]Atencion, []int) {
+	if rf.weights != nil {
+		return sampleWeighted(rf.data, rf.weights, rng)
+	}
+	return sampleData(rf.data, rng)
+}
+
+// Función que toma una muestra aleatoria de los datos sin modificar el slice original.
+// Retorna la muestra (80% de los datos) y los índices de las filas que quedaron fuera (OOB).
+func sampleData(data []Atencion, rng *rand.Rand) ([]Atencion, []int) {
 	trainSize := int(float64(len(data)) * 0.8) // Calcular el tamaño de la muestra (80% de los datos)
-	rand.Shuffle(len(data), func(i, j int) {   // Mezclar los datos
-		data[i], data[j] = data[j], data[i]
-	})
-	return data[:trainSize] // Retornar la muestra
+	perm := rng.Perm(len(data))                // Permutación aleatoria de los índices
+	subData := make([]Atencion, trainSize)
+	for i, idx := range perm[:trainSize] {
+		subData[i] = data[idx]
+	}
+	return subData, perm[trainSize:] // Retornar la muestra y los índices OOB
+}
+
+// Función que cuenta los votos a favor de congestión de todos los árboles
+func (rf *RandomForest) Vote(att Atencion) (votes, total int) {
+	for _, tree := range rf.Trees {
+		if tree.Predict(att) {
+			votes++ // Incrementar el conteo de votos si se predice congestión
+		}
+	}
+	return votes, len(rf.Trees)
 }
 
 // Predicción del bosque aleatorio
@@ -215,32 +676,102 @@ func (rf *RandomForest) Predict(establishment string, month int, day int) bool {
 		return false
 	}
 
-	votes := 0 // Contador de votos a favor de congestión
-	for _, tree := range rf.Trees {
-		// Crear una nueva instancia de Atencion para la predicción
-		testAtencion := Atencion{
-			Mes:                   month,
-			Dia:                   day,
-			NombreEstablecimiento: establishment,
-		}
+	// Crear una nueva instancia de Atencion para la predicción, transformada
+	// con el mismo pipeline que se usó al entrenar
+	testAtencion := queryAtencion(rf.Pipeline, establishment, month, day)
+	votes, total := rf.Vote(testAtencion)
 
-		// Hacer la predicción con el árbol actual
-		if tree.Predict(testAtencion) {
-			votes++ // Incrementar el conteo de votos si se predice congestión
+	// Retornar true si la mayoría de los árboles predicen congestión; un
+	// empate se resuelve con la política del pipeline (ver empates.go)
+	return decideVote(votes, total, rf.Pipeline.tiePolicy()).Congested
+}
+
+// Número de árboles para el bosque aleatorio
+var numTrees int // Se definirá según la entrada del usuario
+
+// Entrada estándar con buffer, compartida por todas las lecturas del menú
+var stdin = bufio.NewReader(os.Stdin)
+
+// Función que lee la siguiente línea no vacía de la entrada estándar
+func readLine() string {
+	for {
+		line, err := stdin.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" || err != nil {
+			return line
 		}
 	}
+}
 
-	// Retornar true si la mayoría de los árboles predicen congestión
-	return votes > len(rf.Trees)/2
+// Función principal: sin argumentos se muestra el menú interactivo,
+// con argumentos se ejecuta el subcomando indicado (por ejemplo "serve")
+func main() {
+	if embeddedMain != nil {
+		embeddedMain() // Build sin línea de comandos, como el de WASM
+		return
+	}
+	startLeakCheck() // Solo con TP_DEBUG_GOROUTINES
+	initTracing()
+	code := exitOK
+	args, err := parseGlobalFlags(os.Args[1:]) // -perfil y -cpuprofile van antes del subcomando
+	if err == nil {
+		err = openAuditFromEnv()
+	}
+	if err == nil {
+		err = startProfiling()
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		code = exitUsage
+	case len(args) > 0 && strings.HasPrefix(args[0], "-"):
+		code = runCommand("menu", args) // Opciones del menú, como -script
+	case len(args) > 0:
+		code = runCommand(args[0], args[1:])
+	default:
+		runMenu(nil, defaultDataPath)
+	}
+	if err := stopProfiling(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error al guardar los perfiles:", err)
+	}
+	shutdownTracing() // Enviar las trazas pendientes antes de salir
+	auditLog.Close()
+	if reportLeakedGoroutines() > 0 && code == exitOK {
+		code = exitLeak // Goroutines que no terminaron: falla la verificación de apagado
+	}
+	os.Exit(code)
 }
 
-// Número de árboles para el bosque aleatorio
-var numTrees int          // Se definirá según la entrada del usuario
-var atenciones []Atencion // Lista global de atenciones procesadas
+// Acción que realiza cada opción del menú, para verificar el perfil
+var menuActions = map[int]Action{
+	1:  ActionLoadData,
+	2:  ActionTrain,
+	3:  ActionPredict,
+	4:  ActionTrain,
+	5:  ActionPublish,
+	6:  ActionPredict, // Cargar un modelo guardado para predecir con él
+	7:  ActionPublish,
+	8:  ActionLoadData,
+	11: ActionLoadData, // Cambiar el conjunto activo
+	12: ActionLoadData,
+}
 
-// Función principal
-func main() {
-	rf := &RandomForest{} // Crear una nueva instancia del bosque aleatorio
+// Opción del menú para salir: siempre la última de la lista y siempre 0, para
+// que las opciones nuevas se agreguen antes con el número siguiente sin cambiar
+// el de las demás. menuExitAlias es el número que tenía antes y se sigue
+// aceptando, así que no se usa para otra opción.
+const (
+	menuExit      = 0
+	menuExitAlias = 9
+)
+
+// Menú interactivo. Si recorder no es nil, las acciones exitosas se graban
+// como guion.
+func runMenu(recorder *scriptRecorder, dataPath string) {
+	m := &menu{rf: &RandomForest{}, recorder: recorder, dataPath: dataPath} // Crear una nueva instancia del bosque aleatorio
+
+	// Ofrecer retomar los registros, el modelo y la última consulta de la sesión anterior
+	m.resumeSession()
 
 	for {
 		// Mostrar el menú de opciones al usuario
@@ -248,182 +779,221 @@ func main() {
 		fmt.Println("1. Procesar registros")
 		fmt.Println("2. Entrenar algoritmo")
 		fmt.Println("3. Predecir congestión en un establecimiento")
-		fmt.Println("4. Salir")
+		fmt.Println("4. Agregar árboles al modelo entrenado")
+		fmt.Println("5. Guardar modelo")
+		fmt.Println("6. Cargar modelo")
+		fmt.Println("7. Exportar modelo en formato plano (mmap)")
+		fmt.Println("8. Filtrar registros procesados")
+		fmt.Println("10. Ver el registro de auditoría")
+		fmt.Println("11. Cambiar el conjunto de registros activo")
+		fmt.Println("12. Comparar los conjuntos de registros")
+		fmt.Printf("%d. Salir\n", menuExit)
+		if m.data.active != nil && len(m.data.list) > 1 {
+			fmt.Printf("(Conjunto activo: %s)\n", m.data.active.Name)
+		}
+		if profile == RoleOperator {
+			fmt.Println("(Perfil operador: solo las opciones 1, 3, 6, 8, 11 y 12)")
+		}
 		fmt.Print("Escoge tu opción: ")
 
 		var option int
-		fmt.Scan(&option) // Leer la opción del usuario
+		if _, err := fmt.Fscan(stdin, &option); err != nil { // Leer la opción del usuario
+			if err == io.EOF {
+				fmt.Println()
+				return // Fin de la entrada
+			}
+			stdin.ReadString('\n') // Descartar la entrada que no es un número
+			option = -1            // Que no se confunda con la opción de salir
+		}
+
+		// Las opciones que entrenan o publican modelos son solo para analistas
+		if action, ok := menuActions[option]; ok && !profile.Can(action) {
+			fmt.Printf("Opción no disponible para el perfil %s.\n", profile)
+			continue
+		}
 
-		// Evaluar la opción seleccionada
+		// Evaluar la opción seleccionada: cada una pide sus datos y ejecuta la acción
+		var err error
 		switch option {
 		case 1:
-			// Procesar registros solo si no se han procesado previamente
-			if len(atenciones) == 0 {
-				fmt.Println("Procesando registros...")
-				start := time.Now() // Iniciar el temporizador para medir el tiempo de procesamiento
-
-				// Abrir el archivo CSV que contiene los registros
-				file, err := os.Open("atenciones_filtradas.csv")
-				if err != nil {
-					log.Fatal(err) // Manejar error si no se puede abrir el archivo
-				}
-				defer file.Close() // Asegurarse de cerrar el archivo al final
-
-				reader := csv.NewReader(file) // Crear un lector CSV
-				reader.Comma = ','            // Establecer el separador de columnas
-
-				// Leer y verificar la cabecera del CSV
-				if _, err := reader.Read(); err != nil {
-					log.Fatalf("Error al leer la cabecera: %v", err)
-				}
-
-				var wg sync.WaitGroup                   // Grupo de espera para sincronizar goroutines
-				dataChannel := make(chan Atencion, 100) // Canal para enviar datos de atención procesados
-
-				// Goroutine para leer registros del CSV y procesarlos
-				go func() {
-					for {
-						record, err := reader.Read() // Leer cada registro del archivo
-						if err != nil {
-							break // Salir si no hay más registros
-						}
-
-						// Verificar que el registro tiene al menos 5 columnas
-						if len(record) < 5 {
-							fmt.Println("Fila inválida: ", record) // Mostrar mensaje de error para fila inválida
-							continue                               // Saltar a la siguiente iteración
-						}
-
-						wg.Add(1) // Aumentar el contador de goroutines
-						go func(record []string) {
-							defer wg.Done() // Decrementar el contador al finalizar
-
-							// Convertir los valores del registro a tipos adecuados
-							mes, err := strconv.Atoi(record[0])
-							if err != nil {
-								log.Printf("Error al convertir mes: %v", err)
-								return
-							}
-							dia, err := strconv.Atoi(record[1])
-							if err != nil {
-								log.Printf("Error al convertir dia: %v", err)
-								return
-							}
-							atendidos, err := strconv.Atoi(record[3])
-							if err != nil {
-								log.Printf("Error al número de atendidos: %v", err)
-								return
-							}
-							atencionesCount, err := strconv.Atoi(record[4])
-							if err != nil {
-								log.Printf("Error al número de atenciones: %v", err)
-								return
-							}
-
-							// Crear un nuevo objeto Atencion con los datos procesados
-							data := Atencion{
-								Mes:                   mes,
-								Dia:                   dia,
-								NombreEstablecimiento: record[2],
-								Atendidos:             atendidos,
-								Atenciones:            atencionesCount,
-							}
-							dataChannel <- data // Enviar el objeto Atencion al canal
-						}(record)
-					}
-					wg.Wait()          // Esperar a que todas las goroutines terminen
-					close(dataChannel) // Cerrar el canal
-				}()
-
-				// Recibir los datos del canal y agregarlos al slice atenciones
-				for data := range dataChannel {
-					atenciones = append(atenciones, data) // Agregar datos procesados al slice
-				}
-
-				// Mostrar información sobre el procesamiento
-				fmt.Printf("Registros procesados: %d\n", len(atenciones))
-				duration := time.Since(start) // Calcular el tiempo de procesamiento
-				fmt.Printf("Tiempo de procesamiento: %v\n", duration)
-			} else {
-				// Mensaje si los registros ya fueron procesados
-				fmt.Println("Los registros ya han sido procesados.")
+			// El archivo puede ser local o una URL de datos abiertos, que se descarga al caché
+			fmt.Printf("Archivo o URL de los registros ('.' para %s): ", m.dataPath)
+			var path string
+			fmt.Fscan(stdin, &path)
+			if path == "." {
+				path = m.dataPath
+			}
+			// Cada archivo procesado es un conjunto con nombre, que pasa a ser el activo
+			fmt.Printf("Nombre del conjunto ('.' para %s): ", datasetName(path))
+			var name string
+			fmt.Fscan(stdin, &name)
+			if name == "." {
+				name = ""
 			}
+			err = m.loadRecords(path, name)
 
 		case 2:
 			// Entrenar el algoritmo solo si se han procesado los registros
-			if len(atenciones) == 0 {
-				fmt.Println("Primero debes procesar los registros.") // Mensaje de advertencia
-			} else {
-				// Solicitar al usuario el número de árboles para entrenar el algoritmo
-				fmt.Print("Ingresa el número de árboles para entrenar el algoritmo: ")
-				fmt.Scan(&numTrees)
-
-				start := time.Now()           // Iniciar el temporizador para el entrenamiento
-				rf.Train(atenciones)          // Entrenar el bosque aleatorio con los registros procesados
-				duration := time.Since(start) // Calcular el tiempo de entrenamiento
-				fmt.Printf("Algoritmo entrenado con %d árboles en %v\n", numTrees, duration)
+			if m.data.active == nil {
+				err = errNoRecords
+				break
 			}
-		case 3:
-			if len(rf.Trees) == 0 {
-				fmt.Println("Primero debes entrenar el algoritmo.")
-			} else {
-				// Mapa para almacenar los establecimientos únicos y un slice para mantener el orden
-				uniqueEstablishments := make(map[string]struct{})
-				var establishmentsList []string // Slice para mantener la lista de establecimientos en orden
-
-				// Recorremos las atenciones y llenamos el mapa y el slice
-				for _, att := range atenciones {
-					// Verificamos si el establecimiento ya está en el mapa
-					if _, exists := uniqueEstablishments[att.NombreEstablecimiento]; !exists {
-						uniqueEstablishments[att.NombreEstablecimiento] = struct{}{}               // Marcamos el establecimiento como existente
-						establishmentsList = append(establishmentsList, att.NombreEstablecimiento) // Agregamos al slice
-					}
-				}
+			// Solicitar al usuario el número de árboles para entrenar el algoritmo
+			fmt.Print("Ingresa el número de árboles para entrenar el algoritmo: ")
+			var trees int
+			fmt.Fscan(stdin, &trees)
+
+			// Preguntar si se desea detener el entrenamiento cuando el error OOB deje de mejorar
+			fmt.Print("¿Activar parada temprana por error OOB? (s/n): ")
+			var answer string
+			fmt.Fscan(stdin, &answer)
+
+			// Elegir las características sobre las que pueden dividir los árboles
+			fmt.Printf("Características a usar, separadas por comas (%s; también Grupo; 'todas' incluye %s): ",
+				strings.Join(defaultFeatures, ","), strings.Join(trainOnlyFeatures(availableFeatures), ","))
+			features, parseErr := ParseFeatures(readLine())
+			if parseErr != nil {
+				err = parseErr
+				break
+			}
+			err = m.train(trees, answer == "s" || answer == "S", features)
 
-				// Imprimimos la lista de establecimientos disponibles
-				fmt.Println("Establecimientos disponibles:")
-				for i, establishment := range establishmentsList {
-					fmt.Printf("%d. %s\n", i+1, establishment) // Mostramos el índice y el nombre del establecimiento
+		case 3:
+			if len(m.rf.Trees) == 0 {
+				err = errNoModel
+				break
+			}
+			// Establecimientos en el orden en que aparecen en los registros, tomados del índice
+			establishmentsList := m.data.active.Index.Establishments()
+
+			// Imprimimos la lista de establecimientos disponibles
+			fmt.Println("Establecimientos disponibles:")
+			last := 0 // Posición del último establecimiento consultado, si sigue en la lista
+			for i, establishment := range establishmentsList {
+				fmt.Printf("%d. %s\n", i+1, establishment) // Mostramos el índice y el nombre del establecimiento
+				if establishment == m.session.Establishment {
+					last = i + 1
 				}
+			}
+			if last > 0 {
+				fmt.Printf("0. Último consultado: %s\n", m.session.Establishment)
+			}
 
-				// Pedimos al usuario que seleccione un establecimiento
-				fmt.Print("Selecciona el número del establecimiento: ")
-				var index int
-				fmt.Scan(&index) // Leemos la opción del usuario
+			// Pedimos al usuario que seleccione un establecimiento
+			fmt.Print("Selecciona el número del establecimiento: ")
+			var index int
+			fmt.Fscan(stdin, &index) // Leemos la opción del usuario
+			if index == 0 {
+				index = last
+			}
 
-				// Validamos si el índice está en el rango de la lista
-				if index < 1 || index > len(establishmentsList) {
-					fmt.Println("Número inválido.") // Mensaje de error si el número no es válido
-					break
-				}
+			// Validamos si el índice está en el rango de la lista
+			if index < 1 || index > len(establishmentsList) {
+				fmt.Println("Número inválido.") // Mensaje de error si el número no es válido
+				break
+			}
 
-				// Seleccionamos el establecimiento de acuerdo al índice ingresado
-				selectedEstablishment := establishmentsList[index-1] // Obtenemos el establecimiento por índice
-
-				// Pedimos al usuario que ingrese el mes y el día para la predicción
-				fmt.Print("Ingresa el mes (1-12): ")
-				var month int
-				fmt.Scan(&month) // Leemos el mes
-				fmt.Print("Ingresa el día (1-31): ")
-				var day int
-				fmt.Scan(&day) // Leemos el día
-
-				// Realizamos la predicción usando el bosque aleatorio
-				if rf.Predict(selectedEstablishment, month, day) {
-					// Mostramos el resultado de la predicción
-					fmt.Printf("El establecimiento %s estará congestionado.\n", selectedEstablishment)
-				} else {
-					// Mostramos el resultado de la predicción
-					fmt.Printf("El establecimiento %s no estará congestionado.\n", selectedEstablishment)
-				}
+			// Pedimos al usuario la fecha de la predicción, de la que salen el mes y el día
+			fmt.Print("Ingresa la fecha (dd/mm/aaaa): ")
+			date, dateErr := parseLocalDate(readLine())
+			if dateErr != nil {
+				err = dateErr
+				break
 			}
+			err = m.predict(establishmentsList[index-1], date)
+
 		case 4:
+			if len(m.rf.Trees) == 0 {
+				err = errNoModel
+				break
+			}
+			fmt.Print("Ingresa el número de árboles a agregar: ")
+			var n int
+			fmt.Fscan(stdin, &n)
+			err = m.addTrees(n)
+
+		case 5:
+			if len(m.rf.Trees) == 0 {
+				err = errNoModel
+				break
+			}
+			fmt.Print("Ruta del archivo (termina en .gz para comprimir): ")
+			var path string
+			fmt.Fscan(stdin, &path)
+			err = m.saveModel(path)
+
+		case 6:
+			fmt.Print("Ruta del archivo del modelo: ")
+			var path string
+			fmt.Fscan(stdin, &path)
+			err = m.loadModel(path)
+
+		case 7:
+			if len(m.rf.Trees) == 0 {
+				err = errNoModel
+				break
+			}
+			fmt.Print("Ruta del archivo plano: ")
+			var path string
+			fmt.Fscan(stdin, &path)
+			err = m.exportFlat(path)
+
+		case 8:
+			if m.data.active == nil {
+				err = errNoRecords
+				break
+			}
+			fmt.Println(`Ejemplo: mes >= 6 AND atendidos > 0 AND establecimiento ~ "HOSPITAL"`)
+			fmt.Print("Filtro: ")
+			err = m.filter(readLine())
+
+		case menuExit, menuExitAlias:
 			// Mensaje de despedida y salir del programa
 			fmt.Println("Saliendo...")
 			return
+
+		case 10:
+			if auditLog == nil {
+				err = m.showAudit("")
+				break
+			}
+			fmt.Print("Operación a mostrar ('todas', o p. ej. entrenamiento, carga_datos, promocion): ")
+			operation := readLine()
+			if operation == "todas" {
+				operation = ""
+			}
+			err = m.showAudit(operation)
+
+		case 11:
+			if m.data.active == nil {
+				err = errNoRecords
+				break
+			}
+			for i, ds := range m.data.list {
+				marker := ""
+				if ds == m.data.active {
+					marker = " (activo)"
+				}
+				fmt.Printf("%d. %s: %d registros de %s%s\n", i+1, ds.Name, len(ds.Records), ds.Path, marker)
+			}
+			fmt.Print("Selecciona el número del conjunto: ")
+			var index int
+			fmt.Fscan(stdin, &index)
+			if index < 1 || index > len(m.data.list) {
+				fmt.Println("Número inválido.")
+				break
+			}
+			err = m.useDataset(m.data.list[index-1].Name)
+
+		case 12:
+			err = m.compareDatasets(nil)
+
 		default:
 			// Mensaje de error si la opción no es válida
 			fmt.Println("Opción no válida, intenta de nuevo.")
 		}
+		if err != nil {
+			printMenuError(err)
+		}
 	}
 }
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cola de trabajos de entrenamiento del servidor. POST /train encola el pedido
+// y responde enseguida con el ID del trabajo; una sola goroutine los entrena de
+// a uno, en orden de llegada, y GET /jobs/{id} informa el estado y el avance.
+// Así la API no queda bloqueada varios minutos y dos entrenamientos no compiten
+// por la memoria.
+
+// Métricas de los trabajos de entrenamiento
+var (
+	trainJobs = NewCounterVec("tp_entrenamientos_total",
+		"Trabajos de entrenamiento terminados por estado", "estado")
+	trainJobDuration = NewHistogramVec("tp_entrenamiento_duracion_segundos",
+		"Duración de los trabajos de entrenamiento, sin contar la espera en la cola",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800})
+)
+
+// Trabajos que pueden esperar en la cola
+const maxQueuedJobs = 32
+
+// Trabajos terminados que se conservan para consultar su estado
+const maxFinishedJobs = 100
+
+// Estado de un trabajo de entrenamiento
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "en_cola"
+	JobRunning   JobStatus = "ejecutando"
+	JobCompleted JobStatus = "completado"
+	JobFailed    JobStatus = "fallido"
+	JobCanceled  JobStatus = "cancelado"
+)
+
+// Indica si el trabajo ya no va a cambiar de estado
+func (s JobStatus) finished() bool {
+	return s == JobCompleted || s == JobFailed || s == JobCanceled
+}
+
+// Pedido de entrenamiento
+type trainRequest struct {
+	Model    string `json:"modelo"`              // Nombre con el que se registra el modelo (vacío = default)
+	Data     string `json:"datos"`               // CSV de atenciones, local o remoto (vacío = el del inquilino)
+	Trees    int    `json:"arboles"`             // Árboles a entrenar
+	Filter   string `json:"filtro"`              // Expresión de filtro opcional
+	Features string `json:"caracteristicas"`     // Características separadas por comas (vacío = Mes,Dia)
+	Timeout  string `json:"plazo,omitempty"`     // Plazo del entrenamiento, p. ej. 10m (vacío = el del servidor)
+	Policy   string `json:"al_vencer,omitempty"` // fallar o parcial (vacío = la del servidor)
+}
+
+// Función que valida el pedido para el inquilino, completa los datos por
+// defecto y retorna el filtro y las características interpretados
+func (req *trainRequest) parse(tenant *Tenant, allowLeakage bool) (Filter, []string, error) {
+	if req.Trees <= 0 {
+		return nil, nil, errors.New("se espera {\"datos\": \"...\", \"arboles\": n}")
+	}
+	if limit := tenant.Quota.Trees; limit > 0 && req.Trees > limit {
+		return nil, nil, fmt.Errorf("el inquilino %s puede entrenar hasta %d árboles", tenant.Name, limit)
+	}
+	data, err := tenant.dataset(req.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Data = data
+	if err := tenant.checkModelQuota(req.Model); err != nil {
+		return nil, nil, err
+	}
+	var filter Filter
+	if req.Filter != "" {
+		var err error
+		if filter, err = ParseFilter(req.Filter); err != nil {
+			return nil, nil, err
+		}
+	}
+	features, err := ParseFeatures(req.Features)
+	if err != nil {
+		return nil, nil, err
+	}
+	if trainOnly := trainOnlyFeatures(features); len(trainOnly) > 0 && !allowLeakage {
+		return nil, nil, fmt.Errorf("%s no se conocen al predecir", strings.Join(trainOnly, ", "))
+	}
+	return filter, features, nil
+}
+
+// Trabajo de entrenamiento
+type TrainJob struct {
+	ID        string
+	Tenant    *Tenant // Inquilino dueño del trabajo y del modelo que resulte
+	Request   trainRequest
+	RequestID string // ID de la petición que lo creó, para los logs
+	User      string // Usuario y perfil que lo pidió, para la auditoría
+	Role      Role
+
+	filter   Filter
+	features []string
+	timeout  OperationTimeout // Plazo del entrenamiento y política al vencer
+	done     chan struct{}    // Se cierra cuando el trabajo termina
+
+	mu       sync.Mutex // Protege los campos siguientes
+	status   JobStatus
+	trained  int  // Árboles entrenados hasta ahora
+	records  int  // Registros usados para entrenar
+	partial  bool // Venció el plazo y se registró el modelo con los árboles ya entrenados
+	oobError float64
+	err      error
+	created  time.Time
+	started  time.Time
+	ended    time.Time
+	model    *modelInfo // Modelo registrado al completarse
+}
+
+// Estado de un trabajo tal como lo informa la API
+type jobReport struct {
+	ID        string     `json:"id"`
+	Model     string     `json:"modelo"`
+	Status    JobStatus  `json:"estado"`
+	Position  int        `json:"posicion,omitempty"` // Trabajos antes que este en la cola (1 = el siguiente)
+	Trained   int        `json:"arboles_entrenados"`
+	Requested int        `json:"arboles_pedidos"`
+	Progress  float64    `json:"progreso"` // Fracción de árboles entrenados (0-1)
+	Records   int        `json:"registros,omitempty"`
+	Partial   bool       `json:"parcial,omitempty"` // Completado con menos árboles porque venció el plazo
+	OOBError  *float64   `json:"error_oob,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Created   time.Time  `json:"creado"`
+	Started   *time.Time `json:"iniciado,omitempty"`
+	Ended     *time.Time `json:"terminado,omitempty"`
+	Seconds   float64    `json:"segundos,omitempty"` // Duración del entrenamiento, o lo que lleva si está en curso
+	Result    *modelInfo `json:"resultado,omitempty"`
+}
+
+// Función que retorna el estado actual del trabajo
+func (j *TrainJob) Report() jobReport {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	report := jobReport{
+		ID:        j.ID,
+		Model:     j.Request.Model,
+		Status:    j.status,
+		Trained:   j.trained,
+		Requested: j.Request.Trees,
+		Progress:  float64(j.trained) / float64(j.Request.Trees),
+		Records:   j.records,
+		Partial:   j.partial,
+		Created:   j.created,
+		Result:    j.model,
+	}
+	if j.status == JobCompleted && !j.partial {
+		report.Progress = 1 // La parada temprana puede terminar con menos árboles
+	}
+	if j.status == JobCompleted {
+		if j.oobError >= 0 {
+			report.OOBError = &j.oobError
+		}
+	}
+	if j.err != nil {
+		report.Error = j.err.Error()
+	}
+	if !j.started.IsZero() {
+		started := j.started
+		report.Started = &started
+		report.Seconds = time.Since(started).Seconds()
+	}
+	if !j.ended.IsZero() {
+		ended := j.ended
+		report.Ended = &ended
+		report.Seconds = ended.Sub(j.started).Seconds()
+	}
+	return report
+}
+
+// Función que retorna un contexto derivado de parent con los datos de la
+// petición que creó el trabajo, para los logs y la auditoría
+func (j *TrainJob) context(parent context.Context) context.Context {
+	ctx := withRequestID(parent, j.RequestID)
+	ctx = context.WithValue(ctx, tenantKey, j.Tenant)
+	ctx = context.WithValue(ctx, roleKey, j.Role)
+	return context.WithValue(ctx, userKey, j.User)
+}
+
+// Función que actualiza el estado del trabajo
+func (j *TrainJob) update(fn func(j *TrainJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(j)
+}
+
+// Función que retorna el resultado del trabajo (después de que termine)
+func (j *TrainJob) Result() (*modelInfo, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.model, j.err
+}
+
+// Cola de trabajos de entrenamiento con una sola goroutine que los ejecuta
+type TrainQueue struct {
+	run func(ctx context.Context, job *TrainJob) error // Entrena el trabajo y registra el modelo
+
+	mu      sync.Mutex
+	jobs    map[string]*TrainJob
+	order   []*TrainJob // Trabajos en orden de llegada
+	pending chan *TrainJob
+	closed  bool
+
+	ctx    context.Context // Se cancela al cerrar la cola
+	cancel context.CancelFunc
+	worker sync.WaitGroup
+}
+
+// Constructor de la cola; inicia la goroutine que ejecuta los trabajos con run
+func NewTrainQueue(run func(ctx context.Context, job *TrainJob) error) *TrainQueue {
+	q := &TrainQueue{run: run, jobs: make(map[string]*TrainJob), pending: make(chan *TrainJob, maxQueuedJobs)}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	q.worker.Add(1)
+	go q.work()
+	return q
+}
+
+// Función que encola un pedido ya validado, respetando la cuota de trabajos
+// del inquilino. El inquilino, el usuario y el ID de petición se toman de ctx.
+func (q *TrainQueue) Submit(ctx context.Context, req trainRequest, filter Filter, features []string, timeout OperationTimeout) (*TrainJob, error) {
+	tenant := tenantFrom(ctx)
+	job := &TrainJob{
+		ID:        newRequestID(),
+		Tenant:    tenant,
+		Request:   req,
+		RequestID: requestID(ctx),
+		User:      userFrom(ctx),
+		Role:      roleFrom(ctx),
+		filter:    filter,
+		features:  features,
+		timeout:   timeout,
+		done:      make(chan struct{}),
+		status:    JobQueued,
+		oobError:  -1,
+		created:   time.Now(),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, errors.New("el servidor se está deteniendo")
+	}
+	if limit := tenant.Quota.Jobs; limit > 0 && q.active(tenant) >= limit {
+		return nil, fmt.Errorf("el inquilino %s ya tiene %d entrenamientos pendientes", tenant.Name, limit)
+	}
+	select {
+	case q.pending <- job:
+	default:
+		return nil, fmt.Errorf("hay %d trabajos en cola, intente más tarde", maxQueuedJobs)
+	}
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job)
+	q.prune()
+	return job, nil
+}
+
+// Función que cuenta los trabajos del inquilino en cola o en ejecución
+func (q *TrainQueue) active(tenant *Tenant) int {
+	n := 0
+	for _, job := range q.order {
+		if job.Tenant == tenant && !job.Report().Status.finished() {
+			n++
+		}
+	}
+	return n
+}
+
+// Función que descarta los trabajos terminados más antiguos si sobran
+func (q *TrainQueue) prune() {
+	finished := 0
+	for _, job := range q.order {
+		if job.Report().Status.finished() {
+			finished++
+		}
+	}
+	kept := q.order[:0]
+	for _, job := range q.order {
+		if finished > maxFinishedJobs && job.Report().Status.finished() {
+			delete(q.jobs, job.ID)
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	q.order = kept
+}
+
+// Función que busca un trabajo del inquilino por ID
+func (q *TrainQueue) Get(tenant *Tenant, id string) (*TrainJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok || job.Tenant != tenant {
+		return nil, false // Los trabajos de otros inquilinos no existen para este
+	}
+	return job, true
+}
+
+// Función que retorna el estado de un trabajo, con su posición si está en cola
+func (q *TrainQueue) Report(job *TrainJob) jobReport {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	report := job.Report()
+	if report.Status == JobQueued {
+		for _, other := range q.order {
+			if other == job {
+				break
+			}
+			if other.Report().Status == JobQueued {
+				report.Position++
+			}
+		}
+		report.Position++
+	}
+	return report
+}
+
+// Función que lista el estado de los trabajos conservados del inquilino, en orden de llegada
+func (q *TrainQueue) List(tenant *Tenant) []jobReport {
+	q.mu.Lock()
+	var jobs []*TrainJob
+	for _, job := range q.order {
+		if job.Tenant == tenant {
+			jobs = append(jobs, job)
+		}
+	}
+	q.mu.Unlock()
+
+	reports := make([]jobReport, 0, len(jobs))
+	for _, job := range jobs {
+		reports = append(reports, q.Report(job))
+	}
+	return reports
+}
+
+// Goroutine que ejecuta los trabajos de a uno
+func (q *TrainQueue) work() {
+	defer q.worker.Done()
+	for job := range q.pending {
+		if q.ctx.Err() != nil {
+			q.finish(job, JobCanceled, errors.New("el servidor se detuvo antes de ejecutar el trabajo"))
+			continue
+		}
+		job.update(func(j *TrainJob) {
+			j.status = JobRunning
+			j.started = time.Now()
+		})
+		err := q.run(q.ctx, job)
+		status := JobCompleted
+		if err != nil {
+			status = JobFailed
+		}
+		q.finish(job, status, err)
+		trainJobDuration.Observe(time.Since(job.started).Seconds())
+	}
+}
+
+// Función que marca el trabajo como terminado y avisa a quien lo espera
+func (q *TrainQueue) finish(job *TrainJob, status JobStatus, err error) {
+	job.update(func(j *TrainJob) {
+		j.status = status
+		j.err = err
+		j.ended = time.Now()
+	})
+	trainJobs.Inc(string(status))
+	close(job.done)
+}
+
+// Función que deja de aceptar trabajos, cancela los pendientes y espera a que
+// termine el que está en curso
+func (q *TrainQueue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		q.cancel()
+		close(q.pending)
+	}
+	q.mu.Unlock()
+	q.worker.Wait()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Clave de los valores que se guardan en el contexto de una petición
+type ctxKey int
+
+const (
+	requestIDKey     ctxKey = iota // ID de la petición
+	traceTreesKey                  // Indica si se deben registrar los recorridos de los árboles
+	tenantKey                      // Inquilino autenticado de la petición
+	roleKey                        // Perfil (analista u operador) de la petición
+	userKey                        // Usuario de la petición, para la auditoría
+	heartbeatKey                   // Latido de la etapa vigilada del demonio
+	controlSocketKey               // La petición llegó por el socket unix de control
+)
+
+// Cabeceras HTTP usadas para propagar el ID y activar la traza de árboles
+const (
+	requestIDHeader  = "X-Request-ID"
+	traceTreesHeader = "X-Trace-Trees"
+)
+
+// Función que genera un ID de petición aleatorio
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Función que guarda el ID de petición en el contexto
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// Función que obtiene el ID de petición del contexto ("-" si no hay)
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+// Función que escribe en el log anteponiendo el ID de la petición
+func logf(ctx context.Context, format string, args ...any) {
+	log.Printf("[%s] "+format, append([]any{requestID(ctx)}, args...)...)
+}
+
+// Middleware que asigna un ID a cada petición (o reutiliza el que envía el
+// cliente), lo devuelve en la respuesta y lo deja disponible en el contexto.
+// La cabecera X-Trace-Trees solo se atiende si traceTrees está activo (serve
+// -trazar-arboles): registrar cada árbol es caro y llena el log, así que lo
+// habilita quien opera el servidor y no cualquier cliente.
+func requestIDMiddleware(next http.Handler, traceTrees bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := withRequestID(r.Context(), id)
+		if traceTrees && r.Header.Get(traceTreesHeader) != "" {
+			ctx = context.WithValue(ctx, traceTreesKey, true)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Modelo que puede describir el recorrido de cada uno de sus árboles
+type pathTracer interface {
+	TracePath(tree int, att Atencion) (prediction bool, path []string)
+}
+
+// Función que vota con el modelo y, si la petición lo pidió con la cabecera
+// X-Trace-Trees, registra el recorrido de cada árbol con el ID de la petición
+func voteTraced(ctx context.Context, model Predictor, att Atencion) (votes, total int) {
+	tracer, ok := model.(pathTracer)
+	if enabled, _ := ctx.Value(traceTreesKey).(bool); !enabled || !ok {
+		return model.Vote(att)
+	}
+
+	for i := 0; i < model.NumTrees(); i++ {
+		prediction, path := tracer.TracePath(i, att)
+		logf(ctx, "árbol %d: %s -> %v", i, strings.Join(path, " -> "), prediction)
+	}
+	return model.Vote(att)
+}
+
+// Función que describe un paso del recorrido de un árbol
+func pathStep(feature string, value, threshold int) string {
+	if value <= threshold {
+		return fmt.Sprintf("%s=%d<=%d", feature, value, threshold)
+	}
+	return fmt.Sprintf("%s=%d>%d", feature, value, threshold)
+}
+
+// Función que describe el recorrido de un árbol del bosque
+func (rf *RandomForest) TracePath(tree int, att Atencion) (bool, []string) {
+	var path []string
+	node := rf.Trees[tree].Root
+	for !node.IsLeaf {
+		accessor, ok := featureAccessor(node.Feature)
+		if !ok {
+			// Característica propia no registrada: como en DecisionTree.Predict, va a la izquierda
+			path = append(path, node.Feature+"=desconocida")
+			node = node.Left
+			continue
+		}
+		value := accessor(att)
+		path = append(path, pathStep(node.Feature, value, node.Threshold))
+		if value <= node.Threshold {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node.Prediction, path
+}
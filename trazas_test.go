@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracePathUnregisteredFeature(t *testing.T) {
+	root := &Node{Feature: "NoRegistrada", Threshold: 5,
+		Left:  &Node{IsLeaf: true, Prediction: true},
+		Right: &Node{IsLeaf: true}}
+	rf := &RandomForest{Trees: []*DecisionTree{{Root: root}}}
+	att := Atencion{Mes: 3, Dia: 10}
+	prediction, path := rf.TracePath(0, att)
+	if prediction != rf.Trees[0].Predict(att) {
+		t.Fatalf("la traza predice %v y el árbol %v", prediction, rf.Trees[0].Predict(att))
+	}
+	if len(path) != 1 || path[0] != "NoRegistrada=desconocida" {
+		t.Fatalf("recorrido %q", path)
+	}
+}
+
+func TestTraceTreesHeaderNeedsServerOption(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var traced bool
+		handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traced, _ = r.Context().Value(traceTreesKey).(bool)
+		}), enabled)
+		r := httptest.NewRequest(http.MethodGet, "/predict", nil).WithContext(context.Background())
+		r.Header.Set(traceTreesHeader, "1")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if traced != enabled {
+			t.Errorf("con -trazar-arboles=%v la traza quedó %v", enabled, traced)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sensibilidad al umbral de congestión: los mismos registros se reetiquetan
+// con varios umbrales (fijos o cuantiles de los atendidos), se entrena un
+// bosque con cada uno, varios a la vez, y se comparan sobre los mismos
+// registros reservados: cuántos registros quedan congestionados, el error OOB,
+// las métricas y qué fracción de las predicciones cambia respecto del umbral de
+// referencia. Un umbral alrededor del cual las métricas y las predicciones
+// cambian poco es más fácil de defender como definición operativa de
+// "congestión" que uno en medio de un salto. Las capacidades declaradas no se
+// usan: todos los establecimientos comparten el umbral.
+
+// Resultado del entrenamiento con un umbral
+type thresholdRun struct {
+	Threshold     int
+	Source        string  // "fijo" o "cuantil 0.9"
+	Positives     float64 // Fracción de registros de entrenamiento congestionados con el umbral
+	OOBError      float64 // -1 si no se pudo calcular
+	Holdout       confusionMatrix
+	PredictedRate float64 // Fracción de los registros reservados que el modelo predice congestionados
+	Changed       float64 // Fracción de los reservados cuya predicción difiere de la del umbral de referencia
+	Duration      time.Duration
+
+	predictions []bool
+}
+
+// Subcomando "threshold-sweep": compara modelos entrenados con distintos umbrales
+func thresholdSweepCommand(args []string) error {
+	fs := flag.NewFlagSet("threshold-sweep", flag.ContinueOnError)
+	dataPath := fs.String("datos", "atenciones_filtradas.csv", "CSV de atenciones")
+	thresholdList := fs.String("umbrales", "15,20,25,30", "umbrales fijos de atendidos separados por comas")
+	quantileList := fs.String("cuantiles", "", "cuantiles de los atendidos a usar también como umbrales, p. ej. 0.5,0.75,0.9")
+	reference := fs.Int("referencia", congestionThreshold, "umbral contra el que se comparan las predicciones (se agrega si no está)")
+	trees := fs.Int("arboles", 50, "árboles de cada modelo")
+	featureList := fs.String("caracteristicas", "", "características separadas por comas sobre las que dividir (vacío = Mes,Dia)")
+	holdoutFraction := fs.Float64("reserva", 0.2, "fracción de los registros reservada para comparar los modelos")
+	parallel := fs.Int("paralelo", 2, "modelos que se entrenan a la vez")
+	output := fs.String("o", "", "archivo CSV con la comparación (vacío = solo la tabla)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *trees <= 0 || *parallel <= 0 || *reference <= 0 {
+		return errors.New("-arboles, -paralelo y -referencia deben ser positivos")
+	}
+	if *holdoutFraction <= 0 || *holdoutFraction >= 1 {
+		return fmt.Errorf("fracción reservada inválida: %g (debe estar entre 0 y 1)", *holdoutFraction)
+	}
+	features, err := ParseFeatures(*featureList)
+	if err != nil {
+		return err
+	}
+	if trainOnly := trainOnlyFeatures(features); len(trainOnly) > 0 {
+		return fmt.Errorf("%s no se conocen al predecir", strings.Join(trainOnly, ", "))
+	}
+
+	data, err := loadAtenciones(context.Background(), *dataPath)
+	if err != nil {
+		return withExitCode(exitLoadFailure, err)
+	}
+	runs, err := sweepThresholds(data, *thresholdList, *quantileList, *reference)
+	if err != nil {
+		return err
+	}
+	train, holdout := splitHoldout(data, *holdoutFraction, 1)
+	if len(train) == 0 || len(holdout) == 0 {
+		return errors.New("no hay registros suficientes para entrenar y reservar")
+	}
+	fmt.Printf("%d umbrales, %d registros para entrenar y %d reservados\n", len(runs), len(train), len(holdout))
+
+	start := time.Now()
+	trainThresholds(runs, train, holdout, features, *trees, *parallel)
+	base := runs[slices.IndexFunc(runs, func(r thresholdRun) bool { return r.Threshold == *reference })]
+	for i := range runs {
+		changed := 0
+		for j, predicted := range runs[i].predictions {
+			if predicted != base.predictions[j] {
+				changed++
+			}
+		}
+		runs[i].Changed = ratio(changed, len(holdout))
+	}
+	fmt.Printf("Modelos entrenados en %v\n", time.Since(start).Round(time.Millisecond))
+	printThresholdRuns(os.Stdout, runs, *reference)
+
+	if *output == "" {
+		return nil
+	}
+	file, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	if err := writeThresholdCSV(file, runs); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Función que arma la lista ordenada de umbrales sin repetir: los fijos, los
+// cuantiles de los atendidos y el de referencia
+func sweepThresholds(data []Atencion, thresholdList, quantileList string, reference int) ([]thresholdRun, error) {
+	sources := make(map[int]string)
+	for _, part := range strings.Split(thresholdList, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		threshold, err := strconv.Atoi(part)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("umbral inválido: %q", part)
+		}
+		sources[threshold] = "fijo"
+	}
+	if quantileList != "" {
+		attended := make([]float64, len(data))
+		for i, att := range data {
+			attended[i] = float64(att.Atendidos)
+		}
+		slices.Sort(attended)
+		for _, part := range strings.Split(quantileList, ",") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || q <= 0 || q >= 1 {
+				return nil, fmt.Errorf("cuantil inválido: %q (debe estar entre 0 y 1)", part)
+			}
+			if len(attended) == 0 {
+				return nil, errors.New("no hay registros para calcular los cuantiles")
+			}
+			threshold := max(int(percentile(attended, q)), 1)
+			if _, ok := sources[threshold]; !ok {
+				sources[threshold] = "cuantil " + strconv.FormatFloat(q, 'g', -1, 64)
+			}
+		}
+	}
+	if _, ok := sources[reference]; !ok {
+		sources[reference] = "referencia"
+	}
+	runs := make([]thresholdRun, 0, len(sources))
+	for threshold, source := range sources {
+		runs = append(runs, thresholdRun{Threshold: threshold, Source: source})
+	}
+	slices.SortFunc(runs, func(a, b thresholdRun) int { return a.Threshold - b.Threshold })
+	return runs, nil
+}
+
+// Función que entrena un bosque por umbral, de a parallel a la vez, y lo
+// evalúa sobre los registros reservados
+func trainThresholds(runs []thresholdRun, train, holdout []Atencion, features []string, trees, parallel int) {
+	queries := make([]batchQuery, len(holdout))
+	for i, att := range holdout {
+		queries[i] = batchQuery{Establishment: att.NombreEstablecimiento, Month: att.Mes, Day: att.Dia}
+	}
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			run := &runs[i]
+			start := time.Now()
+			rf := &RandomForest{Features: features, Threshold: run.Threshold}
+			rf.TrainTrees(train, trees)
+			run.OOBError = rf.OOBError
+			positives := 0
+			for _, att := range train {
+				if rf.Pipeline.Congested(att) {
+					positives++
+				}
+			}
+			run.Positives = ratio(positives, len(train))
+
+			results := predictBatch(rf, rf.Pipeline, queries, 0)
+			run.predictions = make([]bool, len(results))
+			predicted := 0
+			for j, result := range results {
+				run.predictions[j] = result.Congested
+				run.Holdout.add(result.Congested, rf.Pipeline.Congested(holdout[j]))
+				if result.Congested {
+					predicted++
+				}
+			}
+			run.PredictedRate = ratio(predicted, len(results))
+			run.Duration = time.Since(start)
+		}()
+	}
+	wg.Wait()
+}
+
+// Función que escribe la comparación como tabla
+func printThresholdRuns(w io.Writer, runs []thresholdRun, reference int) {
+	fmt.Fprintf(w, "%7s  %-14s %10s %9s %9s %10s %9s %7s %10s %9s\n",
+		"umbral", "origen", "congestion", "error_oob", "precision", "prec_pos", "exhaust", "f1", "predichos", "cambian")
+	for _, run := range runs {
+		marker := ""
+		if run.Threshold == reference {
+			marker = " (referencia)"
+		}
+		fmt.Fprintf(w, "%7d  %-14s %10.4f %9.4f %9.4f %10.4f %9.4f %7.4f %10.4f %9.4f%s\n",
+			run.Threshold, run.Source, run.Positives, run.OOBError, run.Holdout.Accuracy(), run.Holdout.Precision(),
+			run.Holdout.Recall(), run.Holdout.F1(), run.PredictedRate, run.Changed, marker)
+	}
+}
+
+// Función que escribe la comparación en CSV, un umbral por fila
+func writeThresholdCSV(w io.Writer, runs []thresholdRun) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"umbral", "origen", "tasa_congestion", "error_oob", "precision", "precision_positivos",
+		"exhaustividad", "f1", "tasa_predicha", "predicciones_cambiadas", "segundos"})
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	for _, run := range runs {
+		cw.Write([]string{
+			strconv.Itoa(run.Threshold),
+			run.Source,
+			format(run.Positives),
+			format(run.OOBError),
+			format(run.Holdout.Accuracy()),
+			format(run.Holdout.Precision()),
+			format(run.Holdout.Recall()),
+			format(run.Holdout.F1()),
+			format(run.PredictedRate),
+			format(run.Changed),
+			format(run.Duration.Seconds()),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
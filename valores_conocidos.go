@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Valores conocidos de una consulta: Atendidos y Atenciones solo se saben
+// después del día consultado, así que al predecir se imputan con promedios o
+// con el pronóstico de volumen. Cuando se sabe algo mejor, como los atendidos
+// esperados según los turnos reservados para mañana, la consulta puede traerlo
+// (parámetros atendidos=, atenciones= y citas= de GET /predict, campos del
+// mismo nombre en POST /predict/batch o columnas del CSV de predict-batch) y
+// reemplaza al valor imputado.
+
+// Características que una consulta puede traer conocidas
+var knownFeatures = []string{"Atendidos", "Atenciones", "Citas"}
+
+// Valores conocidos de una consulta por característica (nil = todos imputados)
+type knownValues map[string]int
+
+// Función que interpreta los valores conocidos; get retorna el texto de cada
+// uno por su nombre en minúsculas ("" = desconocido)
+func parseKnownValues(get func(name string) string) (knownValues, error) {
+	var known knownValues
+	for _, feature := range knownFeatures {
+		text := strings.TrimSpace(get(strings.ToLower(feature)))
+		if text == "" {
+			continue
+		}
+		v, err := strconv.Atoi(text)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%s inválido: %q", strings.ToLower(feature), text)
+		}
+		if known == nil {
+			known = make(knownValues)
+		}
+		known[feature] = v
+	}
+	return known, nil
+}
+
+// Función que reemplaza los valores imputados de una consulta ya transformada
+// por los conocidos. Si se conocen los atendidos pero no las atenciones, estas
+// se escalan con la proporción imputada, como hace el pronóstico de volumen.
+func (k knownValues) apply(att Atencion) Atencion {
+	attended, hasAttended := k["Atendidos"]
+	attentions, hasAttentions := k["Atenciones"]
+	if hasAttended && !hasAttentions && att.Atendidos > 0 {
+		att.Atenciones = int(math.Round(float64(attended) * float64(att.Atenciones) / float64(att.Atendidos)))
+	}
+	if hasAttended {
+		att.Atendidos = attended
+	}
+	if hasAttentions {
+		att.Atenciones = attentions
+	}
+	if bookings, ok := k["Citas"]; ok {
+		att.Citas = bookings
+	}
+	return att
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Verificación de los archivos de entrada contra un manifiesto: la suma SHA-256
+// del archivo completo y la versión de esquema de su cabecera. Así una descarga
+// truncada o un CSV con otras columnas se rechaza en vez de entrenar con él.
+
+// Verificación esperada de un archivo de entrada
+type InputCheck struct {
+	File   string `json:"archivo"` // Nombre del archivo (sin directorio)
+	SHA256 string `json:"sha256"`  // Suma en hexadecimal (vacío = no se verifica)
+	Schema int    `json:"esquema"` // Versión de esquema de la cabecera (0 = no se verifica)
+}
+
+// Manifiesto con las verificaciones de varios archivos
+type Manifest struct {
+	Files []InputCheck `json:"archivos"`
+}
+
+// Función que lee un manifiesto JSON (local o remoto)
+func LoadManifest(path string) (*Manifest, error) {
+	file, err := openInput(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var m Manifest
+	if err := json.NewDecoder(file).Decode(&m); err != nil {
+		return nil, fmt.Errorf("manifiesto %s inválido: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Función que busca la verificación de un archivo por su nombre. Los archivos
+// que el manifiesto no menciona se rechazan.
+func (m *Manifest) Check(dataPath string) (InputCheck, error) {
+	name := path.Base(strings.SplitN(dataPath, "?", 2)[0])
+	for _, check := range m.Files {
+		if check.File == name {
+			return check, nil
+		}
+	}
+	return InputCheck{}, fmt.Errorf("el manifiesto no incluye %s", name)
+}
+
+// Función que obtiene la verificación de un archivo según el manifiesto
+// indicado por el usuario (vacío = sin verificación)
+func manifestCheck(manifestPath, dataPath string) (InputCheck, error) {
+	if manifestPath == "" {
+		return InputCheck{}, nil
+	}
+	m, err := LoadManifest(manifestPath)
+	if err != nil {
+		return InputCheck{}, err
+	}
+	return m.Check(dataPath)
+}
+
+// Función que normaliza una cabecera para compararla: sin BOM, espacios ni mayúsculas distintas
+func normalizeHeader(header []string) []string {
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	}
+	return columns
+}
+
+// Función que verifica que la cabecera corresponda a la versión de esquema esperada
+func (c InputCheck) verifyHeader(header []string) error {
+	if c.Schema == 0 {
+		return nil
+	}
+	schema, ok := inputSchemas[c.Schema]
+	if !ok {
+		return fmt.Errorf("versión de esquema desconocida: %d", c.Schema)
+	}
+	if got := schemaVersion(header); got != c.Schema {
+		return fmt.Errorf("la cabecera %q no corresponde al esquema v%d (%s)", strings.Join(header, ","), c.Schema, strings.Join(schema.Columns, ","))
+	}
+	return nil
+}
+
+// Función que envuelve el lector para calcular la suma mientras se lee. Retorna
+// nil como hash si no hay suma que verificar ni se pidió calcularla (always).
+func (c InputCheck) hashReader(r io.Reader, always bool) (io.Reader, hash.Hash) {
+	if c.SHA256 == "" && !always {
+		return r, nil
+	}
+	h := sha256.New()
+	return io.TeeReader(r, h), h
+}
+
+// Función que termina de leer el archivo y compara la suma calculada con la esperada
+func (c InputCheck) verifySum(r io.Reader, h hash.Hash) error {
+	if h == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); c.SHA256 != "" && !strings.EqualFold(got, c.SHA256) {
+		return fmt.Errorf("la suma SHA-256 del archivo (%s) no coincide con la del manifiesto (%s); puede estar truncado", got, c.SHA256)
+	}
+	return nil
+}
+
+// Subcomando "manifest": calcula la suma y el esquema de uno o más archivos y
+// escribe el manifiesto que luego se pasa con -manifiesto
+func manifestCommand(args []string) error {
+	fs := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	output := fs.String("o", "manifiesto.json", "archivo donde guardar el manifiesto")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("indica al menos un archivo CSV")
+	}
+
+	var m Manifest
+	for _, dataPath := range files {
+		check, err := describeInput(dataPath)
+		if err != nil {
+			return err
+		}
+		if check.Schema == 0 {
+			fmt.Fprintf(os.Stderr, "Advertencia: la cabecera de %s no corresponde a ningún esquema conocido\n", dataPath)
+		}
+		m.Files = append(m.Files, check)
+		fmt.Printf("%s  %s (esquema v%d)\n", check.SHA256, check.File, check.Schema)
+	}
+
+	out, err := createOutput(context.Background(), *output)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Close()
+}
+
+// Función que calcula la suma SHA-256 de un archivo local
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Función que calcula la suma y la versión de esquema de un archivo
+func describeInput(dataPath string) (InputCheck, error) {
+	file, err := openInput(context.Background(), dataPath)
+	if err != nil {
+		return InputCheck{}, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	plain, err := decompressIfNeeded(bufio.NewReader(io.TeeReader(file, h))) // La suma es la del archivo comprimido
+	if err != nil {
+		return InputCheck{}, fmt.Errorf("error al leer la cabecera de %s: %w", dataPath, err)
+	}
+	reader := csv.NewReader(plain)
+	header, err := reader.Read()
+	if err != nil {
+		return InputCheck{}, fmt.Errorf("error al leer la cabecera de %s: %w", dataPath, err)
+	}
+	// El lector CSV ya pasó por el TeeReader lo que tiene en su buffer; el resto va directo
+	if _, err := io.Copy(h, file); err != nil {
+		return InputCheck{}, err
+	}
+	return InputCheck{
+		File:   path.Base(strings.SplitN(dataPath, "?", 2)[0]),
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Schema: schemaVersion(header),
+	}, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Vigilancia del demonio: cada ejecución se divide en etapas (abrir el modelo,
+// cargar el histórico, armar el reporte, entregarlo) y cada etapa avisa que
+// avanza con un latido que viaja en el contexto (la carga late con cada bloque
+// de filas, la entrega con cada intento). Una goroutine revisa los latidos y, si
+// una etapa pasa el tiempo indicado sin avanzar, escribe en el log la pila de
+// todas las goroutines y la cancela: se reinicia hasta -reinicios veces y, si se
+// agotan, la ejecución falla y el demonio sigue con la próxima en lugar de
+// quedar colgado. Con -latido además escribe en un archivo, en cada revisión, la
+// etapa en curso y su último avance, para que un monitor externo vea que el
+// demonio sigue vivo.
+
+// Error con el que la vigilancia cancela una etapa sin avance
+var errStageStalled = errors.New("etapa sin avance")
+
+// Tiempo que se espera a que una etapa cancelada termine antes de abandonarla
+const stageCancelGrace = 10 * time.Second
+
+// Vigilancia de las etapas del demonio
+type Watchdog struct {
+	Stall     time.Duration // Tiempo sin avance tras el que una etapa se considera trabada
+	Restarts  int           // Reinicios de una etapa trabada antes de darla por fallida
+	Heartbeat string        // Archivo de latido (vacío = ninguno)
+
+	mu     sync.Mutex
+	stage  *watchedStage // Etapa en curso (nil = esperando la próxima ejecución)
+	stalls int           // Etapas trabadas desde el inicio
+}
+
+// Etapa vigilada en curso
+type watchedStage struct {
+	name     string
+	attempt  int
+	started  time.Time
+	progress atomic.Int64 // Momento del último latido (UnixNano)
+	cancel   context.CancelCauseFunc
+	stalled  bool // Ya se diagnosticó y canceló (protegido por Watchdog.mu)
+}
+
+// Función que registra un avance de la etapa
+func (s *watchedStage) beat() {
+	s.progress.Store(time.Now().UnixNano())
+}
+
+// Función que retorna el momento del último avance
+func (s *watchedStage) lastProgress() time.Time {
+	return time.Unix(0, s.progress.Load())
+}
+
+// Función que guarda en el contexto el latido de la etapa
+func withHeartbeat(ctx context.Context, beat func()) context.Context {
+	return context.WithValue(ctx, heartbeatKey, beat)
+}
+
+// Función que retorna el latido del contexto, o una función vacía si la etapa
+// no está vigilada
+func heartbeatFrom(ctx context.Context) func() {
+	if beat, ok := ctx.Value(heartbeatKey).(func()); ok {
+		return beat
+	}
+	return func() {}
+}
+
+// Función que revisa los latidos periódicamente hasta que se cancela ctx
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(max(w.Stall/4, time.Second), 30*time.Second))
+	defer ticker.Stop()
+	for {
+		w.check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Función que diagnostica y cancela la etapa en curso si no avanza, y escribe el latido
+func (w *Watchdog) check(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if st := w.stage; st != nil && !st.stalled && now.Sub(st.lastProgress()) > w.Stall {
+		st.stalled = true
+		w.stalls++
+		log.Printf("Vigilancia: la etapa %s no avanza desde hace %v (intento %d); pilas de las goroutines:",
+			st.name, now.Sub(st.lastProgress()).Round(time.Second), st.attempt+1)
+		pprof.Lookup("goroutine").WriteTo(log.Writer(), 2)
+		st.cancel(errStageStalled)
+	}
+	if w.Heartbeat != "" {
+		if err := w.writeHeartbeat(now); err != nil {
+			log.Printf("Vigilancia: no se pudo escribir el latido en %s: %v", w.Heartbeat, err)
+		}
+	}
+}
+
+// Contenido del archivo de latido
+type heartbeatFile struct {
+	Time         time.Time  `json:"hora"`
+	Stage        string     `json:"etapa"`
+	Attempt      int        `json:"intento,omitempty"`
+	StageStarted *time.Time `json:"etapa_iniciada,omitempty"`
+	LastProgress *time.Time `json:"ultimo_avance,omitempty"`
+	Stalls       int        `json:"etapas_trabadas"`
+}
+
+// Función que reemplaza el archivo de latido con el estado actual. Se llama con w.mu tomado.
+func (w *Watchdog) writeHeartbeat(now time.Time) error {
+	beat := heartbeatFile{Time: now, Stage: "esperando", Stalls: w.stalls}
+	if st := w.stage; st != nil {
+		last := st.lastProgress()
+		beat.Stage, beat.Attempt, beat.StageStarted, beat.LastProgress = st.name, st.attempt+1, &st.started, &last
+	}
+	data, err := json.MarshalIndent(beat, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(w.Heartbeat+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(w.Heartbeat+".tmp", w.Heartbeat)
+}
+
+// Función que marca la etapa en curso (nil al terminar)
+func (w *Watchdog) setStage(st *watchedStage) {
+	w.mu.Lock()
+	w.stage = st
+	w.mu.Unlock()
+}
+
+// Resultado de un intento de una etapa
+type stageResult[T any] struct {
+	value T
+	err   error
+}
+
+// Función que ejecuta una etapa vigilada. Si la vigilancia la cancela por falta
+// de avance, se reinicia hasta w.Restarts veces. Un intento que no responde a
+// la cancelación se abandona: su resultado, si llega, se descarta. Con w nil
+// la etapa se ejecuta sin vigilancia.
+func watchStage[T any](ctx context.Context, w *Watchdog, name string, fn func(ctx context.Context) (T, error)) (T, error) {
+	if w == nil {
+		return fn(ctx)
+	}
+	for attempt := 0; ; attempt++ {
+		stageCtx, cancel := context.WithCancelCause(ctx)
+		st := &watchedStage{name: name, attempt: attempt, started: time.Now(), cancel: cancel}
+		st.beat()
+		w.setStage(st)
+
+		done := make(chan stageResult[T], 1) // Con espacio: un intento abandonado no queda bloqueado
+		go func() {
+			value, err := fn(withHeartbeat(stageCtx, st.beat))
+			done <- stageResult[T]{value, err}
+		}()
+		var result stageResult[T]
+		select {
+		case result = <-done:
+		case <-stageCtx.Done():
+			select {
+			case result = <-done:
+			case <-time.After(stageCancelGrace):
+				log.Printf("Vigilancia: la etapa %s no respondió a la cancelación; se abandona", name)
+				result.err = context.Cause(stageCtx)
+			}
+		}
+		stalled := errors.Is(context.Cause(stageCtx), errStageStalled)
+		cancel(nil)
+		w.setStage(nil)
+
+		if result.err == nil || !stalled || ctx.Err() != nil {
+			return result.value, result.err
+		}
+		if attempt >= w.Restarts {
+			var zero T
+			return zero, fmt.Errorf("etapa %s sin avance durante %v tras %d intentos: %w", name, w.Stall, attempt+1, errStageStalled)
+		}
+		log.Printf("Vigilancia: reiniciando la etapa %s (reinicio %d de %d)", name, attempt+1, w.Restarts)
+	}
+}